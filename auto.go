@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// majorVersionRegexp matches the major version suffix of a module path, e.g.
+// v2 in example.com/foo/v2.
+var majorVersionRegexp = regexp.MustCompile(`^v[0-9]+$`)
+
+// autoQuery returns the QUERY used by -auto for dst. The service is the
+// datadog.service field of cfg if set, otherwise it is derived from the import
+// path of the package in the directory of dst, see serviceFromPackage.
+func autoQuery(dst string, cfg *fileConfig, env string) (string, error) {
+	service := ""
+	if cfg != nil {
+		service = cfg.Service
+	}
+	if service == "" {
+		dir := filepath.Dir(dst)
+		if isRemoteDest(dst) {
+			dir = "."
+		}
+		var err error
+		if service, err = serviceFromPackage(dir); err != nil {
+			return "", fmt.Errorf("-auto: %w, set datadog.service in the config file", err)
+		}
+	}
+	query := "service:" + service
+	if env != "" {
+		query += " env:" + env
+	}
+	return query + " runtime:go", nil
+}
+
+// serviceFromPackage returns the last element of the import path of the
+// package in dir, skipping a major version suffix. The import path is derived
+// from the module path of the nearest go.mod file, e.g. the service of
+// ./cmd/my-service in the module example.com/foo is my-service, the service of
+// the module root of example.com/foo/v2 is foo.
+func serviceFromPackage(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for root := dir; ; root = filepath.Dir(root) {
+		modPath, err := modulePath(filepath.Join(root, "go.mod"))
+		if errors.Is(err, fs.ErrNotExist) {
+			if filepath.Dir(root) == root {
+				return "", fmt.Errorf("no go.mod found in %s or its parents", dir)
+			}
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return "", err
+		}
+		elems := strings.Split(path.Join(modPath, filepath.ToSlash(rel)), "/")
+		service := elems[len(elems)-1]
+		if len(elems) > 1 && majorVersionRegexp.MatchString(service) {
+			service = elems[len(elems)-2]
+		}
+		return service, nil
+	}
+}
+
+// modulePath returns the module path declared in the go.mod file at name.
+func modulePath(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module")
+		if !ok || line == "" || (line[0] != ' ' && line[0] != '\t' && line[0] != '"') {
+			continue
+		}
+		line, _, _ = strings.Cut(line, "//")
+		modPath := strings.TrimSpace(line)
+		if unquoted, err := strconv.Unquote(modPath); err == nil {
+			modPath = unquoted
+		}
+		if modPath != "" {
+			return modPath, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s: no module directive", name)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoQuery(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("// comment\nmodule \"example.com/shop/v2\" // shop\n\ngo 1.21\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "cmd", "billing"), 0755))
+
+	query, err := autoQuery(filepath.Join(root, "cmd", "billing", "default.pgo"), nil, "prod")
+	require.NoError(t, err)
+	require.Equal(t, "service:billing env:prod runtime:go", query)
+
+	query, err = autoQuery(filepath.Join(root, "default.pgo"), nil, "")
+	require.NoError(t, err)
+	require.Equal(t, "service:shop runtime:go", query, "the major version suffix is skipped")
+
+	query, err = autoQuery(filepath.Join(root, "default.pgo"), &fileConfig{Service: "checkout"}, "staging")
+	require.NoError(t, err)
+	require.Equal(t, "service:checkout env:staging runtime:go", query)
+
+	_, err = serviceFromPackage(filepath.Join(root, "..", "elsewhere"))
+	require.ErrorContains(t, err, "no go.mod found")
+}
+
+func TestParseDatadog(t *testing.T) {
+	service, err := parseDatadog(map[string]any{"service": "billing"})
+	require.NoError(t, err)
+	require.Equal(t, "billing", service)
+	_, err = parseDatadog(map[string]any{"service": "billing", "env": "prod"})
+	require.ErrorContains(t, err, `unknown key "env"`)
+	_, err = parseDatadog("billing")
+	require.ErrorContains(t, err, "must be an object")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runBench implements the bench subcommand. It builds a main package with and
+// without its PGO profile and reports the differences in build time and binary
+// size.
+func runBench(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(name+" bench", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: `+name+` bench [OPTIONS]... PACKAGE
+
+bench builds the main PACKAGE twice, once with its PGO profile and once without
+it, and reports the differences in build time and binary size. Both builds use
+an empty build cache to make them comparable.
+
+This only gives a quick signal that PGO is engaging. It does not measure the
+runtime performance of the resulting binaries.
+
+OPTIONS`)
+		fs.PrintDefaults()
+	}
+	pgoF := fs.String("pgo", "", "the PGO profile to use (default PACKAGE/"+defaultPGOFile+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("bench requires exactly 1 argument")
+	}
+	pkg := fs.Arg(0)
+
+	pgoFile := *pgoF
+	if pgoFile == "" {
+		dir, err := packageDir(pkg)
+		if err != nil {
+			return err
+		}
+		pgoFile = filepath.Join(dir, defaultPGOFile)
+	}
+	if _, err := os.Stat(pgoFile); err != nil {
+		return fmt.Errorf("bench: %w", err)
+	}
+
+	with, err := benchBuild(pkg, pgoFile)
+	if err != nil {
+		return err
+	}
+	without, err := benchBuild(pkg, "off")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%-12s %12s %14s\n", "", "build time", "binary size")
+	fmt.Fprintf(stdout, "%-12s %12s %14d\n", "without pgo", without.duration.Round(time.Millisecond), without.size)
+	fmt.Fprintf(stdout, "%-12s %12s %14d\n", "with pgo", with.duration.Round(time.Millisecond), with.size)
+	fmt.Fprintf(stdout, "%-12s %+11.1f%% %+13.1f%%\n", "delta",
+		percentChange(float64(without.duration), float64(with.duration)),
+		percentChange(float64(without.size), float64(with.size)),
+	)
+	if with.size == without.size {
+		fmt.Fprintln(stdout, "\nwarning: the binaries have the same size, PGO might not be engaging")
+	}
+	return nil
+}
+
+// benchResult is the result of a single benchmark build.
+type benchResult struct {
+	duration time.Duration
+	size     int64
+}
+
+// benchBuild builds pkg with the given -pgo flag value using an empty build
+// cache.
+func benchBuild(pkg, pgo string) (res benchResult, err error) {
+	defer wrapErr(&err, "build with -pgo="+pgo)
+	tmp, err := os.MkdirTemp("", name+"-bench-")
+	if err != nil {
+		return res, err
+	}
+	defer os.RemoveAll(tmp)
+
+	out := filepath.Join(tmp, "bin")
+	cmd := exec.Command("go", "build", "-pgo="+pgo, "-o", out, pkg)
+	cmd.Env = append(os.Environ(), "GOCACHE="+filepath.Join(tmp, "cache"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		return res, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	res.duration = time.Since(start)
+	info, err := os.Stat(out)
+	if err != nil {
+		return res, err
+	}
+	res.size = info.Size()
+	return res, nil
+}
+
+// packageDir returns the directory of the go package pkg.
+func packageDir(pkg string) (string, error) {
+	out, err := exec.Command("go", "list", "-f", "{{.Dir}}", pkg).Output()
+	if err != nil {
+		return "", fmt.Errorf("go list %s: %w", pkg, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// percentChange returns the change from a to b in percent.
+func percentChange(a, b float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return (b - a) / a * 100
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// buildUsage is the usage of the build subcommand.
+const buildUsage = `usage: ` + name + ` build [OPTIONS]... [QUERY]... PACKAGE [-- BUILDFLAGS]...
+
+build fetches the PGO profile for the main PACKAGE, writes it to a temporary
+file and runs go build -pgo=<file> PACKAGE with the given BUILDFLAGS, e.g.:
+
+	` + name + ` build ./cmd/my-service -- -o ./bin/my-service -ldflags=-s
+
+The temporary file is removed afterwards, so default.pgo doesn't need to be
+checked into the source tree. Without QUERY arguments, the QUERY is derived
+from the module path of PACKAGE like with -auto. The OPTIONS are the options of
+the fetch command, see '` + name + ` fetch -h'.
+
+If fetching the profile fails without -fail, PACKAGE is built with the go
+toolchain's default -pgo=auto instead.`
+
+// runBuild implements the build subcommand.
+func runBuild(args []string, stdout io.Writer) (err error) {
+	if len(args) > 0 && slices.Contains([]string{"-h", "-help", "--help"}, args[0]) {
+		fmt.Fprintln(os.Stderr, buildUsage)
+		return flag.ErrHelp
+	}
+	fetchArgs, pkg, buildFlags, err := splitBuildArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, buildUsage)
+		return err
+	}
+
+	// Derive the QUERY from PACKAGE if there are no other arguments
+	if len(fetchArgs) == 0 {
+		dir, err := packageDir(pkg)
+		if err != nil {
+			return err
+		}
+		cfg, err := loadFileConfig("")
+		if err != nil {
+			return err
+		}
+		query, err := autoQuery(filepath.Join(dir, defaultPGOFile), cfg, "prod")
+		if err != nil {
+			return err
+		}
+		fetchArgs = []string{query}
+	}
+
+	// Fetch the profile into a temporary directory
+	tmp, err := os.MkdirTemp("", name+"-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	pgoFile := filepath.Join(tmp, defaultPGOFile)
+	if err := run(append(fetchArgs, pgoFile)); err != nil && !errors.As(err, &handledError{}) {
+		return err
+	}
+
+	// Build the package, go build picks up default.pgo files in the main
+	// package if the profile couldn't be fetched
+	goArgs := []string{"build"}
+	if _, err := os.Stat(pgoFile); err == nil {
+		goArgs = append(goArgs, "-pgo="+pgoFile)
+	}
+	cmd := exec.Command("go", append(append(goArgs, buildFlags...), pkg)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build: %w", err)
+	}
+	return nil
+}
+
+// splitBuildArgs splits the arguments of the build subcommand into the
+// arguments for fetch, the PACKAGE and the flags for go build following "--".
+func splitBuildArgs(args []string) (fetchArgs []string, pkg string, buildFlags []string, err error) {
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, buildFlags = args[:i], args[i+1:]
+	}
+	if len(args) == 0 {
+		return nil, "", nil, errors.New("build requires a PACKAGE argument")
+	}
+	return args[:len(args)-1], args[len(args)-1], buildFlags, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBuildArgs(t *testing.T) {
+	fetchArgs, pkg, buildFlags, err := splitBuildArgs([]string{"./cmd/foo"})
+	require.NoError(t, err)
+	require.Empty(t, fetchArgs)
+	require.Equal(t, "./cmd/foo", pkg)
+	require.Empty(t, buildFlags)
+
+	fetchArgs, pkg, buildFlags, err = splitBuildArgs([]string{"-profiles", "10", "service:foo", "./cmd/foo", "--", "-o", "bin/foo", "-ldflags=-s"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"-profiles", "10", "service:foo"}, fetchArgs)
+	require.Equal(t, "./cmd/foo", pkg)
+	require.Equal(t, []string{"-o", "bin/foo", "-ldflags=-s"}, buildFlags)
+
+	_, _, _, err = splitBuildArgs([]string{"--", "-o", "bin/foo"})
+	require.ErrorContains(t, err, "PACKAGE")
+}
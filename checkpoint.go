@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+)
+
+// checkpointVersion is the version of the checkpoint file format. Checkpoints
+// with a different version are ignored.
+const checkpointVersion = 1
+
+// checkpointIgnoredFlags are the flags that don't change the content of DEST,
+// so changing them doesn't invalidate the outputs recorded in a checkpoint.
+// Flags that only select the outputs are ignored as well, as the queries and
+// DEST of each output are part of its key already.
+var checkpointIgnoredFlags = []string{
+	"ca-cert",
+	"cache-dir",
+	"cache-ttl",
+	"checkpoint",
+	"config",
+	"datadog-config",
+	"discover",
+	"dry-run",
+	"envs",
+	"fail",
+	"fail-on",
+	"github-output",
+	"impact",
+	"insecure-skip-verify",
+	"json",
+	"keep-raw",
+	"max-in-flight",
+	"no-cache",
+	"otel",
+	"parse-workers",
+	"progress-interval",
+	"request-timeout",
+	"result-json",
+	"resume",
+	"retries",
+	"retry-backoff",
+	"services",
+	"size-report",
+	"spill",
+	"spill-chunk",
+	"summary-format",
+	"timeout",
+	"v",
+	"verify-pickup",
+}
+
+// Checkpoint records the outputs of previous runs that completed successfully,
+// so a run using -resume can skip them.
+type Checkpoint struct {
+	Version int                         `json:"version"`
+	Outputs map[string]CheckpointOutput `json:"outputs"`
+}
+
+// CheckpointOutput records a single output that was written successfully.
+type CheckpointOutput struct {
+	Key        string    `json:"key"`
+	ProfileIDs []string  `json:"profile_ids"`
+	Bytes      int64     `json:"bytes"`
+	Completed  time.Time `json:"completed"`
+}
+
+// LoadCheckpoint reads the checkpoint at path. A missing or incompatible
+// checkpoint yields an empty checkpoint.
+func LoadCheckpoint(path string) (cp *Checkpoint, err error) {
+	defer wrapErr(&err, "load checkpoint")
+	cp = &Checkpoint{Version: checkpointVersion, Outputs: map[string]CheckpointOutput{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var loaded Checkpoint
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, err
+	}
+	if loaded.Version != checkpointVersion || loaded.Outputs == nil {
+		return cp, nil
+	}
+	return &loaded, nil
+}
+
+// Completed returns true if dst was written by a previous run with the same
+// key and still exists.
+func (cp *Checkpoint) Completed(dst, key string) bool {
+	out, ok := cp.Outputs[dst]
+	if !ok || out.Key != key {
+		return false
+	}
+	_, err := os.Stat(dst)
+	return err == nil
+}
+
+// Record marks dst as completed for key.
+func (cp *Checkpoint) Record(dst, key string, profileIDs []string, bytes int64) {
+	cp.Outputs[dst] = CheckpointOutput{
+		Key:        key,
+		ProfileIDs: profileIDs,
+		Bytes:      bytes,
+		Completed:  time.Now().UTC(),
+	}
+}
+
+// Save writes the checkpoint to path.
+func (cp *Checkpoint) Save(path string) (err error) {
+	defer wrapErr(&err, "save checkpoint")
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// checkpointOptionsKey returns a key identifying the flags set in fs that may
+// change the content of DEST, e.g. the selection of profiles, pruning or the
+// compression level, see checkpointIgnoredFlags. It's combined with the key
+// of the queries of each output, so a run with different options doesn't
+// skip outputs written with the old ones.
+func checkpointOptionsKey(fs *flag.FlagSet) string {
+	h := sha256.New()
+	fs.Visit(func(f *flag.Flag) {
+		if !slices.Contains(checkpointIgnoredFlags, f.Name) {
+			fmt.Fprintf(h, "%s=%q\n", f.Name, f.Value.String())
+		}
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "checkpoint.json")
+	dst := filepath.Join(dir, "default.pgo")
+
+	keyFor := func(window time.Duration, query string) string {
+		queries, err := pgo.BuildQueries(window, 5, nil, []string{query})
+		require.NoError(t, err)
+		return pgo.QueriesKey(window, queries)
+	}
+	key := keyFor(time.Hour, "service:foo")
+	time.Sleep(time.Millisecond)
+	require.Equal(t, key, keyFor(time.Hour, "service:foo"))
+	require.NotEqual(t, key, keyFor(2*time.Hour, "service:foo"))
+	require.NotEqual(t, key, keyFor(time.Hour, "service:bar"))
+	require.NotEqual(t, key, keyFor(time.Hour, "service:foo@weight=2"))
+
+	cp, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	require.False(t, cp.Completed(dst, key))
+
+	cp.Record(dst, key, []string{"a", "b"}, 123)
+	require.NoError(t, cp.Save(path))
+	cp, err = LoadCheckpoint(path)
+	require.NoError(t, err)
+	require.False(t, cp.Completed(dst, key), "dst does not exist yet")
+
+	require.NoError(t, os.WriteFile(dst, []byte("pgo"), 0644))
+	require.True(t, cp.Completed(dst, key))
+	require.False(t, cp.Completed(dst, "other"))
+}
+
+func TestCheckpointOptionsKey(t *testing.T) {
+	keyFor := func(args ...string) string {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Bool("v", false, "")
+		fs.Bool("resume", false, "")
+		fs.Bool("noinline", false, "")
+		fs.Float64("sample-rate", 1, "")
+		fs.Int("compression-level", -1, "")
+		require.NoError(t, fs.Parse(args))
+		return checkpointOptionsKey(fs)
+	}
+	key := keyFor()
+	require.Equal(t, key, keyFor("-v", "-resume"), "flags that don't change DEST are ignored")
+	require.NotEqual(t, key, keyFor("-noinline"))
+	require.NotEqual(t, key, keyFor("-sample-rate", "0.5"))
+	require.NotEqual(t, keyFor("-sample-rate", "0.5"), keyFor("-sample-rate", "0.6"))
+	require.NotEqual(t, key, keyFor("-compression-level", "9"))
+}
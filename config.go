@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the config file that is read from the current
+// directory if -config is not set.
+const defaultConfigFile = ".datadog-pgo.yaml"
+
+// fileConfig holds the arguments and flags read from a config file.
+type fileConfig struct {
+	// Queries are used as the QUERY arguments if none are given.
+	Queries []string
+	// Dest is used as the DEST argument if no arguments are given.
+	Dest string
+	// Outputs are written instead of Queries and Dest if no arguments are
+	// given.
+	Outputs []fileConfigOutput
+	// Service is the service field of the datadog key, it is used by -auto
+	// instead of the service derived from the module path.
+	Service string
+	// Flags holds the values of all other keys by flag name.
+	Flags map[string]any
+}
+
+// fileConfigOutput holds the arguments of a single output of a config file.
+type fileConfigOutput struct {
+	Queries []string
+	Dest    string
+}
+
+// loadFileConfig reads the config file at path. If path is empty, the default
+// config file is read if it exists, otherwise nil is returned.
+func loadFileConfig(path string) (cfg *fileConfig, err error) {
+	optional := path == ""
+	if optional {
+		path = defaultConfigFile
+	}
+	defer wrapErr(&err, "config "+path)
+	data, err := os.ReadFile(path)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	cfg = &fileConfig{Flags: map[string]any{}}
+	for key, value := range raw {
+		switch key {
+		case "queries":
+			if cfg.Queries, err = stringList(value); err != nil {
+				return nil, fmt.Errorf("queries: %w", err)
+			}
+		case "dest":
+			var ok bool
+			if cfg.Dest, ok = value.(string); !ok {
+				return nil, errors.New("dest: must be a string")
+			}
+		case "outputs":
+			if cfg.Outputs, err = parseOutputs(value); err != nil {
+				return nil, fmt.Errorf("outputs: %w", err)
+			}
+		case "datadog":
+			if cfg.Service, err = parseDatadog(value); err != nil {
+				return nil, fmt.Errorf("datadog: %w", err)
+			}
+		default:
+			cfg.Flags[key] = value
+		}
+	}
+	return cfg, nil
+}
+
+// applyFlags sets the flags of fs from the config, except for flags that were
+// already set on the command line. A list value sets the flag once per
+// element, which is useful for repeatable flags like -sort.
+func (c *fileConfig) applyFlags(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := make([]string, 0, len(c.Flags))
+	for name := range c.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config: unknown key %q", name)
+		} else if set[name] {
+			continue
+		}
+		values, err := stringList(c.Flags[name])
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", name, err)
+		}
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("config: %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseOutputs parses the value of the outputs key, a list of objects with
+// queries and dest keys.
+func parseOutputs(value any) (outputs []fileConfigOutput, err error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, errors.New("must be a list")
+	}
+	for i, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%d: must be an object with queries and dest", i)
+		}
+		var out fileConfigOutput
+		if out.Queries, err = stringList(m["queries"]); err != nil {
+			return nil, fmt.Errorf("%d: queries: %w", i, err)
+		} else if out.Dest, ok = m["dest"].(string); !ok || out.Dest == "" {
+			return nil, fmt.Errorf("%d: dest: must be a non-empty string", i)
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// parseDatadog parses the value of the datadog key, an object with a service
+// key, and returns the service.
+func parseDatadog(value any) (string, error) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return "", errors.New("must be an object with a service key")
+	}
+	for key := range m {
+		if key != "service" {
+			return "", fmt.Errorf("unknown key %q", key)
+		}
+	}
+	service, ok := m["service"].(string)
+	if !ok || service == "" {
+		return "", errors.New("service: must be a non-empty string")
+	}
+	return service, nil
+}
+
+// stringList returns value as a list of strings. value may be a scalar or a
+// list of scalars.
+func stringList(value any) ([]string, error) {
+	switch v := value.(type) {
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := stringList(item)
+			if err != nil || len(s) != 1 {
+				return nil, errors.New("must be a scalar or a list of scalars")
+			}
+			list = append(list, s[0])
+		}
+		return list, nil
+	case map[string]any:
+		return nil, errors.New("must be a scalar or a list of scalars")
+	case nil:
+		return nil, nil
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+queries:
+  - service:foo env:prod
+  - service:bar env:prod
+dest: ./cmd/foo/default.pgo
+from: 24h
+profiles: 10
+fail: true
+sort: [cpu_cores, timestamp]
+`), 0644))
+
+	cfg, err := loadFileConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"service:foo env:prod", "service:bar env:prod"}, cfg.Queries)
+	require.Equal(t, "./cmd/foo/default.pgo", cfg.Dest)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	from := fs.Duration("from", time.Hour, "")
+	profiles := fs.Int("profiles", 5, "")
+	fail := fs.Bool("fail", false, "")
+	var sorts sortFlag
+	fs.Var(&sorts, "sort", "")
+	require.NoError(t, fs.Parse([]string{"-profiles", "3"}))
+	require.NoError(t, cfg.applyFlags(fs))
+	require.Equal(t, 24*time.Hour, *from)
+	require.Equal(t, 3, *profiles, "command line flags take precedence")
+	require.True(t, *fail)
+	require.Equal(t, sortFlag{"@metrics.core_cpu_cores", "timestamp"}, sorts)
+
+	cfg.Flags["bogus"] = 1
+	require.ErrorContains(t, cfg.applyFlags(fs), `unknown key "bogus"`)
+
+	_, err = loadFileConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestFileConfigOutputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+outputs:
+  - queries: service:foo env:prod
+    dest: ./cmd/foo/default.pgo
+  - queries: [service:bar env:prod, "file:./bar/*.pprof"]
+    dest: ./cmd/bar/default.pgo
+`), 0644))
+	cfg, err := loadFileConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, []fileConfigOutput{
+		{Queries: []string{"service:foo env:prod"}, Dest: "./cmd/foo/default.pgo"},
+		{Queries: []string{"service:bar env:prod", "file:./bar/*.pprof"}, Dest: "./cmd/bar/default.pgo"},
+	}, cfg.Outputs)
+
+	out, err := newOutput(append(cfg.Outputs[1].Queries, cfg.Outputs[1].Dest), time.Hour, 5, nil)
+	require.NoError(t, err)
+	require.Equal(t, "./cmd/bar/default.pgo", out.dst)
+	require.Len(t, out.queries, 1)
+	require.Equal(t, []string{"./bar/*.pprof"}, out.localFiles)
+	require.Equal(t, "cmd_bar_default.pgo", historyName(out.dst))
+
+	require.NoError(t, os.WriteFile(path, []byte("outputs:\n  - queries: service:foo\n"), 0644))
+	_, err = loadFileConfig(path)
+	require.ErrorContains(t, err, "dest")
+}
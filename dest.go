@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// remoteDestSchemes maps the URL schemes of object storage DEST arguments to
+// the commands used to upload files to them.
+var remoteDestSchemes = map[string][]string{
+	"s3://": {"aws", "s3", "cp", "--only-show-errors"},
+	"gs://": {"gcloud", "storage", "cp"},
+}
+
+// isRemoteDest returns true if dst is an object storage URL like
+// s3://bucket/default.pgo.
+func isRemoteDest(dst string) bool {
+	for scheme := range remoteDestSchemes {
+		if strings.HasPrefix(dst, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinDest joins dir and the relative slash-separated path rel. Unlike
+// filepath.Join, it keeps object storage URLs intact.
+func joinDest(dir, rel string) string {
+	if isRemoteDest(dir) {
+		return strings.TrimSuffix(dir, "/") + "/" + path.Clean(rel)
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel))
+}
+
+// uploadCommand returns the command that uploads the local file src to the
+// object storage URL dst.
+func uploadCommand(ctx context.Context, src, dst string) (*exec.Cmd, error) {
+	for scheme, args := range remoteDestSchemes {
+		if strings.HasPrefix(dst, scheme) {
+			args = append(append([]string{}, args...), src, dst)
+			return exec.CommandContext(ctx, args[0], args[1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported DEST URL: %q", dst)
+}
+
+// upload uploads the local file src to the object storage URL dst using the
+// CLI of the storage provider, so its usual credentials apply.
+func upload(ctx context.Context, src, dst string) error {
+	cmd, err := uploadCommand(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("upload %s: %s: %w: %s", dst, cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
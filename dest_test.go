@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteDest(t *testing.T) {
+	require.True(t, isRemoteDest("s3://bucket/foo/default.pgo"))
+	require.True(t, isRemoteDest("gs://bucket/default.pgo"))
+	require.False(t, isRemoteDest("./cmd/foo/default.pgo"))
+
+	require.Equal(t, "s3://bucket/profiles/foo/default.pgo", joinDest("s3://bucket/profiles/", "foo/default.pgo"))
+	require.Equal(t, filepath.Join("profiles", "foo", "default.pgo"), joinDest("profiles", "foo/default.pgo"))
+
+	cmd, err := uploadCommand(context.Background(), "/tmp/default.pgo", "s3://bucket/default.pgo")
+	require.NoError(t, err)
+	require.Equal(t, []string{"aws", "s3", "cp", "--only-show-errors", "/tmp/default.pgo", "s3://bucket/default.pgo"}, cmd.Args)
+	cmd, err = uploadCommand(context.Background(), "/tmp/default.pgo", "gs://bucket/default.pgo")
+	require.NoError(t, err)
+	require.Equal(t, []string{"gcloud", "storage", "cp", "/tmp/default.pgo", "gs://bucket/default.pgo"}, cmd.Args)
+	_, err = uploadCommand(context.Background(), "/tmp/default.pgo", "./default.pgo")
+	require.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// runDiff implements the diff subcommand. It compares two profiles and
+// reports the functions whose share of the cpu time changed the most.
+func runDiff(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(name+" diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: `+name+` diff [OPTIONS]... OLD NEW
+
+diff compares the pprof or PGO files OLD and NEW and reports the functions
+whose flat share of the cpu time changed by more than -threshold percentage
+points, largest change first. Use it to review how much a new PGO profile
+shifted before promoting it, e.g.:
+
+	`+name+` diff release/default.pgo ./cmd/my-service/default.pgo
+
+OPTIONS`)
+		fs.PrintDefaults()
+	}
+	thresholdF := fs.Float64("threshold", 1, "only report functions whose share of the cpu time changed by more than this many percentage points")
+	topF := fs.Int("top", 20, "the maximum number of functions to report, 0 reports all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("diff requires exactly 2 arguments")
+	} else if *thresholdF < 0 {
+		return errors.New("-threshold must not be negative")
+	}
+
+	before, err := pgo.ReadProfile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := pgo.ReadProfile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	diffs, err := pgo.DiffProfiles(before, after, *thresholdF)
+	if err != nil {
+		return err
+	}
+	return printDiff(stdout, diffs, *topF)
+}
+
+// printDiff writes a table of the top diffs to w.
+func printDiff(w io.Writer, diffs []pgo.FunctionDiff, top int) error {
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintln(w, "no functions changed by more than the threshold")
+		return err
+	}
+	if top > 0 && len(diffs) > top {
+		diffs = diffs[:top]
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OLD\tNEW\tDELTA\t  FUNCTION")
+	for _, d := range diffs {
+		fmt.Fprintf(tw, "%.2f%%\t%.2f%%\t%+.2f\t  %s\n", d.Before, d.After, d.Delta(), d.Function)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestPrintDiff(t *testing.T) {
+	var buf strings.Builder
+	require.NoError(t, printDiff(&buf, []pgo.FunctionDiff{
+		{Function: "main.foo", Before: 10, After: 25.5},
+		{Function: "main.bar", Before: 20, After: 12},
+		{Function: "main.baz", Before: 1, After: 0},
+	}, 2))
+	require.Equal(t, `     OLD     NEW   DELTA  FUNCTION
+  10.00%  25.50%  +15.50  main.foo
+  20.00%  12.00%   -8.00  main.bar
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, printDiff(&buf, nil, 2))
+	require.Contains(t, buf.String(), "no functions changed")
+}
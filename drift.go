@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// checkDrift returns an error of the drift class if the cpu time distribution
+// of mp diverges from the existing profile at dst by more than maxDrift, see
+// pgo.ProfileDrift. If warnOnly is set, it only logs a warning instead. A
+// missing dst is not an error, as it doesn't exist on the first run.
+func checkDrift(log *slog.Logger, mp *pgo.MergedProfile, dst string, maxDrift float64, warnOnly bool) error {
+	prev, err := pgo.ReadProfile(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Info("no existing DEST to check -max-drift against", "path", dst)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	drift, err := pgo.ProfileDrift(prev, mp.Profile())
+	if err != nil {
+		return err
+	} else if drift <= maxDrift {
+		log.Info("new profile is within -max-drift of the existing DEST", "path", dst, "drift", drift)
+		return nil
+	}
+	err = fmt.Errorf("-max-drift: %.0f%% of the cpu time moved to other functions compared to the existing %s, more than %g%%, check that the queries still match the right service", drift*100, dst, maxDrift*100)
+	if warnOnly {
+		log.Warn(err.Error(), "drift", drift)
+		return nil
+	}
+	return pgo.WithErrorClass(err, pgo.ErrorClassDrift)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestCheckDrift(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dst := filepath.Join(t.TempDir(), "default.pgo")
+	newMergedProfile := func(prefix string) *pgo.MergedProfile {
+		prof, err := pgo.ReadProfile("pgo/testdata/grpc-anon.pprof")
+		require.NoError(t, err)
+		for _, fn := range prof.Function {
+			fn.Name = prefix + fn.Name
+		}
+		mp := pgo.NewMergedProfile(pgo.MergeOptions{})
+		require.NoError(t, mp.Merge("p1", prof))
+		require.NoError(t, mp.Finish())
+		return mp
+	}
+	mp := newMergedProfile("")
+
+	// DEST doesn't exist on the first run.
+	require.NoError(t, checkDrift(log, mp, dst, 0.1, false))
+
+	_, err := mp.Write(dst, 0644)
+	require.NoError(t, err)
+	require.NoError(t, checkDrift(log, newMergedProfile(""), dst, 0.1, false))
+
+	other := newMergedProfile("other.")
+	err = checkDrift(log, other, dst, 0.1, false)
+	require.ErrorContains(t, err, "-max-drift: 100% of the cpu time moved")
+	require.Equal(t, pgo.ErrorClassDrift, pgo.ErrorClass(err))
+	require.NoError(t, checkDrift(log, other, dst, 0.1, true))
+}
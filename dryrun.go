@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// printDryRun writes a table of the profiles that would be merged into dst to
+// w, see -dry-run.
+func printDryRun(w io.Writer, dst string, profiles []*pgo.SearchProfile) error {
+	fmt.Fprintf(w, "%s: %d profiles\n", dst, len(profiles))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tTIMESTAMP\tCPU CORES\tDURATION\tPROFILE ID")
+	for _, p := range profiles {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%s\n", p.Service, p.Timestamp.UTC().Format(time.RFC3339), p.CPUCores, p.Duration, p.ProfileID)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestPrintDryRun(t *testing.T) {
+	var buf strings.Builder
+	require.NoError(t, printDryRun(&buf, "default.pgo", []*pgo.SearchProfile{
+		{Service: "foo", Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), CPUCores: 1.25, Duration: time.Minute, ProfileID: "abc"},
+	}))
+	require.Equal(t, `default.pgo: 1 profiles
+SERVICE  TIMESTAMP             CPU CORES  DURATION  PROFILE ID
+foo      2024-01-01T00:00:00Z  1.2        1m0s      abc
+`, buf.String())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// envVarRegexp matches ${VAR} and ${VAR:-default} references.
+var envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} references in s with the value of the environment
+// variable VAR. Shell-style ${VAR:-default} references use default if VAR is
+// unset or empty. An error is returned if a variable without default is
+// unset.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envVarRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envVarRegexp.FindStringSubmatch(ref)
+		if val := os.Getenv(m[1]); val != "" {
+			return val
+		} else if m[2] != "" {
+			return m[3]
+		} else if err == nil {
+			err = fmt.Errorf("environment variable %s referenced in %q is not set", m[1], s)
+		}
+		return ref
+	})
+	return expanded, err
+}
+
+// expandMacro replaces the {name} macro in the QUERY and DEST arguments of
+// each output with each of the comma-separated values, so a single templated
+// output becomes one output per value, e.g. {service} with -services a,b.
+// Outputs that don't use the macro are kept as they are. DEST must contain
+// the macro, so each value gets its own file.
+func expandMacro(outputArgs [][]string, name, values string) ([][]string, error) {
+	ref, flagName := "{"+name+"}", "-"+name+"s"
+	var expanded [][]string
+	used := false
+	for _, args := range outputArgs {
+		if !slices.ContainsFunc(args, func(arg string) bool { return strings.Contains(arg, ref) }) {
+			expanded = append(expanded, args)
+			continue
+		}
+		used = true
+		if values == "" {
+			return nil, fmt.Errorf("%s is used, but %s is not set", ref, flagName)
+		} else if dst := args[len(args)-1]; !strings.Contains(dst, ref) {
+			return nil, fmt.Errorf("DEST %q must contain %s when a QUERY does", dst, ref)
+		}
+		for _, value := range strings.Split(values, ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				return nil, fmt.Errorf("%s must not contain empty values", flagName)
+			}
+			valueArgs := make([]string, len(args))
+			for i, arg := range args {
+				valueArgs[i] = strings.ReplaceAll(arg, ref, value)
+			}
+			expanded = append(expanded, valueArgs)
+		}
+	}
+	if values != "" && !used {
+		return nil, fmt.Errorf("%s is set, but no argument contains %s", flagName, ref)
+	}
+	return expanded, nil
+}
+
+// expandEnvAll applies expandEnv to all strings in ss.
+func expandEnvAll(ss []string) ([]string, error) {
+	expanded := make([]string, 0, len(ss))
+	for _, s := range ss {
+		e, err := expandEnv(s)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, e)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("PGO_TEST_SHA", "abc123")
+	t.Setenv("PGO_TEST_EMPTY", "")
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "service:foo", want: "service:foo"},
+		{in: "service:foo version:${PGO_TEST_SHA}", want: "service:foo version:abc123"},
+		{in: "env:${PGO_TEST_ENV:-prod}", want: "env:prod"},
+		{in: "env:${PGO_TEST_EMPTY:-prod}", want: "env:prod"},
+		{in: "version:${PGO_TEST_SHA:-none}", want: "version:abc123"},
+		{in: "cost:$5", want: "cost:$5"},
+		{in: "env:${PGO_TEST_UNSET}", wantErr: "PGO_TEST_UNSET"},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.in)
+		if tt.wantErr != "" {
+			require.ErrorContains(t, err, tt.wantErr)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.want, got)
+	}
+}
+
+func TestExpandMacro(t *testing.T) {
+	outputArgs := [][]string{
+		{"service:{service} env:prod", "cmd/{service}/default.pgo"},
+		{"service:other", "other.pgo"},
+	}
+	got, err := expandMacro(outputArgs, "service", "a, b")
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"service:a env:prod", "cmd/a/default.pgo"},
+		{"service:b env:prod", "cmd/b/default.pgo"},
+		{"service:other", "other.pgo"},
+	}, got)
+
+	got, err = expandMacro(outputArgs, "env", "")
+	require.NoError(t, err)
+	require.Equal(t, outputArgs, got)
+
+	_, err = expandMacro(outputArgs, "service", "")
+	require.ErrorContains(t, err, "{service} is used, but -services is not set")
+	_, err = expandMacro(outputArgs, "env", "prod")
+	require.ErrorContains(t, err, "-envs is set, but no argument contains {env}")
+	_, err = expandMacro([][]string{{"service:{service}", "default.pgo"}}, "service", "a,b")
+	require.ErrorContains(t, err, `DEST "default.pgo" must contain {service}`)
+	_, err = expandMacro(outputArgs, "service", "a,,b")
+	require.ErrorContains(t, err, "-services must not contain empty values")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// exitCodes maps error classes to the exit code used if they fail the run.
+var exitCodes = map[string]int{
+	pgo.ErrorClassOther:   1,
+	pgo.ErrorClassAuth:    3,
+	pgo.ErrorClassEmpty:   4,
+	pgo.ErrorClassPartial: 5,
+	pgo.ErrorClassNetwork: 6,
+	pgo.ErrorClassStale:   7,
+	pgo.ErrorClassDrift:   8,
+}
+
+// exitCode returns the exit code for err, see exitCodes.
+func exitCode(err error) int {
+	return exitCodes[pgo.ErrorClass(err)]
+}
+
+// parseFailOn parses the comma-separated error classes of the -fail-on flag
+// value s. The class "all" selects all classes.
+func parseFailOn(s string) (map[string]bool, error) {
+	failOn := map[string]bool{}
+	for _, class := range strings.Split(s, ",") {
+		switch class = strings.TrimSpace(class); {
+		case class == "":
+		case class == "all":
+			for _, c := range pgo.ErrorClasses {
+				failOn[c] = true
+			}
+		case slices.Contains(pgo.ErrorClasses, class):
+			failOn[class] = true
+		default:
+			return nil, fmt.Errorf("unknown error class %q, must be one of %s or all", class, strings.Join(pgo.ErrorClasses, ", "))
+		}
+	}
+	return failOn, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestParseFailOn(t *testing.T) {
+	failOn, err := parseFailOn("")
+	require.NoError(t, err)
+	require.Empty(t, failOn)
+
+	failOn, err = parseFailOn("auth, partial")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"auth": true, "partial": true}, failOn)
+
+	failOn, err = parseFailOn("all")
+	require.NoError(t, err)
+	require.Len(t, failOn, len(pgo.ErrorClasses))
+
+	_, err = parseFailOn("auth,bogus")
+	require.ErrorContains(t, err, `"bogus"`)
+}
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, 1, exitCode(errors.New("boom")))
+	require.Equal(t, 4, exitCode(loggedError{pgo.ErrNoProfiles}))
+	require.Equal(t, 5, exitCode(pgo.WithErrorClass(pgo.ErrNoProfiles, pgo.ErrorClassPartial)))
+}
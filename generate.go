@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// maxGenerateRequestBytes bounds the size of the body of a generate request.
+const maxGenerateRequestBytes = 1 << 20
+
+// generateRequest is the JSON body of a POST /generate request of serve.
+type generateRequest struct {
+	// Queries are the QUERY arguments of fetch.
+	Queries []string `json:"queries"`
+	// Window is how far back to search for profiles, e.g. "72h", like -from
+	// of fetch. Empty uses the default of fetch.
+	Window string `json:"window"`
+	// Profiles is the number of profiles to fetch per query, like -profiles
+	// of fetch. 0 uses the default of fetch.
+	Profiles int `json:"profiles"`
+}
+
+// fetchArgs validates r and returns the arguments of the fetch command that
+// writes the requested profile to dst. The arguments of r come after
+// fetchFlags, so they take precedence. Queries must be Datadog queries, as
+// local files and environment variables of the server must not be exposed to
+// its clients.
+func (r generateRequest) fetchArgs(fetchFlags []string, dst string) ([]string, error) {
+	if len(r.Queries) == 0 {
+		return nil, errors.New("queries must not be empty")
+	}
+	for _, q := range r.Queries {
+		if strings.TrimSpace(q) == "" {
+			return nil, errors.New("queries must not contain empty queries")
+		} else if files, _ := pgo.SplitLocalArgs([]string{q}); len(files) > 0 {
+			return nil, fmt.Errorf("query %q must not refer to local files", q)
+		} else if strings.Contains(q, "$") {
+			return nil, fmt.Errorf("query %q must not contain $", q)
+		} else if err := pgo.ValidateQuery(q); err != nil {
+			return nil, err
+		}
+	}
+	args := append([]string{"-fail"}, fetchFlags...)
+	if r.Window != "" {
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid window %q, must be a positive duration like 72h", r.Window)
+		}
+		args = append(args, "-from", window.String())
+	}
+	if r.Profiles < 0 {
+		return nil, errors.New("profiles must not be negative")
+	} else if r.Profiles > 0 {
+		args = append(args, "-profiles", strconv.Itoa(r.Profiles))
+	}
+	// Queries may start with a dash, e.g. -env:staging.
+	args = append(args, "--")
+	return append(append(args, r.Queries...), dst), nil
+}
+
+// serveGenerate fetches and merges the profiles of the queries of a
+// generateRequest and responds with the resulting pprof file. It responds
+// with 404 if no profiles match the queries, and with 502 if fetching them
+// fails otherwise. The output of fetch is only logged, as it may reveal
+// details of the server.
+func (s *pgoServer) serveGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req generateRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGenerateRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmp, err := os.MkdirTemp("", "datadog-pgo-generate-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	dst := filepath.Join(tmp, defaultPGOFile)
+	args, err := req.fetchArgs(s.fetchFlags, dst)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case s.generating <- struct{}{}:
+		defer func() { <-s.generating }()
+	case <-r.Context().Done():
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.generateTimeout)
+	defer cancel()
+	start := time.Now()
+	err = s.fetch(ctx, args, os.Stdout)
+	s.recordGenerate(err)
+	if err != nil {
+		s.log.Error("generate failed", "queries", req.Queries, "error", err)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == exitCodes[pgo.ErrorClassEmpty] {
+			http.Error(w, "no profiles match the queries", http.StatusNotFound)
+		} else {
+			http.Error(w, "generate failed, see the server log for details", http.StatusBadGateway)
+		}
+		return
+	}
+	s.log.Info("generated PGO file", "queries", req.Queries, "duration", time.Since(start).Round(time.Millisecond))
+
+	f, err := os.Open(dst)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+defaultPGOFile+`"`)
+	http.ServeContent(w, r, defaultPGOFile, time.Time{}, f)
+}
+
+// recordGenerate records the result of a generate request.
+func (s *pgoServer) recordGenerate(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.generateFailures++
+	} else {
+		s.generateSuccesses++
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateRequestFetchArgs(t *testing.T) {
+	tests := []struct {
+		req     generateRequest
+		want    []string
+		wantErr string
+	}{
+		{
+			req:  generateRequest{Queries: []string{"service:foo env:prod"}},
+			want: []string{"-fail", "-v", "--", "service:foo env:prod", "dst.pgo"},
+		},
+		{
+			req:  generateRequest{Queries: []string{"service:foo", "-env:staging"}, Window: "72h", Profiles: 10},
+			want: []string{"-fail", "-v", "-from", "72h0m0s", "-profiles", "10", "--", "service:foo", "-env:staging", "dst.pgo"},
+		},
+		{req: generateRequest{}, wantErr: "queries must not be empty"},
+		{req: generateRequest{Queries: []string{" "}}, wantErr: "empty queries"},
+		{req: generateRequest{Queries: []string{"service:(foo"}}, wantErr: "invalid query"},
+		{req: generateRequest{Queries: []string{"service:foo"}, Window: "3d"}, wantErr: "invalid window"},
+		{req: generateRequest{Queries: []string{"service:foo"}, Window: "-1h"}, wantErr: "invalid window"},
+		{req: generateRequest{Queries: []string{"service:foo"}, Profiles: -1}, wantErr: "profiles must not be negative"},
+		{req: generateRequest{Queries: []string{"service:foo", "file:/etc/*"}}, wantErr: "must not refer to local files"},
+		{req: generateRequest{Queries: []string{"service:${DD_API_KEY}"}}, wantErr: "must not contain $"},
+	}
+	for _, tt := range tests {
+		got, err := tt.req.fetchArgs([]string{"-v"}, "dst.pgo")
+		if tt.wantErr != "" {
+			require.ErrorContains(t, err, tt.wantErr)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.want, got)
+	}
+}
+
+func TestServeGenerate(t *testing.T) {
+	var gotArgs []string
+	s := &pgoServer{
+		dir:             t.TempDir(),
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		generate:        true,
+		generating:      make(chan struct{}, 1),
+		generateTimeout: time.Minute,
+		fetch: func(ctx context.Context, args []string, out io.Writer) error {
+			gotArgs = args
+			if strings.Contains(args[len(args)-2], "missing") {
+				cmd := exec.CommandContext(ctx, "sh", "-c", "echo 'no profiles found'; exit 4")
+				cmd.Stdout = out
+				return cmd.Run()
+			} else if strings.Contains(args[len(args)-2], "broken") {
+				cmd := exec.CommandContext(ctx, "sh", "-c", "echo 'no files match \"/secret/*\"'; exit 1")
+				cmd.Stdout = out
+				return cmd.Run()
+			}
+			return os.WriteFile(args[len(args)-1], []byte("profile"), 0o644)
+		},
+	}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	post := func(body string) (int, string) {
+		res, err := http.Post(srv.URL+"/generate", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(data)
+	}
+
+	code, body := post(`{"queries": ["service:foo env:prod"], "window": "1h"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "profile", body)
+	require.Equal(t, []string{"-fail", "-from", "1h0m0s", "--", "service:foo env:prod"}, gotArgs[:len(gotArgs)-1])
+
+	code, body = post(`{"queries": ["service:missing"]}`)
+	require.Equal(t, http.StatusNotFound, code)
+	require.Contains(t, body, "no profiles match")
+
+	code, body = post(`{"queries": ["service:broken"]}`)
+	require.Equal(t, http.StatusBadGateway, code)
+	require.NotContains(t, body, "/secret")
+
+	code, body = post(`{"queries": ["file:/etc/*"]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, body, "local files")
+	code, _ = post(`{"queries": ["service:${DD_API_KEY}"]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = post(`{"query": "service:foo"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = post(`{"queries": []}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	res, err := http.Get(srv.URL + "/generate")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+	res, err = http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Contains(t, string(data), `datadog_pgo_generate_requests_total{result="success"} 1`)
+	require.Contains(t, string(data), `datadog_pgo_generate_requests_total{result="failure"} 2`)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// digestSuffix is appended to DEST to get the path of the file written by
+// -output-digest, e.g. default.pgo.sha256.
+const digestSuffix = ".sha256"
+
+// hermeticConflicts lists the flags that make DEST depend on the time of the
+// run, on randomness or on state outside of the pinned profiles, so they
+// can't be used with -hermetic.
+var hermeticConflicts = []string{
+	"attestation",
+	"baseline-url",
+	"cache-ttl",
+	"discover",
+	"fallback-query",
+	"history-dir",
+	"manifest",
+	"recent-versions",
+	"sample-rate",
+	"saved-search",
+	"sign",
+	"update",
+}
+
+// hermeticValues maps flags to the only value they may be set to with
+// -hermetic, as their other values make DEST depend on the time of the run,
+// e.g. -profile-times sum sets the time of DEST to the time of the run.
+var hermeticValues = map[string]string{
+	"profile-times": pgo.TimeModeMerge,
+}
+
+// checkHermetic returns an error if any of the hermeticConflicts flags is set
+// in fs, or any of the hermeticValues flags is set to another value.
+func checkHermetic(fs *flag.FlagSet) error {
+	var conflicts []string
+	fs.Visit(func(f *flag.Flag) {
+		if value, ok := hermeticValues[f.Name]; ok && f.Value.String() != value {
+			conflicts = append(conflicts, "-"+f.Name+" "+f.Value.String())
+		} else if slices.Contains(hermeticConflicts, f.Name) {
+			conflicts = append(conflicts, "-"+f.Name)
+		}
+	})
+	if len(conflicts) > 0 {
+		return fmt.Errorf("-hermetic can't be used with %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// writeDigest writes the hex encoded sha256 checksum of the file at src to
+// dst in the format of sha256sum, using the base name of name as the file
+// name. It returns the checksum.
+func writeDigest(src, dst, name string) (string, error) {
+	digest, err := fileSHA256(src)
+	if err != nil {
+		return "", err
+	}
+	line := fmt.Sprintf("%s  %s\n", digest, path.Base(name))
+	return digest, os.WriteFile(dst, []byte(line), 0666)
+}
+
+// fileSHA256 returns the hex encoded sha256 checksum of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
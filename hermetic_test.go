@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestCheckHermetic(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("update", false, "")
+	fs.String("history-dir", "", "")
+	fs.Int("profiles", 5, "")
+	require.NoError(t, fs.Parse([]string{"-profiles", "10"}))
+	require.NoError(t, checkHermetic(fs))
+	require.NoError(t, fs.Parse([]string{"-update", "-history-dir", "x"}))
+	require.EqualError(t, checkHermetic(fs), "-hermetic can't be used with -history-dir, -update")
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("profile-times", pgo.TimeModeMerge, "")
+	require.NoError(t, fs.Parse([]string{"-profile-times", "merge"}))
+	require.NoError(t, checkHermetic(fs))
+	require.NoError(t, fs.Parse([]string{"-profile-times", "sum"}))
+	require.EqualError(t, checkHermetic(fs), "-hermetic can't be used with -profile-times sum")
+}
+
+func TestWriteDigest(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "default.pgo")
+	require.NoError(t, os.WriteFile(src, []byte("hello"), 0644))
+	digest, err := writeDigest(src, src+digestSuffix, "gs://bucket/default.pgo")
+	require.NoError(t, err)
+	require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", digest)
+	data, err := os.ReadFile(src + digestSuffix)
+	require.NoError(t, err)
+	require.Equal(t, digest+"  default.pgo\n", string(data))
+}
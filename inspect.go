@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// runInspect implements the inspect subcommand. It prints a summary of an
+// existing PGO file and its manifest.
+func runInspect(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(name+" inspect", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: `+name+` inspect [OPTIONS]... FILE
+
+inspect prints the number of samples, the total cpu time, the time fields, the
+size, the estimated PGO impact and the hottest functions of the pprof or PGO
+file FILE, as well as the debug query of the merged profiles and the manifest
+written by -manifest if present, e.g.:
+
+	`+name+` inspect ./cmd/my-service/default.pgo
+
+OPTIONS`)
+		fs.PrintDefaults()
+	}
+	topF := fs.Int("top", 10, "the number of hot functions to print")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("inspect requires exactly 1 argument")
+	}
+	path := fs.Arg(0)
+
+	prof, err := pgo.ReadProfile(path)
+	if err != nil {
+		return err
+	}
+	summary, err := pgo.Summarize(prof, *topF)
+	if err != nil {
+		return err
+	}
+	manifest, err := readManifest(path + manifestSuffix)
+	if err != nil {
+		return err
+	}
+	return printInspect(stdout, path, summary, manifest)
+}
+
+// readManifest reads the manifest at path. It returns nil if it doesn't
+// exist.
+func readManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("manifest: %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// printInspect writes the summary of the profile at path and its manifest,
+// which may be nil, to w.
+func printInspect(w io.Writer, path string, s pgo.ProfileSummary, m *Manifest) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "file:\t%s\n", path)
+	fmt.Fprintf(tw, "samples:\t%d\n", s.Samples)
+	fmt.Fprintf(tw, "cpu samples:\t%d\n", s.CPUSamples)
+	fmt.Fprintf(tw, "cpu time:\t%s\n", s.CPU.Round(time.Millisecond))
+	fmt.Fprintf(tw, "time:\t%s\n", s.Time.Format(time.RFC3339))
+	fmt.Fprintf(tw, "duration:\t%s\n", s.Duration.Round(time.Millisecond))
+	fmt.Fprintf(tw, "size:\t%d bytes compressed, %d bytes uncompressed\n", s.Size.Compressed, s.Size.Uncompressed)
+	fmt.Fprintf(tw, "tables:\t%d locations, %d functions, %d mappings\n", s.Size.Locations, s.Size.Functions, s.Size.Mappings)
+	if s.DebugQuery != "" {
+		fmt.Fprintf(tw, "debug query:\t%s\n", s.DebugQuery)
+	}
+	if m != nil {
+		fmt.Fprintf(tw, "manifest:\t%s\n", path+manifestSuffix)
+		fmt.Fprintf(tw, "  created:\t%s by %s %s\n", m.Created.Format(time.RFC3339), name, m.ToolVersion)
+		fmt.Fprintf(tw, "  queries:\t%s\n", strings.Join(m.Queries, " | "))
+		fmt.Fprintf(tw, "  window:\t%s to %s\n", m.From.Format(time.RFC3339), m.To.Format(time.RFC3339))
+		fmt.Fprintf(tw, "  profiles:\t%d\n", len(m.Profiles))
+		if len(m.Profiles) > 0 {
+			oldest, newest := m.Profiles[0].Time, m.Profiles[0].Time
+			for _, p := range m.Profiles {
+				if p.Time.Before(oldest) {
+					oldest = p.Time
+				}
+				if p.Time.After(newest) {
+					newest = p.Time
+				}
+			}
+			fmt.Fprintf(tw, "  profile times:\t%s to %s\n", oldest.Format(time.RFC3339), newest.Format(time.RFC3339))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nestimated PGO impact:\n")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  call edges:\t%d\n", s.Impact.CallEdges)
+	fmt.Fprintf(tw, "  hot call edges:\t%d (weight >= %.2f%%), likely inlined\n", s.Impact.HotCallEdges, s.Impact.HotThresholdPercent)
+	fmt.Fprintf(tw, "  hot callers:\t%d functions\n", s.Impact.HotCallers)
+	fmt.Fprintf(tw, "  hot callees:\t%d functions with %.2f%% of the cpu time\n", s.Impact.HotCallees, s.Impact.HotCalleeCPUPercent)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\ntop %d functions:\n", len(s.TopFunctions))
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "FLAT\tFLAT%\t  FUNCTION")
+	for _, fn := range s.TopFunctions {
+		fmt.Fprintf(tw, "%s\t%.2f%%\t  %s\n", fn.CPU.Round(time.Millisecond), fn.Percent, fn.Function)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestPrintInspect(t *testing.T) {
+	s := pgo.ProfileSummary{
+		Samples:    3,
+		CPUSamples: 5,
+		CPU:        55 * time.Millisecond,
+		Time:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Duration:   2 * time.Minute,
+		DebugQuery: "profile-id:(a OR b)",
+		Size:       pgo.SizeStats{Compressed: 1000, Uncompressed: 4000, Samples: 3, Locations: 20, Functions: 15, Mappings: 1},
+		Impact:     pgo.Impact{CallEdges: 10, HotCallEdges: 4, HotThresholdPercent: 1.5, HotCallers: 2, HotCallees: 3, HotCalleeCPUPercent: 80},
+		TopFunctions: []pgo.FunctionShare{
+			{Function: "main.foo", CPU: 40 * time.Millisecond, Percent: 72.72},
+		},
+	}
+	m := &Manifest{
+		ToolVersion: "1.2.3",
+		Created:     time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Queries:     []string{"service:foo runtime:go"},
+		Profiles: []pgo.ProfileInfo{
+			{ID: "a", Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+			{ID: "b", Time: time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	var buf strings.Builder
+	require.NoError(t, printInspect(&buf, "default.pgo", s, m))
+	out := buf.String()
+	require.Contains(t, out, "cpu time:         55ms\n")
+	require.Contains(t, out, "debug query:      profile-id:(a OR b)\n")
+	require.Contains(t, out, "  queries:        service:foo runtime:go\n")
+	require.Contains(t, out, "  profile times:  2024-01-01T06:00:00Z to 2024-01-01T12:00:00Z\n")
+	require.Contains(t, out, "size:             1000 bytes compressed, 4000 bytes uncompressed\n")
+	require.Contains(t, out, "tables:           20 locations, 15 functions, 1 mappings\n")
+	require.Contains(t, out, "  hot call edges:  4 (weight >= 1.50%), likely inlined\n")
+	require.Contains(t, out, "  hot callees:     3 functions with 80.00% of the cpu time\n")
+	require.Contains(t, out, "top 1 functions:\n  FLAT   FLAT%  FUNCTION\n  40ms  72.72%  main.foo\n")
+
+	buf.Reset()
+	require.NoError(t, printInspect(&buf, "default.pgo", s, nil))
+	require.NotContains(t, buf.String(), "manifest")
+}
+
+func TestRunInspect(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "default.pgo")
+	data, err := os.ReadFile("pgo/testdata/grpc-anon.pprof")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst, data, 0644))
+	require.NoError(t, runInspect([]string{"-top", "3", dst}, io.Discard))
+
+	require.NoError(t, os.WriteFile(dst+manifestSuffix, []byte("{"), 0644))
+	require.ErrorContains(t, runInspect([]string{dst}, io.Discard), "manifest")
+}
@@ -1,50 +1,75 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"log/slog"
 
-	"github.com/google/pprof/profile"
 	"github.com/lmittmann/tint"
 	"github.com/mattn/go-isatty"
 	"github.com/sourcegraph/conc/pool"
+
+	"github.com/DataDog/datadog-pgo/pgo"
 )
 
 const (
-	name    = "datadog-pgo"
-	version = "0.0.1"
+	name    = pgo.Name
+	version = pgo.Version
 )
 
+// subcommands maps the name of each subcommand to its implementation.
+var subcommands = map[string]func(args []string, stdout io.Writer) error{
+	"fetch":   func(args []string, _ io.Writer) error { return run(args) },
+	"merge":   runMerge,
+	"inspect": runInspect,
+	"diff":    runDiff,
+	"bench":   runBench,
+	"build":   runBuild,
+	"verify":  runVerify,
+	"serve":   runServe,
+	"pull":    runPull,
+}
+
 // main runs the pgo tool.
 func main() {
-	if err := run(); err != nil && !errors.As(err, &handledError{}) {
+	var err error
+	if len(os.Args) > 1 && subcommands[os.Args[1]] != nil {
+		err = subcommands[os.Args[1]](os.Args[2:], os.Stdout)
+	} else {
+		// Without a subcommand, fetch is run for backwards compatibility.
+		err = run(os.Args[1:])
+	}
+	if err != nil && !errors.As(err, &handledError{}) {
 		if !errors.As(err, &loggedError{}) {
 			fmt.Fprintf(os.Stderr, "pgo: error: %v\n", err)
 		}
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
-// run runs the pgo tool and returns an error if any.
-func run() (err error) {
+// run implements the fetch subcommand for the command line arguments args and
+// returns an error if any.
+func run(args []string) (err error) {
 	start := time.Now()
 
 	// Define usage
 	flag.Usage = func() {
-		usage := `usage: ` + name + ` [OPTIONS]... QUERY... DEST
+		usage := `usage: ` + name + ` [fetch] [OPTIONS]... QUERY... DEST
+       ` + name + ` COMMAND [OPTIONS]... ARGS...
 
 ` + name + ` fetches CPU profiles from Datadog using the given QUERY arguments
 and merges the results into a single DEST file suitable for profile-guided
@@ -56,6 +81,19 @@ In order to use this, you need to set the following environment variables.
 	DD_APP_KEY: A Datadog Application key
 	DD_SITE: A Datadog site to use (defaults to datadoghq.com)
 
+Variables that are not set are read from the file named by the same variable
+with a _FILE suffix, e.g. DD_API_KEY_FILE, or from the api_key, app_key and site
+fields of a datadog config file instead, see -datadog-config.
+
+Instead of DD_APP_KEY, you can authenticate with a bearer token set via
+DD_BEARER_TOKEN, or with OAuth client credentials set via DD_OAUTH_CLIENT_ID and
+DD_OAUTH_CLIENT_SECRET.
+
+To fetch profiles from multiple Datadog orgs in one run, name the other orgs
+via -orgs and prefix their queries with the org name, e.g. -orgs org2 and
+'org2:service:my-service env:prod'. Their credentials are read from the same
+variables with the upper case name as a suffix, e.g. DD_API_KEY_ORG2.
+
 After this, typical usage will look like this:
 
 	` + name + ` 'service:my-service env:prod' ./cmd/my-service/default.pgo
@@ -67,6 +105,41 @@ main package (go1.21+), so you can build your service as usual, for example:
 
 Unless the -fail flag is set, ` + name + ` will always return with a zero exit
 code in order to let your build succeed, even if a PGO download error occured.
+Use -fail-on to only fail for some classes of errors, e.g. -fail-on auth.
+
+QUERY, DEST and flag values can also be read from a YAML config file, see
+-config. Arguments and flags on the command line take precedence.
+
+QUERY and DEST may reference environment variables as ${VAR}, or as
+${VAR:-default} to fall back to a default value if VAR is unset.
+
+A QUERY of the form file:PATTERN merges the local pprof files matching the
+glob PATTERN instead, e.g. file:./profiles/*.pprof.
+
+To derive the QUERY from the module path of DEST, e.g. service:my-service
+env:prod runtime:go for ./cmd/my-service/default.pgo, run:
+
+	` + name + ` -auto ./cmd/my-service/default.pgo
+
+To write a profile for every Go service matching a query instead, e.g. to
+./profiles/<service>/default.pgo, run:
+
+	` + name + ` -discover 'env:prod team:payments' ./profiles
+
+COMMANDS
+
+	fetch    fetch profiles from Datadog and merge them into DEST (default)
+	merge    merge local pprof files into DEST without using Datadog
+	inspect  print a summary of an existing PGO file
+	diff     compare the cpu shares of the functions of two profiles
+	bench    compare the build of a main package with and without its profile
+	build    fetch the profile of a main package and build it with go build
+	verify   check that the hot functions of a profile exist in a binary
+	serve    periodically refresh PGO files and serve them over HTTP
+	pull     download a PGO file published to an OCI registry
+
+Run '` + name + ` COMMAND -h' for the usage of a command. The OPTIONS below
+belong to fetch.
 
 OPTIONS`
 		fmt.Fprintln(flag.CommandLine.Output(), usage)
@@ -75,412 +148,1238 @@ OPTIONS`
 
 	// Parse flags
 	var (
-		failF     = flag.Bool("fail", false, "return with a non-zero exit code on failure")
+		failF     = flag.Bool("fail", false, "return with a non-zero exit code on failure, same as -fail-on all")
+		failOnF   = flag.String("fail-on", "", "return with a non-zero exit code for these comma-separated error classes: auth, empty, partial, network, stale, drift, other or all")
 		jsonF     = flag.Bool("json", false, "print logs in json format")
 		profilesF = flag.Int("profiles", 5, "the number of profiles to fetch per query")
 		timeoutF  = flag.Duration("timeout", 60*time.Second, "timeout for fetching PGO profile")
 		verboseF  = flag.Bool("v", false, "verbose output")
+		progressF = flag.Duration("progress-interval", 10*time.Second, "log the progress of searching, downloading and merging profiles at this interval, on a terminal a progress line is shown instead, 0 disables it")
 		fromF     = flag.Duration("from", 3*24*time.Hour, "how far back to search for profiles")
+		spillF    = flag.Bool("spill", false, "spill intermediate merge results to disk to reduce memory usage (slower)")
+		inFlightF = flag.Int("max-in-flight", 0, "the maximum number of profiles downloaded, parsed or waiting to be merged at the same time to bound memory usage, 0 disables the limit")
+		parseF    = flag.Int("parse-workers", 0, "the maximum number of downloaded profiles parsed at the same time, 0 uses GOMAXPROCS")
+		keepRawF  = flag.String("keep-raw", "", "write every downloaded profile to this directory before merging it, named after its profile ID")
+		chunkF    = flag.Int("spill-chunk", 10, "the number of profiles to merge in memory before spilling to disk (requires -spill)")
+		stripF    = flag.Bool("strip-lines", false, "strip file names and make line numbers function-relative to shrink DEST")
+		resumeF   = flag.Bool("resume", false, "skip outputs that were already completed by a previous run with the same queries")
+		checkF    = flag.String("checkpoint", ".datadog-pgo-checkpoint.json", "the checkpoint file used by -resume")
+		historyF  = flag.String("history-dir", "", "also write a timestamped copy of DEST to this directory")
+		keepF     = flag.Int("history-keep", 10, "the number of copies to keep in -history-dir, 0 keeps all")
+		minVerF   = flag.String("min-version", "", "only use profiles with a version tag greater or equal to this version")
+		excludeF  = flag.String("exclude", "", "exclude the profiles matching this query, e.g. 'pod_name:canary-* OR availability-zone:us-east-1d'")
+		verTagF   = flag.String("version-tag", "", "only use profiles with this version tag, e.g. v1.42.0 or version:v1.42.0")
+		recentF   = flag.Int("recent-versions", 0, "only use profiles from the N most recent versions of each query, 0 uses all versions")
+		depthF    = flag.Int("max-location-depth", 0, "truncate stacks to this many frames closest to the leaf, 0 disables truncation")
+		preTopF   = flag.Int("pre-aggregate-top", 0, "before merging, drop the samples of each profile whose leaf function isn't one of its N hottest, to speed up merging many profiles, 0 disables it")
+		fallbackF = flag.String("fallback-query", "", "query to use if none of the QUERY arguments match any profiles")
+		pickupF   = flag.Bool("verify-pickup", false, "warn if DEST will not be picked up by the go toolchain automatically")
+		resultF   = flag.String("result-json", "", "write a machine-readable JSON result of the run to this file")
+		ghOutF    = flag.Bool("github-output", false, "write the result of the run as GitHub Actions step outputs to the file set via GITHUB_OUTPUT")
+		summaryF  = flag.String("summary-format", "", "print a summary of the run as the last line of stdout in this format: json")
+		rateF     = flag.Float64("sample-rate", 1, "randomly select this fraction of the profiles matching each query")
+		seedF     = flag.Int64("sample-seed", 0, "seed for -sample-rate, defaults to a random seed that is logged")
+		topF      = flag.Int("sample-keep-top", 0, "always keep this many top profiles of each query when using -sample-rate")
+		maxZipF   = flag.Int64("max-archive-bytes", pgo.DefaultZipLimits.MaxArchiveBytes, "the maximum size of a downloaded archive")
+		maxEntryF = flag.Int64("max-entry-bytes", pgo.DefaultZipLimits.MaxEntryBytes, "the maximum uncompressed size of a profile in a downloaded archive")
+		maxEntsF  = flag.Int("max-entries", pgo.DefaultZipLimits.MaxEntries, "the maximum number of profiles in a downloaded archive")
+		savedF    = flag.String("saved-search", "", "use the query of the saved profile search with this ID in addition to any QUERY")
+		staleF    = flag.Duration("stale-after", 24*time.Hour, "warn if the newest merged profile is older than this, 0 disables the warning")
+		majorityF = flag.Float64("require-version-majority", 0, "only write DEST if at least this percentage of the cpu time comes from the version of the newest profile, 0 disables the check")
+		deployF   = flag.String("deployment-query", "", "warn if all merged profiles predate the latest event matching this Datadog events query, e.g. 'source:kubernetes service:foo', use -fail-on stale to fail instead")
+		timesF    = flag.String("profile-times", pgo.TimeModeMerge, "how to set the time and duration of DEST: merge, sum or max")
+		minSuccF  = flag.Float64("min-success-ratio", 0, "skip profiles that fail to download as long as this fraction of them succeeds, e.g. 0.6, 0 fails on the first failed download")
+		strictF   = flag.Bool("strict", false, "fail if a profile is corrupt or invalid instead of skipping it")
+		skipLogF  = flag.String("skip-log-level", pgo.SkipLogSummary, "how to log skipped profiles: silent, summary or each")
+		goVerF    = flag.String("go-version", "", "only use profiles from this go runtime version, e.g. go1.22.1 or go1.22")
+		windowF   = flag.String("window-filter", "", "only use profiles taken within these recurring windows separated by ';', e.g. 'weekday 09:00-18:00 UTC'")
+		otelF     = flag.Bool("otel", false, "export OpenTelemetry spans to the OTLP/HTTP endpoint set via OTEL_EXPORTER_OTLP_ENDPOINT")
+		pruneF    = flag.Float64("prune-below-percent", 0, "drop the coldest functions accounting for less than this percentage of cpu time, 0 disables pruning")
+		pruneRtF  = flag.Bool("prune-runtime", false, "collapse runtime, cgo and assembly frames into their callers to shrink DEST, the runtime itself is no longer optimized")
+		moduleF   = flag.String("module-filter", "", "drop samples without any function from these comma-separated module paths or main packages, e.g. github.com/acme/myservice")
+		trimThF   = flag.Float64("trim-threshold", 0, "drop samples with functions whose cumulative cpu time is below this fraction of the total, e.g. 0.005, 0 disables trimming")
+		maxSizeF  = flag.Int64("max-size", 0, "trim cold samples until DEST is at most this many bytes, 0 disables the limit")
+		ddConfF   = flag.String("datadog-config", "", "read api_key, app_key and site from this YAML file if the env vars are not set (default ~/.datadog/datadog.yaml)")
+		orgsF     = flag.String("orgs", "", "comma-separated names of additional Datadog orgs, e.g. org2, queries prefixed with org2: use the credentials of DD_API_KEY_ORG2, DD_APP_KEY_ORG2 and DD_SITE_ORG2")
+		baseURLF  = flag.String("baseline-url", "", "fetch a baseline pprof file from this URL and merge it into DEST")
+		baseWF    = flag.Float64("baseline-weight", 0, "scale the baseline to this multiple of the cpu time of the fetched profiles, 0 merges it as-is")
+		mergeOpF  = flag.String("merge-op", pgo.MergeOpSum, "how to combine the values of identical stacks across profiles: sum, max or avg")
+		cacheTTLF = flag.Duration("cache-ttl", 0, "reuse profiles fetched by a previous run with the same arguments for this long, 0 disables the cache")
+		noCacheF  = flag.Bool("no-cache", false, "ignore cached profiles, but still refresh the cache if -cache-ttl is set")
+		cacheDirF = flag.String("cache-dir", "", "the directory used by -cache-ttl (default ~/.cache/datadog-pgo on Linux)")
+		retriesF  = flag.Int("retries", pgo.DefaultRetries, "the number of times to retry requests failing with a server or network error")
+		backoffF  = flag.Duration("retry-backoff", pgo.DefaultRetryBackoff, "the delay before the first retry, doubling for every further retry")
+		reqTimeF  = flag.Duration("request-timeout", 0, "cancel and retry individual requests taking longer than this, 0 only applies -timeout")
+		minSampF  = flag.Int64("min-samples", 0, "refuse to write DEST if it contains fewer cpu samples than this")
+		minCPUF   = flag.Float64("min-cpu-seconds", 0, "refuse to write DEST if it contains less cpu time than this")
+		minWarnF  = flag.Bool("min-data-warn", false, "only warn instead of refusing to write DEST if -min-samples or -min-cpu-seconds is not met")
+		chmodF    = flag.String("chmod", "", "set the permissions of DEST to this octal mode, e.g. 0640 (default 0666 minus the umask)")
+		discoverF = flag.String("discover", "", "write a profile for every Go service with profiles matching this query, e.g. 'env:prod team:payments', below the DEST directory")
+		updateF   = flag.Bool("update", false, "merge the existing DEST file into the new profile instead of replacing it")
+		driftF    = flag.Float64("max-drift", 0, "don't overwrite DEST if the cpu time distribution of the new profile diverges from the existing DEST by more than this fraction, e.g. 0.5, 0 disables the check")
+		driftWF   = flag.Bool("drift-warn", false, "only warn if -max-drift is exceeded and overwrite DEST anyway")
+		updShareF = flag.Float64("update-share", pgo.DefaultUpdateShare, "the share of the cpu time of DEST that comes from the existing DEST file when using -update")
+		levelF    = flag.Int("compression-level", pgo.DefaultCompressionLevel, "the gzip compression level of DEST from 1 (fastest) to 9 (smallest), 0 writes it uncompressed, -1 uses the default level")
+		sizeRepF  = flag.Bool("size-report", false, "log the compressed and uncompressed size of DEST and the number of its samples, locations and functions")
+		impactF   = flag.Bool("impact", false, "log an estimate of the impact of DEST on PGO, e.g. the number of call edges that are hot enough to be inlined")
+		manifestF = flag.Bool("manifest", false, "write a JSON manifest with the queries, time window and profiles used to DEST.json")
+		publishF  = flag.String("publish", "", "also push DEST as an OCI artifact to this reference using the oras CLI, e.g. oci://registry.example.com/org/pgo:my-service")
+		attestF   = flag.Bool("attestation", false, "write an in-toto statement with the SLSA provenance of DEST, i.e. its queries, profile IDs and tool version, to DEST.intoto.json")
+		signF     = flag.Bool("sign", false, "sign DEST and the -attestation with cosign, keyless unless -sign-key is set, and write the sigstore bundles to DEST.sigstore.json and DEST.intoto.json.sigstore.json")
+		signKeyF  = flag.String("sign-key", "", "the cosign key used by -sign, e.g. cosign.key or a KMS URI like awskms:///alias/pgo")
+		digestF   = flag.Bool("output-digest", false, "write the sha256 checksum of DEST to DEST.sha256 in the format of sha256sum")
+		hermeticF = flag.Bool("hermetic", false, "refuse options that make DEST depend on anything but the -profile-ids or local files, e.g. for remote build caches")
+		caCertF   = flag.String("ca-cert", "", "trust the PEM encoded CA certificates in this file in addition to the system ones (default $DD_CA_CERT_FILE)")
+		insecureF = flag.Bool("insecure-skip-verify", false, "don't verify TLS certificates, only use this for debugging")
+		dryRunF   = flag.Bool("dry-run", false, "print the profiles that would be merged into DEST without downloading them or writing DEST")
+		typeF     = flag.String("profile-type", pgo.ProfileTypeCPU, "the type of profiles to merge: cpu, heap or mutex, only cpu profiles can be used for PGO")
+		saveBundF = flag.String("save-bundle", "", "also write the merged profiles to this zip file, which -from-bundle turns into DEST without access to Datadog")
+		fromBundF = flag.String("from-bundle", "", "use the merged profiles of a zip file written by -save-bundle instead of fetching them, no API requests are made")
+		idsF      = flag.String("profile-ids", "", "merge exactly the profiles with these comma-separated IDs instead of searching with QUERY arguments, they must be within -from")
+		servicesF = flag.String("services", "", "comma-separated services, write one output per service by replacing {service} in QUERY and DEST, e.g. 'service:{service} env:prod' ./cmd/{service}/default.pgo")
+		envsF     = flag.String("envs", "", "comma-separated envs, write one output per env by replacing {env} in QUERY and DEST, like -services")
+		discTmplF = flag.String("discover-dest", "{service}/default.pgo", "the path of the profile written for each service found by -discover, relative to the DEST directory")
+		autoF     = flag.Bool("auto", false, "derive the QUERY from the module path of DEST or the datadog.service field of the config file, DEST defaults to "+defaultPGOFile)
+		autoEnvF  = flag.String("auto-env", "prod", "the env of the QUERY derived by -auto, empty matches all envs")
+		strategyF = flag.String("strategy", pgo.StrategyTop, "how to choose the profiles of each query: top of the whole -from window, stratified to take the top profiles of each of -buckets windows, or p90-cpu to take the profiles closest to the 90th percentile of cpu cores")
+		bucketsF  = flag.Int("buckets", 6, "the number of windows of equal length -from is split into by -strategy stratified, each contributes at least one profile")
 	)
-	flag.Parse()
+	var sortF sortFlag
+	flag.Var(&sortF, "sort", "sort the profiles of each query by cpu_cores, cpu_time, duration, timestamp or a numeric @field, repeat to merge the union of the top profiles of each sort (default cpu_cores)")
+	flag.Var(&sortF, "sort-by", "alias of -sort")
+	var noInlineF regexpFlag
+	flag.Var(&noInlineF, "noinline-func", "prevent inlining of the functions whose names match this regular expression, in addition to the built-in ones, can be repeated")
+	var dropFuncF, onlyFuncF regexpFlag
+	flag.Var(&dropFuncF, "drop-function", "drop the samples whose stack contains a function matching this regular expression from DEST, so PGO ignores its calls, can be repeated")
+	flag.Var(&onlyFuncF, "only-function", "only keep the samples whose stack contains a function matching this regular expression in DEST, can be repeated")
+	var weightF weightFlag
+	flag.Var(&weightF, "weight", "add a QUERY whose profiles contribute this relative weight to DEST, e.g. '3 service:api env:prod', can be repeated")
+	configF := flag.String("config", "", "read QUERY, DEST and flag values from this YAML file, flags on the command line take precedence (default "+defaultConfigFile+" if it exists)")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
 
-	// Validate args
-	if flag.NArg() < 2 {
-		flag.Usage()
-		return errors.New("at least 2 arguments are required")
+	// Apply the config file
+	cfg, err := loadFileConfig(*configF)
+	if err != nil {
+		return err
+	}
+	argList := flag.Args()
+	if cfg != nil {
+		if err := cfg.applyFlags(flag.CommandLine); err != nil {
+			return err
+		}
+		if len(argList) == 0 && cfg.Dest != "" {
+			argList = append(append(argList, cfg.Queries...), cfg.Dest)
+		}
 	}
 
-	// Split args into queries and dst
-	queries := buildQueries(*fromF, *profilesF, flag.Args()[:flag.NArg()-1])
-	dst := flag.Arg(flag.NArg() - 1)
+	// Derive the QUERY from DEST
+	var autoQueryStr string
+	if *autoF {
+		if len(argList) > 1 {
+			return errors.New("-auto requires at most 1 DEST argument and no QUERY arguments")
+		} else if *discoverF != "" || *idsF != "" || (len(argList) == 0 && cfg != nil && len(cfg.Outputs) > 0) {
+			return errors.New("-auto can't be used with -discover, -profile-ids or outputs")
+		} else if len(argList) == 0 {
+			argList = []string{defaultPGOFile}
+		}
+		if autoQueryStr, err = autoQuery(argList[0], cfg, *autoEnvF); err != nil {
+			return err
+		}
+		argList = append([]string{autoQueryStr}, argList...)
+	}
 
-	// Setup logger
-	logOpt := &slog.HandlerOptions{AddSource: *verboseF}
-	if *verboseF {
-		logOpt.Level = slog.LevelDebug
+	// Write the machine-readable result, even if the run fails
+	var result *Result
+	githubOutput := os.Getenv("GITHUB_OUTPUT")
+	if *ghOutF && githubOutput == "" {
+		return errors.New("-github-output is set, but GITHUB_OUTPUT is not")
 	}
-	log := slog.New(tint.NewHandler(os.Stdout, &tint.Options{
-		AddSource:  logOpt.AddSource,
-		Level:      logOpt.Level,
-		TimeFormat: "",
-		NoColor:    !isatty.IsTerminal(os.Stdout.Fd()),
-	}))
-	if *jsonF {
-		log = slog.New(slog.NewJSONHandler(os.Stdout, logOpt))
+	if *summaryF != "" && *summaryF != "json" {
+		return fmt.Errorf("invalid -summary-format: %q", *summaryF)
+	}
+	var collector *warningCollector
+	if *resultF != "" || *ghOutF || *summaryF != "" {
+		defer func() {
+			if result == nil {
+				result = newResult(nil, "")
+			}
+			result.Finish(start, err)
+			if collector != nil {
+				result.Warnings = collector.Warnings()
+			}
+			if *resultF != "" {
+				if writeErr := result.WriteFile(*resultF); writeErr != nil && err == nil {
+					err = fmt.Errorf("write result: %w", writeErr)
+				}
+			}
+			if *ghOutF {
+				if writeErr := result.WriteGitHubOutput(githubOutput); writeErr != nil && err == nil {
+					err = fmt.Errorf("write github output: %w", writeErr)
+				}
+			}
+			if *summaryF != "" {
+				if writeErr := newSummary(result).Write(os.Stdout); writeErr != nil && err == nil {
+					err = fmt.Errorf("write summary: %w", writeErr)
+				}
+			}
+		}()
+	}
+
+	// Collect the QUERY and DEST arguments of each output
+	outputArgs := [][]string{argList}
+	if len(flag.Args()) == 0 && cfg != nil && len(cfg.Outputs) > 0 {
+		outputArgs = outputArgs[:0]
+		for _, o := range cfg.Outputs {
+			outputArgs = append(outputArgs, append(append([]string{}, o.Queries...), o.Dest))
+		}
+	}
+	if (*servicesF != "" || *envsF != "") && *discoverF != "" {
+		return errors.New("-services and -envs can't be used with -discover")
+	}
+	for _, macro := range []struct{ name, values string }{{"service", *servicesF}, {"env", *envsF}} {
+		if outputArgs, err = expandMacro(outputArgs, macro.name, macro.values); err != nil {
+			return err
+		}
+	}
+
+	// Validate args and split them into local files, queries and dst, the
+	// outputs of -discover are created once the services are known
+	var (
+		outputs    []*output
+		profileIDs []string
+	)
+	if *saveBundF != "" && (len(outputArgs) != 1 || *discoverF != "") {
+		return errors.New("-save-bundle requires a single DEST and can't be used with -discover or outputs")
 	}
+	var publishRef string
+	if *publishF != "" {
+		if len(outputArgs) != 1 || *discoverF != "" {
+			return errors.New("-publish requires a single DEST and can't be used with -discover or outputs")
+		} else if publishRef, err = parsePublishRef(*publishF); err != nil {
+			return err
+		}
+	}
+	if *fromBundF != "" {
+		if len(outputArgs) != 1 || len(argList) != 1 {
+			flag.Usage()
+			return errors.New("-from-bundle requires exactly 1 DEST argument and no QUERY arguments")
+		} else if *idsF != "" || *discoverF != "" || *savedF != "" || *fallbackF != "" || len(weightF) > 0 || *saveBundF != "" || *cacheTTLF > 0 {
+			return errors.New("-from-bundle can't be used with -profile-ids, -discover, -saved-search, -fallback-query, -weight, -save-bundle or -cache-ttl")
+		}
+		out, err := newOutput(outputArgs[0], *fromF, *profilesF, sortF)
+		if err != nil {
+			return err
+		}
+		outputs, outputArgs = append(outputs, out), nil
+	}
+	if *idsF != "" {
+		if len(outputArgs) != 1 || len(argList) != 1 {
+			flag.Usage()
+			return errors.New("-profile-ids requires exactly 1 DEST argument and no QUERY arguments")
+		} else if *discoverF != "" || *savedF != "" || *fallbackF != "" || *excludeF != "" || len(weightF) > 0 {
+			return errors.New("-profile-ids can't be used with -discover, -saved-search, -fallback-query, -exclude or -weight")
+		}
+		if profileIDs, err = pgo.ParseProfileIDs(*idsF); err != nil {
+			return fmt.Errorf("invalid -profile-ids: %w", err)
+		}
+		out, err := newOutput(outputArgs[0], *fromF, *profilesF, sortF)
+		if err != nil {
+			return err
+		}
+		out.addQueries([]pgo.SearchQuery{pgo.ProfileIDsQuery(*fromF, profileIDs)})
+		outputs, outputArgs = append(outputs, out), nil
+	}
+	if *discoverF != "" {
+		if len(outputArgs) != 1 || len(argList) != 1 {
+			flag.Usage()
+			return errors.New("-discover requires exactly 1 DEST directory argument")
+		} else if !strings.Contains(*discTmplF, "{service}") {
+			return errors.New("-discover-dest must contain {service}")
+		} else if len(weightF) > 0 {
+			return errors.New("-weight can't be used with -discover")
+		}
+		outputArgs = nil
+	}
+	for _, args := range outputArgs {
+		// Add the -weight queries before DEST
+		if len(weightF) > 0 && len(args) > 0 {
+			args = append(append(append([]string{}, args[:len(args)-1]...), weightF...), args[len(args)-1])
+		}
+		if *savedF == "" && len(args) < 2 {
+			flag.Usage()
+			return errors.New("at least 2 arguments are required")
+		} else if len(args) < 1 {
+			flag.Usage()
+			return errors.New("at least 1 argument is required when using -saved-search")
+		}
+		out, err := newOutput(args, *fromF, *profilesF, sortF)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, out)
+	}
+	result = outputsResult(outputs)
+
+	// Setup logger, it removes the progress line before logging on a terminal
+	log := newLogger(*verboseF, *jsonF)
+	var progress *progressReporter
+	if *progressF > 0 && !*dryRunF {
+		var tty io.Writer
+		if !*jsonF && isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stderr.Fd()) {
+			tty = os.Stderr
+		}
+		progress = newProgressReporter(&pgo.Progress{}, tty)
+		if tty != nil {
+			log = slog.New(&progressHandler{Handler: log.Handler(), r: progress})
+		}
+	}
+	collector = newWarningCollector(log.Handler())
+	log = slog.New(collector)
 	log.Info(name, "version", version, "go-version", runtime.Version())
+	if *idsF == "" {
+		logQueryWarnings(log, outputs)
+	}
+	if autoQueryStr != "" {
+		log.Info("derived query from -auto", "query", autoQueryStr)
+	}
 
-	// Log errors and turn them into warnings unless -fail is set
+	// Log errors and turn them into warnings unless -fail or -fail-on
+	// includes their class
+	failOn, err := parseFailOn(*failOnF)
+	if err != nil {
+		return fmt.Errorf("invalid -fail-on: %w", err)
+	} else if *failF {
+		failOn, _ = parseFailOn("all")
+	}
 	defer func() {
 		if err == nil {
 			return
 		}
-		log.Error(err.Error())
+		class := pgo.ErrorClass(err)
+		log.Error(err.Error(), "error-class", class)
 		err = loggedError{err}
-		if !*failF {
+		if *failOnF == "" && !*failF {
 			err = handledError{err}
 			log.Warn(name + " failed, but -fail is not set, returning exit code 0 to continue without PGO")
+		} else if !failOn[class] {
+			err = handledError{err}
+			log.Warn(name+" failed, but -fail-on doesn't include the error class, returning exit code 0 to continue without PGO", "error-class", class)
 		}
 	}()
 
-	// Setup API client
-	client, err := ClientFromEnv()
-	if err != nil {
-		return fmt.Errorf("clientFromEnv: %w", err)
+	// Setup tracing
+	var tracer *pgo.Tracer
+	if *otelF {
+		if tracer = pgo.TracerFromEnv(); tracer == nil {
+			log.Warn("-otel is set, but OTEL_EXPORTER_OTLP_ENDPOINT is not, spans will not be exported")
+		}
 	}
+	traceCtx, runSpan := pgo.StartSpan(pgo.WithTracer(context.Background(), tracer), "run")
+	defer func() {
+		runSpan.End(err)
+		exportCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := tracer.Export(exportCtx); err != nil {
+			log.Warn("failed to export OpenTelemetry spans", "error", err)
+		}
+	}()
 
-	// Create context
-	ctx, cancel := context.WithTimeout(context.Background(), *timeoutF)
-	defer cancel()
+	// Setup select options
+	selectOpts := pgo.SelectOptions{
+		MinVersion:    *minVerF,
+		GoVersion:     *goVerF,
+		SampleRate:    *rateF,
+		SampleSeed:    *seedF,
+		SampleKeepTop: *topF,
+	}
+	if *rateF <= 0 || *rateF > 1 {
+		return errors.New("-sample-rate must be in the range (0, 1]")
+	} else if *rateF < 1 && selectOpts.SampleSeed == 0 {
+		selectOpts.SampleSeed = time.Now().UnixNano()
+	}
+	if *windowF != "" {
+		if selectOpts.WindowFilter, err = pgo.ParseWindowFilter(*windowF); err != nil {
+			return fmt.Errorf("-window-filter: %w", err)
+		}
+	}
 
-	// Search, download and merge profiles
-	mergedProfile, err := SearchDownloadMerge(ctx, log, client, queries)
-	if err != nil {
-		return err
+	// Validate time mode
+	switch *timesF {
+	case pgo.TimeModeMerge, pgo.TimeModeSum, pgo.TimeModeMax:
+	default:
+		return fmt.Errorf("invalid -profile-times: %q", *timesF)
 	}
 
-	// Apply no inline hack
-	if err := mergedProfile.ApplyNoInlineHack(); err != nil {
-		return err
+	// Validate baseline weight
+	if *baseWF < 0 {
+		return errors.New("-baseline-weight must not be negative")
 	}
 
-	// Writing pgo file to dst
-	n, err := mergedProfile.Write(dst)
-	if err != nil {
-		return err
+	// Validate update share
+	if *updShareF < 0 || *updShareF >= 1 {
+		return errors.New("-update-share must be in the range [0, 1)")
 	}
-	log.Info(
-		"wrote PGO file",
-		"path", dst,
-		"samples", mergedProfile.Samples(),
-		"bytes", n,
-		"total-duration", timeSinceRoundMS(start),
-		"debug-query", mergedProfile.DebugQuery(),
-	)
-	return nil
-}
 
-// buildQueries returns a list of SearchQuery for the given time window and queries.
-func buildQueries(window time.Duration, limit int, queries []string) (searchQueries []SearchQuery) {
-	searchQueries = make([]SearchQuery, 0, len(queries))
-	for _, q := range queries {
-		// PGO is only supported for Go right now, avoid fetching non-go
-		// profiles (e.g. from native) that might exist for the same query.
-		if !strings.Contains(q, "language:go") && !strings.Contains(q, "runtime:go") {
-			q = strings.TrimSpace(q) + " runtime:go"
-		}
-
-		searchQueries = append(searchQueries, SearchQuery{
-			Filter: SearchFilter{
-				From:  JSONTime{time.Now().Add(-window)},
-				To:    JSONTime{time.Now()},
-				Query: q,
-			},
-			Sort: SearchSort{
-				Order: "desc",
-				// TODO(fg) or use @metrics.core_cpu_time_total?
-				Field: "@metrics.core_cpu_cores",
-			},
-			Limit: limit,
-		})
+	// Validate recent versions
+	if *recentF < 0 {
+		return errors.New("-recent-versions must not be negative")
+	}
+
+	// Validate trimming
+	if *trimThF < 0 || *trimThF >= 1 {
+		return errors.New("-trim-threshold must be in the range [0, 1)")
+	} else if *maxSizeF < 0 {
+		return errors.New("-max-size must not be negative")
 	}
-	return
-}
 
-// usePGOEndpoint is a flag to use the pgo endpoint instead of the search and
-// download endpoints. If this new endpoint proves to work well, we can remove
-// this flag and the old code.
-const usePGOEndpoint = true
+	// Validate strategy
+	var buckets int
+	switch *strategyF {
+	case pgo.StrategyTop:
+	case pgo.StrategyStratified:
+		if *bucketsF < 1 {
+			return errors.New("-buckets must be at least 1")
+		} else if *idsF != "" {
+			return errors.New("-strategy stratified can't be used with -profile-ids")
+		}
+		buckets = *bucketsF
+	case pgo.StrategyP90CPU:
+		if *idsF != "" {
+			return errors.New("-strategy p90-cpu can't be used with -profile-ids")
+		}
+		selectOpts.CPUPercentile = 90
+	default:
+		return fmt.Errorf("invalid -strategy: %q", *strategyF)
+	}
 
-// SearchDownloadMerge queries the profiles, downloads them and merges them into a single profile.
-func SearchDownloadMerge(ctx context.Context, log *slog.Logger, client *Client, queries []SearchQuery) (*MergedProfile, error) {
-	if usePGOEndpoint {
-		return searchDownloadMergePGOEndpoint(ctx, log, client, queries)
+	// Validate file mode
+	var fileMode os.FileMode
+	if *chmodF != "" {
+		if fileMode, err = parseFileMode(*chmodF); err != nil {
+			return fmt.Errorf("invalid -chmod: %w", err)
+		}
 	}
-	return searchDownloadMerge(ctx, log, client, queries)
-}
 
-// searchDownloadMerge queries the profiles, downloads them and merges them into a single profile.
-func searchDownloadMerge(ctx context.Context, log *slog.Logger, client *Client, queries []SearchQuery) (*MergedProfile, error) {
-	newPool := func() *pool.ContextPool {
-		return pool.New().WithErrors().WithContext(ctx).WithCancelOnError().WithFirstError()
+	// Validate profile type, cpu time based options only work for cpu profiles
+	if err := pgo.ValidateProfileType(*typeF); err != nil {
+		return fmt.Errorf("invalid -profile-type: %w", err)
+	} else if *typeF != pgo.ProfileTypeCPU {
+		if *pruneF > 0 || *trimThF > 0 || *maxSizeF > 0 || *minSampF > 0 || *minCPUF > 0 || *baseWF > 0 || *updateF || len(weightF) > 0 || *preTopF > 0 {
+			return errors.New("-prune-below-percent, -trim-threshold, -max-size, -min-samples, -min-cpu-seconds, -baseline-weight, -update, -weight and -pre-aggregate-top require -profile-type cpu")
+		}
+		log.Warn("only cpu profiles can be used for PGO, DEST is meant for custom analysis", "profile-type", *typeF)
 	}
 
-	var pgoProfile = &MergedProfile{}
-	queryPool := newPool()
-	downloadPool := newPool()
-	for _, q := range queries {
-		q := q
-		queryPool.Go(func(ctx context.Context) error {
+	// Setup merge options
+	mergeOpts := pgo.MergeOptions{MaxLocationDepth: *depthF, PreAggregateTopK: *preTopF, SkipLogLevel: *skipLogF, MergeOp: *mergeOpF, ProfileType: *typeF}
+	switch *skipLogF {
+	case pgo.SkipLogSilent, pgo.SkipLogSummary, pgo.SkipLogEach:
+	default:
+		return fmt.Errorf("invalid -skip-log-level: %q", *skipLogF)
+	}
+	switch *mergeOpF {
+	case pgo.MergeOpSum, pgo.MergeOpMax, pgo.MergeOpAvg:
+	default:
+		return fmt.Errorf("invalid -merge-op: %q", *mergeOpF)
+	}
+	if *inFlightF < 0 {
+		return errors.New("-max-in-flight must not be negative")
+	}
+	if *preTopF < 0 {
+		return errors.New("-pre-aggregate-top must not be negative")
+	}
+	if *parseF < 0 {
+		return errors.New("-parse-workers must not be negative")
+	}
+	mergeOpts.MaxInFlight = *inFlightF
+	if progress != nil {
+		mergeOpts.Progress = progress.progress
+	}
+	mergeOpts.ParseWorkers = *parseF
+	mergeOpts.KeepRawDir = *keepRawF
+	mergeOpts.Strict = *strictF
+	if *minSuccF < 0 || *minSuccF > 1 {
+		return errors.New("-min-success-ratio must be in the range [0, 1]")
+	}
+	mergeOpts.MinSuccessRatio = *minSuccF
+	if *signKeyF != "" && !*signF {
+		return errors.New("-sign-key requires -sign")
+	}
+	if err := pgo.ValidCompressionLevel(*levelF); err != nil {
+		return fmt.Errorf("-compression-level: %w", err)
+	}
+	if *driftF < 0 || *driftF > 1 {
+		return errors.New("-max-drift must be between 0 and 1")
+	}
+	if *majorityF < 0 || *majorityF > 100 {
+		return errors.New("-require-version-majority must be between 0 and 100")
+	}
+	mergeOpts.TrackVersions = *majorityF > 0
+	chunkSet := false
+	flag.Visit(func(f *flag.Flag) { chunkSet = chunkSet || f.Name == "spill-chunk" })
+	if chunkSet && !*spillF {
+		return errors.New("-spill-chunk requires -spill")
+	} else if *spillF {
+		if *chunkF < 1 {
+			return errors.New("-spill-chunk must be at least 1")
+		}
+		mergeOpts.SpillChunk = *chunkF
+	}
+
+	// Setup HTTP client, proxies are configured via HTTPS_PROXY
+	if *caCertF == "" {
+		*caCertF = os.Getenv("DD_CA_CERT_FILE")
+	}
+	if *insecureF {
+		log.Warn("-insecure-skip-verify is set, TLS certificates are not verified")
+	}
+	httpClient, err := pgo.NewHTTPClient(*caCertF, *insecureF)
+	if err != nil {
+		return err
+	}
+
+	// Validate -hermetic, DEST must only depend on pinned profiles
+	if *hermeticF {
+		if err := checkHermetic(flag.CommandLine); err != nil {
+			return err
+		} else if needsClient(outputs) && *idsF == "" {
+			return errors.New("-hermetic requires -profile-ids or QUERY arguments that are local files")
+		}
+	}
+
+	// Setup API client, it's not needed if all QUERY arguments are local files
+	if *retriesF < 0 {
+		return errors.New("-retries must not be negative")
+	} else if *reqTimeF < 0 {
+		return errors.New("-request-timeout must not be negative")
+	} else if *maxZipF <= 0 {
+		return errors.New("-max-archive-bytes must be positive")
+	} else if *maxEntryF <= 0 {
+		return errors.New("-max-entry-bytes must be positive")
+	} else if *maxEntsF <= 0 {
+		return errors.New("-max-entries must be positive")
+	}
+	if *deployF != "" && !needsClient(outputs) && *savedF == "" && *discoverF == "" {
+		return errors.New("-deployment-query requires QUERY arguments that aren't local files")
+	}
+	var client *pgo.Client
+	if needsClient(outputs) || *savedF != "" || *discoverF != "" {
+		if client, err = pgo.ClientFromEnvAndConfig(*ddConfF); err != nil {
+			return fmt.Errorf("clientFromEnv: %w", err)
+		}
+		client.ZipLimits = pgo.ZipLimits{
+			MaxArchiveBytes: *maxZipF,
+			MaxEntryBytes:   *maxEntryF,
+			MaxEntries:      *maxEntsF,
+		}
+		client.Retries = *retriesF
+		client.RetryBackoff = *backoffF
+		client.RequestTimeout = *reqTimeF
+		client.Log = log
+		client.HTTPClient = httpClient
+		client.Metrics = pgo.NewMetrics()
+		if *orgsF != "" {
+			for _, org := range strings.Split(*orgsF, ",") {
+				if err := client.AddOrg(strings.TrimSpace(org)); err != nil {
+					return fmt.Errorf("-orgs: %w", err)
+				}
+			}
+		}
+
+		// Report request metrics, and send them via DogStatsD if configured
+		statsd, statsdErr := pgo.StatsdFromEnv()
+		if statsdErr != nil {
+			return statsdErr
+		}
+		defer func() {
+			total := client.Metrics.Total()
 			log.Info(
-				"searching profiles",
-				"query", q.Filter.Query,
-				"by", q.Sort.Field,
-				"order", q.Sort.Order,
-				"from", q.Filter.From.String(),
-				"to", q.Filter.To.String(),
+				"request metrics",
+				"requests", total.Requests,
+				"errors", total.Errors,
+				"bytes", total.Bytes,
+				"max-duration", total.MaxDuration(),
 			)
-			startQuery := time.Now()
-			profiles, err := client.SearchProfiles(ctx, q)
+			if statsd == nil {
+				return
+			} else if sendErr := statsd.SendMetrics(client.Metrics, "success:"+strconv.FormatBool(err == nil)); sendErr != nil {
+				log.Warn("failed to send metrics via DogStatsD", "error", sendErr)
+			}
+		}()
+	}
+	fetcher := &pgo.Fetcher{Client: client, Log: log, Select: selectOpts, Merge: mergeOpts}
+
+	// Create context
+	ctx, cancel := context.WithTimeout(traceCtx, *timeoutF)
+	defer cancel()
+
+	// Discover services and create an output for each of them
+	if *discoverF != "" {
+		services, err := client.DiscoverServices(ctx, *fromF, *discoverF)
+		if err != nil {
+			return err
+		}
+		log.Info("discovered services", "discover", *discoverF, "services", len(services))
+		for _, service := range services {
+			out, err := discoverOutput(argList[0], *discTmplF, *discoverF, service, *fromF, *profilesF, sortF)
+			if err != nil {
+				log.Warn("skipping discovered service", "error", err)
+				continue
+			}
+			outputs = append(outputs, out)
+		}
+		if len(outputs) == 0 {
+			return pgo.ErrNoProfiles
+		}
+		result = outputsResult(outputs)
+	}
+
+	// Resolve saved search, it's added to the queries of all outputs
+	if *savedF != "" {
+		savedQuery, err := client.SavedSearchQuery(ctx, *savedF)
+		if err != nil && !needsSavedSearch(outputs) {
+			log.Warn("failed to resolve saved search, continuing with QUERY arguments", "saved-search", *savedF, "error", err)
+		} else if err != nil {
+			return err
+		} else {
+			log.Info("resolved saved search", "saved-search", *savedF, "query", savedQuery)
+			savedQueries, err := pgo.BuildQueries(*fromF, *profilesF, sortF, []string{savedQuery})
 			if err != nil {
 				return err
 			}
-			log.Debug(
-				"found profiles",
-				"count", len(profiles),
-				"duration", timeSinceRoundMS(startQuery),
-				"query", q.Filter.Query,
-			)
+			for _, out := range outputs {
+				out.addQueries(savedQueries)
+			}
+		}
+	}
 
-			if len(profiles) > q.Limit {
-				profiles = profiles[:q.Limit]
-			}
-
-			for _, p := range profiles {
-				p := p
-				downloadPool.Go(func(ctx context.Context) error {
-					log.Info(
-						"downloading profile",
-						"service", p.Service,
-						"cpu-cores", float64(int(p.CPUCores*10))/10,
-						"duration", p.Duration,
-						"age", time.Since(p.Timestamp).Round(time.Second),
-						"profile-id", p.ProfileID,
-					)
-					startDownload := time.Now()
-					download, err := client.DownloadProfile(ctx, p)
-					if err != nil {
-						return err
-					}
-					log.Debug(
-						"downloaded profile",
-						"duration", timeSinceRoundMS(startDownload),
-						"bytes", len(download.data),
-						"profile-id", p.ProfileID,
-						"event-id", p.EventID,
-					)
-
-					cpu, err := download.ExtractCPUProfile()
-					if err != nil {
-						return err
-					}
-
-					prof, err := profile.ParseData(cpu)
-					if err != nil {
-						return err
-					}
-					return pgoProfile.Merge(p.ProfileID, prof)
-				})
+	// Exclude profiles from the queries of all outputs, restrict them to a
+	// version tag or recent versions and split them into buckets for
+	// -strategy stratified
+	for _, out := range outputs {
+		queries := out.queries
+		if *excludeF != "" {
+			queries = pgo.WithQueryFilter(queries, excludeFilter(*excludeF))
+		}
+		if *verTagF != "" {
+			queries = pgo.WithQueryFilter(queries, versionTagFilter(*verTagF))
+		}
+		if *recentF > 0 && len(queries) > 0 {
+			if queries, err = pgo.RestrictToRecentVersions(ctx, log, client, queries, *recentF); err != nil {
+				return err
 			}
-			return nil
-		})
+		}
+		out.setQueries(pgo.StratifyQueries(queries, buckets))
 	}
-	if err := queryPool.Wait(); err != nil {
-		return nil, err
-	} else if err := downloadPool.Wait(); err != nil {
-		return nil, err
+
+	// List the profiles that would be merged without downloading them
+	if *dryRunF {
+		for _, out := range outputs {
+			var profiles []*pgo.SearchProfile
+			if len(out.queries) > 0 {
+				profiles, err = fetcher.Search(ctx, out.queries)
+				if err != nil && !errors.Is(err, pgo.ErrNoProfiles) {
+					return err
+				}
+			}
+			if len(out.localFiles) > 0 {
+				log.Info("-dry-run doesn't list local files", "files", out.localFiles)
+			}
+			if err := printDryRun(os.Stdout, out.dst, profiles); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	return pgoProfile, nil
-}
 
-// searchDownloadMergePGOEndpoint queries the profiles and downloads them using
-// the new pgo endpoint. Then it merges hte profiles into a single profile using
-// the pgo endpoint.
-func searchDownloadMergePGOEndpoint(ctx context.Context, log *slog.Logger, client *Client, queries []SearchQuery) (*MergedProfile, error) {
-	download, err := client.SearchAndDownloadProfiles(ctx, queries)
-	if err != nil {
-		return nil, err
+	// Load the checkpoint of previous runs
+	var (
+		checkpoint   *Checkpoint
+		checkpointMu sync.Mutex
+	)
+	if *resumeF {
+		if checkpoint, err = LoadCheckpoint(*checkF); err != nil {
+			return err
+		}
 	}
-	return download.MergedProfile(log)
-}
+	cpOptionsKey := checkpointOptionsKey(flag.CommandLine)
+
+	// writeOutput fetches, merges and writes the profile of a single output
+	writeOutput := func(log *slog.Logger, out *output) (err error) {
+		defer func() { out.result.Finish(start, err) }()
+		queries, localFiles, dst := out.queries, out.localFiles, out.dst
+		if *updateF && isRemoteDest(dst) {
+			return errors.New("-update can't be used with an object storage DEST")
+		} else if *driftF > 0 && isRemoteDest(dst) {
+			return errors.New("-max-drift can't be used with an object storage DEST")
+		}
 
-// MergedProfile is the result of merging multiple profiles.
-type MergedProfile struct {
-	mu         sync.Mutex
-	profile    *profile.Profile
-	profileIDs []string
-}
+		// Skip outputs completed by a previous run
+		cpKey := pgo.QueriesKey(*fromF, queries) + ":" + cpOptionsKey
+		if checkpoint != nil {
+			checkpointMu.Lock()
+			completed := checkpoint.Completed(dst, cpKey)
+			checkpointMu.Unlock()
+			if completed {
+				log.Info("skipping output completed by a previous run", "path", dst, "checkpoint", *checkF)
+				return nil
+			}
+		}
 
-// Merge merges prof into the current profile. Callers must not use prof after
-// calling Merge.
-func (p *MergedProfile) Merge(id string, prof *profile.Profile) (err error) {
-	// Drop labels to reduce profile size
-	for _, s := range prof.Sample {
-		s.Label = nil
-	}
+		// Load merged profile from a bundle or from the cache
+		var (
+			mergedProfile *pgo.MergedProfile
+			usedFallback  bool
+			cache         *pgo.Cache
+			cKey          = pgo.CacheKey(*fromF, queries, *fallbackF, selectOpts, mergeOpts)
+		)
+		if *fromBundF != "" {
+			if mergedProfile, usedFallback, err = pgo.ReadBundle(*fromBundF, mergeOpts); err != nil {
+				return err
+			}
+			log.Info("using profiles from bundle", "profiles", len(mergedProfile.ProfileIDs()), "bundle", *fromBundF)
+		} else if *cacheTTLF > 0 && len(localFiles) > 0 {
+			log.Warn("-cache-ttl is ignored when merging local files")
+		} else if *cacheTTLF > 0 {
+			if cache, err = pgo.NewCache(*cacheDirF, *cacheTTLF); err != nil {
+				log.Warn("failed to setup cache, continuing without it", "error", err)
+			} else if !*noCacheF {
+				mergedProfile, usedFallback, err = cache.Load(cKey, mergeOpts, time.Now())
+				if err != nil {
+					log.Warn("failed to load cached profiles", "error", err)
+				} else if mergedProfile != nil {
+					log.Info("using cached profiles", "profiles", len(mergedProfile.ProfileIDs()), "cache-dir", cache.Dir())
+				}
+			}
+		}
 
-	// Acquire lock to access p fields
-	p.mu.Lock()
-	defer p.mu.Unlock()
+		if mergedProfile == nil {
+			// Search, download and merge profiles
+			if len(queries) > 0 {
+				mergedProfile, err = fetcher.Fetch(ctx, queries)
+			} else {
+				mergedProfile = pgo.NewMergedProfile(mergeOpts)
+			}
+			if errors.Is(err, pgo.ErrNoProfiles) && *fallbackF != "" {
+				log.Warn("no profiles found for any QUERY, using fallback query", "fallback-query", *fallbackF)
+				var fallbackQueries []pgo.SearchQuery
+				if fallbackQueries, err = pgo.BuildQueries(*fromF, *profilesF, sortF, []string{*fallbackF}); err != nil {
+					return err
+				} else if *excludeF != "" {
+					fallbackQueries = pgo.WithQueryFilter(fallbackQueries, excludeFilter(*excludeF))
+				}
+				mergedProfile, err = fetcher.Fetch(ctx, pgo.StratifyQueries(fallbackQueries, buckets))
+				usedFallback = true
+			}
+			if errors.Is(err, pgo.ErrNoProfiles) && len(localFiles) > 0 {
+				log.Warn("no profiles found for any QUERY, continuing with local files")
+				mergedProfile, err = pgo.NewMergedProfile(mergeOpts), nil
+			}
+			if err != nil {
+				return err
+			}
 
-	// Append profile ID
-	p.profileIDs = append(p.profileIDs, id)
+			// Merge local files
+			if len(localFiles) > 0 {
+				if err := mergedProfile.MergeFiles(log, localFiles); err != nil {
+					return err
+				} else if len(mergedProfile.ProfileIDs()) == 0 {
+					return pgo.ErrNoProfiles
+				}
+			}
 
-	// First profile? No need to merge.
-	if p.profile == nil {
-		p.profile = prof
-		return nil
-	}
+			// Apply merge op
+			if err := mergedProfile.ApplyMergeOp(); err != nil {
+				return err
+			}
 
-	// Merge profiles after the first one.
-	p.profile, err = profile.Merge([]*profile.Profile{p.profile, prof})
-	return
-}
+			// Cache the merged profile
+			if cache != nil {
+				if err := cache.Store(cKey, mergedProfile, usedFallback, time.Now()); err != nil {
+					log.Warn("failed to cache profiles", "error", err)
+				}
+			}
+		}
 
-// ApplyNoInlineHack removes samples that lead to bad inlining decisions.
-func (p *MergedProfile) ApplyNoInlineHack() error {
-	return ApplyNoInlineHack(p.profile)
-}
+		// Save the merged profile for a later run with -from-bundle
+		if *saveBundF != "" {
+			if err := mergedProfile.WriteBundle(*saveBundF, usedFallback, time.Now()); err != nil {
+				return err
+			}
+			log.Info("wrote bundle", "path", *saveBundF, "profiles", len(mergedProfile.ProfileIDs()))
+		}
 
-// Write writes the merged profile to dst and returns the number of bytes
-// written.
-func (p *MergedProfile) Write(dst string) (int64, error) {
-	file, err := os.Create(dst)
-	if err != nil {
-		return 0, err
-	}
-	defer file.Close()
+		// Make sure that all pinned profiles were merged
+		if missing := mergedProfile.MissingProfileIDs(profileIDs); len(missing) > 0 {
+			err := fmt.Errorf("-profile-ids: %d of %d profiles not found within -from: %s", len(missing), len(profileIDs), strings.Join(missing, ","))
+			return pgo.WithErrorClass(err, pgo.ErrorClassPartial)
+		}
 
-	cw := &countingWriter{W: file}
-	if err := p.profile.Write(cw); err != nil {
-		return cw.N, err
-	}
-	return cw.N, file.Close()
-}
+		// Make sure that the profiles don't all predate the latest
+		// deployment, this is only fatal if -fail-on includes stale
+		if *deployF != "" {
+			deployed, err := client.LatestEvent(ctx, *fromF, *deployF)
+			if err != nil {
+				return err
+			} else if deployAge := time.Since(deployed).Round(time.Second); !deployed.IsZero() && mergedProfile.NewestAge() > deployAge {
+				err := fmt.Errorf("all merged profiles predate the latest deployment %s ago, they may not reflect the current version", deployAge)
+				if failOn[pgo.ErrorClassStale] {
+					return pgo.WithErrorClass(err, pgo.ErrorClassStale)
+				}
+				log.Warn(err.Error(), "deployment-query", *deployF, "newest-profile-age", mergedProfile.NewestAge())
+			}
+		}
 
-// Samples returns the number of samples in the merged profile.
-func (p *MergedProfile) Samples() int {
-	return len(p.profile.Sample)
-}
+		// Report the versions of the profiles, and make sure that most of
+		// the cpu time comes from the current version if requested
+		if shares := mergedProfile.VersionShares(); len(shares) > 1 {
+			log.Info("merged profiles span multiple versions", "versions", formatVersionShares(shares))
+		}
+		if *majorityF > 0 {
+			if err := checkVersionMajority(mergedProfile, *majorityF); err != nil {
+				return pgo.WithErrorClass(err, pgo.ErrorClassStale)
+			}
+		}
 
-// DebugQuery returns a query string that can be used to view the profiles that
-// went into the merged profile.
-func (p *MergedProfile) DebugQuery() string {
-	return "profile-id:(" + strings.Join(p.profileIDs, " OR ") + ")"
-}
+		// Merge baseline profile, a failure is only fatal if -fail-on
+		// includes partial
+		if *baseURLF != "" {
+			base, err := pgo.FetchBaseline(ctx, httpClient, *baseURLF)
+			if err == nil {
+				err = mergedProfile.MergeBaseline(base, *baseWF)
+			}
+			if err != nil && failOn[pgo.ErrorClassPartial] {
+				return pgo.WithErrorClass(err, pgo.ErrorClassPartial)
+			} else if err != nil {
+				log.Warn("failed to merge baseline profile, continuing without it", "error", err)
+			} else {
+				log.Info("merged baseline profile", "baseline-url", *baseURLF, "weight", *baseWF)
+			}
+		}
 
-// ProfileDownload is the result of downloading a profile.
-type ProfileDownload struct {
-	data []byte
-}
+		// Make sure that the new profile doesn't diverge too much from the
+		// existing DEST, e.g. because a query matches the wrong service
+		if *driftF > 0 {
+			if err := checkDrift(log, mergedProfile, dst, *driftF, *driftWF); err != nil {
+				return err
+			}
+		}
 
-// ExtractCPUProfile extracts the CPU profile from the download.
-func (d ProfileDownload) ExtractCPUProfile() ([]byte, error) {
-	zr, err := zip.NewReader(bytes.NewReader(d.data), int64(len(d.data)))
-	if err != nil {
-		return nil, err
-	}
-	for _, f := range zr.File {
-		if filepath.Base(f.Name) == "cpu.pprof" {
-			rc, err := f.Open()
+		// Merge the existing DEST file, it doesn't exist on the first run
+		if *updateF {
+			prev, err := pgo.ReadProfile(dst)
+			if errors.Is(err, fs.ErrNotExist) {
+				log.Info("no existing DEST to update, writing new profile", "path", dst)
+			} else if err != nil {
+				return err
+			} else if err := mergedProfile.MergePrevious(prev, *updShareF); err != nil {
+				return err
+			} else {
+				log.Info("merged existing DEST", "path", dst, "update-share", *updShareF)
+			}
+		}
+
+		// Set time fields
+		if err := mergedProfile.SetTimes(*timesF, start); err != nil {
+			return err
+		}
+
+		// Report skipped profiles
+		mergedProfile.LogSkipSummary(log)
+
+		// Report trimmed data
+		if *depthF > 0 {
+			stats := mergedProfile.TrimStats()
+			log.Info("truncated deep stacks", "frames", stats.Frames, "locations", stats.Locations, "bytes-saved", stats.Bytes)
+		}
+		if *preTopF > 0 {
+			log.Info("pre-aggregated profiles", "top", *preTopF, "samples-dropped", mergedProfile.TrimStats().Samples)
+		}
+
+		// Collapse runtime frames
+		if *pruneRtF {
+			stats, err := mergedProfile.PruneRuntimeFrames()
 			if err != nil {
-				return nil, err
+				return err
 			}
-			defer rc.Close()
-			return io.ReadAll(rc)
+			log.Info(
+				"collapsed runtime frames",
+				"frames", stats.Frames,
+				"samples", stats.Samples,
+				"functions", stats.Functions,
+				"bytes-before", stats.BytesBefore,
+				"bytes-after", stats.BytesAfter,
+			)
 		}
-	}
 
-	return nil, errors.New("no cpu.pprof found in download")
-}
+		// Drop samples from other modules
+		if *moduleF != "" {
+			stats, err := mergedProfile.FilterModules(strings.Fields(strings.ReplaceAll(*moduleF, ",", " ")))
+			if err != nil {
+				return err
+			}
+			log.Info(
+				"dropped samples from other modules",
+				"samples", stats.Samples,
+				"functions", stats.Functions,
+				"bytes-before", stats.BytesBefore,
+				"bytes-after", stats.BytesAfter,
+			)
+		}
 
-// ProfilesDownload is the result of downloading several profiles from the pgo
-// endpoint.
-type ProfilesDownload struct {
-	data []byte
-}
+		// Drop samples of denied functions, or without allowed functions
+		if len(dropFuncF) > 0 || len(onlyFuncF) > 0 {
+			stats, err := mergedProfile.FilterFunctions(onlyFuncF, dropFuncF)
+			if err != nil {
+				return err
+			}
+			log.Info(
+				"dropped samples of -drop-function or without -only-function",
+				"samples", stats.Samples,
+				"functions", stats.Functions,
+				"bytes-before", stats.BytesBefore,
+				"bytes-after", stats.BytesAfter,
+			)
+		}
 
-// MergeProfile merges the profiles in the download into a single profile.
-func (d *ProfilesDownload) MergedProfile(log *slog.Logger) (*MergedProfile, error) {
-	zr, err := zip.NewReader(bytes.NewReader(d.data), int64(len(d.data)))
-	if err != nil {
-		return nil, err
-	}
+		// Prune cold functions
+		if *pruneF > 0 {
+			stats, err := mergedProfile.PruneBelowPercent(*pruneF)
+			if err != nil {
+				return err
+			}
+			log.Info(
+				"pruned cold functions",
+				"samples", stats.Samples,
+				"functions", stats.Functions,
+				"bytes-before", stats.BytesBefore,
+				"bytes-after", stats.BytesAfter,
+			)
+		}
 
-	var pgoProfile = &MergedProfile{}
-	for _, f := range zr.File {
-		rc, err := f.Open()
-		if err != nil {
-			return nil, err
+		// Trim samples with cold functions
+		if *trimThF > 0 {
+			stats, err := mergedProfile.PruneNodeFraction(*trimThF)
+			if err != nil {
+				return err
+			}
+			log.Info(
+				"trimmed cold samples",
+				"samples", stats.Samples,
+				"functions", stats.Functions,
+				"bytes-before", stats.BytesBefore,
+				"bytes-after", stats.BytesAfter,
+			)
 		}
-		prof, err := profile.Parse(rc)
-		if err != nil {
-			return nil, err
+
+		// Apply no inline hack
+		if err := mergedProfile.ApplyNoInlineHack(noInlineF...); err != nil {
+			return err
 		}
-		if err := pgoProfile.Merge(f.Name, prof); err != nil {
-			return nil, err
+
+		// Strip file/line information
+		if *stripF {
+			before, after, err := mergedProfile.StripLines()
+			if err != nil {
+				return err
+			}
+			log.Info("stripped file and line information", "bytes-before", before, "bytes-after", after)
 		}
 
-		seconds := prof.TimeNanos / int64(time.Second)
-		nanoseconds := prof.TimeNanos % int64(time.Second)
-		t := time.Unix(seconds, nanoseconds)
+		// Trim samples with cold functions until the profile is small enough
+		if *maxSizeF > 0 {
+			stats, fraction, err := mergedProfile.PruneToSize(*maxSizeF)
+			if err != nil {
+				return fmt.Errorf("-max-size: %w", err)
+			} else if fraction > 0 {
+				log.Info(
+					"trimmed cold samples to fit -max-size",
+					"trim-threshold", fraction,
+					"samples", stats.Samples,
+					"functions", stats.Functions,
+					"bytes-before", stats.BytesBefore,
+					"bytes-after", stats.BytesAfter,
+				)
+			}
+		}
 
-		cores, err := cpuCores(prof)
-		if err != nil {
-			log.Warn("failed to extract cpu cores", "error", err)
+		// Check that there is enough data
+		var (
+			totalSamples int64
+			totalCPU     time.Duration
+		)
+		if *typeF == pgo.ProfileTypeCPU {
+			if totalSamples, totalCPU, err = mergedProfile.Totals(); err != nil {
+				return err
+			}
 		}
+		if problem := checkMinData(totalSamples, totalCPU, *minSampF, *minCPUF); problem != "" && *minWarnF {
+			log.Warn("the merged profile contains little data, PGO might not be effective", "problem", problem)
+		} else if problem != "" {
+			return pgo.WithErrorClass(fmt.Errorf("refusing to write PGO file: %s", problem), pgo.ErrorClassEmpty)
+		}
+
+		// Embed the debug query, it's reported by the inspect subcommand
+		mergedProfile.SetDebugQueryComment()
 
+		// Writing pgo file to dst, or to a temporary file that is uploaded to
+		// dst if it's an object storage URL
+		writePath := dst
+		if isRemoteDest(dst) {
+			tmpDir, err := os.MkdirTemp("", name)
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(tmpDir)
+			writePath = filepath.Join(tmpDir, path.Base(dst))
+		}
+		n, err := mergedProfile.WriteLevel(writePath, fileMode, *levelF)
+		if err != nil {
+			return err
+		}
+		if writePath != dst {
+			if err := upload(ctx, writePath, dst); err != nil {
+				return err
+			}
+			log.Info("uploaded PGO file", "url", dst)
+		}
+		if *digestF {
+			digest, err := writeDigest(writePath, writePath+digestSuffix, dst)
+			if err != nil {
+				return fmt.Errorf("write digest: %w", err)
+			} else if writePath != dst {
+				if err := upload(ctx, writePath+digestSuffix, dst+digestSuffix); err != nil {
+					return err
+				}
+			}
+			log.Info("wrote PGO file digest", "path", dst+digestSuffix, "sha256", digest)
+		}
+		if *pickupF && writePath == dst {
+			problems, err := verifyPickup(dst)
+			if err != nil {
+				return err
+			}
+			for _, problem := range problems {
+				log.Warn("PGO file will not be used by go build", "path", dst, "problem", problem)
+			}
+		}
+		if *historyF != "" {
+			historyDir := *historyF
+			if len(outputs) > 1 {
+				historyDir = filepath.Join(historyDir, historyName(dst))
+			}
+			histPath, pruned, err := mergedProfile.WriteHistory(historyDir, *keepF, start)
+			if err != nil {
+				return err
+			}
+			log.Info("wrote PGO history file", "path", histPath, "pruned", len(pruned))
+		}
+		if *manifestF {
+			manifest := newManifest(dst, queries, localFiles, mergedProfile)
+			manifest.BaselineURL, manifest.Updated = *baseURLF, *updateF
+			manifest.Samples, manifest.CPUSamples, manifest.CPUSeconds = mergedProfile.Samples(), totalSamples, totalCPU.Seconds()
+			if usedFallback {
+				manifest.FallbackQuery = *fallbackF
+			}
+			if err := manifest.WriteFile(writePath + manifestSuffix); err != nil {
+				return fmt.Errorf("write manifest: %w", err)
+			} else if writePath != dst {
+				if err := upload(ctx, writePath+manifestSuffix, dst+manifestSuffix); err != nil {
+					return err
+				}
+			}
+		}
+		if *attestF {
+			digest, err := fileSHA256(writePath)
+			if err != nil {
+				return err
+			}
+			manifest := newManifest(dst, queries, localFiles, mergedProfile)
+			manifest.BaselineURL = *baseURLF
+			if usedFallback {
+				manifest.FallbackQuery = *fallbackF
+			}
+			attestation, err := newAttestation(manifest, digest, start, time.Now())
+			if err != nil {
+				return fmt.Errorf("attestation: %w", err)
+			} else if err := attestation.WriteFile(writePath + attestationSuffix); err != nil {
+				return fmt.Errorf("write attestation: %w", err)
+			}
+		}
+		if *signF {
+			signed := []string{""}
+			if *attestF {
+				signed = append(signed, attestationSuffix)
+			}
+			for _, suffix := range signed {
+				if err := sign(ctx, writePath+suffix, *signKeyF); err != nil {
+					return err
+				}
+			}
+			log.Info("signed PGO file", "path", dst, "bundle", dst+signatureSuffix)
+		}
+		if writePath != dst {
+			var suffixes []string
+			if *attestF {
+				suffixes = append(suffixes, attestationSuffix)
+			}
+			if *signF {
+				suffixes = append(suffixes, signatureSuffix)
+				if *attestF {
+					suffixes = append(suffixes, attestationSuffix+signatureSuffix)
+				}
+			}
+			for _, suffix := range suffixes {
+				if err := upload(ctx, writePath+suffix, dst+suffix); err != nil {
+					return err
+				}
+			}
+		}
+		if publishRef != "" {
+			annotations, err := publishAnnotations(queries, mergedProfile, start)
+			if err != nil {
+				return err
+			}
+			digest, err := publish(ctx, writePath, publishRef, annotations)
+			if err != nil {
+				return err
+			}
+			log.Info("published PGO file", "ref", *publishF, "digest", digest)
+		}
+		out.result.SetProfile(mergedProfile, n)
+		if checkpoint != nil {
+			checkpointMu.Lock()
+			checkpoint.Record(dst, cpKey, mergedProfile.ProfileIDs(), n)
+			err := checkpoint.Save(*checkF)
+			checkpointMu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
 		log.Info(
-			"extracted profile",
-			// "service", p.Service, TODO: can we get this?
-			"cpu-cores", float64(int(cores*10))/10,
-			"duration", time.Duration(prof.DurationNanos),
-			"age", time.Since(t).Round(time.Second),
-			"profile-id", f.Name,
+			"wrote PGO file",
+			"path", dst,
+			"samples", mergedProfile.Samples(),
+			"cpu-samples", totalSamples,
+			"cpu-seconds", totalCPU.Seconds(),
+			"bytes", n,
+			"total-duration", timeSinceRoundMS(start),
+			"oldest-profile-age", mergedProfile.OldestAge(),
+			"newest-profile-age", mergedProfile.NewestAge(),
+			"debug-query", mergedProfile.DebugQuery(),
 		)
-		if err := rc.Close(); err != nil {
-			return nil, err
+		if *sizeRepF {
+			size, err := pgo.ProfileSize(mergedProfile.Profile())
+			if err != nil {
+				return err
+			}
+			log.Info(
+				"PGO file size",
+				"path", dst,
+				"bytes", n,
+				"uncompressed-bytes", size.Uncompressed,
+				"samples", size.Samples,
+				"locations", size.Locations,
+				"functions", size.Functions,
+				"mappings", size.Mappings,
+			)
 		}
+		if *impactF {
+			impact, err := pgo.EstimateImpact(mergedProfile.Profile())
+			if err != nil {
+				return err
+			}
+			log.Info(
+				"estimated PGO impact",
+				"path", dst,
+				"call-edges", impact.CallEdges,
+				"hot-call-edges", impact.HotCallEdges,
+				"hot-threshold-percent", impact.HotThresholdPercent,
+				"hot-callers", impact.HotCallers,
+				"hot-callees", impact.HotCallees,
+				"hot-callee-cpu-percent", impact.HotCalleeCPUPercent,
+			)
+			if impact.HotCallEdges == 0 {
+				log.Warn("DEST has no hot call edges, PGO is unlikely to make a difference", "path", dst)
+			}
+		}
+		if age := mergedProfile.NewestAge(); *staleF > 0 && age > *staleF {
+			log.Warn("the newest merged profile is stale, check that your service is still being profiled", "newest-profile-age", age, "stale-after", *staleF)
+		}
+		if usedFallback {
+			log.Warn("PGO file was created from the fallback query, not from profiles matching QUERY", "fallback-query", *fallbackF)
+		}
+		return nil
 	}
 
-	return pgoProfile, nil
-}
+	// Report the progress until the outputs are written
+	if progress != nil {
+		progressCtx, stopProgress := context.WithCancel(ctx)
+		progressDone := make(chan struct{})
+		go func() {
+			defer close(progressDone)
+			progress.Run(progressCtx, log, *progressF)
+		}()
+		defer func() {
+			stopProgress()
+			<-progressDone
+		}()
+	}
 
-// cpuCores returns the number of CPU cores used in the profile.
-func cpuCores(prof *profile.Profile) (float64, error) {
-	cpuIdx := -1
-	for idx, st := range prof.SampleType {
-		if st.Type == "cpu" && st.Unit == "nanoseconds" {
-			cpuIdx = idx
-			break
-		}
+	// Write the outputs, concurrently if there are multiple
+	if len(outputs) == 1 {
+		return writeOutput(log, outputs[0])
 	}
-	if cpuIdx == -1 {
-		return 0, errors.New("no cpu sample type found")
+	// Some outputs failing while others succeed is a partial failure.
+	var failed atomic.Int32
+	p := pool.New().WithErrors()
+	for _, out := range outputs {
+		out := out
+		p.Go(func() error {
+			if err := writeOutput(log.With("output", out.dst), out); err != nil {
+				failed.Add(1)
+				return fmt.Errorf("%s: %w", out.dst, err)
+			}
+			return nil
+		})
 	}
-	var cpuNanos int64
-	for _, s := range prof.Sample {
-		if len(s.Value) <= int(cpuIdx) {
-			return 0, errors.New("invalid sample value")
-		}
-		cpuNanos += s.Value[cpuIdx]
+	if err := p.Wait(); err != nil && int(failed.Load()) < len(outputs) {
+		return pgo.WithErrorClass(err, pgo.ErrorClassPartial)
+	} else if err != nil {
+		return err
 	}
-	return float64(cpuNanos) / float64(prof.DurationNanos), nil
+	return nil
 }
 
-// wrapErr wraps the error with name if it is not nil.
-func wrapErr(err *error, name string) {
-	if *err != nil {
-		*err = fmt.Errorf("%s: %w", name, *err)
+// newLogger returns the logger writing to stdout, in json format if
+// jsonFormat is set. Debug logs and source locations are enabled by verbose.
+func newLogger(verbose, jsonFormat bool) *slog.Logger {
+	logOpt := &slog.HandlerOptions{AddSource: verbose}
+	if verbose {
+		logOpt.Level = slog.LevelDebug
 	}
+	if jsonFormat {
+		return slog.New(slog.NewJSONHandler(os.Stdout, logOpt))
+	}
+	return slog.New(tint.NewHandler(os.Stdout, &tint.Options{
+		AddSource:  logOpt.AddSource,
+		Level:      logOpt.Level,
+		TimeFormat: "",
+		NoColor:    !isatty.IsTerminal(os.Stdout.Fd()),
+	}))
 }
 
-// timeSinceRoundMS returns the time since t rounded to the nearest millisecond.
-func timeSinceRoundMS(t time.Time) time.Duration {
-	return time.Since(t) / time.Millisecond * time.Millisecond
-}
-
-// countingWriter counts the number of bytes written to W.
-type countingWriter struct {
-	W io.Writer
-	N int64
-}
-
-// Write writes p to W and updates N.
-func (c *countingWriter) Write(p []byte) (n int, err error) {
-	n, err = c.W.Write(p)
-	c.N += int64(n)
-	return
+// checkMinData returns a description of the problem if samples or cpu are
+// below the given minimums, or an empty string otherwise.
+func checkMinData(samples int64, cpu time.Duration, minSamples int64, minCPUSeconds float64) string {
+	if samples < minSamples {
+		return fmt.Sprintf("%d cpu samples is less than -min-samples %d", samples, minSamples)
+	} else if cpu.Seconds() < minCPUSeconds {
+		return fmt.Sprintf("%.1fs of cpu time is less than -min-cpu-seconds %g", cpu.Seconds(), minCPUSeconds)
+	}
+	return ""
 }
 
 // loggedError is an error that has been logged.
@@ -488,7 +1387,24 @@ type loggedError struct {
 	error
 }
 
+// Unwrap returns the logged error.
+func (e loggedError) Unwrap() error {
+	return e.error
+}
+
 // handledError is an error that has been handled.
 type handledError struct {
 	error
 }
+
+// wrapErr wraps the error with name if it is not nil.
+func wrapErr(err *error, name string) {
+	if *err != nil {
+		*err = fmt.Errorf("%s: %w", name, *err)
+	}
+}
+
+// timeSinceRoundMS returns the time since t rounded to the nearest millisecond.
+func timeSinceRoundMS(t time.Time) time.Duration {
+	return time.Since(t) / time.Millisecond * time.Millisecond
+}
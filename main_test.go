@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMinData(t *testing.T) {
+	require.Empty(t, checkMinData(100, time.Second, 0, 0))
+	require.Empty(t, checkMinData(100, time.Second, 100, 1))
+	require.Contains(t, checkMinData(99, time.Second, 100, 1), "-min-samples")
+	require.Contains(t, checkMinData(100, time.Second/2, 100, 1), "-min-cpu-seconds")
+}
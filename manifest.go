@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// manifestSchemaVersion is the version of the Manifest schema, see
+// resultSchemaVersion for when it must be bumped.
+const manifestSchemaVersion = 1
+
+// manifestSuffix is appended to DEST to get the path of its manifest, e.g.
+// "default.pgo.json".
+const manifestSuffix = ".json"
+
+// Manifest records the provenance of a DEST file written with -manifest, e.g.
+// for build auditing.
+type Manifest struct {
+	SchemaVersion int       `json:"schema_version"`
+	ToolVersion   string    `json:"tool_version"`
+	Output        string    `json:"output"`
+	Created       time.Time `json:"created"`
+	Queries       []string  `json:"queries"`
+	// FallbackQuery is set if DEST was created from -fallback-query instead of
+	// Queries.
+	FallbackQuery string    `json:"fallback_query,omitempty"`
+	LocalFiles    []string  `json:"local_files,omitempty"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	BaselineURL   string    `json:"baseline_url,omitempty"`
+	// Updated is true if the previous DEST was merged into DEST, see -update.
+	Updated    bool              `json:"updated"`
+	Samples    int               `json:"samples"`
+	CPUSamples int64             `json:"cpu_samples"`
+	CPUSeconds float64           `json:"cpu_seconds"`
+	Profiles   []pgo.ProfileInfo `json:"profiles"`
+}
+
+// newManifest returns the manifest for DEST dst merged from the profiles
+// matching queries and the given local files.
+func newManifest(dst string, queries []pgo.SearchQuery, localFiles []string, p *pgo.MergedProfile) *Manifest {
+	m := &Manifest{
+		SchemaVersion: manifestSchemaVersion,
+		ToolVersion:   version,
+		Output:        dst,
+		Created:       time.Now().UTC(),
+		Queries:       []string{},
+		LocalFiles:    localFiles,
+		Profiles:      append([]pgo.ProfileInfo{}, p.ProfileInfos()...),
+	}
+	seen := map[string]bool{}
+	for i, q := range queries {
+		// A query searched with multiple sort fields is only recorded once.
+		if !seen[q.Filter.Query] {
+			seen[q.Filter.Query] = true
+			m.Queries = append(m.Queries, q.Filter.Query)
+		}
+		if i == 0 || q.Filter.From.Before(m.From) {
+			m.From = q.Filter.From.UTC()
+		}
+		if i == 0 || q.Filter.To.After(m.To) {
+			m.To = q.Filter.To.UTC()
+		}
+	}
+	sort.Slice(m.Profiles, func(i, j int) bool { return m.Profiles[i].ID < m.Profiles[j].ID })
+	return m
+}
+
+// WriteFile writes the manifest as JSON to path.
+func (m *Manifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
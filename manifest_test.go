@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestManifest(t *testing.T) {
+	queries, err := pgo.BuildQueries(time.Hour, 5, sortFlag{"@metrics.core_cpu_cores", "timestamp"}, []string{"service:foo", "service:bar"})
+	require.NoError(t, err)
+	m := newManifest("default.pgo", queries, nil, pgo.NewMergedProfile(pgo.MergeOptions{}))
+	require.Equal(t, []string{"service:foo runtime:go", "service:bar runtime:go"}, m.Queries)
+	require.Equal(t, time.Hour, m.To.Sub(m.From).Round(time.Minute))
+
+	path := filepath.Join(t.TempDir(), "default.pgo"+manifestSuffix)
+	require.NoError(t, m.WriteFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, float64(manifestSchemaVersion), decoded["schema_version"])
+	require.Equal(t, []any{}, decoded["profiles"])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// runMerge implements the merge subcommand. It merges local pprof files into
+// a single PGO file without using the Datadog API.
+func runMerge(args []string, _ io.Writer) error {
+	fs := flag.NewFlagSet(name+" merge", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: `+name+` merge [OPTIONS]... FILE... DEST
+
+merge merges the local pprof files matching the glob patterns FILE into a
+single DEST file suitable for profile-guided optimization, e.g.:
+
+	`+name+` merge './profiles/*.pprof' ./cmd/my-service/default.pgo
+
+Invalid profiles are skipped, but a pattern without any matches is an error.
+No Datadog credentials are needed.
+
+OPTIONS`)
+		fs.PrintDefaults()
+	}
+	mergeOpF := fs.String("merge-op", pgo.MergeOpSum, "how to combine the values of identical stacks across profiles: sum, max or avg")
+	stripF := fs.Bool("strip-lines", false, "strip file names and make line numbers function-relative to shrink DEST")
+	chmodF := fs.String("chmod", "", "set the permissions of DEST to this octal mode, e.g. 0640 (default 0666 minus the umask)")
+	levelF := fs.Int("compression-level", pgo.DefaultCompressionLevel, "the gzip compression level of DEST from 1 (fastest) to 9 (smallest), 0 writes it uncompressed, -1 uses the default level")
+	verboseF := fs.Bool("v", false, "verbose output")
+	jsonF := fs.Bool("json", false, "print logs in json format")
+	var noInlineF regexpFlag
+	fs.Var(&noInlineF, "noinline-func", "prevent inlining of the functions whose names match this regular expression, in addition to the built-in ones, can be repeated")
+	var dropFuncF, onlyFuncF regexpFlag
+	fs.Var(&dropFuncF, "drop-function", "drop the samples whose stack contains a function matching this regular expression from DEST, so PGO ignores its calls, can be repeated")
+	fs.Var(&onlyFuncF, "only-function", "only keep the samples whose stack contains a function matching this regular expression in DEST, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("merge requires at least 2 arguments")
+	}
+	switch *mergeOpF {
+	case pgo.MergeOpSum, pgo.MergeOpMax, pgo.MergeOpAvg:
+	default:
+		return fmt.Errorf("invalid -merge-op: %q", *mergeOpF)
+	}
+	var fileMode os.FileMode
+	if *chmodF != "" {
+		var err error
+		if fileMode, err = parseFileMode(*chmodF); err != nil {
+			return fmt.Errorf("invalid -chmod: %w", err)
+		}
+	}
+
+	log := newLogger(*verboseF, *jsonF)
+	patterns, dst := fs.Args()[:fs.NArg()-1], fs.Arg(fs.NArg()-1)
+	mergedProfile := pgo.NewMergedProfile(pgo.MergeOptions{MergeOp: *mergeOpF})
+	if err := mergedProfile.MergeFiles(log, patterns); err != nil {
+		return err
+	} else if len(mergedProfile.ProfileIDs()) == 0 {
+		return pgo.ErrNoProfiles
+	} else if err := mergedProfile.ApplyMergeOp(); err != nil {
+		return err
+	} else if err := mergedProfile.ApplyNoInlineHack(noInlineF...); err != nil {
+		return err
+	}
+	mergedProfile.LogSkipSummary(log)
+	if len(dropFuncF) > 0 || len(onlyFuncF) > 0 {
+		stats, err := mergedProfile.FilterFunctions(onlyFuncF, dropFuncF)
+		if err != nil {
+			return err
+		}
+		log.Info("dropped samples of -drop-function or without -only-function", "samples", stats.Samples, "functions", stats.Functions)
+	}
+	if *stripF {
+		before, after, err := mergedProfile.StripLines()
+		if err != nil {
+			return err
+		}
+		log.Info("stripped file and line information", "bytes-before", before, "bytes-after", after)
+	}
+
+	n, err := mergedProfile.WriteLevel(dst, fileMode, *levelF)
+	if err != nil {
+		return err
+	}
+	log.Info("wrote PGO file", "path", dst, "bytes", n, "profiles", len(mergedProfile.ProfileIDs()), "samples", mergedProfile.Samples())
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestRunMerge(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "default.pgo")
+	require.NoError(t, runMerge([]string{"-strip-lines", "pgo/testdata/*.pprof", dst}, io.Discard))
+	prof, err := pgo.ReadProfile(dst)
+	require.NoError(t, err)
+	require.NotEmpty(t, prof.Sample)
+
+	require.ErrorContains(t, runMerge([]string{"pgo/testdata/missing-*.pprof", dst}, io.Discard), "no files match")
+	require.ErrorContains(t, runMerge([]string{"-merge-op", "min", "pgo/testdata/*.pprof", dst}, io.Discard), "-merge-op")
+}
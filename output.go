@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// output is a DEST file and the arguments used to create it.
+type output struct {
+	dst        string
+	queries    []pgo.SearchQuery
+	localFiles []string
+	result     *Result
+}
+
+// newOutput returns the output for the QUERY... DEST arguments args after
+// expanding environment variables.
+func newOutput(args []string, window time.Duration, limit int, sorts []string) (*output, error) {
+	args, err := expandEnvAll(args)
+	if err != nil {
+		return nil, err
+	}
+	localFiles, queryArgs := pgo.SplitLocalArgs(args[:len(args)-1])
+	queries, err := pgo.BuildQueries(window, limit, sorts, queryArgs)
+	if err != nil {
+		return nil, err
+	}
+	dst := args[len(args)-1]
+	return &output{dst: dst, queries: queries, localFiles: localFiles, result: newResult(queries, dst)}, nil
+}
+
+// addQueries adds queries to the output and its result.
+func (o *output) addQueries(queries []pgo.SearchQuery) {
+	o.setQueries(append(o.queries, queries...))
+}
+
+// setQueries replaces the queries of the output and its result.
+func (o *output) setQueries(queries []pgo.SearchQuery) {
+	o.queries = queries
+	o.result.setQueries(o.queries)
+}
+
+// logQueryWarnings logs the pgo.QueryWarnings of the distinct queries of
+// outputs.
+func logQueryWarnings(log *slog.Logger, outputs []*output) {
+	seen := map[string]bool{}
+	for _, o := range outputs {
+		for _, q := range o.queries {
+			if seen[q.Filter.Query] {
+				continue
+			}
+			seen[q.Filter.Query] = true
+			for _, w := range pgo.QueryWarnings(q.Filter.Query) {
+				log.Warn(w, "query", q.Filter.Query)
+			}
+		}
+	}
+}
+
+// needsClient returns true if any of the outputs has queries.
+func needsClient(outputs []*output) bool {
+	for _, o := range outputs {
+		if len(o.queries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// needsSavedSearch returns true if any of the outputs has neither queries nor
+// local files, so it depends on the saved search.
+func needsSavedSearch(outputs []*output) bool {
+	for _, o := range outputs {
+		if len(o.queries) == 0 && len(o.localFiles) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// historyName returns the name of the -history-dir subdirectory used for dst
+// when writing multiple outputs, e.g. "cmd_foo_default.pgo" for
+// "./cmd/foo/default.pgo".
+func historyName(dst string) string {
+	name := strings.TrimLeft(filepath.ToSlash(filepath.Clean(dst)), "./")
+	return strings.NewReplacer("/", "_", ":", "_").Replace(name)
+}
+
+// discoverOutput returns the output for a service found by -discover. Its DEST
+// is the template with {service} replaced by the service name, relative to dir.
+func discoverOutput(dir, template, filter, service string, window time.Duration, limit int, sorts []string) (*output, error) {
+	rel := strings.ReplaceAll(template, "{service}", service)
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return nil, fmt.Errorf("service %q: %q is not a local path", service, rel)
+	}
+	queries, err := pgo.BuildQueries(window, limit, sorts, []string{"service:" + service + " " + filter})
+	if err != nil {
+		return nil, err
+	}
+	dst := joinDest(dir, rel)
+	return &output{dst: dst, queries: queries, result: newResult(queries, dst)}, nil
+}
+
+// outputsResult returns the result of a run writing outputs. A single output
+// reports its result directly.
+func outputsResult(outputs []*output) *Result {
+	if len(outputs) == 1 {
+		return outputs[0].result
+	}
+	result := newResult(nil, "")
+	for _, out := range outputs {
+		result.Outputs = append(result.Outputs, out.result)
+	}
+	return result
+}
+
+// excludeFilter returns the query filter excluding the profiles matching
+// query, e.g. "-(pod_name:canary-* OR availability-zone:us-east-1d)".
+func excludeFilter(query string) string {
+	return "-(" + strings.TrimSpace(query) + ")"
+}
+
+// versionTagFilter returns the query filter for the -version-tag value tag,
+// which may omit the "version:" prefix.
+func versionTagFilter(tag string) string {
+	if strings.HasPrefix(tag, "version:") {
+		return tag
+	}
+	return "version:" + tag
+}
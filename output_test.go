@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverOutput(t *testing.T) {
+	out, err := discoverOutput("profiles", "{service}/default.pgo", "env:prod", "billing", time.Hour, 5, nil)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("profiles", "billing", "default.pgo"), out.dst)
+	require.Len(t, out.queries, 1)
+	require.Equal(t, "service:billing env:prod runtime:go", out.queries[0].Filter.Query)
+
+	_, err = discoverOutput("profiles", "{service}/default.pgo", "env:prod", "../billing", time.Hour, 5, nil)
+	require.ErrorContains(t, err, "not a local path")
+}
+
+func TestExcludeFilter(t *testing.T) {
+	require.Equal(t, "-(pod_name:canary-* OR availability-zone:us-east-1d)", excludeFilter(" pod_name:canary-* OR availability-zone:us-east-1d "))
+}
+
+func TestVersionTagFilter(t *testing.T) {
+	require.Equal(t, "version:v1.42.0", versionTagFilter("v1.42.0"))
+	require.Equal(t, "version:v1.42.0", versionTagFilter("version:v1.42.0"))
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// parseFileMode parses an octal permission mode like "0640" or "644".
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q: must be an octal number between 0 and 0777", s)
+	}
+	return os.FileMode(mode), nil
+}
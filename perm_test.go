@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileMode(t *testing.T) {
+	mode, err := parseFileMode("0640")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), mode)
+	mode, err = parseFileMode("755")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), mode)
+	for _, s := range []string{"", "rw-r--r--", "0888", "01777", "-1"} {
+		_, err := parseFileMode(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,98 @@
+package pgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauthTokenPath is the path of the Datadog OAuth token endpoint on the api
+// subdomain of the site.
+const oauthTokenPath = "/oauth2/v1/token"
+
+// oauthExpiryMargin is how long before its expiry an OAuth token is renewed.
+const oauthExpiryMargin = time.Minute
+
+// setAuth sets the authentication headers of req. A bearer token or OAuth
+// client credentials take precedence over the application key.
+func (c *Client) setAuth(ctx context.Context, req *http.Request) error {
+	switch {
+	case c.oauth != nil:
+		token, err := c.oauth.token(ctx, c.httpClient())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	default:
+		req.Header.Set("DD-APPLICATION-KEY", c.appKey)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("DD-API-KEY", c.apiKey)
+	}
+	return nil
+}
+
+// oauthClient fetches access tokens using the OAuth client credentials grant
+// and caches them until shortly before they expire.
+type oauthClient struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// token returns a valid access token, fetching a new one using hc if needed.
+func (o *oauthClient) token(ctx context.Context, hc *http.Client) (token string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.accessToken != "" && time.Now().Before(o.expiry) {
+		return o.accessToken, nil
+	}
+	defer wrapErr(&err, "oauth token")
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", Name+"/"+Version)
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+	res, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", responseError(res)
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", err
+	} else if response.AccessToken == "" {
+		return "", errors.New("response has no access_token")
+	}
+	o.accessToken = response.AccessToken
+	o.expiry = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - oauthExpiryMargin)
+	return o.accessToken, nil
+}
+
+// oauthTokenURL returns the OAuth token endpoint for site.
+func oauthTokenURL(site string) string {
+	return fmt.Sprintf("https://api.%s%s", site, oauthTokenPath)
+}
@@ -0,0 +1,86 @@
+package pgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAuth(t *testing.T) {
+	var tokenRequests atomic.Int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+		id, secret, _ := r.BasicAuth()
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		if id != "my-id" || secret != "my-secret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "oauth-token", "expires_in": 3600}`)
+	}))
+	defer tokenSrv.Close()
+
+	// An empty config file prevents reading ~/.datadog/datadog.yaml
+	emptyConfig := filepath.Join(t.TempDir(), "datadog.yaml")
+	require.NoError(t, os.WriteFile(emptyConfig, nil, 0600))
+
+	var headers http.Header
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.Write([]byte("ok"))
+	}))
+	defer apiSrv.Close()
+
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		want map[string]string
+	}{
+		{
+			name: "keys",
+			env:  map[string]string{"DD_API_KEY": "api", "DD_APP_KEY": "app"},
+			want: map[string]string{"DD-API-KEY": "api", "DD-APPLICATION-KEY": "app", "Authorization": ""},
+		},
+		{
+			name: "bearer",
+			env:  map[string]string{"DD_BEARER_TOKEN": "bearer"},
+			want: map[string]string{"DD-API-KEY": "", "DD-APPLICATION-KEY": "", "Authorization": "Bearer bearer"},
+		},
+		{
+			name: "oauth",
+			env:  map[string]string{"DD_OAUTH_CLIENT_ID": "my-id", "DD_OAUTH_CLIENT_SECRET": "my-secret", "DD_OAUTH_TOKEN_URL": tokenSrv.URL},
+			want: map[string]string{"DD-APPLICATION-KEY": "", "Authorization": "Bearer oauth-token"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"DD_API_KEY", "DD_APP_KEY", "DD_BEARER_TOKEN", "DD_OAUTH_CLIENT_ID", "DD_OAUTH_CLIENT_SECRET", "DD_OAUTH_TOKEN_URL"} {
+				t.Setenv(key, tc.env[key])
+			}
+			c, err := ClientFromEnvAndConfig(emptyConfig)
+			require.NoError(t, err)
+			c.baseURL = apiSrv.URL
+			for i := 0; i < 2; i++ {
+				_, err = c.get(context.Background(), "/")
+				require.NoError(t, err)
+				for key, value := range tc.want {
+					require.Equal(t, value, headers.Get(key), key)
+				}
+			}
+		})
+	}
+	require.Equal(t, int32(1), tokenRequests.Load(), "the oauth token must be cached")
+
+	t.Setenv("DD_BEARER_TOKEN", "")
+	t.Setenv("DD_OAUTH_CLIENT_ID", "my-id")
+	t.Setenv("DD_OAUTH_CLIENT_SECRET", "")
+	_, err := ClientFromEnvAndConfig(emptyConfig)
+	require.ErrorContains(t, err, "must both be set")
+}
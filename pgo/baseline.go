@@ -0,0 +1,84 @@
+package pgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// maxBaselineBytes is the maximum size of a baseline profile.
+const maxBaselineBytes = 256 << 20
+
+// FetchBaseline downloads the pprof file at url using hc, or
+// http.DefaultClient if hc is nil.
+func FetchBaseline(ctx context.Context, hc *http.Client, url string) (prof *profile.Profile, err error) {
+	defer wrapErr(&err, "fetch baseline")
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", Name+"/"+Version)
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		return nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxBaselineBytes+1))
+	if err != nil {
+		return nil, err
+	} else if len(data) > maxBaselineBytes {
+		return nil, fmt.Errorf("baseline is larger than %d bytes", maxBaselineBytes)
+	}
+	return profile.ParseData(data)
+}
+
+// MergeBaseline merges the baseline profile base into the merged profile. If
+// weight is greater than zero, base is scaled so that its total cpu time is
+// weight times the cpu time of the merged profile before merging. Otherwise
+// base is merged as-is.
+func (p *MergedProfile) MergeBaseline(base *profile.Profile, weight float64) (err error) {
+	defer wrapErr(&err, "merge baseline")
+	return p.mergeScaled(base, weight)
+}
+
+// mergeScaled merges base into the merged profile after scaling it to weight
+// times the cpu time of the merged profile, or as-is if weight is zero.
+func (p *MergedProfile) mergeScaled(base *profile.Profile, weight float64) error {
+	for _, s := range base.Sample {
+		s.Label = nil
+	}
+	if _, err := trimProfile(base, p.opts); err != nil {
+		return err
+	}
+	if weight > 0 {
+		baseCPU, err := totalCPUNanos(base)
+		if err != nil {
+			return err
+		}
+		freshCPU, err := totalCPUNanos(p.profile)
+		if err != nil {
+			return err
+		}
+		if baseCPU > 0 {
+			base.Scale(weight * freshCPU / baseCPU)
+		}
+	}
+	merged, err := profile.Merge([]*profile.Profile{p.profile, base})
+	if err != nil {
+		return err
+	}
+	p.profile = merged
+	return nil
+}
@@ -0,0 +1,41 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseline(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 3e7}).Write(&buf))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/default.pgo" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	_, err := FetchBaseline(context.Background(), nil, srv.URL+"/missing.pgo")
+	require.ErrorContains(t, err, "404")
+
+	for _, tc := range []struct {
+		weight float64
+		want   map[string][]int64
+	}{
+		{0, map[string][]int64{"main;foo": {4, 4e7}, "main;bar": {1, 1e7}}},
+		{0.5, map[string][]int64{"main;foo": {2, 2e7}, "main;bar": {1, 1e7}}},
+	} {
+		base, err := FetchBaseline(context.Background(), nil, srv.URL+"/default.pgo")
+		require.NoError(t, err)
+		mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{"main;foo": 1e7, "main;bar": 1e7})}
+		require.NoError(t, mp.MergeBaseline(base, tc.weight))
+		require.Equal(t, tc.want, stackValues(mp.profile), "weight %v", tc.weight)
+	}
+}
@@ -0,0 +1,87 @@
+package pgo
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Names of the files in a bundle written by WriteBundle.
+const (
+	bundleEntryName   = "bundle.json"
+	bundleProfileName = "profile.pprof"
+)
+
+// WriteBundle writes the merged profile p and its metadata to a zip archive
+// at dst that can be read by ReadBundle, e.g. on a machine without access to
+// the Datadog API. Like Write, it replaces dst atomically.
+func (p *MergedProfile) WriteBundle(dst string, usedFallback bool, now time.Time) (err error) {
+	defer wrapErr(&err, "write bundle")
+	file, err := createTemp(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	zw := zip.NewWriter(file)
+	w, err := zw.Create(bundleEntryName)
+	if err != nil {
+		return err
+	} else if err := json.NewEncoder(w).Encode(newCacheEntry(p, usedFallback, now)); err != nil {
+		return err
+	}
+	if w, err = zw.Create(bundleProfileName); err != nil {
+		return err
+	}
+	normalizeProfile(p.profile)
+	if err := p.profile.Write(w); err != nil {
+		return err
+	} else if err := zw.Close(); err != nil {
+		return err
+	} else if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), dst)
+}
+
+// ReadBundle reads the merged profile written by WriteBundle to path. It
+// returns the profile and whether it was fetched using the fallback query.
+func ReadBundle(path string, opts MergeOptions) (p *MergedProfile, usedFallback bool, err error) {
+	defer wrapErr(&err, "read bundle")
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer zr.Close()
+
+	var entry cacheEntry
+	f, err := zr.Open(bundleEntryName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&entry); err != nil {
+		return nil, false, err
+	} else if entry.Version != cacheVersion {
+		return nil, false, fmt.Errorf("unsupported bundle version %d, it was written by a different version of %s", entry.Version, Name)
+	}
+	f, err = zr.Open(bundleProfileName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry.mergedProfile(prof, opts), entry.UsedFallback, nil
+}
@@ -0,0 +1,31 @@
+package pgo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle(t *testing.T) {
+	mp := NewMergedProfile(MergeOptions{})
+	require.NoError(t, mp.Merge("a", newTestProfile(t, map[string]int64{"main;foo": 1e7})))
+	require.NoError(t, mp.Merge("b", newTestProfile(t, map[string]int64{"main;bar": 2e7})))
+	mp.countQuery("service:foo")
+
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	require.NoError(t, mp.WriteBundle(path, true, time.Now()))
+	p, usedFallback, err := ReadBundle(path, MergeOptions{})
+	require.NoError(t, err)
+	require.True(t, usedFallback)
+	require.Equal(t, []string{"a", "b"}, p.profileIDs)
+	require.Equal(t, map[string]int{"service:foo": 1}, p.queryProfiles)
+	require.Equal(t, mp.newest.UnixNano(), p.newest.UnixNano())
+	require.Equal(t, stackValues(mp.profile), stackValues(p.profile))
+
+	require.NoError(t, os.WriteFile(path, []byte("not a zip"), 0644))
+	_, _, err = ReadBundle(path, MergeOptions{})
+	require.ErrorContains(t, err, "read bundle")
+}
@@ -0,0 +1,225 @@
+package pgo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// cacheVersion is the version of the cache entry format. Entries with a
+// different version are ignored.
+const cacheVersion = 2
+
+// Cache stores merged profiles on disk, so repeated runs with the same
+// arguments can skip searching and downloading profiles.
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// cacheEntry holds the metadata of a cached merged profile. The profile itself
+// is stored in a separate pprof file next to it.
+type cacheEntry struct {
+	Version       int            `json:"version"`
+	Created       time.Time      `json:"created"`
+	ProfileIDs    []string       `json:"profile_ids"`
+	ProfileInfos  []ProfileInfo  `json:"profile_infos"`
+	QueryProfiles map[string]int `json:"query_profiles"`
+	TrimStats     TrimStats      `json:"trim_stats"`
+	Oldest        time.Time      `json:"oldest"`
+	Newest        time.Time      `json:"newest"`
+	DurationSum   int64          `json:"duration_sum"`
+	DurationMax   int64          `json:"duration_max"`
+	Skipped       int            `json:"skipped"`
+	UsedFallback  bool           `json:"used_fallback"`
+}
+
+// newCacheEntry returns the entry for the merged profile p.
+func newCacheEntry(p *MergedProfile, usedFallback bool, now time.Time) cacheEntry {
+	return cacheEntry{
+		Version:       cacheVersion,
+		Created:       now.UTC(),
+		ProfileIDs:    p.profileIDs,
+		ProfileInfos:  p.profileInfos,
+		QueryProfiles: p.queryProfiles,
+		TrimStats:     p.trimStats,
+		Oldest:        p.oldest,
+		Newest:        p.newest,
+		DurationSum:   p.durationSum,
+		DurationMax:   p.durationMax,
+		Skipped:       p.skipped,
+		UsedFallback:  usedFallback,
+	}
+}
+
+// mergedProfile returns the merged profile described by the entry, using prof
+// as its profile.
+func (e *cacheEntry) mergedProfile(prof *profile.Profile, opts MergeOptions) *MergedProfile {
+	p := NewMergedProfile(opts)
+	p.profile = prof
+	p.profileIDs = e.ProfileIDs
+	p.profileInfos = e.ProfileInfos
+	p.queryProfiles = e.QueryProfiles
+	p.trimStats = e.TrimStats
+	p.oldest = e.Oldest
+	p.newest = e.Newest
+	p.durationSum = e.DurationSum
+	p.durationMax = e.DurationMax
+	p.skipped = e.Skipped
+	return p
+}
+
+// NewCache returns a cache storing its entries in dir for ttl. An empty dir
+// uses a datadog-pgo directory in the user cache directory, e.g.
+// ~/.cache/datadog-pgo on Linux.
+func NewCache(dir string, ttl time.Duration) (*Cache, error) {
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userDir, Name)
+	}
+	return &Cache{dir: dir, ttl: ttl}, nil
+}
+
+// Dir returns the directory holding the cache entries.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Load returns the merged profile cached under key and whether it was fetched
+// using the fallback query. It returns a nil profile if there is no entry for
+// key or if it has expired.
+func (c *Cache) Load(key string, opts MergeOptions, now time.Time) (p *MergedProfile, usedFallback bool, err error) {
+	defer wrapErr(&err, "load cache")
+	data, err := os.ReadFile(c.path(key, ".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+	if entry.Version != cacheVersion || now.Sub(entry.Created) > c.ttl {
+		return nil, false, nil
+	}
+	prof, err := readProfile(c.path(key, ".pprof"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return entry.mergedProfile(prof, opts), entry.UsedFallback, nil
+}
+
+// Store caches the merged profile p under key and removes expired entries.
+func (c *Cache) Store(key string, p *MergedProfile, usedFallback bool, now time.Time) (err error) {
+	defer wrapErr(&err, "store cache")
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	// The profile is written first, so an entry is never visible without it.
+	if _, err := p.Write(c.path(key, ".pprof"), 0); err != nil {
+		return err
+	}
+	data, err := json.Marshal(newCacheEntry(p, usedFallback, now))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.path(key, ".json"), data, 0644); err != nil {
+		return err
+	}
+	return c.prune(now)
+}
+
+// prune removes all expired entries from the cache.
+func (c *Cache) prune(now time.Time) error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		key, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) <= c.ttl {
+			continue
+		}
+		os.Remove(c.path(key, ".json"))
+		os.Remove(c.path(key, ".pprof"))
+	}
+	return nil
+}
+
+// path returns the path of the file with the given extension for key.
+func (c *Cache) path(key, ext string) string {
+	return filepath.Join(c.dir, key+ext)
+}
+
+// CacheKey returns a key identifying the profiles fetched for the given
+// arguments. Like QueriesKey, it ignores the absolute time range of the
+// queries. The sampling options are ignored if sampling is disabled.
+func CacheKey(window time.Duration, queries []SearchQuery, fallback string, sel SelectOptions, opts MergeOptions) string {
+	if !sel.sampling() {
+		sel.SampleSeed, sel.SampleKeepTop = 0, 0
+	}
+	var key = struct {
+		Version          string        `json:"version"`
+		Queries          string        `json:"queries"`
+		Fallback         string        `json:"fallback"`
+		Select           SelectOptions `json:"select"`
+		MaxLocationDepth int           `json:"max_location_depth"`
+		PreAggregateTopK int           `json:"pre_aggregate_top_k"`
+		MergeOp          string        `json:"merge_op"`
+		ProfileType      string        `json:"profile_type"`
+		TrackVersions    bool          `json:"track_versions"`
+	}{
+		Version:          Version,
+		Queries:          QueriesKey(window, queries),
+		Fallback:         fallback,
+		Select:           sel,
+		MaxLocationDepth: opts.MaxLocationDepth,
+		PreAggregateTopK: opts.PreAggregateTopK,
+		MergeOp:          opts.MergeOp,
+		ProfileType:      opts.profileType(),
+		TrackVersions:    opts.TrackVersions,
+	}
+	data, _ := json.Marshal(key)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// QueriesKey returns a key identifying the given queries and search window.
+// The absolute from/to timestamps of the queries are ignored, so the key is
+// stable across runs using the same arguments.
+func QueriesKey(window time.Duration, queries []SearchQuery) string {
+	type keyQuery struct {
+		Query  string     `json:"query"`
+		Sort   SearchSort `json:"sort"`
+		Limit  int        `json:"limit"`
+		Weight float64    `json:"weight"`
+	}
+	var key = struct {
+		Window  time.Duration `json:"window"`
+		Queries []keyQuery    `json:"queries"`
+	}{Window: window}
+	for _, q := range queries {
+		key.Queries = append(key.Queries, keyQuery{Query: q.Filter.Query, Sort: q.Sort, Limit: q.Limit, Weight: q.Weight})
+	}
+	data, _ := json.Marshal(key)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
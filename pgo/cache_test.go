@@ -0,0 +1,55 @@
+package pgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+	now := time.Now()
+
+	queries, err := BuildQueries(time.Hour, 5, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	key := CacheKey(time.Hour, queries, "", SelectOptions{}, MergeOptions{})
+	require.NotEqual(t, key, CacheKey(time.Hour, queries, "", SelectOptions{MinVersion: "1.0"}, MergeOptions{}))
+	require.NotEqual(t, key, CacheKey(time.Hour, queries, "", SelectOptions{}, MergeOptions{MergeOp: MergeOpMax}))
+	require.NotEqual(t, key, CacheKey(time.Hour, queries, "", SelectOptions{}, MergeOptions{PreAggregateTopK: 10}))
+	require.NotEqual(t, key, CacheKey(time.Hour, queries, "", SelectOptions{}, MergeOptions{MaxLocationDepth: 10}))
+	require.Equal(t, key, CacheKey(time.Hour, queries, "", SelectOptions{}, MergeOptions{SpillChunk: 3}))
+
+	// Runs with the same arguments use the same key, even if they pick
+	// different random seeds, as long as they don't sample.
+	noSampling := CacheKey(time.Hour, queries, "", SelectOptions{SampleRate: 1, SampleSeed: 1}, MergeOptions{})
+	require.Equal(t, noSampling, CacheKey(time.Hour, queries, "", SelectOptions{SampleRate: 1, SampleSeed: 2}, MergeOptions{}))
+	require.NotEqual(t,
+		CacheKey(time.Hour, queries, "", SelectOptions{SampleRate: 0.5, SampleSeed: 1}, MergeOptions{}),
+		CacheKey(time.Hour, queries, "", SelectOptions{SampleRate: 0.5, SampleSeed: 2}, MergeOptions{}),
+	)
+
+	p, _, err := cache.Load(key, MergeOptions{}, now)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	mp := NewMergedProfile(MergeOptions{})
+	require.NoError(t, mp.Merge("a", newTestProfile(t, map[string]int64{"main;foo": 1e7})))
+	require.NoError(t, mp.Merge("b", newTestProfile(t, map[string]int64{"main;bar": 2e7})))
+	mp.countQuery("service:foo")
+	require.NoError(t, cache.Store(key, mp, true, now))
+
+	p, usedFallback, err := cache.Load(key, MergeOptions{}, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, usedFallback)
+	require.Equal(t, []string{"a", "b"}, p.profileIDs)
+	require.Equal(t, map[string]int{"service:foo": 1}, p.queryProfiles)
+	require.Equal(t, mp.durationSum, p.durationSum)
+	require.Equal(t, mp.oldest.UnixNano(), p.oldest.UnixNano())
+	require.Equal(t, stackValues(mp.profile), stackValues(p.profile))
+
+	p, _, err = cache.Load(key, MergeOptions{}, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Nil(t, p, "entry should have expired")
+}
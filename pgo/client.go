@@ -0,0 +1,557 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxConcurrency is the maximum number of concurrent requests to make to the
+// Datadog API.
+const maxConcurrency = 5
+
+// ClientFromEnv returns a new Client with its fields populated from the
+// environment. It returns an error if any of the required environment variables
+// are not set.
+//
+// The client authenticates with DD_BEARER_TOKEN if it is set, or with an OAuth
+// access token obtained for DD_OAUTH_CLIENT_ID and DD_OAUTH_CLIENT_SECRET if
+// they are set. Otherwise it uses DD_API_KEY and DD_APP_KEY.
+//
+// Instead of the credentials themselves, DD_API_KEY, DD_APP_KEY,
+// DD_BEARER_TOKEN and DD_OAUTH_CLIENT_SECRET may hold references to secrets in
+// AWS Secrets Manager, GCP Secret Manager or Vault, e.g.
+// aws-sm://my-secret#api_key, see secretProviders. Each of them can also be
+// read from the file named by the same variable with a _FILE suffix, e.g.
+// DD_API_KEY_FILE=/run/secrets/dd_api_key for a Docker BuildKit secret.
+func ClientFromEnv() (*Client, error) {
+	return ClientFromEnvAndConfig("")
+}
+
+// ClientFromEnvAndConfig is like ClientFromEnv, but falls back to the values
+// of the datadog config file at configPath for environment variables that are
+// not set. An empty configPath uses the default config file, if it exists.
+func ClientFromEnvAndConfig(configPath string) (*Client, error) {
+	cfg, err := loadDatadogConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return clientFromEnv(cfg, "")
+}
+
+// clientFromEnv implements ClientFromEnvAndConfig. The names of all
+// environment variables get the given suffix, see Client.AddOrg.
+func clientFromEnv(cfg DatadogConfig, suffix string) (c *Client, err error) {
+	env := func(key string) string { return key + suffix }
+	c = &Client{
+		concurrency:  make(chan struct{}, maxConcurrency),
+		ZipLimits:    DefaultZipLimits,
+		Retries:      DefaultRetries,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+	if c.site = envOr(env("DD_SITE"), cfg.Site); c.site == "" {
+		c.site = "datadoghq.com"
+	}
+	if c.apiKey, err = credential(env("DD_API_KEY"), cfg.APIKey); err != nil {
+		return nil, err
+	}
+	if c.bearerToken, err = credential(env("DD_BEARER_TOKEN"), ""); err != nil || c.bearerToken != "" {
+		return c, err
+	}
+	secret, err := envOrFile(env("DD_OAUTH_CLIENT_SECRET"), "")
+	if err != nil {
+		return nil, &authError{msg: err.Error()}
+	}
+	if id := os.Getenv(env("DD_OAUTH_CLIENT_ID")); id != "" || secret != "" {
+		if id == "" || secret == "" {
+			return nil, &authError{msg: env("DD_OAUTH_CLIENT_ID") + " and " + env("DD_OAUTH_CLIENT_SECRET") + " must both be set"}
+		} else if secret, err = resolveSecret(secret); err != nil {
+			return nil, &authError{msg: err.Error()}
+		}
+		c.oauth = &oauthClient{
+			tokenURL:     envOr(env("DD_OAUTH_TOKEN_URL"), oauthTokenURL(c.site)),
+			clientID:     id,
+			clientSecret: secret,
+		}
+		return c, nil
+	}
+	if c.apiKey == "" {
+		return nil, &authError{msg: env("DD_API_KEY") + " is not set"}
+	}
+	if c.appKey, err = credential(env("DD_APP_KEY"), cfg.AppKey); err != nil {
+		return nil, err
+	} else if c.appKey == "" {
+		return nil, &authError{msg: env("DD_APP_KEY") + " is not set"}
+	}
+	return c, nil
+}
+
+// credential returns the value of the environment variable key, or fallback
+// if it is not set, see envOrFile. If the value is a secret reference like
+// aws-sm://my-secret#api_key, the referenced secret is returned instead, see
+// secretProviders.
+func credential(key, fallback string) (string, error) {
+	value, err := envOrFile(key, fallback)
+	if err == nil {
+		value, err = resolveSecret(value)
+	}
+	if err != nil {
+		return "", &authError{msg: key + ": " + err.Error()}
+	}
+	return value, nil
+}
+
+// envOrFile is like envOr, but if key is not set and key_FILE is, the value is
+// read from the file named by key_FILE, e.g. a secret mounted by Docker
+// BuildKit. Surrounding whitespace is trimmed from the file contents.
+func envOrFile(key, fallback string) (string, error) {
+	if v := os.Getenv(key); v != "" {
+		return v, nil
+	}
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s_FILE: %w", key, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return fallback, nil
+}
+
+// envOr returns the value of the environment variable key, or fallback if it
+// is not set.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// ErrNoProfiles is returned when a search does not match any profiles.
+var ErrNoProfiles = errors.New("no profiles found")
+
+// Client is a client for the Datadog API.
+type Client struct {
+	// ZipLimits bounds the size of downloaded archives.
+	ZipLimits ZipLimits
+	// Retries is the number of times a failed request is retried, see
+	// retryable for which errors are retried.
+	Retries int
+	// RetryBackoff is the delay before the first retry. It doubles for
+	// every subsequent retry.
+	RetryBackoff time.Duration
+	// RequestTimeout bounds every attempt of a request, including reading
+	// the response body. Attempts that time out are retried. Zero disables
+	// the timeout, the deadline of the context still applies.
+	RequestTimeout time.Duration
+	// Log is used to log retries, it may be nil.
+	Log *slog.Logger
+	// HTTPClient is used to send requests, http.DefaultClient is used if it
+	// is nil. See NewHTTPClient.
+	HTTPClient *http.Client
+	// Metrics records the sent requests, it may be nil.
+	Metrics *Metrics
+
+	site        string
+	apiKey      string
+	appKey      string
+	bearerToken string
+	oauth       *oauthClient
+	concurrency chan struct{}
+	// orgs holds the credentials of additional orgs by name, see AddOrg.
+	orgs map[string]*Client
+	// baseURL overrides the URL derived from site, it's used for testing.
+	baseURL string
+}
+
+// SearchAndDownloadProfiles searches for profiles using the given queries and
+// downloads them.
+func (c *Client) SearchAndDownloadProfiles(ctx context.Context, queries []SearchQuery) (profiles *ProfilesDownload, err error) {
+	defer wrapErr(&err, "search and download profiles")
+	defer c.limitConcurrency()()
+
+	var payload = struct {
+		Queries []SearchQuery `json:"queries"`
+	}{queries}
+
+	file, size, err := c.download(ctx, "/api/unstable/profiles/gopgo", payload)
+	if err != nil {
+		return nil, err
+	}
+	return &ProfilesDownload{file: file, size: size, limits: c.ZipLimits}, nil
+}
+
+// SearchProfiles searches for profiles using the given query. It returns a list
+// of profiles and an error if any.
+func (c *Client) SearchProfiles(ctx context.Context, query SearchQuery) (profiles []*SearchProfile, err error) {
+	if org, q, ok := c.orgQuery(query.Filter.Query); ok {
+		query.Filter.Query = q
+		profiles, err = c.forOrg(org).SearchProfiles(ctx, query)
+		for _, p := range profiles {
+			p.org = org
+		}
+		return profiles, err
+	}
+	defer wrapErr(&err, "search profiles")
+	defer c.limitConcurrency()()
+	var response struct {
+		Data []struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				ID            string   `json:"id"`
+				Service       string   `json:"service"`
+				Version       string   `json:"version"`
+				GoVersion     string   `json:"runtime_version"`
+				Tags          []string `json:"tags"`
+				DurationNanos float64  `json:"duration_nanos"`
+				Timestamp     JSONTime `json:"timestamp"`
+				Custom        struct {
+					Metrics struct {
+						CoreCPUCores float64 `json:"core_cpu_cores"`
+					} `json:"metrics"`
+				} `json:"custom"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	data, err := c.post(ctx, "/api/unstable/profiles/list", query)
+	if err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Data) == 0 {
+		return nil, ErrNoProfiles
+	}
+
+	for _, item := range response.Data {
+		p := &SearchProfile{
+			EventID:   item.ID,
+			ProfileID: item.Attributes.ID,
+			Service:   item.Attributes.Service,
+			Version:   attributeOrTag(item.Attributes.Version, item.Attributes.Tags, "version"),
+			GoVersion: attributeOrTag(item.Attributes.GoVersion, item.Attributes.Tags, "runtime_version"),
+			CPUCores:  item.Attributes.Custom.Metrics.CoreCPUCores,
+			Timestamp: item.Attributes.Timestamp.Time,
+			Duration:  time.Duration(item.Attributes.DurationNanos),
+		}
+		profiles = append(profiles, p)
+	}
+	return
+}
+
+// attributeOrTag returns attr if it's not empty, otherwise the value of the
+// first <key>:<value> tag.
+func attributeOrTag(attr string, tags []string, key string) string {
+	if attr != "" {
+		return attr
+	}
+	for _, tag := range tags {
+		if v, ok := strings.CutPrefix(tag, key+":"); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// SavedSearchQuery returns the query of the saved profile search with the
+// given ID.
+func (c *Client) SavedSearchQuery(ctx context.Context, id string) (query string, err error) {
+	defer wrapErr(&err, "saved search")
+	defer c.limitConcurrency()()
+	var response struct {
+		Data struct {
+			Attributes struct {
+				Query string `json:"query"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	data, err := c.get(ctx, "/api/unstable/profiles/saved-searches/"+url.PathEscape(id))
+	if err != nil {
+		return "", err
+	} else if err := json.Unmarshal(data, &response); err != nil {
+		return "", err
+	} else if response.Data.Attributes.Query == "" {
+		return "", fmt.Errorf("saved search %q has no query", id)
+	}
+	return response.Data.Attributes.Query, nil
+}
+
+// DownloadProfile downloads the profile identified by the given SearchProfile.
+func (c *Client) DownloadProfile(ctx context.Context, p *SearchProfile) (d ProfileDownload, err error) {
+	if p.org != "" && c.orgs != nil {
+		c = c.forOrg(p.org)
+	}
+	defer wrapErr(&err, "download profile")
+	defer c.limitConcurrency()()
+	file, size, err := c.download(ctx, fmt.Sprintf("/api/ui/profiling/profiles/%s/download?eventId=%s", p.ProfileID, p.EventID), nil)
+	if err != nil {
+		return ProfileDownload{}, err
+	}
+	return ProfileDownload{file: file, size: size, limits: c.ZipLimits}, nil
+}
+
+// request creates a new HTTP request with the given method and path and sets
+// the required headers.
+func (c *Client) request(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	url := fmt.Sprintf("https://app.%s%s", c.site, path)
+	if c.baseURL != "" {
+		url = c.baseURL + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", Name+"/"+Version)
+	if err := c.setAuth(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// post sends a POST request to the given path with the given payload and decodes
+// the response.
+func (c *Client) post(ctx context.Context, path string, payload any) ([]byte, error) {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.retry(ctx, func(ctx context.Context) ([]byte, error) {
+		req, err := c.request(ctx, "POST", path, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		return c.do(req)
+	})
+}
+
+// get sends a GET request to the given path and returns the response body.
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	return c.retry(ctx, func(ctx context.Context) ([]byte, error) {
+		req, err := c.request(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		return c.do(req)
+	})
+}
+
+// download sends a GET request to the given path, or a POST request with the
+// given payload if it's not nil, and streams the response body to a temporary
+// file instead of holding it in memory. The caller must remove the file.
+//
+// Truncated or corrupted bodies are retried, see partialDownload. A GET
+// request that fails while reading the body is resumed with a range request
+// if the server supports it.
+func (c *Client) download(ctx context.Context, path string, payload any) (file *os.File, size int64, err error) {
+	method, reqBody := "GET", []byte(nil)
+	if payload != nil {
+		method = "POST"
+		if reqBody, err = json.Marshal(payload); err != nil {
+			return nil, 0, err
+		}
+	}
+	partial := &partialDownload{total: -1}
+	_, err = c.retry(ctx, func(ctx context.Context) ([]byte, error) {
+		req, err := c.request(ctx, method, path, reqBody)
+		if err != nil {
+			return nil, err
+		} else if method == "GET" {
+			partial.prepare(req)
+		}
+		return nil, c.send(req, func(res *http.Response) (int64, error) {
+			before := partial.size
+			err := partial.read(res, c.ZipLimits)
+			return max(partial.size-before, 0), err
+		})
+	})
+	if err != nil {
+		if partial.file != nil {
+			removeTemp(partial.file)
+		}
+		return nil, 0, err
+	}
+	return partial.file, partial.size, nil
+}
+
+// do sends the request and returns the response body. It returns an error for
+// non-2xx responses. It's only used for JSON responses, archives are streamed
+// to a file with the ZipLimits applied, see download.
+func (c *Client) do(req *http.Request) (data []byte, err error) {
+	err = c.send(req, func(res *http.Response) (int64, error) {
+		var readErr error
+		data, readErr = io.ReadAll(res.Body)
+		return int64(len(data)), readErr
+	})
+	return data, err
+}
+
+// send sends the request and passes the response to read, which reads the
+// body and returns the number of bytes it read. It returns an error for
+// non-2xx responses.
+func (c *Client) send(req *http.Request, read func(*http.Response) (int64, error)) (err error) {
+	start := time.Now()
+	var n int64
+	defer func() {
+		c.Metrics.record(endpointName(req.URL.Path), time.Since(start), int(n), err)
+	}()
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	c.logRateLimit(res)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return responseError(res)
+	}
+	n, err = read(res)
+	return err
+}
+
+// maxErrorBodySize is the maximum number of bytes of an error response body
+// that are included in error messages.
+const maxErrorBodySize = 4 << 10
+
+// responseError returns an error for a non-2xx response. It includes a
+// snippet of the response body that is read through a size-bounded reader,
+// so huge error pages can't blow up memory usage or flood the logs.
+func responseError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize+1))
+	snippet := strings.TrimSpace(string(body))
+	if len(body) > maxErrorBodySize {
+		snippet = strings.TrimSpace(string(body[:maxErrorBodySize])) + "... (truncated)"
+	}
+	msg := res.Status
+	if snippet != "" {
+		msg += ": " + snippet
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return &statusError{
+			StatusCode: res.StatusCode,
+			RetryAfter: rateLimitReset(res.Header),
+			msg:        msg + ": rate limited by the Datadog API, try again later or reduce the number of queries and profiles",
+		}
+	}
+	return &statusError{
+		StatusCode: res.StatusCode,
+		msg:        msg + ": please check that your DD_API_KEY, DD_APP_KEY and DD_SITE env vars are set correctly and that your account has profiles matching your query",
+	}
+}
+
+// statusError is returned for non-2xx responses.
+type statusError struct {
+	StatusCode int
+	// RetryAfter is the time until a rate limit resets for 429 responses.
+	RetryAfter time.Duration
+	msg        string
+}
+
+// Error implements the error interface.
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// httpClient returns the HTTP client used to send requests.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// limitConcurrency blocks until a slot is available in the concurrency channel.
+// It returns a function that should be called to release the slot.
+func (c *Client) limitConcurrency() func() {
+	c.concurrency <- struct{}{}
+	return func() { <-c.concurrency }
+}
+
+// SearchQuery holds the query parameters for searching for profiles.
+type SearchQuery struct {
+	Filter SearchFilter `json:"filter"`
+	Sort   SearchSort   `json:"sort"`
+	Limit  int          `json:"limit"`
+	// Weight is the relative contribution of the profiles matching this
+	// query to the merged profile. Zero means the query is not weighted.
+	Weight float64 `json:"-"`
+	// profileIDs are the IDs matched by a query of ProfileIDsQuery, which is
+	// split by its IDs rather than by time, see splitPGOQueries.
+	profileIDs []string
+}
+
+// SearchFilter holds the filter parameters for searching for profiles.
+type SearchFilter struct {
+	From  JSONTime `json:"from"`
+	To    JSONTime `json:"to"`
+	Query string   `json:"query"`
+}
+
+// SearchSort holds the sort parameters for searching for profiles.
+type SearchSort struct {
+	Order string `json:"order"`
+	Field string `json:"field"`
+}
+
+// timeFormat is the time format used by the Datadog API.
+const timeFormat = "2006-01-02T15:04:05.999999999Z"
+
+// JSONTime is a time.Time that marshals to and from JSON in the format used by
+// the Datadog API.
+type JSONTime struct {
+	time.Time
+}
+
+// MarshalJSON marshals the time in the format used by the Datadog API.
+func (t JSONTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON unmarshals the time from the format used by the Datadog API.
+func (t *JSONTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(timeFormat, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// String returns the time in the format used by the Datadog API.
+func (t JSONTime) String() string {
+	return t.Time.UTC().Round(time.Second).Format(timeFormat)
+}
+
+// SearchProfile holds information about a profile search result. ProfileID and
+// EventID are used to identify the SearchProfile for downloading. The other
+// fields are just logged for debugging.
+type SearchProfile struct {
+	Service   string
+	Version   string
+	GoVersion string
+	CPUCores  float64
+	ProfileID string
+	EventID   string
+	Timestamp time.Time
+	Duration  time.Duration
+
+	// org is the name of the org the profile was found in, or empty for the
+	// default org, see Client.AddOrg.
+	org string
+}
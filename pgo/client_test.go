@@ -0,0 +1,178 @@
+package pgo
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseError(t *testing.T) {
+	newResponse := func(body string) *http.Response {
+		return &http.Response{
+			Status:     "500 Internal Server Error",
+			StatusCode: http.StatusInternalServerError,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}
+	}
+
+	err := responseError(newResponse(`{"errors":["boom"]}`))
+	require.ErrorContains(t, err, `500 Internal Server Error: {"errors":["boom"]}: please check`)
+
+	err = responseError(newResponse(""))
+	require.ErrorContains(t, err, "500 Internal Server Error: please check")
+
+	err = responseError(newResponse(strings.Repeat("x", 10*maxErrorBodySize)))
+	require.ErrorContains(t, err, strings.Repeat("x", maxErrorBodySize)+"... (truncated)")
+	require.Less(t, len(err.Error()), 2*maxErrorBodySize)
+}
+
+func TestClientRetry(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch n := requests.Add(1); {
+		case r.URL.Path == "/bad-request":
+			http.Error(w, "bad request", http.StatusBadRequest)
+		case n < 3:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, Retries: 2, baseURL: srv.URL}
+	data, err := c.get(context.Background(), "/")
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+	require.Equal(t, int32(3), requests.Load())
+
+	requests.Store(0)
+	c.Retries = 1
+	_, err = c.get(context.Background(), "/")
+	require.ErrorContains(t, err, "503")
+	require.Equal(t, int32(2), requests.Load())
+
+	// JSON responses aren't archives, so the ZipLimits don't apply.
+	requests.Store(10)
+	c.ZipLimits.MaxArchiveBytes = 1
+	data, err = c.post(context.Background(), "/", map[string]string{"query": "service:foo"})
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+
+	requests.Store(10)
+	_, err = c.get(context.Background(), "/bad-request")
+	require.ErrorContains(t, err, "400")
+	require.Equal(t, int32(11), requests.Load(), "client errors must not be retried")
+}
+
+func TestClientRequestTimeout(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, Retries: 1, RequestTimeout: 50 * time.Millisecond, baseURL: srv.URL}
+	data, err := c.get(context.Background(), "/")
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+	require.Equal(t, int32(2), requests.Load())
+
+	requests.Store(0)
+	c.Retries = 0
+	_, err = c.get(context.Background(), "/")
+	require.ErrorContains(t, err, "request timed out after 50ms")
+
+	// The deadline of the context is not retried.
+	requests.Store(0)
+	c.Retries, c.RequestTimeout = 3, time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.get(ctx, "/")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 0; attempt < 5; attempt++ {
+		d := retryDelay(time.Second, attempt)
+		require.GreaterOrEqual(t, d, time.Second<<attempt/2)
+		require.LessOrEqual(t, d, time.Second<<attempt)
+	}
+	require.Equal(t, time.Duration(0), retryDelay(0, 3))
+}
+
+func TestClientRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Reset", "0.05")
+		if requests.Add(1) == 1 {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// A huge backoff proves that the rate limit reset is used instead.
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, Retries: 1, RetryBackoff: time.Hour, baseURL: srv.URL}
+	data, err := c.get(context.Background(), "/")
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+	require.Equal(t, int32(2), requests.Load())
+}
+
+func TestRateLimitReset(t *testing.T) {
+	h := http.Header{}
+	require.Equal(t, time.Duration(0), rateLimitReset(h))
+	h.Set("Retry-After", "2")
+	require.Equal(t, 2*time.Second, rateLimitReset(h))
+	h.Set("X-RateLimit-Reset", "3")
+	require.Equal(t, 3*time.Second, rateLimitReset(h))
+	h.Set("X-RateLimit-Reset", "3600")
+	require.Equal(t, maxRateLimitWait, rateLimitReset(h))
+}
+
+func TestClientFromEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api_key"), []byte("file-api\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app_key"), []byte("file-app\n"), 0600))
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("DD_BEARER_TOKEN", "")
+	t.Setenv("DD_OAUTH_CLIENT_ID", "")
+	t.Setenv("DD_OAUTH_CLIENT_SECRET", "")
+	t.Setenv("DD_API_KEY", "")
+	t.Setenv("DD_APP_KEY", "")
+	t.Setenv("DD_API_KEY_FILE", filepath.Join(dir, "api_key"))
+	t.Setenv("DD_APP_KEY_FILE", filepath.Join(dir, "app_key"))
+
+	c, err := ClientFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "file-api", c.apiKey)
+	require.Equal(t, "file-app", c.appKey)
+
+	// The variable itself takes precedence.
+	t.Setenv("DD_APP_KEY", "env-app")
+	c, err = ClientFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "env-app", c.appKey)
+
+	t.Setenv("DD_API_KEY_FILE", filepath.Join(dir, "missing"))
+	_, err = ClientFromEnv()
+	require.ErrorContains(t, err, "DD_API_KEY_FILE")
+	require.Equal(t, ErrorClassAuth, ErrorClass(err))
+}
@@ -0,0 +1,51 @@
+package pgo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DatadogConfig holds the credentials and site read from a datadog config
+// file, as used by other Datadog tools.
+type DatadogConfig struct {
+	APIKey string `yaml:"api_key"`
+	AppKey string `yaml:"app_key"`
+	Site   string `yaml:"site"`
+}
+
+// defaultDatadogConfigPath returns the path of the default datadog config
+// file, ~/.datadog/datadog.yaml.
+func defaultDatadogConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".datadog", "datadog.yaml")
+}
+
+// loadDatadogConfig reads the datadog config file at path. If path is empty,
+// the default config file is read if it exists. The error messages never
+// include the contents of the file, so secrets can't leak into logs.
+func loadDatadogConfig(path string) (cfg DatadogConfig, err error) {
+	optional := path == ""
+	if optional {
+		if path = defaultDatadogConfigPath(); path == "" {
+			return cfg, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, fmt.Errorf("datadog config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("datadog config: %s: invalid yaml", path)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,42 @@
+package pgo
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LatestEvent returns the time of the most recent event matching the events
+// query within the given window, e.g. "source:kubernetes service:foo
+// Deployment" for the deployments of a service. It returns the zero time if
+// no event matches.
+func (c *Client) LatestEvent(ctx context.Context, window time.Duration, query string) (latest time.Time, err error) {
+	defer wrapErr(&err, "latest event")
+	defer c.limitConcurrency()()
+	var response struct {
+		Data []struct {
+			Attributes struct {
+				Timestamp time.Time `json:"timestamp"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	now := time.Now()
+	params := url.Values{
+		"filter[query]": {query},
+		"filter[from]":  {strconv.FormatInt(now.Add(-window).UnixMilli(), 10)},
+		"filter[to]":    {strconv.FormatInt(now.UnixMilli(), 10)},
+		"sort":          {"-timestamp"},
+		"page[limit]":   {"1"},
+	}
+	data, err := c.get(ctx, "/api/v2/events?"+params.Encode())
+	if err != nil {
+		return time.Time{}, err
+	} else if err := json.Unmarshal(data, &response); err != nil {
+		return time.Time{}, err
+	} else if len(response.Data) == 0 {
+		return time.Time{}, nil
+	}
+	return response.Data[0].Attributes.Timestamp, nil
+}
@@ -0,0 +1,34 @@
+package pgo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientLatestEvent(t *testing.T) {
+	var query, sort string
+	body := `{"data":[{"id":"1","type":"event","attributes":{"timestamp":"2024-05-01T12:00:00Z"}}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/events", r.URL.Path)
+		query, sort = r.URL.Query().Get("filter[query]"), r.URL.Query().Get("sort")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, baseURL: srv.URL}
+	latest, err := c.LatestEvent(context.Background(), time.Hour, "source:kubernetes service:foo")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), latest)
+	require.Equal(t, "source:kubernetes service:foo", query)
+	require.Equal(t, "-timestamp", sort)
+
+	body = `{"data":[]}`
+	latest, err = c.LatestEvent(context.Background(), time.Hour, "source:kubernetes service:foo")
+	require.NoError(t, err)
+	require.True(t, latest.IsZero())
+}
@@ -0,0 +1,87 @@
+package pgo
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// FunctionDiff is the change of the share of the cpu time spent in a
+// function between two profiles.
+type FunctionDiff struct {
+	Function string
+	// Before and After are the percentages of the total cpu time that the
+	// function is the leaf of in the old and the new profile.
+	Before float64
+	After  float64
+}
+
+// Delta returns the change of the share in percentage points.
+func (d FunctionDiff) Delta() float64 {
+	return d.After - d.Before
+}
+
+// DiffProfiles returns the functions whose flat share of the cpu time changed
+// by more than threshold percentage points between before and after, sorted
+// by the largest absolute change first. The shares are relative to the total
+// cpu time of each profile, so profiles merged from a different number of
+// profiles can be compared.
+func DiffProfiles(before, after *profile.Profile, threshold float64) (diffs []FunctionDiff, err error) {
+	defer wrapErr(&err, "diff profiles")
+	beforeShares, err := flatShares(before)
+	if err != nil {
+		return nil, err
+	}
+	afterShares, err := flatShares(after)
+	if err != nil {
+		return nil, err
+	}
+
+	for fn, share := range beforeShares {
+		diffs = append(diffs, FunctionDiff{Function: fn, Before: share, After: afterShares[fn]})
+	}
+	for fn, share := range afterShares {
+		if _, ok := beforeShares[fn]; !ok {
+			diffs = append(diffs, FunctionDiff{Function: fn, After: share})
+		}
+	}
+
+	changed := diffs[:0]
+	for _, d := range diffs {
+		if math.Abs(d.Delta()) > threshold {
+			changed = append(changed, d)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		if di, dj := math.Abs(changed[i].Delta()), math.Abs(changed[j].Delta()); di != dj {
+			return di > dj
+		}
+		return changed[i].Function < changed[j].Function
+	})
+	return changed, nil
+}
+
+// flatShares returns the percentage of the total cpu time of prof that each
+// function is the leaf of.
+func flatShares(prof *profile.Profile) (map[string]float64, error) {
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return nil, err
+	}
+	flat := map[string]int64{}
+	var total int64
+	for _, s := range prof.Sample {
+		total += s.Value[cpuIdx]
+		if leaf, ok := leafLine(s); ok {
+			flat[leaf.Function.Name] += s.Value[cpuIdx]
+		}
+	}
+	shares := make(map[string]float64, len(flat))
+	for fn, v := range flat {
+		if total > 0 {
+			shares[fn] = float64(v) / float64(total) * 100
+		}
+	}
+	return shares, nil
+}
@@ -0,0 +1,24 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffProfiles(t *testing.T) {
+	before := newTestProfile(t, map[string]int64{"main;foo": 50, "main;bar": 30, "main;baz": 20})
+	after := newTestProfile(t, map[string]int64{"main;foo": 100, "main;bar": 59, "main;qux": 41})
+	diffs, err := DiffProfiles(before, after, 1)
+	require.NoError(t, err)
+	require.Equal(t, []FunctionDiff{
+		{Function: "qux", Before: 0, After: 20.5},
+		{Function: "baz", Before: 20, After: 0},
+	}, diffs)
+	require.Equal(t, -20.0, diffs[1].Delta())
+
+	diffs, err = DiffProfiles(before, after, 0.1)
+	require.NoError(t, err)
+	require.Len(t, diffs, 3)
+	require.Equal(t, "bar", diffs[2].Function)
+}
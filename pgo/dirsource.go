@@ -0,0 +1,80 @@
+package pgo
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirSource is a ProfileSource for a local directory containing pprof files
+// with a .pprof extension, including its subdirectories. The query strings are
+// ignored, so every query matches all profiles within its time window.
+type DirSource struct {
+	// Dir is the directory containing the profiles.
+	Dir string
+}
+
+// SearchProfiles implements ProfileSource. The profiles are sorted by
+// timestamp if query.Sort.Field is "timestamp", or by cpu cores otherwise.
+func (s *DirSource) SearchProfiles(ctx context.Context, query SearchQuery) (profiles []*SearchProfile, err error) {
+	defer wrapErr(&err, "search profiles")
+	err = filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if err := ctx.Err(); err != nil {
+			return err
+		} else if d.IsDir() || !strings.HasSuffix(path, ".pprof") {
+			return nil
+		}
+		prof, err := readProfile(path)
+		if err != nil {
+			return err
+		}
+		ts := time.Unix(0, prof.TimeNanos)
+		if prof.TimeNanos != 0 && (ts.Before(query.Filter.From.Time) || ts.After(query.Filter.To.Time)) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		cores, _ := cpuCores(prof)
+		profiles = append(profiles, &SearchProfile{
+			ProfileID: filepath.ToSlash(rel),
+			CPUCores:  cores,
+			Timestamp: ts,
+			Duration:  time.Duration(prof.DurationNanos),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if len(profiles) == 0 {
+		return nil, ErrNoProfiles
+	}
+
+	sort.SliceStable(profiles, func(i, j int) bool {
+		if query.Sort.Field == sortFields["timestamp"] {
+			return profiles[i].Timestamp.After(profiles[j].Timestamp)
+		}
+		return profiles[i].CPUCores > profiles[j].CPUCores
+	})
+	if query.Limit > 0 && len(profiles) > query.Limit {
+		profiles = profiles[:query.Limit]
+	}
+	return profiles, nil
+}
+
+// DownloadProfile implements ProfileSource.
+func (s *DirSource) DownloadProfile(ctx context.Context, p *SearchProfile) (d ProfileDownload, err error) {
+	defer wrapErr(&err, "download profile")
+	data, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(p.ProfileID)))
+	if err != nil {
+		return ProfileDownload{}, err
+	}
+	return NewPprofDownload(data, DefaultZipLimits)
+}
@@ -0,0 +1,36 @@
+package pgo
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// discoverLimit is the number of profiles searched by DiscoverServices.
+// Services with only a few profiles in the window may be missed if many other
+// services match the filter.
+const discoverLimit = 1000
+
+// DiscoverServices returns the sorted names of all services with Go profiles
+// matching the filter query within the given window, e.g. "env:prod
+// team:payments".
+func (c *Client) DiscoverServices(ctx context.Context, window time.Duration, filter string) (services []string, err error) {
+	defer wrapErr(&err, "discover services")
+	queries, err := BuildQueries(window, discoverLimit, []string{sortFields["timestamp"]}, []string{filter})
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := c.SearchProfiles(ctx, queries[0])
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, p := range profiles {
+		if p.Service != "" && !seen[p.Service] {
+			seen[p.Service] = true
+			services = append(services, p.Service)
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
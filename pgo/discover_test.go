@@ -0,0 +1,35 @@
+package pgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverServices(t *testing.T) {
+	var query SearchQuery
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/unstable/profiles/list", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+		fmt.Fprint(w, `{"data": [
+			{"attributes": {"service": "payments-api"}},
+			{"attributes": {"service": "billing"}},
+			{"attributes": {"service": "payments-api"}},
+			{"attributes": {"service": ""}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, baseURL: srv.URL}
+	services, err := c.DiscoverServices(context.Background(), time.Hour, "env:prod team:payments")
+	require.NoError(t, err)
+	require.Equal(t, []string{"billing", "payments-api"}, services)
+	require.Equal(t, "env:prod team:payments runtime:go", query.Filter.Query)
+	require.Equal(t, discoverLimit, query.Limit)
+}
@@ -0,0 +1,35 @@
+package pgo
+
+import (
+	"math"
+
+	"github.com/google/pprof/profile"
+)
+
+// ProfileDrift returns how much the distribution of the cpu time across the
+// functions of after diverges from before, from 0 for identical flat shares
+// to 1 for profiles without any functions in common. It's the total variation
+// distance of the flat shares, i.e. the fraction of the cpu time that would
+// have to move to other functions to turn one profile into the other.
+func ProfileDrift(before, after *profile.Profile) (drift float64, err error) {
+	defer wrapErr(&err, "profile drift")
+	beforeShares, err := flatShares(before)
+	if err != nil {
+		return 0, err
+	}
+	afterShares, err := flatShares(after)
+	if err != nil {
+		return 0, err
+	}
+	var sum float64
+	for fn, share := range beforeShares {
+		sum += math.Abs(share - afterShares[fn])
+	}
+	for fn, share := range afterShares {
+		if _, ok := beforeShares[fn]; !ok {
+			sum += share
+		}
+	}
+	// The shares are percentages.
+	return sum / 2 / 100, nil
+}
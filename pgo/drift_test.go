@@ -0,0 +1,24 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileDrift(t *testing.T) {
+	before := newTestProfile(t, map[string]int64{"main;foo": 6e7, "main;bar": 4e7})
+
+	drift, err := ProfileDrift(before, newTestProfile(t, map[string]int64{"main;foo": 3e7, "main;bar": 2e7}))
+	require.NoError(t, err)
+	require.InDelta(t, 0, drift, 1e-9)
+
+	// 20% of the cpu time moved from foo to bar.
+	drift, err = ProfileDrift(before, newTestProfile(t, map[string]int64{"main;foo": 4e7, "main;bar": 6e7}))
+	require.NoError(t, err)
+	require.InDelta(t, 0.2, drift, 1e-9)
+
+	drift, err = ProfileDrift(before, newTestProfile(t, map[string]int64{"main;baz": 1e7}))
+	require.NoError(t, err)
+	require.InDelta(t, 1, drift, 1e-9)
+}
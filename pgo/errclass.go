@@ -0,0 +1,94 @@
+package pgo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Error classes returned by ErrorClass.
+const (
+	// ErrorClassAuth is returned for missing or rejected credentials.
+	ErrorClassAuth = "auth"
+	// ErrorClassEmpty is returned if no or too little profiling data was
+	// found.
+	ErrorClassEmpty = "empty"
+	// ErrorClassPartial is returned if only some of the requested data could
+	// be used, e.g. a baseline profile failed to download.
+	ErrorClassPartial = "partial"
+	// ErrorClassNetwork is returned for network errors, timeouts and server
+	// errors.
+	ErrorClassNetwork = "network"
+	// ErrorClassStale is returned if the merged profiles don't represent the
+	// currently deployed version, e.g. because they all predate the latest
+	// deployment of the service.
+	ErrorClassStale = "stale"
+	// ErrorClassDrift is returned if the merged profile diverges too much
+	// from the existing DEST, e.g. because a query suddenly matches the
+	// profiles of a different service.
+	ErrorClassDrift = "drift"
+	// ErrorClassOther is returned for all other errors, e.g. invalid
+	// arguments.
+	ErrorClassOther = "other"
+)
+
+// ErrorClasses lists all error classes.
+var ErrorClasses = []string{ErrorClassAuth, ErrorClassEmpty, ErrorClassPartial, ErrorClassNetwork, ErrorClassStale, ErrorClassDrift, ErrorClassOther}
+
+// ErrorClass returns the class of err, see the ErrorClass constants. Errors
+// wrapped with WithErrorClass take precedence over the class derived from
+// the error itself.
+func ErrorClass(err error) string {
+	var classErr *classifiedError
+	var authErr *authError
+	var statusErr *statusError
+	switch {
+	case errors.As(err, &classErr):
+		return classErr.class
+	case errors.As(err, &authErr):
+		return ErrorClassAuth
+	case errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden):
+		return ErrorClassAuth
+	case errors.Is(err, ErrNoProfiles):
+		return ErrorClassEmpty
+	case retryable(err) || errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassNetwork
+	default:
+		return ErrorClassOther
+	}
+}
+
+// WithErrorClass wraps err so that ErrorClass returns class for it. It
+// returns nil if err is nil.
+func WithErrorClass(err error, class string) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// classifiedError is an error with an explicit error class.
+type classifiedError struct {
+	class string
+	err   error
+}
+
+// Error implements the error interface.
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// authError is returned if no valid credentials are configured.
+type authError struct {
+	msg string
+}
+
+// Error implements the error interface.
+func (e *authError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,43 @@
+package pgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorClass(t *testing.T) {
+	t.Setenv("DD_API_KEY", "")
+	t.Setenv("DD_BEARER_TOKEN", "")
+	t.Setenv("DD_OAUTH_CLIENT_ID", "")
+	t.Setenv("DD_OAUTH_CLIENT_SECRET", "")
+	t.Setenv("HOME", t.TempDir())
+	_, envErr := ClientFromEnvAndConfig("")
+	require.Error(t, envErr)
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{envErr, ErrorClassAuth},
+		{&statusError{StatusCode: 403}, ErrorClassAuth},
+		{fmt.Errorf("search: %w", ErrNoProfiles), ErrorClassEmpty},
+		{&statusError{StatusCode: 503}, ErrorClassNetwork},
+		{&statusError{StatusCode: 429}, ErrorClassNetwork},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection refused")}, ErrorClassNetwork},
+		{context.DeadlineExceeded, ErrorClassNetwork},
+		{&statusError{StatusCode: 400}, ErrorClassOther},
+		{errors.New("boom"), ErrorClassOther},
+		{fmt.Errorf("datadog config: %w", fs.ErrNotExist), ErrorClassOther},
+		{WithErrorClass(&statusError{StatusCode: 503}, ErrorClassPartial), ErrorClassPartial},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, ErrorClass(tt.err), tt.err)
+	}
+	require.NoError(t, WithErrorClass(nil, ErrorClassPartial))
+}
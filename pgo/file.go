@@ -0,0 +1,23 @@
+package pgo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// createTemp creates a new temporary file next to dst. Unlike os.CreateTemp,
+// the file is created with 0666 permissions minus the umask, i.e. the same
+// permissions as os.Create would use.
+func createTemp(dst string) (*os.File, error) {
+	for i := 0; i < 100; i++ {
+		path := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-"+randomHex(8))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		return file, err
+	}
+	return nil, fmt.Errorf("create temporary file for %s: too many attempts", dst)
+}
@@ -0,0 +1,45 @@
+package pgo
+
+import (
+	"regexp"
+
+	"github.com/google/pprof/profile"
+)
+
+// FilterFunctions drops all samples whose stack contains a function matching
+// any of drop, and, if only is not empty, all samples whose stack doesn't
+// contain a function matching any of only, along with any locations and
+// functions that are no longer referenced. Dropping the samples of a function
+// removes its call edges from the profile, so PGO no longer considers them
+// hot, e.g. to avoid an inlining decision known to cause a regression.
+func (p *MergedProfile) FilterFunctions(only, drop []*regexp.Regexp) (stats PruneStats, err error) {
+	if stats.BytesBefore, err = encodedSize(p.profile); err != nil {
+		return stats, err
+	}
+	stats.Samples = dropSamples(p.profile, func(s *profile.Sample) bool {
+		matchesOnly := len(only) == 0
+		for fn := range sampleFunctions(s) {
+			if matchesAny(fn.Name, drop) {
+				return true
+			}
+			matchesOnly = matchesOnly || matchesAny(fn.Name, only)
+		}
+		return !matchesOnly
+	})
+	functionsBefore := len(p.profile.Function)
+	removeUnreferenced(p.profile)
+	stats.Functions = functionsBefore - len(p.profile.Function)
+
+	stats.BytesAfter, err = encodedSize(p.profile)
+	return stats, err
+}
+
+// matchesAny returns true if name matches any of patterns.
+func matchesAny(name string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package pgo
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterFunctions(t *testing.T) {
+	stacks := map[string]int64{
+		"main.main;main.handle;encoding/json.Marshal": 1e7,
+		"main.main;main.handle;main.compress":         2e7,
+		"main.main;main.background":                   3e7,
+		"runtime.gcBgMarkWorker":                      4e7,
+	}
+
+	mp := &MergedProfile{profile: newTestProfile(t, stacks)}
+	stats, err := mp.FilterFunctions(nil, []*regexp.Regexp{regexp.MustCompile(`^main\.compress$`), regexp.MustCompile(`^runtime\.`)})
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Samples)
+	require.Equal(t, 2, stats.Functions)
+	require.Equal(t, []string{
+		"main.main;main.background",
+		"main.main;main.handle;encoding/json.Marshal",
+	}, sortedKeys(stackValues(mp.profile)))
+
+	mp = &MergedProfile{profile: newTestProfile(t, stacks)}
+	stats, err = mp.FilterFunctions([]*regexp.Regexp{regexp.MustCompile(`^main\.handle$`)}, []*regexp.Regexp{regexp.MustCompile(`json`)})
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Samples)
+	require.Equal(t, []string{"main.main;main.handle;main.compress"}, sortedKeys(stackValues(mp.profile)))
+}
@@ -0,0 +1,70 @@
+package pgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	// historyTimeFormat is used to name the files in the history directory.
+	// It sorts lexically in chronological order.
+	historyTimeFormat = "20060102T150405Z"
+	// historySuffix is the file name suffix of the files in the history
+	// directory.
+	historySuffix = ".pgo"
+)
+
+// historyNameRE matches the names of the files written by WriteHistory, so
+// other files in the history directory, e.g. default.pgo, are never pruned.
+var historyNameRE = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z-[0-9]+profiles\.pgo$`)
+
+// WriteHistory writes a timestamped copy of the merged profile to dir and
+// removes the oldest copies so that at most keep copies remain. A keep value
+// of zero or less disables pruning. It returns the path of the new copy and
+// the paths of the pruned copies.
+func (p *MergedProfile) WriteHistory(dir string, keep int, now time.Time) (path string, pruned []string, err error) {
+	defer wrapErr(&err, "write history")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	fileName := fmt.Sprintf("%s-%dprofiles%s", now.UTC().Format(historyTimeFormat), len(p.profileIDs), historySuffix)
+	path = filepath.Join(dir, fileName)
+	if _, err := p.Write(path, 0); err != nil {
+		return "", nil, err
+	}
+	if keep <= 0 {
+		return path, nil, nil
+	}
+	pruned, err = pruneHistory(dir, keep)
+	return path, pruned, err
+}
+
+// pruneHistory removes the oldest history files in dir so that at most keep
+// files remain. Files not written by WriteHistory are ignored. It returns the
+// paths of the removed files.
+func pruneHistory(dir string, keep int) (pruned []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && historyNameRE.MatchString(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		path := filepath.Join(dir, names[0])
+		if err := os.Remove(path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, path)
+		names = names[1:]
+	}
+	return pruned, nil
+}
@@ -0,0 +1,42 @@
+package pgo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHistory(t *testing.T) {
+	dir := t.TempDir()
+	mp := &MergedProfile{
+		profile:    newTestProfile(t, map[string]int64{"main;foo": 1e7}),
+		profileIDs: []string{"a", "b"},
+	}
+	// Other profiles in the directory are not part of the history.
+	for _, name := range []string{"default.pgo", "0-other.pgo", "20230101T000000Z-mine.pgo"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("other"), 0o644))
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 5; i++ {
+		path, pruned, err := mp.WriteHistory(dir, 3, now.Add(time.Duration(i)*time.Hour))
+		require.NoError(t, err)
+		paths = append(paths, path)
+		if i < 3 {
+			require.Empty(t, pruned)
+		} else {
+			require.Equal(t, []string{paths[i-3]}, pruned)
+		}
+	}
+	require.Contains(t, paths[0], "20240101T000000Z-2profiles.pgo")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3+3)
+	require.FileExists(t, filepath.Join(dir, "default.pgo"))
+	require.FileExists(t, filepath.Join(dir, "0-other.pgo"))
+	require.FileExists(t, filepath.Join(dir, "20230101T000000Z-mine.pgo"))
+}
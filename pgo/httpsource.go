@@ -0,0 +1,126 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPSource is a ProfileSource for a generic HTTP profile store.
+//
+// SearchProfiles sends a POST request with the SearchQuery as JSON to
+// URL/search, which must respond with the matching profiles in the requested
+// order:
+//
+//	{"profiles": [{
+//	  "id": "abc", "service": "foo", "version": "v1.2.3", "go_version": "go1.22.1",
+//	  "timestamp": "2024-01-01T00:00:00Z", "duration_seconds": 60, "cpu_cores": 1.5
+//	}]}
+//
+// DownloadProfile sends a GET request to URL/profiles/<id>, which must respond
+// with the pprof file of the profile.
+type HTTPSource struct {
+	// URL is the base URL of the profile store.
+	URL string
+	// HTTPClient is used to send requests, http.DefaultClient is used if it
+	// is nil.
+	HTTPClient *http.Client
+	// ZipLimits bounds the size of downloaded profiles, DefaultZipLimits is
+	// used if it is zero.
+	ZipLimits ZipLimits
+}
+
+// SearchProfiles implements ProfileSource.
+func (s *HTTPSource) SearchProfiles(ctx context.Context, query SearchQuery) (profiles []*SearchProfile, err error) {
+	defer wrapErr(&err, "search profiles")
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.do(ctx, "POST", "/search", body)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Profiles []struct {
+			ID              string    `json:"id"`
+			Service         string    `json:"service"`
+			Version         string    `json:"version"`
+			GoVersion       string    `json:"go_version"`
+			Timestamp       time.Time `json:"timestamp"`
+			DurationSeconds float64   `json:"duration_seconds"`
+			CPUCores        float64   `json:"cpu_cores"`
+		} `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	} else if len(response.Profiles) == 0 {
+		return nil, ErrNoProfiles
+	}
+	for _, p := range response.Profiles {
+		profiles = append(profiles, &SearchProfile{
+			Service:   p.Service,
+			Version:   p.Version,
+			GoVersion: p.GoVersion,
+			CPUCores:  p.CPUCores,
+			ProfileID: p.ID,
+			Timestamp: p.Timestamp,
+			Duration:  time.Duration(p.DurationSeconds * float64(time.Second)),
+		})
+	}
+	if query.Limit > 0 && len(profiles) > query.Limit {
+		profiles = profiles[:query.Limit]
+	}
+	return profiles, nil
+}
+
+// DownloadProfile implements ProfileSource.
+func (s *HTTPSource) DownloadProfile(ctx context.Context, p *SearchProfile) (d ProfileDownload, err error) {
+	defer wrapErr(&err, "download profile")
+	data, err := s.do(ctx, "GET", "/profiles/"+url.PathEscape(p.ProfileID), nil)
+	if err != nil {
+		return ProfileDownload{}, err
+	}
+	return NewPprofDownload(data, s.limits())
+}
+
+// do sends a request to path and returns the response body. It returns an
+// error for non-2xx responses.
+func (s *HTTPSource) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", Name+"/"+Version)
+	hc := s.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		return nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	// Read one byte more than allowed, so oversized profiles are detected.
+	return io.ReadAll(io.LimitReader(res.Body, s.limits().MaxEntryBytes+1))
+}
+
+// limits returns the limits for downloaded profiles.
+func (s *HTTPSource) limits() ZipLimits {
+	if s.ZipLimits == (ZipLimits{}) {
+		return DefaultZipLimits
+	}
+	return s.ZipLimits
+}
@@ -0,0 +1,86 @@
+package pgo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseProfileIDs parses a comma-separated list of profile IDs, e.g. the
+// profile_ids reported by a previous run.
+func ParseProfileIDs(s string) ([]string, error) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		} else if strings.ContainsAny(id, " ()") {
+			return nil, fmt.Errorf("invalid profile id %q", id)
+		} else if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no profile ids in %q", s)
+	}
+	return ids, nil
+}
+
+// ProfileIDsQuery returns a query matching exactly the profiles with the given
+// IDs that were collected within window.
+func ProfileIDsQuery(window time.Duration, ids []string) SearchQuery {
+	return SearchQuery{
+		Filter: SearchFilter{
+			From:  JSONTime{time.Now().Add(-window)},
+			To:    JSONTime{time.Now()},
+			Query: profileIDsFilter(ids),
+		},
+		Sort: SearchSort{
+			Order: "desc",
+			Field: sortFields["timestamp"],
+		},
+		Limit:      len(ids),
+		profileIDs: ids,
+	}
+}
+
+// profileIDsFilter returns the query filter matching the profiles with the
+// given IDs.
+func profileIDsFilter(ids []string) string {
+	return "profile-id:(" + strings.Join(ids, " OR ") + ")"
+}
+
+// splitProfileIDs splits a query of ProfileIDsQuery into queries for chunks
+// of at most n of its IDs. Unlike splitWindow, this never drops profiles that
+// were collected close to each other. Filters added to the query, e.g. by
+// WithQueryFilter, are kept.
+func splitProfileIDs(q SearchQuery, n int) []SearchQuery {
+	rest := strings.TrimPrefix(q.Filter.Query, profileIDsFilter(q.profileIDs))
+	var split []SearchQuery
+	for ids := q.profileIDs; len(ids) > 0; {
+		chunk := ids[:min(n, len(ids))]
+		ids = ids[len(chunk):]
+		sub := q
+		sub.Filter.Query = profileIDsFilter(chunk) + rest
+		sub.Limit = len(chunk)
+		sub.profileIDs = chunk
+		split = append(split, sub)
+	}
+	return split
+}
+
+// MissingProfileIDs returns the ids that are not part of the merged profile.
+func (p *MergedProfile) MissingProfileIDs(ids []string) (missing []string) {
+	merged := map[string]bool{}
+	for _, id := range p.profileIDs {
+		merged[id] = true
+	}
+	for _, id := range ids {
+		if !merged[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
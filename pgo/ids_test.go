@@ -0,0 +1,25 @@
+package pgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileIDs(t *testing.T) {
+	ids, err := ParseProfileIDs(" a, b,,a ,c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, ids)
+	_, err = ParseProfileIDs(" , ")
+	require.Error(t, err)
+	_, err = ParseProfileIDs("a OR b")
+	require.Error(t, err)
+
+	q := ProfileIDsQuery(time.Hour, ids)
+	require.Equal(t, "profile-id:(a OR b OR c)", q.Filter.Query)
+	require.Equal(t, 3, q.Limit)
+
+	mp := &MergedProfile{profileIDs: []string{"c", "a"}}
+	require.Equal(t, []string{"b"}, mp.MissingProfileIDs(ids))
+}
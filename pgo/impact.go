@@ -0,0 +1,131 @@
+package pgo
+
+import (
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// hotCallEdgeCDFPercent is the percentage of the total call edge weight that
+// the compiler considers hot, see inlineCDFHotCallSiteThresholdPercent in
+// cmd/compile/internal/inline.
+const hotCallEdgeCDFPercent = 99
+
+// Impact estimates how much PGO can do with a profile, see EstimateImpact.
+type Impact struct {
+	// CallEdges is the number of distinct call edges, i.e. call sites and
+	// their callees, in the profile.
+	CallEdges int
+	// HotCallEdges is the number of call edges the compiler considers hot.
+	// The calls of hot call edges get a larger inlining budget, so they are
+	// likely to be inlined.
+	HotCallEdges int
+	// HotThresholdPercent is the weight of the coldest hot call edge as a
+	// percentage of the total call edge weight.
+	HotThresholdPercent float64
+	// HotCallers is the number of functions with hot call sites.
+	HotCallers int
+	// HotCallees is the number of functions called by hot call sites.
+	HotCallees int
+	// HotCalleeCPUPercent is the percentage of the total cpu time spent in
+	// the hot callees themselves, i.e. their flat cpu time.
+	HotCalleeCPUPercent float64
+}
+
+// callEdge is a call site, identified by its caller and its line offset
+// from the start of the caller, and its callee.
+type callEdge struct {
+	caller string
+	offset int64
+	callee string
+}
+
+// EstimateImpact returns an estimate of the impact of the cpu profile prof
+// when used for PGO. Like the compiler, it weighs every call edge by the cpu
+// time of the samples whose stacks contain it and considers the hottest edges
+// that make up 99% of the total weight hot. It only estimates which calls are
+// candidates for inlining, whether they are inlined depends on the code.
+func EstimateImpact(prof *profile.Profile) (impact Impact, err error) {
+	defer wrapErr(&err, "estimate impact")
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return impact, err
+	}
+
+	weights := map[callEdge]int64{}
+	flat := map[string]int64{}
+	var totalWeight, totalCPU int64
+	for _, s := range prof.Sample {
+		v := s.Value[cpuIdx]
+		totalCPU += v
+		if leaf, ok := leafLine(s); ok {
+			flat[leaf.Function.Name] += v
+		}
+		// Frames are ordered from the leaf to the root, including inlined
+		// frames. Recursive stacks count each edge once per sample.
+		var frames []profile.Line
+		for _, loc := range s.Location {
+			frames = append(frames, loc.Line...)
+		}
+		seen := map[callEdge]bool{}
+		for i := 0; i+1 < len(frames); i++ {
+			caller, callee := frames[i+1], frames[i]
+			if caller.Function == nil || callee.Function == nil {
+				continue
+			}
+			e := callEdge{caller: caller.Function.Name, offset: caller.Line - caller.Function.StartLine, callee: callee.Function.Name}
+			if !seen[e] {
+				seen[e] = true
+				weights[e] += v
+				totalWeight += v
+			}
+		}
+	}
+
+	impact.CallEdges = len(weights)
+	if totalWeight == 0 {
+		return impact, nil
+	}
+	edges := make([]callEdge, 0, len(weights))
+	for e := range weights {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if weights[a] != weights[b] {
+			return weights[a] > weights[b]
+		} else if a.caller != b.caller {
+			return a.caller < b.caller
+		} else if a.callee != b.callee {
+			return a.callee < b.callee
+		}
+		return a.offset < b.offset
+	})
+
+	// Like the compiler, include the edge that crosses the threshold.
+	callers, callees := map[string]bool{}, map[string]bool{}
+	var cum int64
+	for _, e := range edges {
+		cum += weights[e]
+		impact.HotCallEdges++
+		impact.HotThresholdPercent = percent(weights[e], totalWeight)
+		callers[e.caller], callees[e.callee] = true, true
+		if percent(cum, totalWeight) > hotCallEdgeCDFPercent {
+			break
+		}
+	}
+	impact.HotCallers, impact.HotCallees = len(callers), len(callees)
+	var calleeCPU int64
+	for fn := range callees {
+		calleeCPU += flat[fn]
+	}
+	if totalCPU > 0 {
+		impact.HotCalleeCPUPercent = percent(calleeCPU, totalCPU)
+	}
+	return impact, nil
+}
+
+// percent returns v as a percentage of total.
+func percent(v, total int64) float64 {
+	return float64(v) / float64(total) * 100
+}
@@ -0,0 +1,29 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateImpact(t *testing.T) {
+	prof := newTestProfile(t, map[string]int64{
+		"main;a;b": 90e7,
+		"main;c":   9e7,
+		"main;d":   1e7,
+	})
+	impact, err := EstimateImpact(prof)
+	require.NoError(t, err)
+	// The edges weigh 90 (a;b), 90 (main;a), 9 (main;c) and 1 (main;d), the
+	// first three make up more than 99% of the total.
+	require.Equal(t, 4, impact.CallEdges)
+	require.Equal(t, 3, impact.HotCallEdges)
+	require.InDelta(t, 9.0/190*100, impact.HotThresholdPercent, 1e-9)
+	require.Equal(t, 2, impact.HotCallers)
+	require.Equal(t, 3, impact.HotCallees)
+	require.InDelta(t, 99, impact.HotCalleeCPUPercent, 1e-9)
+
+	impact, err = EstimateImpact(newTestProfile(t, map[string]int64{"main": 1e7}))
+	require.NoError(t, err)
+	require.Equal(t, Impact{}, impact)
+}
@@ -0,0 +1,108 @@
+package pgo
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// debugQueryCommentPrefix prefixes the profile comment holding the debug
+// query, see SetDebugQueryComment.
+const debugQueryCommentPrefix = Name + " debug-query: "
+
+// SetDebugQueryComment stores the DebugQuery of the merged profile in a
+// comment of the profile, replacing any debug query merged from a previous
+// profile. This allows Summarize to report which profiles a PGO file was
+// merged from.
+func (p *MergedProfile) SetDebugQueryComment() {
+	comments := p.profile.Comments[:0]
+	for _, c := range p.profile.Comments {
+		if !strings.HasPrefix(c, debugQueryCommentPrefix) {
+			comments = append(comments, c)
+		}
+	}
+	p.profile.Comments = append(comments, debugQueryCommentPrefix+p.DebugQuery())
+}
+
+// ProfileSummary summarizes a profile, see Summarize.
+type ProfileSummary struct {
+	// Samples is the number of samples in the profile.
+	Samples int
+	// CPUSamples is the number of cpu samples, i.e. the sum of the
+	// samples/count values.
+	CPUSamples int64
+	// CPU is the total cpu time.
+	CPU time.Duration
+	// Time and Duration are the time fields of the profile, see
+	// -profile-times.
+	Time     time.Time
+	Duration time.Duration
+	// TopFunctions are the functions with the highest flat cpu time.
+	TopFunctions []FunctionShare
+	// DebugQuery is the debug query stored by SetDebugQueryComment, if any.
+	DebugQuery string
+	// Impact estimates the impact of the profile on PGO.
+	Impact Impact
+	// Size breaks down the size of the profile.
+	Size SizeStats
+}
+
+// FunctionShare is the flat cpu time of a function.
+type FunctionShare struct {
+	Function string
+	CPU      time.Duration
+	// Percent is the percentage of the total cpu time.
+	Percent float64
+}
+
+// Summarize returns a summary of the cpu profile prof with up to top
+// functions.
+func Summarize(prof *profile.Profile, top int) (summary ProfileSummary, err error) {
+	defer wrapErr(&err, "summarize profile")
+	summary.Samples = len(prof.Sample)
+	if summary.CPUSamples, summary.CPU, err = profileTotals(prof); err != nil {
+		return summary, err
+	}
+	summary.Time = time.Unix(0, prof.TimeNanos).UTC()
+	summary.Duration = time.Duration(prof.DurationNanos)
+	for _, c := range prof.Comments {
+		if q, ok := strings.CutPrefix(c, debugQueryCommentPrefix); ok {
+			summary.DebugQuery = q
+		}
+	}
+
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return summary, err
+	}
+	flat := map[string]int64{}
+	for _, s := range prof.Sample {
+		if leaf, ok := leafLine(s); ok {
+			flat[leaf.Function.Name] += s.Value[cpuIdx]
+		}
+	}
+	for fn, v := range flat {
+		share := FunctionShare{Function: fn, CPU: time.Duration(v)}
+		if summary.CPU > 0 {
+			share.Percent = float64(v) / float64(summary.CPU) * 100
+		}
+		summary.TopFunctions = append(summary.TopFunctions, share)
+	}
+	sort.Slice(summary.TopFunctions, func(i, j int) bool {
+		a, b := summary.TopFunctions[i], summary.TopFunctions[j]
+		if a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		return a.Function < b.Function
+	})
+	if len(summary.TopFunctions) > top {
+		summary.TopFunctions = summary.TopFunctions[:top]
+	}
+	if summary.Impact, err = EstimateImpact(prof); err != nil {
+		return summary, err
+	}
+	summary.Size, err = ProfileSize(prof)
+	return summary, err
+}
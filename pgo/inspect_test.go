@@ -0,0 +1,31 @@
+package pgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	mp := NewMergedProfile(MergeOptions{})
+	require.NoError(t, mp.Merge("a", newTestProfile(t, map[string]int64{"main;foo": 3e7, "main;bar": 1e7})))
+	mp.SetDebugQueryComment()
+	require.NoError(t, mp.Merge("b", newTestProfile(t, map[string]int64{"main;qux": 1e7, "main;baz": 5e6})))
+	mp.SetDebugQueryComment()
+	require.Len(t, mp.Profile().Comments, 1)
+
+	summary, err := Summarize(mp.Profile(), 2)
+	require.NoError(t, err)
+	require.Equal(t, 4, summary.Samples)
+	require.Equal(t, int64(5), summary.CPUSamples)
+	require.Equal(t, 55*time.Millisecond, summary.CPU)
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), summary.Time)
+	require.Equal(t, 2*time.Minute, summary.Duration)
+	require.Equal(t, "profile-id:(a OR b)", summary.DebugQuery)
+	require.Len(t, summary.TopFunctions, 2)
+	require.Equal(t, "foo", summary.TopFunctions[0].Function)
+	require.Equal(t, 30*time.Millisecond, summary.TopFunctions[0].CPU)
+	require.InDelta(t, 54.55, summary.TopFunctions[0].Percent, 0.01)
+	require.Equal(t, "bar", summary.TopFunctions[1].Function)
+}
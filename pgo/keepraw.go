@@ -0,0 +1,39 @@
+package pgo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rawProfilePath returns the path of the raw profile with the given id in dir,
+// see MergeOptions.KeepRawDir. Path separators in id are replaced, so every
+// profile is written directly to dir.
+func rawProfilePath(dir, id string) string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(strings.TrimSuffix(id, ".pprof"))
+	return filepath.Join(dir, name+".pprof")
+}
+
+// keepRaw writes the raw profile data with the given id to dir, see
+// MergeOptions.KeepRawDir.
+func keepRaw(dir, id string, data []byte) (err error) {
+	defer wrapErr(&err, "keep raw profile")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(rawProfilePath(dir, id), data, 0644)
+}
+
+// keepRawReader returns a reader that copies r to the raw profile with the
+// given id in dir while it's read, and a function to close the copy.
+func keepRawReader(dir, id string, r io.Reader) (io.Reader, func() error, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Create(rawProfilePath(dir, id))
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.TeeReader(r, f), f.Close, nil
+}
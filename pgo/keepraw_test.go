@@ -0,0 +1,45 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepRaw(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	raw := buf.Bytes()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("search", func(t *testing.T) {
+		src, keep := t.TempDir(), t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "a.pprof"), raw, 0644))
+		queries, err := BuildQueries(time.Since(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)), 1, nil, []string{"ignored"})
+		require.NoError(t, err)
+		_, err = SearchDownloadMerge(context.Background(), log, &DirSource{Dir: src}, queries, SelectOptions{}, MergeOptions{KeepRawDir: keep})
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(keep, "sub_a.pprof"))
+		require.NoError(t, err)
+		require.Equal(t, raw, got)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		keep := t.TempDir()
+		d := &ProfilesDownload{data: newTestZip(t, map[string][]byte{"p1.pprof": raw}), limits: DefaultZipLimits}
+		mp, err := d.MergedProfile(log, MergeOptions{KeepRawDir: keep})
+		require.NoError(t, err)
+		require.Equal(t, []string{"p1.pprof"}, mp.ProfileIDs())
+		got, err := os.ReadFile(filepath.Join(keep, "p1.pprof"))
+		require.NoError(t, err)
+		require.Equal(t, raw, got)
+	})
+}
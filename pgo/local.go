@@ -0,0 +1,63 @@
+package pgo
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// localPrefix marks QUERY arguments that are glob patterns of local pprof
+// files rather than Datadog queries, e.g. "file:./profiles/*.pprof".
+const localPrefix = "file:"
+
+// SplitLocalArgs splits args into glob patterns of local files (without their
+// prefix) and Datadog queries.
+func SplitLocalArgs(args []string) (patterns, queries []string) {
+	for _, arg := range args {
+		if pattern, ok := strings.CutPrefix(arg, localPrefix); ok {
+			patterns = append(patterns, pattern)
+		} else {
+			queries = append(queries, arg)
+		}
+	}
+	return patterns, queries
+}
+
+// MergeFiles merges the local pprof files matching the glob patterns into the
+// merged profile. Each file is identified by its path. Invalid profiles are
+// skipped just like downloaded profiles, but a pattern without any matches is
+// an error.
+func (p *MergedProfile) MergeFiles(log *slog.Logger, patterns []string) (err error) {
+	defer wrapErr(&err, "merge local files")
+	defer func() {
+		if err != nil {
+			p.Close()
+		}
+	}()
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		} else if len(paths) == 0 {
+			return fmt.Errorf("no files match %q", pattern)
+		}
+		for _, path := range paths {
+			log.Info("merging local profile", "path", path)
+			prof, err := readProfile(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if err := validateProfile(prof, p.opts.profileType()); err != nil {
+				if err := p.skipInvalid(log, path, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.Merge(path, prof); err != nil {
+				return err
+			}
+		}
+	}
+	return p.Finish()
+}
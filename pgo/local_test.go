@@ -0,0 +1,42 @@
+package pgo
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitLocalArgs(t *testing.T) {
+	patterns, queries := SplitLocalArgs([]string{"service:foo", "file:./profiles/*.pprof", "service:bar"})
+	require.Equal(t, []string{"./profiles/*.pprof"}, patterns)
+	require.Equal(t, []string{"service:foo", "service:bar"}, queries)
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, stacks := range map[string]map[string]int64{
+		"a.pprof": {"main;foo": 1e7},
+		"b.pprof": {"main;foo": 2e7, "main;bar": 1e7},
+	} {
+		f, err := os.Create(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.NoError(t, newTestProfile(t, stacks).Write(f))
+		require.NoError(t, f.Close())
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a profile"), 0644))
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mp := NewMergedProfile(MergeOptions{})
+	require.NoError(t, mp.MergeFiles(log, []string{filepath.Join(dir, "*.pprof")}))
+	require.Len(t, mp.profileIDs, 2)
+	require.Equal(t, map[string][]int64{"main;foo": {3, 3e7}, "main;bar": {1, 1e7}}, stackValues(mp.profile))
+
+	err := mp.MergeFiles(log, []string{filepath.Join(dir, "*.missing")})
+	require.ErrorContains(t, err, "no files match")
+	err = mp.MergeFiles(log, []string{filepath.Join(dir, "*.txt")})
+	require.Error(t, err)
+}
@@ -0,0 +1,942 @@
+package pgo
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// BuildQueries returns a list of SearchQuery for the given time window and
+// queries. Each query is searched once per sort field, the default sort field
+// is used if sorts is empty.
+func BuildQueries(window time.Duration, limit int, sorts []string, queries []string) (searchQueries []SearchQuery, err error) {
+	if len(sorts) == 0 {
+		sorts = []string{DefaultSortField}
+	}
+	searchQueries = make([]SearchQuery, 0, len(queries)*len(sorts))
+	now := time.Now()
+	for _, q := range queries {
+		// Split off the optional weight suffix
+		q, weight, err := parseQueryWeight(q)
+		if err != nil {
+			return nil, err
+		} else if err := ValidateQuery(q); err != nil {
+			return nil, err
+		}
+
+		// PGO is only supported for Go right now, avoid fetching non-go
+		// profiles (e.g. from native) that might exist for the same query.
+		if !strings.Contains(q, "language:go") && !strings.Contains(q, "runtime:go") {
+			q = strings.TrimSpace(q) + " runtime:go"
+		}
+
+		for _, field := range sorts {
+			searchQueries = append(searchQueries, SearchQuery{
+				Filter: SearchFilter{
+					From:  JSONTime{now.Add(-window)},
+					To:    JSONTime{now},
+					Query: q,
+				},
+				Sort: SearchSort{
+					Order: "desc",
+					Field: field,
+				},
+				Limit:  limit,
+				Weight: weight,
+			})
+		}
+	}
+	return
+}
+
+// maxPGOEndpointProfiles is the maximum number of profiles the pgo endpoint
+// can return for a single request. Larger requests are split, see
+// splitPGOQueries.
+const maxPGOEndpointProfiles = 30
+
+// usePGOEndpoint returns true if the profiles matching queries can be fetched
+// using the pgo endpoint instead of the search and download endpoints. This is
+// not the case if the select options require filtering the search results on
+// the client side, if the same query is searched multiple times and the
+// results need to be deduplicated, if the versions of the profiles are
+// needed, or for profile types other than cpu.
+func usePGOEndpoint(queries []SearchQuery, sel SelectOptions, opts MergeOptions) bool {
+	return !sel.RequiresSearch() && !opts.TrackVersions && !hasDuplicateQueries(queries) && opts.profileType() == ProfileTypeCPU
+}
+
+// pgoEndpointFailed returns true if err indicates that the pgo endpoint is
+// unavailable or can't handle the request, so the search and download
+// endpoints should be used instead.
+func pgoEndpointFailed(err error) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode >= 500)
+}
+
+// SearchDownloadMerge queries the profiles of source, downloads them and merges
+// them into a single profile. If source is a Client, the pgo endpoint is used
+// if possible, see usePGOEndpoint, unless queries search other orgs, see
+// Client.AddOrg. If it fails with a 404 or server error, the search and
+// download endpoints are used instead.
+func SearchDownloadMerge(ctx context.Context, log *slog.Logger, source ProfileSource, queries []SearchQuery, sel SelectOptions, opts MergeOptions) (mp *MergedProfile, err error) {
+	client, isClient := source.(*Client)
+	if hasQueryWeights(queries) {
+		mp, err = searchDownloadMergeWeighted(ctx, log, source, queries, sel, opts)
+	} else if isClient && usePGOEndpoint(queries, sel, opts) && !client.hasOrgQueries(queries) {
+		mp, err = searchDownloadMergePGOBatches(ctx, log, client, queries, opts)
+		if pgoEndpointFailed(err) {
+			log.Warn("pgo endpoint failed, falling back to downloading profiles individually", "error", err)
+			mp, err = searchDownloadMerge(ctx, log, source, queries, sel, opts)
+		}
+	} else {
+		mp, err = searchDownloadMerge(ctx, log, source, queries, sel, opts)
+	}
+	if err != nil {
+		return nil, err
+	} else if err := mp.Finish(); err != nil {
+		return nil, err
+	} else if len(mp.profileIDs) == 0 && mp.skipped > 0 {
+		return nil, fmt.Errorf("%w: skipped %d invalid profiles", ErrNoProfiles, mp.skipped)
+	} else if len(mp.profileIDs) == 0 {
+		return nil, ErrNoProfiles
+	}
+	return mp, nil
+}
+
+// searchDownloadMerge queries the profiles, downloads them and merges them into a single profile.
+func searchDownloadMerge(ctx context.Context, log *slog.Logger, source ProfileSource, queries []SearchQuery, sel SelectOptions, opts MergeOptions) (*MergedProfile, error) {
+	newPool := func() *pool.ContextPool {
+		return pool.New().WithErrors().WithContext(ctx).WithCancelOnError().WithFirstError()
+	}
+
+	// Each query merges its profiles into its own accumulator, so downloads of
+	// different queries don't contend on the same lock. The accumulators are
+	// reduced into a single profile at the end.
+	accumulators := make([]*MergedProfile, len(queries))
+	// Accumulators that aren't finished because of an error still have to
+	// remove their spilled chunks.
+	defer func() {
+		for _, acc := range accumulators {
+			if acc != nil {
+				acc.Close()
+			}
+		}
+	}()
+	// Profiles matched by multiple queries are only downloaded once.
+	var claimed profileSet
+	// At most MaxInFlight profiles are downloaded, parsed or waiting to be
+	// merged at the same time, and parsing and preparing profiles is limited
+	// to ParseWorkers at a time, independently of the downloads. See
+	// MergeOptions.
+	limits := opts.mergeLimits()
+	inFlight, parsing := limits.inFlight, limits.parsing
+	opts.Progress.addQueries(len(queries))
+	// Failed downloads are skipped if MinSuccessRatio allows it.
+	var failed failedDownloads
+	var attempted atomic.Int32
+	queryPool := newPool()
+	downloadPool := newPool()
+	for i, q := range queries {
+		q := q
+		pgoProfile := NewMergedProfile(opts)
+		accumulators[i] = pgoProfile
+		queryPool.Go(func(ctx context.Context) (err error) {
+			ctx, searchSpan := StartSpan(ctx, "search", "query", q.Filter.Query)
+			defer func() { searchSpan.End(err) }()
+			log.Info(
+				"searching profiles",
+				"query", q.Filter.Query,
+				"by", q.Sort.Field,
+				"order", q.Sort.Order,
+				"from", q.Filter.From.String(),
+				"to", q.Filter.To.String(),
+			)
+			startQuery := time.Now()
+			profiles, err := source.SearchProfiles(ctx, sel.searchQuery(q))
+			if errors.Is(err, ErrNoProfiles) {
+				log.Warn("no profiles found", "query", q.Filter.Query)
+				opts.Progress.addSearched(1, 0)
+				return nil
+			} else if err != nil {
+				return err
+			}
+			log.Debug(
+				"found profiles",
+				"count", len(profiles),
+				"duration", timeSinceRoundMS(startQuery),
+				"query", q.Filter.Query,
+			)
+
+			if profiles = sel.Select(log, profiles); len(profiles) > q.Limit {
+				profiles = profiles[:q.Limit]
+			}
+
+			searchSpan.SetAttributes("profiles", len(profiles))
+			var claimedProfiles []*SearchProfile
+			for _, p := range profiles {
+				if !claimed.Claim(p.ProfileID) {
+					log.Debug("skipping duplicate profile", "profile-id", p.ProfileID, "query", q.Filter.Query, "by", q.Sort.Field)
+					continue
+				}
+				claimedProfiles = append(claimedProfiles, p)
+			}
+			opts.Progress.addSearched(1, len(claimedProfiles))
+			for _, p := range claimedProfiles {
+				p := p
+				attempted.Add(1)
+				downloadPool.Go(func(ctx context.Context) (err error) {
+					var merged bool
+					defer func() {
+						if merged {
+							opts.Progress.addMerged(1)
+						} else {
+							opts.Progress.addFailed()
+						}
+					}()
+					defer func() {
+						if err != nil && opts.MinSuccessRatio > 0 && ctx.Err() == nil {
+							log.Warn("failed to download profile, skipping it", "profile-id", p.ProfileID, "error", err)
+							failed.add(p.ProfileID, err)
+							err = nil
+						}
+					}()
+					if inFlight != nil {
+						select {
+						case inFlight <- struct{}{}:
+							defer func() { <-inFlight }()
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					}
+					ctx, downloadSpan := StartSpan(withSpan(ctx, searchSpan), "download", "profile-id", p.ProfileID)
+					defer func() { downloadSpan.End(err) }()
+					log.Info(
+						"downloading profile",
+						"service", p.Service,
+						"cpu-cores", float64(int(p.CPUCores*10))/10,
+						"duration", p.Duration,
+						"age", time.Since(p.Timestamp).Round(time.Second),
+						"profile-id", p.ProfileID,
+					)
+					startDownload := time.Now()
+					download, err := source.DownloadProfile(ctx, p)
+					if err != nil {
+						return err
+					}
+					defer download.Close()
+					opts.Progress.addDownloaded(1, download.Size())
+					downloadSpan.SetAttributes("bytes", download.Size())
+					log.Debug(
+						"downloaded profile",
+						"duration", timeSinceRoundMS(startDownload),
+						"bytes", download.Size(),
+						"profile-id", p.ProfileID,
+						"event-id", p.EventID,
+					)
+
+					data, err := download.ExtractProfile(opts.profileType())
+					if err != nil {
+						return err
+					} else if opts.KeepRawDir != "" {
+						if err := keepRaw(opts.KeepRawDir, p.ProfileID, data); err != nil {
+							return err
+						}
+					}
+
+					select {
+					case parsing <- struct{}{}:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					prepared, err := func() (_ *preparedProfile, err error) {
+						defer func() { <-parsing }()
+						_, parseSpan := StartSpan(ctx, "parse", "profile-id", p.ProfileID)
+						defer func() { parseSpan.End(err) }()
+						prof, err := profile.ParseData(data)
+						if err == nil {
+							err = validateProfile(prof, opts.profileType())
+						}
+						if err != nil {
+							return nil, pgoProfile.skipInvalid(log, p.ProfileID, err)
+						}
+						return pgoProfile.prepare(p.ProfileID, prof)
+					}()
+					if err != nil || prepared == nil {
+						return err
+					}
+					_, mergeSpan := StartSpan(ctx, "merge", "profile-id", p.ProfileID)
+					err = pgoProfile.mergePrepared(prepared)
+					mergeSpan.End(err)
+					if err != nil {
+						return err
+					}
+					pgoProfile.countQuery(q.Filter.Query)
+					pgoProfile.setVersion(p.ProfileID, p.Version)
+					merged = true
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	if err := queryPool.Wait(); err != nil {
+		return nil, err
+	} else if err := downloadPool.Wait(); err != nil {
+		return nil, err
+	} else if err := failed.check(int(attempted.Load()), opts.MinSuccessRatio); err != nil {
+		return nil, err
+	} else if ids := failed.IDs(); len(ids) > 0 {
+		log.Warn("skipped profiles that failed to download", "count", len(ids), "attempted", attempted.Load(), "profile-ids", strings.Join(ids, ","))
+	}
+	_, reduceSpan := StartSpan(ctx, "reduce", "queries", len(queries))
+	mp, err := reduceMerged(accumulators, opts)
+	reduceSpan.End(err)
+	return mp, err
+}
+
+// searchDownloadMergePGOEndpoint queries the profiles and downloads them using
+// the new pgo endpoint. Then it merges hte profiles into a single profile using
+// the pgo endpoint.
+func searchDownloadMergePGOEndpoint(ctx context.Context, log *slog.Logger, client *Client, queries []SearchQuery, opts MergeOptions) (*MergedProfile, error) {
+	_, downloadSpan := StartSpan(ctx, "search_and_download", "queries", len(queries))
+	opts.Progress.addQueries(len(queries))
+	download, err := client.SearchAndDownloadProfiles(ctx, queries)
+	if err != nil {
+		// The queries may be searched again without the pgo endpoint.
+		opts.Progress.addQueries(-len(queries))
+		downloadSpan.End(err)
+		return nil, err
+	}
+	defer download.Close()
+	downloadSpan.SetAttributes("bytes", download.Size())
+	downloadSpan.End(nil)
+
+	_, mergeSpan := StartSpan(ctx, "merge")
+	mp, err := download.MergedProfile(log, opts)
+	if err != nil {
+		mergeSpan.End(err)
+		return nil, err
+	}
+	mergeSpan.SetAttributes("profiles", len(mp.profileIDs))
+	mergeSpan.End(nil)
+	// The pgo endpoint searches and merges the profiles at once.
+	opts.Progress.addSearched(len(queries), len(mp.profileIDs))
+	opts.Progress.addDownloaded(len(mp.profileIDs), download.Size())
+	opts.Progress.addMerged(len(mp.profileIDs))
+	// The profiles can only be attributed to a query if there is just one.
+	if len(queries) == 1 {
+		mp.queryProfiles = map[string]int{queries[0].Filter.Query: len(mp.profileIDs)}
+	}
+	return mp, nil
+}
+
+// MergeOptions controls how profiles are merged into a MergedProfile.
+type MergeOptions struct {
+	// SpillChunk is the number of profiles to merge in memory before the
+	// intermediate result is spilled to disk. Zero disables spilling.
+	SpillChunk int
+	// ProfileType is the type of the profiles to merge, see the ProfileType
+	// constants. It defaults to ProfileTypeCPU.
+	ProfileType string
+	// SkipLogLevel controls how skipped profiles are logged. See the
+	// skipLogLevel constants for the supported values.
+	SkipLogLevel string
+	// MaxLocationDepth truncates the stack of each sample to this many frames
+	// closest to the leaf before merging. Zero disables truncation.
+	MaxLocationDepth int
+	// PreAggregateTopK drops the samples of each cpu profile whose leaf
+	// function isn't one of the K hottest leaf functions of the profile
+	// before it's merged, which makes merging many profiles faster and use
+	// less memory. Zero disables it.
+	PreAggregateTopK int
+	// MergeOp controls how the values of identical stacks are combined. See
+	// the mergeOp constants for the supported values.
+	MergeOp string
+	// MaxInFlight is the maximum number of profiles that are downloaded,
+	// parsed or waiting to be merged at the same time. Profiles are merged
+	// one at a time, so this bounds the memory used by profiles that are not
+	// merged yet, at the cost of overlapping fewer downloads with merging.
+	// Zero only limits the concurrency of the downloads themselves.
+	MaxInFlight int
+	// ParseWorkers is the maximum number of downloaded profiles that are
+	// parsed and prepared for merging at the same time. Parsing is CPU-bound,
+	// so it's limited separately from the downloads, which mostly wait for
+	// the network. Zero uses GOMAXPROCS.
+	ParseWorkers int
+	// MinSuccessRatio is the minimum fraction of the searched profiles that
+	// must download successfully. Profiles that fail to download are skipped
+	// as long as it's met. Zero fails the merge on the first failed download.
+	MinSuccessRatio float64
+	// Strict fails the merge if a profile can't be parsed or is invalid,
+	// see validateProfile. By default, such profiles are skipped.
+	Strict bool
+	// Progress is updated as the profiles are searched, downloaded and
+	// merged. Nil disables it.
+	Progress *Progress
+	// KeepRawDir is a directory that every downloaded profile is written to
+	// before it's merged, named after its profile ID. Empty disables it.
+	KeepRawDir string
+	// TrackVersions forces the use of the search and download endpoints,
+	// which know the version of every profile, see VersionShares. The pgo
+	// endpoint doesn't return the versions.
+	TrackVersions bool
+
+	// limits are shared by concurrent calls of searchDownloadMerge, e.g. for
+	// the groups of searchDownloadMergeWeighted, so MaxInFlight and
+	// ParseWorkers apply to all of them together. Nil uses new limits.
+	limits *mergeLimits
+}
+
+// mergeLimits bounds the number of profiles in flight and being parsed, see
+// MergeOptions.MaxInFlight and MergeOptions.ParseWorkers.
+type mergeLimits struct {
+	// inFlight is nil if MaxInFlight is not set.
+	inFlight chan struct{}
+	parsing  chan struct{}
+}
+
+// mergeLimits returns the limits shared by the merges using o, or new limits
+// if there are none.
+func (o MergeOptions) mergeLimits() *mergeLimits {
+	if o.limits != nil {
+		return o.limits
+	}
+	l := &mergeLimits{}
+	if o.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, o.MaxInFlight)
+	}
+	parseWorkers := o.ParseWorkers
+	if parseWorkers <= 0 {
+		parseWorkers = runtime.GOMAXPROCS(0)
+	}
+	l.parsing = make(chan struct{}, parseWorkers)
+	return l
+}
+
+// MergedProfile is the result of merging multiple profiles.
+type MergedProfile struct {
+	mu            sync.Mutex
+	opts          MergeOptions
+	profile       *profile.Profile
+	profileIDs    []string
+	profileInfos  []ProfileInfo
+	queryProfiles map[string]int
+	trimStats     TrimStats
+	oldest        time.Time
+	newest        time.Time
+	durationSum   int64
+	durationMax   int64
+	skipped       int
+	spill         *spiller
+	// maxValues holds the maximum values of each stack across the merged
+	// profiles if MergeOp is MergeOpMax.
+	maxValues map[string][]int64
+}
+
+// NewMergedProfile returns a new MergedProfile using the given options.
+func NewMergedProfile(opts MergeOptions) *MergedProfile {
+	return &MergedProfile{opts: opts}
+}
+
+// Merge merges prof into the current profile. Callers must not use prof after
+// calling Merge.
+func (p *MergedProfile) Merge(id string, prof *profile.Profile) error {
+	prepared, err := p.prepare(id, prof)
+	if err != nil {
+		return err
+	}
+	return p.mergePrepared(prepared)
+}
+
+// preparedProfile is a profile that is ready to be merged, see
+// MergedProfile.prepare.
+type preparedProfile struct {
+	id     string
+	prof   *profile.Profile
+	stats  TrimStats
+	values map[string][]int64
+	info   ProfileInfo
+}
+
+// prepare does the work of merging prof that doesn't need the lock of p, so
+// multiple profiles can be prepared in parallel. Callers must not use prof
+// afterwards.
+func (p *MergedProfile) prepare(id string, prof *profile.Profile) (*preparedProfile, error) {
+	// Drop labels to reduce profile size
+	for _, s := range prof.Sample {
+		s.Label = nil
+	}
+
+	// Trim the profile before merging it
+	stats, err := trimProfile(prof, p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compute stack values and profile info before taking the lock
+	var values map[string][]int64
+	if p.opts.MergeOp == MergeOpMax {
+		values = stackMaxValues(prof)
+	}
+	return &preparedProfile{id: id, prof: prof, stats: stats, values: values, info: newProfileInfo(id, prof)}, nil
+}
+
+// mergePrepared merges a profile returned by prepare into the current
+// profile.
+func (p *MergedProfile) mergePrepared(pp *preparedProfile) (err error) {
+	id, prof, stats, values, info := pp.id, pp.prof, pp.stats, pp.values, pp.info
+
+	// Acquire lock to access p fields
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if values != nil {
+		if p.maxValues == nil {
+			p.maxValues = map[string][]int64{}
+		}
+		maxInto(p.maxValues, values)
+	}
+
+	// Append profile ID, trim stats and time range
+	p.profileIDs = append(p.profileIDs, id)
+	p.profileInfos = append(p.profileInfos, info)
+	p.trimStats.add(stats)
+	p.addTime(time.Unix(0, prof.TimeNanos))
+	p.addDuration(prof.DurationNanos)
+
+	// First profile? No need to merge.
+	if p.profile == nil {
+		p.profile = prof
+		return p.maybeSpill()
+	}
+
+	// Merge profiles after the first one.
+	if p.profile, err = profile.Merge([]*profile.Profile{p.profile, prof}); err != nil {
+		return err
+	}
+	return p.maybeSpill()
+}
+
+// countQuery records that a profile matching query was merged.
+func (p *MergedProfile) countQuery(query string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.queryProfiles == nil {
+		p.queryProfiles = map[string]int{}
+	}
+	p.queryProfiles[query]++
+}
+
+// setVersion records the version of the merged profile with the given id.
+func (p *MergedProfile) setVersion(id, version string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.profileInfos) - 1; i >= 0; i-- {
+		if p.profileInfos[i].ID == id {
+			p.profileInfos[i].Version = version
+			return
+		}
+	}
+}
+
+// Finish completes the merge. It must be called after the last call to Merge
+// and before the merged profile is used.
+func (p *MergedProfile) Finish() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.spill == nil {
+		return nil
+	}
+	defer p.spill.Close()
+	merged, err := p.spill.MergeChunks(p.profile)
+	if err != nil {
+		return err
+	}
+	p.profile = merged
+	p.spill = nil
+	return nil
+}
+
+// Close removes the chunks spilled to disk by an unfinished merge, e.g. if
+// the merge is abandoned because of an error. It does nothing after Finish
+// and may be called multiple times.
+func (p *MergedProfile) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.spill == nil {
+		return nil
+	}
+	err := p.spill.Close()
+	p.spill = nil
+	return err
+}
+
+// ApplyNoInlineHack renames functions that lead to bad inlining decisions, see
+// ApplyNoInlineHack.
+func (p *MergedProfile) ApplyNoInlineHack(funcs ...*regexp.Regexp) error {
+	return ApplyNoInlineHack(p.profile, funcs...)
+}
+
+// Write writes the merged profile to dst and returns the number of bytes
+// written. The profile is written to a temporary file in the same directory
+// first, which is then renamed to dst. This guarantees that dst is either left
+// untouched or replaced with a complete file, even if writing fails halfway.
+// The profile is normalized before writing, so merging the same profiles
+// always produces the same file, regardless of the merge order.
+//
+// A zero mode creates dst with the same permissions as os.Create, i.e. 0666
+// minus the umask. Otherwise dst is set to exactly mode, regardless of the
+// umask.
+func (p *MergedProfile) Write(dst string, mode os.FileMode) (n int64, err error) {
+	return p.WriteLevel(dst, mode, DefaultCompressionLevel)
+}
+
+// WriteLevel is like Write, but compresses the profile with the given gzip
+// level, from 1 for the fastest to 9 for the smallest file. Level 0 writes
+// the profile uncompressed, which the go toolchain accepts as well.
+func (p *MergedProfile) WriteLevel(dst string, mode os.FileMode, level int) (n int64, err error) {
+	if err := ValidCompressionLevel(level); err != nil {
+		return 0, err
+	}
+	file, err := createTemp(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	normalizeProfile(p.profile)
+	cw := &countingWriter{W: file}
+	if err := writeProfile(cw, p.profile, level); err != nil {
+		return cw.N, err
+	} else if err := file.Close(); err != nil {
+		return cw.N, err
+	} else if mode == 0 {
+		// Nothing to do, the umask was applied when creating the file.
+	} else if err := os.Chmod(file.Name(), mode); err != nil {
+		return cw.N, err
+	}
+	return cw.N, os.Rename(file.Name(), dst)
+}
+
+// Profile returns the merged profile. It is nil if no profiles were merged.
+func (p *MergedProfile) Profile() *profile.Profile {
+	return p.profile
+}
+
+// ProfileIDs returns the ids of the merged profiles.
+func (p *MergedProfile) ProfileIDs() []string {
+	return p.profileIDs
+}
+
+// QueryProfiles returns the number of merged profiles per query. Queries for
+// which the number is unknown are missing.
+func (p *MergedProfile) QueryProfiles() map[string]int {
+	return p.queryProfiles
+}
+
+// TrimStats returns the amount of data removed by truncating deep stacks.
+func (p *MergedProfile) TrimStats() TrimStats {
+	return p.trimStats
+}
+
+// Samples returns the number of samples in the merged profile.
+func (p *MergedProfile) Samples() int {
+	return len(p.profile.Sample)
+}
+
+// addTime extends the time range of the merged profiles to include t. Callers
+// must hold p.mu.
+func (p *MergedProfile) addTime(t time.Time) {
+	if p.oldest.IsZero() || t.Before(p.oldest) {
+		p.oldest = t
+	}
+	if p.newest.IsZero() || t.After(p.newest) {
+		p.newest = t
+	}
+}
+
+// OldestAge returns the age of the oldest merged profile.
+func (p *MergedProfile) OldestAge() time.Duration {
+	return time.Since(p.oldest).Round(time.Second)
+}
+
+// NewestAge returns the age of the newest merged profile.
+func (p *MergedProfile) NewestAge() time.Duration {
+	return time.Since(p.newest).Round(time.Second)
+}
+
+// ProfileInfos returns information about the merged profiles.
+func (p *MergedProfile) ProfileInfos() []ProfileInfo {
+	return p.profileInfos
+}
+
+// ProfileInfo describes a profile merged into a MergedProfile.
+type ProfileInfo struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration_seconds"`
+	CPUCores float64   `json:"cpu_cores"`
+	Samples  int       `json:"samples"`
+	// Version is the version tag of the profile. It's only known for
+	// profiles found with the search endpoint.
+	Version string `json:"version,omitempty"`
+}
+
+// newProfileInfo returns the info of profile prof with the given id.
+func newProfileInfo(id string, prof *profile.Profile) ProfileInfo {
+	// Profiles without a cpu sample type were rejected by validateProfile.
+	cores, _ := cpuCores(prof)
+	return ProfileInfo{
+		ID:       id,
+		Time:     time.Unix(0, prof.TimeNanos).UTC(),
+		Duration: time.Duration(prof.DurationNanos).Seconds(),
+		CPUCores: cores,
+		Samples:  len(prof.Sample),
+	}
+}
+
+// DebugQuery returns a query string that can be used to view the profiles that
+// went into the merged profile.
+func (p *MergedProfile) DebugQuery() string {
+	return "profile-id:(" + strings.Join(p.profileIDs, " OR ") + ")"
+}
+
+// ProfileDownload is the result of downloading a profile. It must be closed
+// after use.
+type ProfileDownload struct {
+	data []byte
+	// file holds the archive instead of data if it was streamed to a
+	// temporary file, see partialDownload. Its entries are read with
+	// ZipLimits.OpenEntry.
+	file   *os.File
+	size   int64
+	limits ZipLimits
+	// pprof is true if data is a single pprof file instead of a zip archive,
+	// see NewPprofDownload.
+	pprof bool
+}
+
+// Size returns the size of the download in bytes.
+func (d ProfileDownload) Size() int64 {
+	if d.file != nil {
+		return d.size
+	}
+	return int64(len(d.data))
+}
+
+// Close removes the temporary file holding the download, if any.
+func (d ProfileDownload) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	return removeTemp(d.file)
+}
+
+// ExtractProfile extracts the profile of the given type from the download,
+// e.g. ProfileTypeCPU.
+func (d ProfileDownload) ExtractProfile(typ string) ([]byte, error) {
+	if err := ValidateProfileType(typ); err != nil {
+		return nil, err
+	} else if d.pprof {
+		// The type of a single pprof file is checked by validateProfile.
+		return d.data, nil
+	}
+	zr, err := openArchive(d.limits, d.data, d.file, d.size)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range profileTypeFiles[typ] {
+		for _, f := range zr.File {
+			if filepath.Base(f.Name) == name {
+				rc, err := d.limits.OpenEntry(f)
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			}
+		}
+	}
+	return nil, fmt.Errorf("no %s found in download", strings.Join(profileTypeFiles[typ], " or "))
+}
+
+// openArchive opens the archive held in data, or in the first size bytes of
+// file if it's not nil.
+func openArchive(limits ZipLimits, data []byte, file *os.File, size int64) (*zip.Reader, error) {
+	if file != nil {
+		return limits.OpenArchiveReader(file, size)
+	}
+	return limits.OpenArchive(data)
+}
+
+// ProfilesDownload is the result of downloading several profiles from the pgo
+// endpoint. It must be closed after use.
+type ProfilesDownload struct {
+	data []byte
+	// file holds the archive instead of data if it was streamed to a
+	// temporary file, see partialDownload. Its entries are read with
+	// ZipLimits.OpenEntry.
+	file   *os.File
+	size   int64
+	limits ZipLimits
+}
+
+// Size returns the size of the download in bytes.
+func (d *ProfilesDownload) Size() int64 {
+	if d.file != nil {
+		return d.size
+	}
+	return int64(len(d.data))
+}
+
+// Close removes the temporary file holding the download, if any.
+func (d *ProfilesDownload) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	return removeTemp(d.file)
+}
+
+// MergeProfile merges the profiles in the download into a single profile. The
+// profiles are extracted and merged one at a time.
+func (d *ProfilesDownload) MergedProfile(log *slog.Logger, opts MergeOptions) (_ *MergedProfile, err error) {
+	zr, err := openArchive(d.limits, d.data, d.file, d.size)
+	if err != nil {
+		return nil, err
+	}
+
+	var pgoProfile = NewMergedProfile(opts)
+	defer func() {
+		if err != nil {
+			pgoProfile.Close()
+		}
+	}()
+	for _, f := range zr.File {
+		if err := d.mergeEntry(log, opts, pgoProfile, f); err != nil {
+			return nil, err
+		}
+	}
+	return pgoProfile, nil
+}
+
+// mergeEntry extracts the profile in the archive entry f and merges it into
+// pgoProfile.
+func (d *ProfilesDownload) mergeEntry(log *slog.Logger, opts MergeOptions, pgoProfile *MergedProfile, f *zip.File) (err error) {
+	rc, err := d.limits.OpenEntry(f)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := rc.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	var r io.Reader = rc
+	closeRaw := func() error { return nil }
+	if opts.KeepRawDir != "" {
+		if r, closeRaw, err = keepRawReader(opts.KeepRawDir, f.Name, rc); err != nil {
+			return fmt.Errorf("keep raw profile: %w", err)
+		}
+	}
+	prof, err := profile.Parse(r)
+	if closeErr := closeRaw(); closeErr != nil {
+		return fmt.Errorf("keep raw profile: %w", closeErr)
+	} else if err == nil {
+		err = validateProfile(prof, opts.profileType())
+	}
+	if err != nil {
+		return pgoProfile.skipInvalid(log, f.Name, err)
+	}
+	if err := pgoProfile.Merge(f.Name, prof); err != nil {
+		return err
+	}
+
+	seconds := prof.TimeNanos / int64(time.Second)
+	nanoseconds := prof.TimeNanos % int64(time.Second)
+	t := time.Unix(seconds, nanoseconds)
+
+	cores, err := cpuCores(prof)
+	if err != nil {
+		log.Warn("failed to extract cpu cores", "error", err)
+	}
+
+	log.Info(
+		"extracted profile",
+		// "service", p.Service, TODO: can we get this?
+		"cpu-cores", float64(int(cores*10))/10,
+		"duration", time.Duration(prof.DurationNanos),
+		"age", time.Since(t).Round(time.Second),
+		"profile-id", f.Name,
+	)
+	return nil
+}
+
+// cpuCores returns the number of CPU cores used in the profile.
+func cpuCores(prof *profile.Profile) (float64, error) {
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return 0, err
+	}
+	var cpuNanos int64
+	for _, s := range prof.Sample {
+		if len(s.Value) <= int(cpuIdx) {
+			return 0, errors.New("invalid sample value")
+		}
+		cpuNanos += s.Value[cpuIdx]
+	}
+	return float64(cpuNanos) / float64(prof.DurationNanos), nil
+}
+
+// cpuSampleIndex returns the index of the cpu sample type in the profile.
+func cpuSampleIndex(prof *profile.Profile) (int, error) {
+	for idx, st := range prof.SampleType {
+		if st.Type == "cpu" && st.Unit == "nanoseconds" {
+			return idx, nil
+		}
+	}
+	return -1, errors.New("no cpu sample type found")
+}
+
+// wrapErr wraps the error with name if it is not nil.
+func wrapErr(err *error, name string) {
+	if *err != nil {
+		*err = fmt.Errorf("%s: %w", name, *err)
+	}
+}
+
+// timeSinceRoundMS returns the time since t rounded to the nearest millisecond.
+func timeSinceRoundMS(t time.Time) time.Duration {
+	return time.Since(t) / time.Millisecond * time.Millisecond
+}
+
+// countingWriter counts the number of bytes written to W.
+type countingWriter struct {
+	W io.Writer
+	N int64
+}
+
+// Write writes p to W and updates N.
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.W.Write(p)
+	c.N += int64(n)
+	return
+}
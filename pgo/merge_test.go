@@ -0,0 +1,188 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProfile returns a cpu profile with one sample per entry in stacks.
+// Each key is a semicolon separated list of function names from root to
+// leaf, and each value is the cpu time in nanoseconds.
+func newTestProfile(t testing.TB, stacks map[string]int64) *profile.Profile {
+	t.Helper()
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		PeriodType:    &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        int64(10 * time.Millisecond),
+		TimeNanos:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+		DurationNanos: int64(time.Minute),
+	}
+	functions := map[string]*profile.Function{}
+	locations := map[string]*profile.Location{}
+	for stack, value := range stacks {
+		frames := strings.Split(stack, ";")
+		sample := &profile.Sample{Value: []int64{value / prof.Period, value}}
+		for i := len(frames) - 1; i >= 0; i-- {
+			fnName := frames[i]
+			loc, ok := locations[fnName]
+			if !ok {
+				fn := &profile.Function{ID: uint64(len(functions) + 1), Name: fnName, SystemName: fnName, Filename: "main.go"}
+				functions[fnName] = fn
+				loc = &profile.Location{ID: uint64(len(locations) + 1), Line: []profile.Line{{Function: fn, Line: int64(len(locations) + 1)}}}
+				locations[fnName] = loc
+				prof.Function = append(prof.Function, fn)
+				prof.Location = append(prof.Location, loc)
+			}
+			sample.Location = append(sample.Location, loc)
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+	require.NoError(t, prof.CheckValid())
+	return prof
+}
+
+// stackValues returns the values of all samples in prof keyed by their stack
+// in the same format as accepted by newTestProfile.
+func stackValues(prof *profile.Profile) map[string][]int64 {
+	values := map[string][]int64{}
+	for _, s := range prof.Sample {
+		var frames []string
+		for i := len(s.Location) - 1; i >= 0; i-- {
+			for j := len(s.Location[i].Line) - 1; j >= 0; j-- {
+				frames = append(frames, s.Location[i].Line[j].Function.Name)
+			}
+		}
+		key := strings.Join(frames, ";")
+		if prev, ok := values[key]; ok {
+			for i := range prev {
+				prev[i] += s.Value[i]
+			}
+			continue
+		}
+		values[key] = append([]int64(nil), s.Value...)
+	}
+	return values
+}
+
+func TestMergedProfileWrite(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "default.pgo")
+	require.NoError(t, os.WriteFile(dst, []byte("old"), 0644))
+
+	mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{"main;foo": 1e7})}
+	n, err := mp.Write(dst, 0)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	_, err = profile.ParseData(data)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary file was not removed")
+
+	_, err = mp.Write(filepath.Join(dir, "missing", "default.pgo"), 0)
+	require.Error(t, err)
+
+	_, err = mp.Write(dst, 0640)
+	require.NoError(t, err)
+	info, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+// sortedKeys returns the sorted keys of m.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestProfileInfos(t *testing.T) {
+	mp := NewMergedProfile(MergeOptions{})
+	require.NoError(t, mp.Merge("a", newTestProfile(t, map[string]int64{"main;foo": int64(30 * time.Second)})))
+	require.NoError(t, mp.Merge("b", newTestProfile(t, map[string]int64{"main;foo": int64(time.Minute), "main;bar": int64(time.Minute)})))
+	require.NoError(t, mp.Finish())
+	require.Equal(t, []ProfileInfo{
+		{ID: "a", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Duration: 60, CPUCores: 0.5, Samples: 1},
+		{ID: "b", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Duration: 60, CPUCores: 2, Samples: 2},
+	}, mp.ProfileInfos())
+}
+
+func TestSearchDownloadMergeFallback(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	archive := newTestZip(t, map[string][]byte{"cpu.pprof": buf.Bytes()})
+
+	var pgoRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/unstable/profiles/gopgo":
+			pgoRequests.Add(1)
+			http.NotFound(w, r)
+		case r.URL.Path == "/api/unstable/profiles/list":
+			fmt.Fprint(w, `{"data": [{"id": "e1", "attributes": {"id": "p1"}}, {"id": "e2", "attributes": {"id": "p2"}}]}`)
+		case strings.HasSuffix(r.URL.Path, "/download"):
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, baseURL: srv.URL}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 2, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	require.True(t, usePGOEndpoint(queries, SelectOptions{}, MergeOptions{}))
+	mp, err := SearchDownloadMerge(context.Background(), log, client, queries, SelectOptions{}, MergeOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), pgoRequests.Load())
+	require.ElementsMatch(t, []string{"p1", "p2"}, mp.ProfileIDs())
+	require.Equal(t, map[string][]int64{"main;foo": {2, 2e7}}, stackValues(mp.profile))
+}
+
+func TestSearchDownloadMergeParseWorkers(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 10, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	source := &failingSource{profiles: 10, data: buf.Bytes()}
+
+	for _, workers := range []int{0, 1, 3} {
+		mp, err := SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{ParseWorkers: workers})
+		require.NoError(t, err)
+		require.Len(t, mp.ProfileIDs(), 10)
+		require.Equal(t, map[string][]int64{"main;foo": {10, 1e8}}, stackValues(mp.profile))
+	}
+
+	source.data = []byte("not a profile")
+	_, err = SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{ParseWorkers: 1})
+	require.ErrorContains(t, err, "skipped 10 invalid profiles")
+	_, err = SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{ParseWorkers: 1, Strict: true})
+	require.ErrorContains(t, err, "invalid profile")
+}
@@ -0,0 +1,104 @@
+package pgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// Supported values for MergeOptions.MergeOp.
+const (
+	// MergeOpSum sums the values of identical stacks across profiles.
+	MergeOpSum = "sum"
+	// MergeOpMax uses the maximum value of identical stacks across profiles.
+	MergeOpMax = "max"
+	// MergeOpAvg uses the average value of identical stacks across profiles.
+	// Profiles without a stack count as zero for it.
+	MergeOpAvg = "avg"
+)
+
+// stackMaxValues returns the summed sample values of prof keyed by stackKey.
+// The result is used to compute the maximum of each stack across profiles.
+func stackMaxValues(prof *profile.Profile) map[string][]int64 {
+	values := map[string][]int64{}
+	for _, s := range prof.Sample {
+		key := stackKey(s)
+		if sum, ok := values[key]; ok {
+			for i, v := range s.Value {
+				sum[i] += v
+			}
+		} else {
+			values[key] = append([]int64(nil), s.Value...)
+		}
+	}
+	return values
+}
+
+// maxInto updates dst to hold the element-wise maximum of the values in dst
+// and src.
+func maxInto(dst, src map[string][]int64) {
+	for key, values := range src {
+		cur, ok := dst[key]
+		if !ok {
+			dst[key] = append([]int64(nil), values...)
+			continue
+		}
+		for i, v := range values {
+			cur[i] = max(cur[i], v)
+		}
+	}
+}
+
+// stackKey identifies the stack of s by the function names and line numbers
+// of its frames, so identical stacks from different profiles get the same key
+// regardless of their location ids and addresses.
+func stackKey(s *profile.Sample) string {
+	var b strings.Builder
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function != nil {
+				b.WriteString(line.Function.Name)
+			}
+			b.WriteByte(':')
+			b.WriteString(strconv.FormatInt(line.Line, 10))
+			b.WriteByte(';')
+		}
+	}
+	return b.String()
+}
+
+// ApplyMergeOp replaces the summed sample values of the merged profile
+// according to the configured merge op.
+func (p *MergedProfile) ApplyMergeOp() error {
+	switch p.opts.MergeOp {
+	case "", MergeOpSum:
+		return nil
+	case MergeOpAvg:
+		if n := len(p.profileIDs); n > 1 {
+			p.profile.Scale(1 / float64(n))
+		}
+		return nil
+	case MergeOpMax:
+		// Replace the values of each stack with its maximum. Samples that
+		// have the same stack key are collapsed into the first one.
+		seen := map[string]bool{}
+		samples := p.profile.Sample[:0]
+		for _, s := range p.profile.Sample {
+			key := stackKey(s)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if values, ok := p.maxValues[key]; ok {
+				copy(s.Value, values)
+			}
+			samples = append(samples, s)
+		}
+		p.profile.Sample = samples
+		return nil
+	default:
+		return fmt.Errorf("unknown merge op: %q", p.opts.MergeOp)
+	}
+}
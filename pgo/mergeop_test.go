@@ -0,0 +1,54 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+// newMergeOpTestProfile is like newTestProfile, but uses the same line number
+// for all frames, so identical stacks get the same stack key across profiles.
+func newMergeOpTestProfile(t *testing.T, stacks map[string]int64) *profile.Profile {
+	prof := newTestProfile(t, stacks)
+	for _, loc := range prof.Location {
+		for i := range loc.Line {
+			loc.Line[i].Line = 1
+		}
+	}
+	return prof
+}
+
+func TestMergeOp(t *testing.T) {
+	for _, tc := range []struct {
+		op   string
+		want map[string][]int64
+	}{
+		{MergeOpSum, map[string][]int64{"main;foo": {4, 4e7}, "main;bar": {3, 3e7}, "main;baz": {2, 2e7}}},
+		{MergeOpMax, map[string][]int64{"main;foo": {3, 3e7}, "main;bar": {2, 2e7}, "main;baz": {2, 2e7}}},
+		{MergeOpAvg, map[string][]int64{"main;foo": {2, 2e7}, "main;bar": {2, 1.5e7}, "main;baz": {1, 1e7}}},
+	} {
+		t.Run(tc.op, func(t *testing.T) {
+			for _, spill := range []int{0, 1} {
+				mp := NewMergedProfile(MergeOptions{MergeOp: tc.op, SpillChunk: spill})
+				require.NoError(t, mp.Merge("a", newMergeOpTestProfile(t, map[string]int64{"main;foo": 3e7, "main;bar": 1e7})))
+				require.NoError(t, mp.Merge("b", newMergeOpTestProfile(t, map[string]int64{"main;foo": 1e7, "main;bar": 2e7, "main;baz": 2e7})))
+				require.NoError(t, mp.Finish())
+				require.NoError(t, mp.ApplyMergeOp())
+				require.Equal(t, tc.want, stackValues(mp.profile), "spill-chunk %d", spill)
+			}
+		})
+	}
+}
+
+func TestMergeOpReduce(t *testing.T) {
+	opts := MergeOptions{MergeOp: MergeOpMax}
+	a := NewMergedProfile(opts)
+	require.NoError(t, a.Merge("a", newMergeOpTestProfile(t, map[string]int64{"main;foo": 3e7})))
+	b := NewMergedProfile(opts)
+	require.NoError(t, b.Merge("b", newMergeOpTestProfile(t, map[string]int64{"main;foo": 5e7})))
+	mp, err := reduceMerged([]*MergedProfile{a, b}, opts)
+	require.NoError(t, err)
+	require.NoError(t, mp.ApplyMergeOp())
+	require.Equal(t, map[string][]int64{"main;foo": {5, 5e7}}, stackValues(mp.profile))
+}
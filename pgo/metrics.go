@@ -0,0 +1,116 @@
+package pgo
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics records the requests sent by a Client per endpoint. A nil Metrics
+// is valid and records nothing.
+type Metrics struct {
+	mu        sync.Mutex
+	endpoints map[string]*EndpointMetrics
+}
+
+// EndpointMetrics holds the metrics of the requests sent to a single
+// endpoint. Every attempt of a retried request counts as a request.
+type EndpointMetrics struct {
+	// Requests is the number of sent requests.
+	Requests int
+	// Errors is the number of requests that failed with a network error or
+	// a non-2xx response.
+	Errors int
+	// Bytes is the number of bytes downloaded in successful responses.
+	Bytes int64
+	// Durations holds the latency of every request.
+	Durations []time.Duration
+}
+
+// NewMetrics returns a new Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{endpoints: map[string]*EndpointMetrics{}}
+}
+
+// record records a request to endpoint that took d and returned n bytes or
+// failed with err.
+func (m *Metrics) record(endpoint string, d time.Duration, n int, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.endpoints[endpoint]
+	if !ok {
+		e = &EndpointMetrics{}
+		m.endpoints[endpoint] = e
+	}
+	e.Requests++
+	e.Bytes += int64(n)
+	e.Durations = append(e.Durations, d)
+	if err != nil {
+		e.Errors++
+	}
+}
+
+// Endpoints returns a copy of the metrics of every endpoint that received
+// requests, keyed by the endpoint name, see endpointName.
+func (m *Metrics) Endpoints() map[string]EndpointMetrics {
+	endpoints := map[string]EndpointMetrics{}
+	if m == nil {
+		return endpoints
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, e := range m.endpoints {
+		c := *e
+		c.Durations = append([]time.Duration{}, e.Durations...)
+		endpoints[name] = c
+	}
+	return endpoints
+}
+
+// Total returns the metrics summed up across all endpoints.
+func (m *Metrics) Total() (total EndpointMetrics) {
+	endpoints := m.Endpoints()
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e := endpoints[name]
+		total.Requests += e.Requests
+		total.Errors += e.Errors
+		total.Bytes += e.Bytes
+		total.Durations = append(total.Durations, e.Durations...)
+	}
+	return total
+}
+
+// MaxDuration returns the highest latency of the requests.
+func (e EndpointMetrics) MaxDuration() (d time.Duration) {
+	for _, ed := range e.Durations {
+		d = max(d, ed)
+	}
+	return d
+}
+
+// endpointName returns the name of the API endpoint of the request path,
+// without any IDs or query parameters, so it can be used as a metric tag.
+func endpointName(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	switch {
+	case path == "/api/unstable/profiles/gopgo":
+		return "gopgo"
+	case path == "/api/unstable/profiles/list":
+		return "list"
+	case strings.HasPrefix(path, "/api/unstable/profiles/saved-searches/"):
+		return "saved_search"
+	case strings.HasPrefix(path, "/api/ui/profiling/profiles/") && strings.HasSuffix(path, "/download"):
+		return "download"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,91 @@
+package pgo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/unstable/profiles/saved-searches/") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, baseURL: srv.URL, Metrics: NewMetrics()}
+	for i := 0; i < 2; i++ {
+		_, err := c.get(context.Background(), "/api/ui/profiling/profiles/abc/download?eventId=def")
+		require.NoError(t, err)
+	}
+	_, err := c.get(context.Background(), "/api/unstable/profiles/saved-searches/123")
+	require.Error(t, err)
+
+	endpoints := c.Metrics.Endpoints()
+	require.Equal(t, 2, endpoints["download"].Requests)
+	require.Equal(t, int64(4), endpoints["download"].Bytes)
+	require.Equal(t, 1, endpoints["saved_search"].Errors)
+	total := c.Metrics.Total()
+	require.Equal(t, 3, total.Requests)
+	require.Equal(t, 1, total.Errors)
+	require.Len(t, total.Durations, 3)
+
+	var nilMetrics *Metrics
+	nilMetrics.record("list", time.Second, 1, nil)
+	require.Empty(t, nilMetrics.Endpoints())
+}
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	t.Setenv("DD_DOGSTATSD_URL", "udp://"+conn.LocalAddr().String())
+	t.Setenv("DD_TAGS", "team:foo,ci:true")
+	s, err := StatsdFromEnv()
+	require.NoError(t, err)
+
+	m := NewMetrics()
+	m.record("list", 1500*time.Microsecond, 10, nil)
+	require.NoError(t, s.SendMetrics(m, "success:true"))
+
+	var lines []string
+	buf := make([]byte, 1024)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		lines = append(lines, string(buf[:n]))
+	}
+	tags := "|#team:foo,ci:true,success:true,endpoint:list"
+	require.Equal(t, []string{
+		"datadog_pgo.requests:1|c" + tags,
+		"datadog_pgo.request.errors:0|c" + tags,
+		"datadog_pgo.request.bytes:10|c" + tags,
+		"datadog_pgo.request.duration:1.5|ms" + tags,
+	}, lines)
+
+	t.Setenv("DD_DOGSTATSD_URL", "tcp://localhost:8125")
+	_, err = StatsdFromEnv()
+	require.ErrorContains(t, err, "unsupported scheme")
+	t.Setenv("DD_DOGSTATSD_URL", "")
+	s, err = StatsdFromEnv()
+	require.NoError(t, err)
+	require.Nil(t, s)
+}
+
+func TestEndpointName(t *testing.T) {
+	require.Equal(t, "list", endpointName("/api/unstable/profiles/list"))
+	require.Equal(t, "gopgo", endpointName("/api/unstable/profiles/gopgo"))
+	require.Equal(t, "download", endpointName("/api/ui/profiling/profiles/abc/download"))
+	require.Equal(t, "other", endpointName("/foo"))
+}
@@ -0,0 +1,46 @@
+package pgo
+
+import (
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// FilterModules drops all samples whose stack doesn't contain any function
+// from one of the given module paths, e.g. github.com/acme/myservice, along
+// with any locations and functions that are no longer referenced. Functions
+// of main packages are named main.* instead of their import path, so they
+// are always considered to be part of the modules.
+func (p *MergedProfile) FilterModules(modules []string) (stats PruneStats, err error) {
+	if stats.BytesBefore, err = encodedSize(p.profile); err != nil {
+		return stats, err
+	}
+	stats.Samples = dropSamples(p.profile, func(s *profile.Sample) bool {
+		for fn := range sampleFunctions(s) {
+			if inModules(fn.Name, modules) {
+				return false
+			}
+		}
+		return true
+	})
+	functionsBefore := len(p.profile.Function)
+	removeUnreferenced(p.profile)
+	stats.Functions = functionsBefore - len(p.profile.Function)
+
+	stats.BytesAfter, err = encodedSize(p.profile)
+	return stats, err
+}
+
+// inModules returns true if the function name belongs to a package of one of
+// the modules or to a main package.
+func inModules(name string, modules []string) bool {
+	if strings.HasPrefix(name, "main.") {
+		return true
+	}
+	for _, mod := range modules {
+		if rest, ok := strings.CutPrefix(name, strings.TrimSuffix(mod, "/")); ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterModules(t *testing.T) {
+	mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{
+		"main.main;github.com/acme/svc/api.Handle;encoding/json.Marshal": 1e7,
+		"github.com/acme/lib.Run;github.com/acme/lib.work":               2e7,
+		"net/http.(*conn).serve;github.com/acme/svc.(*Server).ServeHTTP": 3e7,
+		"runtime.gcBgMarkWorker":                                         4e7,
+	})}
+	stats, err := mp.FilterModules([]string{"github.com/acme/svc/", "github.com/other/mod"})
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Samples)
+	require.Equal(t, 3, stats.Functions)
+	require.Equal(t, []string{
+		"main.main;github.com/acme/svc/api.Handle;encoding/json.Marshal",
+		"net/http.(*conn).serve;github.com/acme/svc.(*Server).ServeHTTP",
+	}, sortedKeys(stackValues(mp.profile)))
+}
+
+func TestInModules(t *testing.T) {
+	modules := []string{"github.com/acme/svc"}
+	require.True(t, inModules("github.com/acme/svc.main", modules))
+	require.True(t, inModules("github.com/acme/svc/internal/db.(*DB).Query", modules))
+	require.True(t, inModules("main.run", modules))
+	require.False(t, inModules("github.com/acme/svc2.Run", modules))
+	require.False(t, inModules("github.com/acme/lib.Run", modules))
+}
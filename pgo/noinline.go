@@ -1,7 +1,9 @@
-package main
+package pgo
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/google/pprof/profile"
 )
@@ -15,22 +17,26 @@ const (
 // inlining decisions that can have a large memory impact.
 // See https://github.com/golang/go/issues/65532 for details.
 //
+// In addition to the built-in functions, the leaf functions whose names match
+// any of the regular expressions in funcs are renamed, e.g. for other
+// pathological inlining cases.
+//
 // TODO: Delete this once it's fixed upstream.
-func ApplyNoInlineHack(prof *profile.Profile) error {
-	if err := renameNoInlineFuncs(prof, []string{grpcProcessDataFunc}); err != nil {
+func ApplyNoInlineHack(prof *profile.Profile, funcs ...*regexp.Regexp) error {
+	if err := renameNoInlineFuncs(prof, []string{grpcProcessDataFunc}, funcs); err != nil {
 		return fmt.Errorf("noinline hack: %w", err)
 	}
 	return nil
 }
 
-func renameNoInlineFuncs(prof *profile.Profile, noInlineFuncs []string) error {
+func renameNoInlineFuncs(prof *profile.Profile, noInlineFuncs []string, patterns []*regexp.Regexp) error {
 	for _, s := range prof.Sample {
 		leaf, ok := leafLine(s)
-		if ok && lineContainsAny(leaf, noInlineFuncs) {
+		if ok && !strings.HasPrefix(leaf.Function.Name, doNotInlinePrefix) && (lineContainsAny(leaf, noInlineFuncs) || lineMatchesAny(leaf, patterns)) {
 			// There might be multiple samples that point to the same function.
-			// But once we rename the function for the function for the first
-			// time, it stops matching the noInlineFuncs list. So we don't end
-			// up adding the prefix multiple times.
+			// But once we rename the function for the first time, it has the
+			// prefix and is skipped. So we don't end up adding the prefix
+			// multiple times.
 			leaf.Function.Name = doNotInlinePrefix + leaf.Function.Name
 		}
 	}
@@ -52,3 +58,7 @@ func lineContainsAny(leaf profile.Line, funcs []string) bool {
 	}
 	return false
 }
+
+func lineMatchesAny(leaf profile.Line, patterns []*regexp.Regexp) bool {
+	return matchesAny(leaf.Function.Name, patterns)
+}
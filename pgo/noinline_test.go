@@ -1,8 +1,9 @@
-package main
+package pgo
 
 import (
 	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/google/pprof/profile"
@@ -17,6 +18,16 @@ func TestApplyNoInlineHack(t *testing.T) {
 	require.Equal(t, 17, leafSamples(prof, doNotInlinePrefix+grpcProcessDataFunc))
 }
 
+func TestApplyNoInlineHackFuncs(t *testing.T) {
+	prof := newTestProfile(t, map[string]int64{"main;foo.bar": 1e7, "main;foo.baz": 1e7, "main;qux": 1e7})
+	funcs := []*regexp.Regexp{regexp.MustCompile(`^foo\.`), regexp.MustCompile(`bar`)}
+	require.NoError(t, ApplyNoInlineHack(prof, funcs...))
+	require.NoError(t, ApplyNoInlineHack(prof, funcs...))
+	require.Equal(t, 1, leafSamples(prof, doNotInlinePrefix+"foo.bar"), "the prefix is only added once")
+	require.Equal(t, 1, leafSamples(prof, doNotInlinePrefix+"foo.baz"))
+	require.Equal(t, 1, leafSamples(prof, "qux"))
+}
+
 func loadTestProfile(t *testing.T, name string) *profile.Profile {
 	t.Helper()
 	data, err := os.ReadFile(filepath.Join("testdata", name))
@@ -0,0 +1,128 @@
+package pgo
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// normalizeProfile sorts the samples, locations, functions, mappings and
+// comments of prof into a canonical order and renumbers their IDs. The order
+// produced by profile.Merge depends on the order of its inputs, which in turn
+// depends on the order in which profiles were downloaded. Normalizing the
+// profile before writing it makes the encoded profile only depend on the
+// merged data, so identical inputs always produce identical files.
+func normalizeProfile(prof *profile.Profile) {
+	sort.SliceStable(prof.Mapping, func(i, j int) bool {
+		return compareMappings(prof.Mapping[i], prof.Mapping[j]) < 0
+	})
+	for i, m := range prof.Mapping {
+		m.ID = uint64(i + 1)
+	}
+
+	sort.SliceStable(prof.Function, func(i, j int) bool {
+		return compareFunctions(prof.Function[i], prof.Function[j]) < 0
+	})
+	for i, fn := range prof.Function {
+		fn.ID = uint64(i + 1)
+	}
+
+	// Locations are compared by the IDs of their mapping and functions, so
+	// they must be sorted after those have been renumbered.
+	sort.SliceStable(prof.Location, func(i, j int) bool {
+		return compareLocations(prof.Location[i], prof.Location[j]) < 0
+	})
+	for i, loc := range prof.Location {
+		loc.ID = uint64(i + 1)
+	}
+
+	sort.SliceStable(prof.Sample, func(i, j int) bool {
+		return compareSamples(prof.Sample[i], prof.Sample[j]) < 0
+	})
+	sort.Strings(prof.Comments)
+}
+
+// compareMappings orders mappings by their address range, file and build ID.
+func compareMappings(a, b *profile.Mapping) int {
+	if c := cmp.Compare(a.Start, b.Start); c != 0 {
+		return c
+	} else if c := cmp.Compare(a.Limit, b.Limit); c != 0 {
+		return c
+	} else if c := cmp.Compare(a.Offset, b.Offset); c != 0 {
+		return c
+	} else if c := cmp.Compare(a.File, b.File); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.BuildID, b.BuildID)
+}
+
+// compareFunctions orders functions by their name, file and start line.
+func compareFunctions(a, b *profile.Function) int {
+	if c := cmp.Compare(a.Name, b.Name); c != 0 {
+		return c
+	} else if c := cmp.Compare(a.SystemName, b.SystemName); c != 0 {
+		return c
+	} else if c := cmp.Compare(a.Filename, b.Filename); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.StartLine, b.StartLine)
+}
+
+// compareLocations orders locations by their lines, mapping and address.
+func compareLocations(a, b *profile.Location) int {
+	if c := slices.CompareFunc(a.Line, b.Line, compareLines); c != 0 {
+		return c
+	} else if c := cmp.Compare(mappingID(a.Mapping), mappingID(b.Mapping)); c != 0 {
+		return c
+	} else if c := cmp.Compare(a.Address, b.Address); c != 0 {
+		return c
+	}
+	return compareBools(a.IsFolded, b.IsFolded)
+}
+
+// compareLines orders lines by their function, line and column.
+func compareLines(a, b profile.Line) int {
+	if c := cmp.Compare(functionID(a.Function), functionID(b.Function)); c != 0 {
+		return c
+	} else if c := cmp.Compare(a.Line, b.Line); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Column, b.Column)
+}
+
+// compareSamples orders samples by their stack and values.
+func compareSamples(a, b *profile.Sample) int {
+	if c := slices.CompareFunc(a.Location, b.Location, func(a, b *profile.Location) int {
+		return cmp.Compare(a.ID, b.ID)
+	}); c != 0 {
+		return c
+	}
+	return slices.Compare(a.Value, b.Value)
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func mappingID(m *profile.Mapping) uint64 {
+	if m == nil {
+		return 0
+	}
+	return m.ID
+}
+
+func functionID(fn *profile.Function) uint64 {
+	if fn == nil {
+		return 0
+	}
+	return fn.ID
+}
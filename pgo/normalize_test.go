@@ -0,0 +1,37 @@
+package pgo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDeterministic(t *testing.T) {
+	a := newTestProfile(t, map[string]int64{"main;foo": 3e7, "main;bar": 1e7, "main;foo;baz": 2e7})
+	b := newTestProfile(t, map[string]int64{"main;qux": 1e7, "main;bar": 4e7})
+	b.Comments = []string{"b"}
+	a.Comments = []string{"a"}
+
+	write := func(order ...*profile.Profile) []byte {
+		mp := NewMergedProfile(MergeOptions{})
+		for i, prof := range order {
+			require.NoError(t, mp.Merge(string(rune('a'+i)), prof.Copy()))
+		}
+		dst := filepath.Join(t.TempDir(), "default.pgo")
+		_, err := mp.Write(dst, 0)
+		require.NoError(t, err)
+		data, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		return data
+	}
+	ab, ba := write(a, b), write(b, a)
+	require.Equal(t, ab, ba)
+
+	prof, err := profile.ParseData(ab)
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+	require.Equal(t, []string{"a", "b"}, prof.Comments)
+}
@@ -0,0 +1,66 @@
+package pgo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// orgNameRE matches valid org names, they become part of environment variable
+// names, see Client.AddOrg.
+var orgNameRE = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// AddOrg reads the credentials of an additional Datadog org from the
+// environment, so profiles of queries prefixed with "<name>:", e.g.
+// "org2:service:my-service", are searched and downloaded from that org. The
+// environment variables are the ones read by ClientFromEnv with an upper case
+// suffix of the name, e.g. DD_API_KEY_ORG2, DD_APP_KEY_ORG2 and DD_SITE_ORG2.
+// The datadog config file is not used for other orgs. All other settings of c
+// are shared by all orgs.
+func (c *Client) AddOrg(name string) error {
+	if !orgNameRE.MatchString(name) {
+		return fmt.Errorf("invalid org name %q: must start with a letter and only contain letters, digits and underscores", name)
+	} else if _, ok := c.orgs[name]; ok {
+		return fmt.Errorf("duplicate org %q", name)
+	}
+	org, err := clientFromEnv(DatadogConfig{}, "_"+strings.ToUpper(name))
+	if err != nil {
+		return err
+	}
+	if c.orgs == nil {
+		c.orgs = map[string]*Client{}
+	}
+	c.orgs[name] = org
+	return nil
+}
+
+// orgQuery splits off the org prefix of query, if it names an org added with
+// AddOrg.
+func (c *Client) orgQuery(query string) (org, rest string, ok bool) {
+	name, rest, found := strings.Cut(strings.TrimSpace(query), ":")
+	if !found || c.orgs[name] == nil {
+		return "", query, false
+	}
+	return name, rest, true
+}
+
+// hasOrgQueries returns true if any of queries is prefixed with an org added
+// with AddOrg.
+func (c *Client) hasOrgQueries(queries []SearchQuery) bool {
+	for _, q := range queries {
+		if _, _, ok := c.orgQuery(q.Filter.Query); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// forOrg returns a copy of c that uses the site and credentials of the given
+// org.
+func (c *Client) forOrg(name string) *Client {
+	org := c.orgs[name]
+	oc := *c
+	oc.site, oc.apiKey, oc.appKey, oc.bearerToken, oc.oauth = org.site, org.apiKey, org.appKey, org.bearerToken, org.oauth
+	oc.orgs = nil
+	return &oc
+}
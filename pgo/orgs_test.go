@@ -0,0 +1,61 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOrgs(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	archive := newTestZip(t, map[string][]byte{"cpu.pprof": buf.Bytes()})
+
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("DD-API-KEY")
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, key+" "+r.URL.Path)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/api/unstable/profiles/list":
+			require.NotContains(t, string(body), "org2:")
+			fmt.Fprintf(w, `{"data": [{"id": "e-%s", "attributes": {"id": "p-%s"}}]}`, key, key)
+		case strings.HasSuffix(r.URL.Path, "/download"):
+			require.Contains(t, r.URL.Path, "p-"+key)
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("DD_API_KEY_ORG2", "k2")
+	t.Setenv("DD_APP_KEY_ORG2", "a2")
+	client := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, apiKey: "k1", appKey: "a1", baseURL: srv.URL}
+	require.NoError(t, client.AddOrg("org2"))
+	require.ErrorContains(t, client.AddOrg("org2"), "duplicate org")
+	require.ErrorContains(t, client.AddOrg("org-3"), "invalid org name")
+	require.ErrorContains(t, client.AddOrg("org3"), "DD_API_KEY_ORG3 is not set")
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 1, nil, []string{"service:foo", "org2:service:foo"})
+	require.NoError(t, err)
+	mp, err := SearchDownloadMerge(context.Background(), log, client, queries, SelectOptions{}, MergeOptions{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"p-k1", "p-k2"}, mp.ProfileIDs())
+	require.NotContains(t, requests, "k1 /api/unstable/profiles/gopgo", "the pgo endpoint can't search other orgs")
+	require.Contains(t, requests, "k2 /api/ui/profiling/profiles/p-k2/download")
+}
@@ -0,0 +1,236 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer records spans for the run and exports them to an OpenTelemetry
+// collector using OTLP/HTTP with JSON encoding. It is implemented without
+// depending on the OpenTelemetry SDK to keep the dependencies of the tool
+// small.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	traceID  string
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// TracerFromEnv returns a Tracer exporting to the endpoint configured via the
+// standard OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT
+// environment variables. It returns nil if neither is set. A nil Tracer is
+// valid and records nothing.
+func TracerFromEnv() *Tracer {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	headers := map[string]string{}
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return &Tracer{endpoint: endpoint, headers: headers, traceID: randomHex(16)}
+}
+
+// Span is a single operation of a trace. A nil Span is valid and records
+// nothing.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	id       string
+	parentID string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	err      error
+}
+
+// spanKey is the context key for the current span.
+type spanKey struct{}
+
+// tracerKey is the context key for the tracer.
+type tracerKey struct{}
+
+// WithTracer returns a context carrying t.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// withSpan returns a context carrying s as the current span.
+func withSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// StartSpan starts a new span as a child of the span in ctx, if any. It
+// returns a nil span if ctx doesn't carry a tracer. The span must be ended by
+// calling End.
+func StartSpan(ctx context.Context, name string, attrs ...any) (context.Context, *Span) {
+	t, _ := ctx.Value(tracerKey{}).(*Tracer)
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, name: name, id: randomHex(8), start: time.Now(), attrs: map[string]any{}}
+	if parent, _ := ctx.Value(spanKey{}).(*Span); parent != nil {
+		s.parentID = parent.id
+	}
+	s.SetAttributes(attrs...)
+	return withSpan(ctx, s), s
+}
+
+// SetAttributes sets the given key value pairs as attributes of the span.
+func (s *Span) SetAttributes(attrs ...any) {
+	if s == nil {
+		return
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+}
+
+// End ends the span and marks it as failed if err is not nil.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+// Export sends all ended spans to the collector.
+func (t *Tracer) Export(ctx context.Context) (err error) {
+	defer wrapErr(&err, "export spans")
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.mu.Unlock()
+
+	type (
+		value    map[string]any
+		keyValue struct {
+			Key   string `json:"key"`
+			Value value  `json:"value"`
+		}
+		otlpStatus struct {
+			Code    int    `json:"code"`
+			Message string `json:"message,omitempty"`
+		}
+		otlpSpan struct {
+			TraceID      string     `json:"traceId"`
+			SpanID       string     `json:"spanId"`
+			ParentSpanID string     `json:"parentSpanId,omitempty"`
+			Name         string     `json:"name"`
+			Kind         int        `json:"kind"`
+			Start        string     `json:"startTimeUnixNano"`
+			End          string     `json:"endTimeUnixNano"`
+			Attributes   []keyValue `json:"attributes"`
+			Status       otlpStatus `json:"status"`
+		}
+	)
+	toValue := func(v any) value {
+		switch v := v.(type) {
+		case string:
+			return value{"stringValue": v}
+		case bool:
+			return value{"boolValue": v}
+		case int:
+			return value{"intValue": strconv.Itoa(v)}
+		case int64:
+			return value{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			return value{"doubleValue": v}
+		default:
+			return value{"stringValue": fmt.Sprint(v)}
+		}
+	}
+
+	var out []otlpSpan
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:      t.traceID,
+			SpanID:       s.id,
+			ParentSpanID: s.parentID,
+			Name:         s.name,
+			Kind:         1, // internal
+			Start:        strconv.FormatInt(s.start.UnixNano(), 10),
+			End:          strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:   []keyValue{},
+			Status:       otlpStatus{Code: 1}, // ok
+		}
+		for k, v := range s.attrs {
+			span.Attributes = append(span.Attributes, keyValue{Key: k, Value: toValue(v)})
+		}
+		if s.err != nil {
+			span.Status = otlpStatus{Code: 2, Message: s.err.Error()} // error
+		}
+		out = append(out, span)
+	}
+
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []keyValue{{Key: "service.name", Value: toValue(Name)}},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": Name, "version": Version},
+				"spans": out,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return nil
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
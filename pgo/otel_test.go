@@ -0,0 +1,70 @@
+package pgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+		tracer := TracerFromEnv()
+		require.Nil(t, tracer)
+		_, span := StartSpan(WithTracer(context.Background(), tracer), "run")
+		require.Nil(t, span)
+		span.SetAttributes("foo", "bar")
+		span.End(nil)
+		require.NoError(t, tracer.Export(context.Background()))
+	})
+
+	t.Run("export", func(t *testing.T) {
+		var payload struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct {
+						TraceID      string `json:"traceId"`
+						SpanID       string `json:"spanId"`
+						ParentSpanID string `json:"parentSpanId"`
+						Name         string `json:"name"`
+						Status       struct {
+							Code int `json:"code"`
+						} `json:"status"`
+					} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/v1/traces", r.URL.Path)
+			require.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		}))
+		defer srv.Close()
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+		t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "X-Api-Key=secret")
+
+		tracer := TracerFromEnv()
+		require.NotNil(t, tracer)
+		ctx, root := StartSpan(WithTracer(context.Background(), tracer), "run")
+		_, child := StartSpan(ctx, "download", "profile-id", "abc", "bytes", 123)
+		child.End(errors.New("boom"))
+		root.End(nil)
+		require.NoError(t, tracer.Export(context.Background()))
+
+		spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+		require.Len(t, spans, 2)
+		require.Equal(t, "download", spans[0].Name)
+		require.Equal(t, 2, spans[0].Status.Code)
+		require.Equal(t, "run", spans[1].Name)
+		require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+		require.Equal(t, spans[0].TraceID, spans[1].TraceID)
+		require.Len(t, spans[0].TraceID, 32)
+	})
+}
@@ -0,0 +1,97 @@
+// Package pgo fetches CPU profiles from Datadog and merges them into a single
+// profile suitable for profile-guided optimization (PGO) with the go
+// toolchain. It is the library behind the datadog-pgo command, which can be
+// used to embed PGO fetching in other build tools.
+//
+// A typical use looks like this:
+//
+//	client, err := pgo.ClientFromEnv()
+//	...
+//	queries, err := pgo.BuildQueries(72*time.Hour, 5, nil, []string{"service:foo env:prod"})
+//	...
+//	f := &pgo.Fetcher{Client: client}
+//	merged, err := f.Fetch(ctx, queries)
+//	...
+//	_, err = merged.Write("./cmd/foo/default.pgo", 0)
+package pgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+)
+
+const (
+	// Name is the name of the tool, it's used in the User-Agent of requests
+	// and in the names of temporary files.
+	Name = "datadog-pgo"
+	// Version is the version of the tool.
+	Version = "0.0.1"
+)
+
+// Fetcher searches, downloads and merges profiles from Datadog.
+type Fetcher struct {
+	// Client is used to access the Datadog API.
+	Client *Client
+	// Source is used instead of Client if it is not nil, e.g. to fetch
+	// profiles from a DirSource or HTTPSource.
+	Source ProfileSource
+	// Log receives progress and debug logs. A nil Log discards them.
+	Log *slog.Logger
+	// Select controls which of the found profiles are used.
+	Select SelectOptions
+	// Merge controls how the profiles are merged.
+	Merge MergeOptions
+}
+
+// Fetch searches, downloads and merges the profiles matching queries. It
+// returns ErrNoProfiles if none of the queries match any profiles.
+func (f *Fetcher) Fetch(ctx context.Context, queries []SearchQuery) (*MergedProfile, error) {
+	log := f.Log
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return SearchDownloadMerge(ctx, log, f.source(), queries, f.Select, f.Merge)
+}
+
+// source returns the source of the profiles.
+func (f *Fetcher) source() ProfileSource {
+	if f.Source != nil {
+		return f.Source
+	}
+	return f.Client
+}
+
+// Search searches for the profiles matching queries and returns the profiles
+// that Fetch would download, without downloading them. Profiles matched by
+// multiple queries are only returned once. It returns ErrNoProfiles if none of
+// the queries match any profiles.
+func (f *Fetcher) Search(ctx context.Context, queries []SearchQuery) (profiles []*SearchProfile, err error) {
+	log := f.Log
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	var claimed profileSet
+	for _, q := range queries {
+		found, err := f.source().SearchProfiles(ctx, f.Select.searchQuery(q))
+		if errors.Is(err, ErrNoProfiles) {
+			log.Warn("no profiles found", "query", q.Filter.Query)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if found = f.Select.Select(log, found); len(found) > q.Limit {
+			found = found[:q.Limit]
+		}
+		for _, p := range found {
+			if claimed.Claim(p.ProfileID) {
+				profiles = append(profiles, p)
+			}
+		}
+	}
+	if len(profiles) == 0 {
+		return nil, ErrNoProfiles
+	}
+	return profiles, nil
+}
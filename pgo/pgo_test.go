@@ -0,0 +1,43 @@
+package pgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetcherSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var q SearchQuery
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&q))
+		switch q.Filter.Query {
+		case "service:a runtime:go":
+			fmt.Fprint(w, `{"data": [{"attributes": {"id": "1"}}, {"attributes": {"id": "2"}}, {"attributes": {"id": "3"}}]}`)
+		case "service:b runtime:go":
+			fmt.Fprint(w, `{"data": [{"attributes": {"id": "2"}}, {"attributes": {"id": "4"}}]}`)
+		default:
+			fmt.Fprint(w, `{"data": []}`)
+		}
+	}))
+	defer srv.Close()
+
+	f := &Fetcher{Client: &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, baseURL: srv.URL}}
+	queries, err := BuildQueries(time.Hour, 2, nil, []string{"service:a", "service:b", "service:c"})
+	require.NoError(t, err)
+	profiles, err := f.Search(context.Background(), queries)
+	require.NoError(t, err)
+	var ids []string
+	for _, p := range profiles {
+		ids = append(ids, p.ProfileID)
+	}
+	require.Equal(t, []string{"1", "2", "4"}, ids)
+
+	_, err = f.Search(context.Background(), queries[2:])
+	require.ErrorIs(t, err, ErrNoProfiles)
+}
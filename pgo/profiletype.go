@@ -0,0 +1,45 @@
+package pgo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile types supported by MergeOptions.ProfileType. Only cpu profiles can
+// be used for profile-guided optimization, the other types can be fetched for
+// custom analysis.
+const (
+	ProfileTypeCPU   = "cpu"
+	ProfileTypeHeap  = "heap"
+	ProfileTypeMutex = "mutex"
+)
+
+// profileTypeFiles maps each profile type to the names of the files that may
+// contain it in a downloaded archive, in order of preference.
+var profileTypeFiles = map[string][]string{
+	ProfileTypeCPU:   {"cpu.pprof"},
+	ProfileTypeHeap:  {"delta-heap.pprof", "heap.pprof"},
+	ProfileTypeMutex: {"delta-mutex.pprof", "mutex.pprof"},
+}
+
+// ValidateProfileType returns an error if typ is not a supported profile type.
+func ValidateProfileType(typ string) error {
+	if _, ok := profileTypeFiles[typ]; ok {
+		return nil
+	}
+	types := make([]string, 0, len(profileTypeFiles))
+	for t := range profileTypeFiles {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return fmt.Errorf("unknown profile type %q, must be one of %s", typ, strings.Join(types, ", "))
+}
+
+// profileType returns the profile type of the options, defaulting to cpu.
+func (o MergeOptions) profileType() string {
+	if o.ProfileType == "" {
+		return ProfileTypeCPU
+	}
+	return o.ProfileType
+}
@@ -0,0 +1,26 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractProfile(t *testing.T) {
+	d := ProfileDownload{data: newTestZip(t, map[string][]byte{
+		"cpu.pprof":        []byte("cpu"),
+		"heap.pprof":       []byte("heap"),
+		"delta-heap.pprof": []byte("delta-heap"),
+	}), limits: DefaultZipLimits}
+
+	data, err := d.ExtractProfile(ProfileTypeCPU)
+	require.NoError(t, err)
+	require.Equal(t, "cpu", string(data))
+	data, err = d.ExtractProfile(ProfileTypeHeap)
+	require.NoError(t, err)
+	require.Equal(t, "delta-heap", string(data))
+	_, err = d.ExtractProfile(ProfileTypeMutex)
+	require.ErrorContains(t, err, "no delta-mutex.pprof or mutex.pprof found")
+	_, err = d.ExtractProfile("goroutine")
+	require.ErrorContains(t, err, "unknown profile type")
+}
@@ -0,0 +1,106 @@
+package pgo
+
+import "sync/atomic"
+
+// Progress counts the progress of SearchDownloadMerge, e.g. to report it
+// during long downloads. It's safe for concurrent use, and the methods of a
+// nil *Progress do nothing, so it's optional.
+type Progress struct {
+	queries    atomic.Int64
+	searched   atomic.Int64
+	profiles   atomic.Int64
+	downloaded atomic.Int64
+	merged     atomic.Int64
+	failed     atomic.Int64
+	bytes      atomic.Int64
+}
+
+// ProgressSnapshot is the state of a Progress at a point in time.
+type ProgressSnapshot struct {
+	// Queries is the number of queries to search.
+	Queries int
+	// Searched is the number of queries that were searched.
+	Searched int
+	// Profiles is the number of profiles found by the searched queries.
+	Profiles int
+	// Downloaded is the number of profiles that were downloaded.
+	Downloaded int
+	// Merged is the number of profiles that were merged.
+	Merged int
+	// Failed is the number of profiles that failed to download or were
+	// skipped because they are invalid.
+	Failed int
+	// Bytes is the number of bytes downloaded.
+	Bytes int64
+}
+
+// Done returns true if all queries were searched and all profiles found by
+// them were merged or failed.
+func (s ProgressSnapshot) Done() bool {
+	return s.Searched >= s.Queries && s.Merged+s.Failed >= s.Profiles
+}
+
+// Percent returns the percentage of the profiles found so far that were
+// merged or failed. It's 0 until profiles were found.
+func (s ProgressSnapshot) Percent() float64 {
+	if s.Profiles == 0 {
+		return 0
+	}
+	return percent(int64(s.Merged+s.Failed), int64(s.Profiles))
+}
+
+// Snapshot returns the current state of p.
+func (p *Progress) Snapshot() ProgressSnapshot {
+	if p == nil {
+		return ProgressSnapshot{}
+	}
+	return ProgressSnapshot{
+		Queries:    int(p.queries.Load()),
+		Searched:   int(p.searched.Load()),
+		Profiles:   int(p.profiles.Load()),
+		Downloaded: int(p.downloaded.Load()),
+		Merged:     int(p.merged.Load()),
+		Failed:     int(p.failed.Load()),
+		Bytes:      p.bytes.Load(),
+	}
+}
+
+// addQueries records that n more queries will be searched. n is negative to
+// undo it, e.g. if the pgo endpoint fails and the queries are searched again.
+func (p *Progress) addQueries(n int) {
+	if p != nil {
+		p.queries.Add(int64(n))
+	}
+}
+
+// addSearched records that n queries that found profiles profiles were
+// searched.
+func (p *Progress) addSearched(n, profiles int) {
+	if p != nil {
+		p.searched.Add(int64(n))
+		p.profiles.Add(int64(profiles))
+	}
+}
+
+// addDownloaded records that n profiles with a total size of bytes were
+// downloaded.
+func (p *Progress) addDownloaded(n int, bytes int64) {
+	if p != nil {
+		p.downloaded.Add(int64(n))
+		p.bytes.Add(bytes)
+	}
+}
+
+// addMerged records that n profiles were merged.
+func (p *Progress) addMerged(n int) {
+	if p != nil {
+		p.merged.Add(int64(n))
+	}
+}
+
+// addFailed records that a profile failed to download or was skipped.
+func (p *Progress) addFailed() {
+	if p != nil {
+		p.failed.Add(1)
+	}
+}
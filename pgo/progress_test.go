@@ -0,0 +1,42 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	var nilProgress *Progress
+	nilProgress.addQueries(1)
+	require.Equal(t, ProgressSnapshot{}, nilProgress.Snapshot())
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 10, nil, []string{"service:foo", "service:bar"})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	source := &failingSource{profiles: 10, failing: 2, data: buf.Bytes()}
+
+	progress := &Progress{}
+	_, err = SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{MinSuccessRatio: 0.5, Progress: progress})
+	require.NoError(t, err)
+	s := progress.Snapshot()
+	// Both queries find the same profiles, which are only downloaded once.
+	require.Equal(t, ProgressSnapshot{
+		Queries:    2,
+		Searched:   2,
+		Profiles:   10,
+		Downloaded: 8,
+		Merged:     8,
+		Failed:     2,
+		Bytes:      int64(8 * buf.Len()),
+	}, s)
+	require.True(t, s.Done())
+	require.Equal(t, float64(100), s.Percent())
+}
@@ -0,0 +1,185 @@
+package pgo
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// PruneStats holds statistics about data pruned from the merged profile.
+type PruneStats struct {
+	// Frames is the number of frames removed from samples, it's only set by
+	// PruneRuntimeFrames.
+	Frames      int
+	Samples     int
+	Functions   int
+	BytesBefore int64
+	BytesAfter  int64
+}
+
+// PruneBelowPercent drops the coldest leaf functions whose combined cpu time
+// is less than percent of the total cpu time, along with their samples and any
+// locations and functions that are no longer referenced. Functions are ranked
+// by their flat cpu time, i.e. the cpu time of the samples they are the leaf
+// of. Unlike keeping a fixed number of functions, this adapts to the
+// distribution of each profile, and the cpu time of the dropped samples is
+// guaranteed to be below the threshold.
+func (p *MergedProfile) PruneBelowPercent(percent float64) (stats PruneStats, err error) {
+	if stats.BytesBefore, err = encodedSize(p.profile); err != nil {
+		return stats, err
+	}
+	cpuIdx, err := cpuSampleIndex(p.profile)
+	if err != nil {
+		return stats, err
+	}
+
+	flat := map[*profile.Function]int64{}
+	var total int64
+	for _, s := range p.profile.Sample {
+		total += s.Value[cpuIdx]
+		if leaf, ok := leafLine(s); ok {
+			flat[leaf.Function] += s.Value[cpuIdx]
+		}
+	}
+
+	functions := make([]*profile.Function, 0, len(flat))
+	for fn := range flat {
+		functions = append(functions, fn)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if flat[functions[i]] != flat[functions[j]] {
+			return flat[functions[i]] < flat[functions[j]]
+		}
+		return functions[i].Name < functions[j].Name
+	})
+
+	threshold := float64(total) * percent / 100
+	cold := map[*profile.Function]bool{}
+	var cum int64
+	for _, fn := range functions {
+		if float64(cum+flat[fn]) >= threshold {
+			break
+		}
+		cum += flat[fn]
+		cold[fn] = true
+	}
+
+	stats.Samples = dropSamples(p.profile, func(s *profile.Sample) bool {
+		leaf, ok := leafLine(s)
+		return ok && cold[leaf.Function]
+	})
+	functionsBefore := len(p.profile.Function)
+	removeUnreferenced(p.profile)
+	stats.Functions = functionsBefore - len(p.profile.Function)
+
+	stats.BytesAfter, err = encodedSize(p.profile)
+	return stats, err
+}
+
+// dropSamples removes the samples for which drop returns true from prof and
+// returns the number of removed samples. Callers should call
+// removeUnreferenced afterwards.
+func dropSamples(prof *profile.Profile, drop func(*profile.Sample) bool) (dropped int) {
+	samples := prof.Sample[:0]
+	for _, s := range prof.Sample {
+		if drop(s) {
+			dropped++
+			continue
+		}
+		samples = append(samples, s)
+	}
+	prof.Sample = samples
+	return dropped
+}
+
+// PruneNodeFraction drops all samples whose stack contains a function with a
+// cumulative cpu time below fraction of the total cpu time, along with any
+// locations and functions that are no longer referenced. This is similar to
+// pprof's -nodefraction option. The cumulative cpu time of a function is the
+// cpu time of all samples it appears in, so the dropped samples only contain
+// cold call paths.
+func (p *MergedProfile) PruneNodeFraction(fraction float64) (stats PruneStats, err error) {
+	if stats.BytesBefore, err = encodedSize(p.profile); err != nil {
+		return stats, err
+	}
+	if err := pruneNodeFraction(p.profile, fraction, &stats); err != nil {
+		return stats, err
+	}
+	stats.BytesAfter, err = encodedSize(p.profile)
+	return stats, err
+}
+
+// PruneToSize calls PruneNodeFraction with the smallest fraction out of
+// 0.0001, 0.0002, 0.0004, ... that shrinks the encoded profile to at most
+// maxBytes, and returns the fraction that was used. The profile is not
+// modified if it's already small enough or can't be shrunk enough.
+func (p *MergedProfile) PruneToSize(maxBytes int64) (stats PruneStats, fraction float64, err error) {
+	if stats.BytesBefore, err = encodedSize(p.profile); err != nil {
+		return stats, 0, err
+	}
+	stats.BytesAfter = stats.BytesBefore
+	for fraction = minPruneFraction; stats.BytesAfter > maxBytes; fraction *= 2 {
+		if fraction > 1 {
+			return stats, 0, fmt.Errorf("can't prune profile of %d bytes to %d bytes", stats.BytesBefore, maxBytes)
+		}
+		pruned := p.profile.Copy()
+		stats = PruneStats{BytesBefore: stats.BytesBefore}
+		if err := pruneNodeFraction(pruned, fraction, &stats); err != nil {
+			return stats, 0, err
+		} else if stats.BytesAfter, err = encodedSize(pruned); err != nil {
+			return stats, 0, err
+		} else if stats.BytesAfter <= maxBytes {
+			p.profile = pruned
+			return stats, fraction, nil
+		}
+	}
+	return stats, 0, nil
+}
+
+// minPruneFraction is the first fraction tried by PruneToSize.
+const minPruneFraction = 0.0001
+
+// pruneNodeFraction implements PruneNodeFraction without measuring the size
+// of prof.
+func pruneNodeFraction(prof *profile.Profile, fraction float64, stats *PruneStats) error {
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return err
+	}
+
+	cum := map[*profile.Function]int64{}
+	var total int64
+	for _, s := range prof.Sample {
+		total += s.Value[cpuIdx]
+		for fn := range sampleFunctions(s) {
+			cum[fn] += s.Value[cpuIdx]
+		}
+	}
+
+	threshold := float64(total) * fraction
+	stats.Samples = dropSamples(prof, func(s *profile.Sample) bool {
+		for fn := range sampleFunctions(s) {
+			if float64(cum[fn]) < threshold {
+				return true
+			}
+		}
+		return false
+	})
+	functionsBefore := len(prof.Function)
+	removeUnreferenced(prof)
+	stats.Functions = functionsBefore - len(prof.Function)
+	return nil
+}
+
+// sampleFunctions returns the set of functions in the stack of s, including
+// inlined functions.
+func sampleFunctions(s *profile.Sample) map[*profile.Function]bool {
+	functions := map[*profile.Function]bool{}
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			functions[line.Function] = true
+		}
+	}
+	return functions
+}
@@ -0,0 +1,65 @@
+package pgo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneBelowPercent(t *testing.T) {
+	mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{
+		"main;hot":   900,
+		"main;warm":  95,
+		"main;cold1": 3,
+		"main;cold2": 2,
+	})}
+	stats, err := mp.PruneBelowPercent(1)
+	require.NoError(t, err)
+	require.NoError(t, mp.profile.CheckValid())
+	require.Equal(t, 2, stats.Samples)
+	require.Equal(t, 2, stats.Functions)
+	require.Less(t, stats.BytesAfter, stats.BytesBefore)
+	require.Equal(t, []string{"main;hot", "main;warm"}, sortedKeys(stackValues(mp.profile)))
+}
+
+func TestPruneNodeFraction(t *testing.T) {
+	mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{
+		"main;hot":        900,
+		"main;warm;hot":   95,
+		"main;warm;cold1": 3,
+		"main;cold2":      2,
+	})}
+	stats, err := mp.PruneNodeFraction(0.01)
+	require.NoError(t, err)
+	require.NoError(t, mp.profile.CheckValid())
+	require.Equal(t, 2, stats.Samples)
+	require.Equal(t, 2, stats.Functions)
+	require.Less(t, stats.BytesAfter, stats.BytesBefore)
+	require.Equal(t, []string{"main;hot", "main;warm;hot"}, sortedKeys(stackValues(mp.profile)))
+}
+
+func TestPruneToSize(t *testing.T) {
+	stacks := map[string]int64{"main;hot": 1e6}
+	for i := 0; i < 100; i++ {
+		stacks[fmt.Sprintf("main;cold%d", i)] = int64(i + 1)
+	}
+	mp := &MergedProfile{profile: newTestProfile(t, stacks)}
+	size, err := encodedSize(mp.profile)
+	require.NoError(t, err)
+
+	stats, fraction, err := mp.PruneToSize(size)
+	require.NoError(t, err)
+	require.Zero(t, fraction)
+	require.Zero(t, stats.Samples)
+
+	stats, fraction, err = mp.PruneToSize(size / 2)
+	require.NoError(t, err)
+	require.Greater(t, fraction, 0.0)
+	require.Positive(t, stats.Samples)
+	require.LessOrEqual(t, stats.BytesAfter, size/2)
+	require.Contains(t, stackValues(mp.profile), "main;hot")
+
+	_, _, err = mp.PruneToSize(1)
+	require.ErrorContains(t, err, "can't prune")
+}
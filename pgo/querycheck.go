@@ -0,0 +1,158 @@
+package pgo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// queryTagKeyRE matches the valid keys of key:value terms of a query, e.g.
+// service, env or @metrics.core_cpu_cores.
+var queryTagKeyRE = regexp.MustCompile(`^@?[a-zA-Z_][a-zA-Z0-9_.\-/@]*$`)
+
+// queryOperators are the boolean operators of the query syntax.
+var queryOperators = map[string]bool{"AND": true, "OR": true, "NOT": true}
+
+// queryTerm is a key:value term of a query.
+type queryTerm struct {
+	negated bool
+	key     string
+	value   string
+}
+
+// ValidateQuery checks the syntax of a profile search query, so mistakes are
+// reported with an actionable message instead of an opaque 400 response of
+// the API. It checks that quotes and parentheses are balanced, that every
+// key:value term has a valid key and a value, that boolean operators have
+// operands, and that the query doesn't restrict the runtime or language to
+// something other than Go, as PGO only works with Go profiles.
+func ValidateQuery(query string) error {
+	terms, err := parseQuery(query)
+	if err != nil {
+		return fmt.Errorf("invalid query %q: %w", query, err)
+	}
+	for _, t := range terms {
+		if (t.key == "runtime" || t.key == "language") && !t.negated && t.value != "go" {
+			return fmt.Errorf("invalid query %q: %s:%s: PGO only works with Go profiles, remove it or use %s:go", query, t.key, t.value, t.key)
+		}
+	}
+	return nil
+}
+
+// QueryWarnings returns problems of query that don't prevent searching it,
+// e.g. that it doesn't filter by service or env, so it may mix profiles of
+// unrelated services or environments.
+func QueryWarnings(query string) (warnings []string) {
+	terms, _ := parseQuery(query)
+	for _, tag := range []struct{ key, what string }{{"service", "services"}, {"env", "environments"}} {
+		if !hasQueryTag(terms, tag.key) {
+			warnings = append(warnings, fmt.Sprintf("query has no %s: filter, it may mix the profiles of different %s", tag.key, tag.what))
+		}
+	}
+	return warnings
+}
+
+// hasQueryTag returns true if terms include a key:value term that isn't
+// negated. A value that is itself a key:value term counts as well, which
+// covers queries prefixed with an org, see Client.AddOrg.
+func hasQueryTag(terms []queryTerm, key string) bool {
+	for _, t := range terms {
+		if !t.negated && (t.key == key || strings.HasPrefix(t.value, key+":")) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQuery splits query into its key:value terms and returns an error if it
+// is malformed. Bare words, operators and the contents of quoted values are
+// not returned.
+func parseQuery(query string) (terms []queryTerm, err error) {
+	var (
+		depth        int
+		lastOperator string
+		empty        = true
+	)
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("unexpected ) at position %d", i)
+			}
+			i++
+		case c == '"':
+			end, err := quoteEnd(query, i)
+			if err != nil {
+				return nil, err
+			}
+			i, lastOperator, empty = end, "", false
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n()\"", rune(query[i])) {
+				i++
+			}
+			word := query[start:i]
+			if queryOperators[word] {
+				if empty && word != "NOT" {
+					return nil, fmt.Errorf("%s at position %d has no left operand", word, start)
+				}
+				lastOperator = word
+				continue
+			}
+			lastOperator, empty = "", false
+			key, value, ok := strings.Cut(word, ":")
+			if !ok {
+				continue
+			}
+			t := queryTerm{key: key, value: value}
+			if k, ok := strings.CutPrefix(t.key, "-"); ok {
+				t.key, t.negated = k, true
+			} else if k, ok := strings.CutPrefix(t.key, "!"); ok {
+				t.key, t.negated = k, true
+			}
+			if !queryTagKeyRE.MatchString(t.key) {
+				return nil, fmt.Errorf("invalid key %q at position %d, keys must look like service or @field", t.key, start)
+			}
+			if t.value == "" {
+				// The value may be quoted or a group, e.g. version:(a OR b)
+				if i == len(query) || (query[i] != '"' && query[i] != '(') {
+					return nil, fmt.Errorf("%s: at position %d has no value, quote values with spaces, e.g. %s:\"a b\"", t.key, start, t.key)
+				}
+				t.value = "(...)"
+				if query[i] == '"' {
+					end, err := quoteEnd(query, i)
+					if err != nil {
+						return nil, err
+					}
+					t.value, i = query[i+1:end-1], end
+				}
+			}
+			terms = append(terms, t)
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("missing %s", strings.Repeat(")", depth))
+	} else if lastOperator != "" {
+		return nil, fmt.Errorf("%s at the end has no right operand", lastOperator)
+	}
+	return terms, nil
+}
+
+// quoteEnd returns the index after the closing quote of the quoted string
+// starting at query[start]. Backslashes escape the next character.
+func quoteEnd(query string, start int) (int, error) {
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quote at position %d", start)
+}
@@ -0,0 +1,49 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateQuery(t *testing.T) {
+	for _, q := range []string{
+		"service:foo env:prod",
+		"ignored",
+		"",
+		`service:foo -version:"1.2 beta" @metrics.core_cpu_cores:>2`,
+		"service:foo AND (env:prod OR env:staging)",
+		"service:foo version:(a OR b)",
+		"NOT env:staging service:foo",
+		`service:"foo \" bar"`,
+		"org2:service:foo",
+		"runtime:go language:go -runtime:python",
+	} {
+		require.NoError(t, ValidateQuery(q), q)
+	}
+
+	for q, msg := range map[string]string{
+		`service:"foo`:              "unterminated quote at position 8",
+		"service:foo)":              "unexpected ) at position 11",
+		"(service:foo":              "missing )",
+		"service: env:prod":         "service: at position 0 has no value",
+		"service:foo env:":          "env: at position 12 has no value",
+		"serv ice:foo -:bar":        `invalid key "" at position 13`,
+		"service:foo OR":            "OR at the end has no right operand",
+		"AND service:foo":           "AND at position 0 has no left operand",
+		"service:foo runtime:java":  "runtime:java: PGO only works with Go profiles",
+		"service:foo language:rust": "language:rust: PGO only works with Go profiles",
+	} {
+		require.ErrorContains(t, ValidateQuery(q), msg, q)
+	}
+
+	_, err := BuildQueries(0, 1, nil, []string{"service:foo@weight=2", "service:(foo"})
+	require.ErrorContains(t, err, `invalid query "service:(foo": missing )`)
+}
+
+func TestQueryWarnings(t *testing.T) {
+	require.Empty(t, QueryWarnings("service:foo env:prod"))
+	require.Empty(t, QueryWarnings("org2:service:foo env:prod"))
+	require.Equal(t, []string{"query has no env: filter, it may mix the profiles of different environments"}, QueryWarnings("service:foo -env:staging"))
+	require.Len(t, QueryWarnings("version:1.2"), 2)
+}
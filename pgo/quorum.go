@@ -0,0 +1,49 @@
+package pgo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// failedDownloads records the profiles that failed to download if
+// MergeOptions.MinSuccessRatio allows to continue without them.
+type failedDownloads struct {
+	mu    sync.Mutex
+	ids   []string
+	first error
+}
+
+// add records that the profile with the given id failed with err.
+func (f *failedDownloads) add(id string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ids = append(f.ids, id)
+	if f.first == nil {
+		f.first = err
+	}
+}
+
+// check returns an error wrapping the first failure if fewer than ratio of
+// the attempted downloads succeeded.
+func (f *failedDownloads) check(attempted int, ratio float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.ids) == 0 {
+		return nil
+	}
+	succeeded := attempted - len(f.ids)
+	if float64(succeeded) >= ratio*float64(attempted) {
+		return nil
+	}
+	return fmt.Errorf("only %d of %d profiles were downloaded, below the minimum success ratio of %g: %w", succeeded, attempted, ratio, f.first)
+}
+
+// IDs returns the sorted ids of the failed profiles.
+func (f *failedDownloads) IDs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := append([]string(nil), f.ids...)
+	sort.Strings(ids)
+	return ids
+}
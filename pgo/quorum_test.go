@@ -0,0 +1,60 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// failingSource is a ProfileSource whose downloads fail for the first failing
+// profile IDs.
+type failingSource struct {
+	profiles int
+	failing  int
+	data     []byte
+}
+
+func (s *failingSource) SearchProfiles(ctx context.Context, query SearchQuery) ([]*SearchProfile, error) {
+	var profiles []*SearchProfile
+	for i := 0; i < s.profiles; i++ {
+		profiles = append(profiles, &SearchProfile{ProfileID: fmt.Sprint(i)})
+	}
+	return profiles, nil
+}
+
+func (s *failingSource) DownloadProfile(ctx context.Context, p *SearchProfile) (ProfileDownload, error) {
+	var i int
+	fmt.Sscan(p.ProfileID, &i)
+	if i < s.failing {
+		return ProfileDownload{}, errors.New("boom")
+	}
+	return NewPprofDownload(s.data, DefaultZipLimits)
+}
+
+func TestSearchDownloadMergeMinSuccessRatio(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 10, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	source := &failingSource{profiles: 10, failing: 2, data: buf.Bytes()}
+
+	_, err = SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{})
+	require.ErrorContains(t, err, "boom", "any failure fails the merge by default")
+
+	mp, err := SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{MinSuccessRatio: 0.6})
+	require.NoError(t, err)
+	require.Len(t, mp.ProfileIDs(), 8)
+
+	source.failing = 5
+	_, err = SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{MinSuccessRatio: 0.6})
+	require.ErrorContains(t, err, "only 5 of 10 profiles were downloaded")
+	require.ErrorContains(t, err, "boom")
+}
@@ -0,0 +1,41 @@
+package pgo
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRateLimitWait is the maximum time to wait for a rate limit to reset
+// before retrying. Longer resets are capped, the context deadline still
+// applies.
+const maxRateLimitWait = time.Minute
+
+// rateLimitReset returns the time until the rate limit of a 429 response
+// resets according to the X-RateLimit-Reset or Retry-After header, or zero
+// if neither is set.
+func rateLimitReset(h http.Header) time.Duration {
+	for _, key := range []string{"X-RateLimit-Reset", "Retry-After"} {
+		seconds, err := strconv.ParseFloat(h.Get(key), 64)
+		if err == nil && seconds > 0 {
+			return min(time.Duration(seconds*float64(time.Second)), maxRateLimitWait)
+		}
+	}
+	return 0
+}
+
+// logRateLimit logs the rate limit budget reported by the response headers
+// at debug level.
+func (c *Client) logRateLimit(res *http.Response) {
+	if c.Log == nil || res.Header.Get("X-RateLimit-Limit") == "" {
+		return
+	}
+	c.Log.Debug(
+		"rate limit",
+		"name", res.Header.Get("X-RateLimit-Name"),
+		"limit", res.Header.Get("X-RateLimit-Limit"),
+		"remaining", res.Header.Get("X-RateLimit-Remaining"),
+		"period", res.Header.Get("X-RateLimit-Period"),
+		"reset", res.Header.Get("X-RateLimit-Reset"),
+	)
+}
@@ -0,0 +1,106 @@
+package pgo
+
+import (
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// reduceMerged merges the finished groups into a single MergedProfile. Groups
+// without any profiles are ignored. If opts.MaxInFlight is set, the profiles
+// of the groups are merged one at a time and released afterwards, so only
+// the result and one group profile need to be held at once, instead of all
+// of them plus the result. If opts.SpillChunk is set, the profile of each
+// group is spilled to disk as soon as it's finished, and the chunks are
+// merged one at a time, so the memory bound of spilling also holds for
+// multiple groups.
+func reduceMerged(groups []*MergedProfile, opts MergeOptions) (_ *MergedProfile, err error) {
+	result := NewMergedProfile(opts)
+	defer func() {
+		if err != nil {
+			result.Close()
+		}
+	}()
+	spill := opts.SpillChunk > 0 && len(groups) > 1
+	var profiles []*profile.Profile
+	for _, g := range groups {
+		if err := g.Finish(); err != nil {
+			return nil, err
+		}
+		result.skipped += g.skipped
+		if g.profile == nil {
+			continue
+		}
+		if spill {
+			if result.spill == nil {
+				if result.spill, err = newSpiller(); err != nil {
+					return nil, err
+				}
+			}
+			if err := result.spill.Spill(g.profile); err != nil {
+				return nil, err
+			}
+		} else {
+			profiles = append(profiles, g.profile)
+		}
+		g.profile = nil
+		result.profileIDs = append(result.profileIDs, g.profileIDs...)
+		result.profileInfos = append(result.profileInfos, g.profileInfos...)
+		for q, n := range g.queryProfiles {
+			if result.queryProfiles == nil {
+				result.queryProfiles = map[string]int{}
+			}
+			result.queryProfiles[q] += n
+		}
+		result.trimStats.add(g.trimStats)
+		result.addTime(g.oldest)
+		result.addTime(g.newest)
+		result.durationSum += g.durationSum
+		result.durationMax = max(result.durationMax, g.durationMax)
+		if g.maxValues != nil {
+			if result.maxValues == nil {
+				result.maxValues = map[string][]int64{}
+			}
+			maxInto(result.maxValues, g.maxValues)
+		}
+	}
+
+	// Profiles are merged in download order, sort them to make the result
+	// independent of it.
+	sort.Strings(result.profileIDs)
+	sort.Slice(result.profileInfos, func(i, j int) bool {
+		return result.profileInfos[i].ID < result.profileInfos[j].ID
+	})
+
+	if result.spill != nil {
+		// The spilled chunks are merged by Finish.
+		if err := result.Finish(); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	switch len(profiles) {
+	case 0:
+		return result, nil
+	case 1:
+		result.profile = profiles[0]
+		return result, nil
+	}
+	if opts.MaxInFlight > 0 {
+		result.profile = profiles[0]
+		for i := 1; i < len(profiles); i++ {
+			merged, err := profile.Merge([]*profile.Profile{result.profile, profiles[i]})
+			if err != nil {
+				return nil, err
+			}
+			result.profile, profiles[i] = merged, nil
+		}
+		return result, nil
+	}
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return nil, err
+	}
+	result.profile = merged
+	return result, nil
+}
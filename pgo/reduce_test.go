@@ -0,0 +1,157 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+// BenchmarkConcurrentMerge compares merging the profiles of many concurrent
+// downloads into a single shared accumulator with merging them into one
+// accumulator per query that are reduced at the end.
+func BenchmarkConcurrentMerge(b *testing.B) {
+	const queries, profilesPerQuery = 8, 8
+	newProfiles := func() [][]*profile.Profile {
+		profiles := make([][]*profile.Profile, queries)
+		for q := range profiles {
+			for i := 0; i < profilesPerQuery; i++ {
+				stacks := map[string]int64{}
+				for j := 0; j < 200; j++ {
+					stacks[fmt.Sprintf("main;q%d;fn%d;leaf%d", q, j, i)] = 1e7
+				}
+				profiles[q] = append(profiles[q], newTestProfile(b, stacks))
+			}
+		}
+		return profiles
+	}
+
+	run := func(b *testing.B, profiles [][]*profile.Profile, accumulator func(q int) *MergedProfile) {
+		var wg sync.WaitGroup
+		for q := range profiles {
+			for i, prof := range profiles[q] {
+				wg.Add(1)
+				go func(acc *MergedProfile, id string, prof *profile.Profile) {
+					defer wg.Done()
+					require.NoError(b, acc.Merge(id, prof))
+				}(accumulator(q), fmt.Sprintf("%d-%d", q, i), prof)
+			}
+		}
+		wg.Wait()
+	}
+
+	b.Run("shared", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			profiles := newProfiles()
+			shared := NewMergedProfile(MergeOptions{})
+			b.StartTimer()
+			run(b, profiles, func(int) *MergedProfile { return shared })
+			require.NoError(b, shared.Finish())
+		}
+	})
+
+	b.Run("per-query", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			profiles := newProfiles()
+			accs := make([]*MergedProfile, queries)
+			for i := range accs {
+				accs[i] = NewMergedProfile(MergeOptions{})
+			}
+			b.StartTimer()
+			run(b, profiles, func(q int) *MergedProfile { return accs[q] })
+			_, err := reduceMerged(accs, MergeOptions{})
+			require.NoError(b, err)
+		}
+	})
+}
+
+func TestReduceMergedMaxInFlight(t *testing.T) {
+	newGroups := func() []*MergedProfile {
+		var groups []*MergedProfile
+		for i, stack := range []string{"main;foo", "main;bar", "main;baz"} {
+			g := NewMergedProfile(MergeOptions{})
+			require.NoError(t, g.Merge(fmt.Sprint(i), newTestProfile(t, map[string]int64{stack: 1e7})))
+			groups = append(groups, g)
+		}
+		return groups
+	}
+	want, err := reduceMerged(newGroups(), MergeOptions{})
+	require.NoError(t, err)
+	groups := newGroups()
+	got, err := reduceMerged(groups, MergeOptions{MaxInFlight: 1})
+	require.NoError(t, err)
+	require.Equal(t, stackValues(want.profile), stackValues(got.profile))
+	require.Equal(t, []string{"0", "1", "2"}, got.ProfileIDs())
+	for _, g := range groups {
+		require.Nil(t, g.profile, "group profiles are released")
+	}
+
+	// With spilling, the group profiles are reduced from disk.
+	t.Setenv("TMPDIR", t.TempDir())
+	groups = newGroups()
+	got, err = reduceMerged(groups, MergeOptions{SpillChunk: 10})
+	require.NoError(t, err)
+	require.Equal(t, stackValues(want.profile), stackValues(got.profile))
+	require.Equal(t, []string{"0", "1", "2"}, got.ProfileIDs())
+	require.Nil(t, got.spill)
+	for _, g := range groups {
+		require.Nil(t, g.profile, "group profiles are released")
+	}
+	entries, err := os.ReadDir(os.Getenv("TMPDIR"))
+	require.NoError(t, err)
+	require.Empty(t, entries, "spilled chunks are removed")
+}
+
+// inFlightSource is a ProfileSource that records the maximum number of
+// profiles that are downloaded at the same time.
+type inFlightSource struct {
+	profiles    int
+	data        []byte
+	current     atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (s *inFlightSource) SearchProfiles(ctx context.Context, query SearchQuery) ([]*SearchProfile, error) {
+	var profiles []*SearchProfile
+	for i := 0; i < s.profiles; i++ {
+		profiles = append(profiles, &SearchProfile{ProfileID: fmt.Sprint(i)})
+	}
+	return profiles, nil
+}
+
+func (s *inFlightSource) DownloadProfile(ctx context.Context, p *SearchProfile) (ProfileDownload, error) {
+	n := s.current.Add(1)
+	defer s.current.Add(-1)
+	for {
+		if m := s.maxInFlight.Load(); n <= m || s.maxInFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return NewPprofDownload(s.data, DefaultZipLimits)
+}
+
+func TestSearchDownloadMergeMaxInFlight(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 10, nil, []string{"service:foo"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	source := &inFlightSource{profiles: 10, data: buf.Bytes()}
+	mp, err := SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{MaxInFlight: 2})
+	require.NoError(t, err)
+	require.Len(t, mp.ProfileIDs(), 10)
+	require.LessOrEqual(t, source.maxInFlight.Load(), int32(2))
+}
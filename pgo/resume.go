@@ -0,0 +1,141 @@
+package pgo
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// partialDownload is a response body streamed to a temporary file. If reading
+// the body fails, the next attempt resumes the download with a range request
+// instead of starting over, if the server supports it.
+type partialDownload struct {
+	file *os.File
+	// size is the number of bytes written to file.
+	size int64
+	// total is the size of the complete body, or -1 if it's unknown.
+	total int64
+	// validator is the ETag or Last-Modified header of the response that is
+	// sent as If-Range when resuming. It's empty if the download can't be
+	// resumed.
+	validator string
+}
+
+// prepare adds the headers for resuming the download to req. It must only be
+// used for GET requests.
+func (d *partialDownload) prepare(req *http.Request) {
+	if d.file != nil && d.size > 0 && d.validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.size))
+		req.Header.Set("If-Range", d.validator)
+	}
+}
+
+// read writes the body of res to the file. A 206 response resuming at the
+// current size is appended, any other response replaces the partial content.
+// It returns an incompleteDownloadError if the body doesn't match the size or
+// the sha-256 Repr-Digest announced by the server.
+func (d *partialDownload) read(res *http.Response, limits ZipLimits) (err error) {
+	if d.file == nil {
+		if d.file, err = os.CreateTemp("", Name+"-download-*.zip"); err != nil {
+			return err
+		}
+	}
+	start, total, ok := parseContentRange(res.Header.Get("Content-Range"))
+	if res.StatusCode == http.StatusPartialContent && ok && start == d.size {
+		d.total = total
+		if _, err := d.file.Seek(d.size, io.SeekStart); err != nil {
+			return err
+		}
+	} else {
+		if err := d.file.Truncate(0); err != nil {
+			return err
+		} else if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		d.size, d.total, d.validator = 0, res.ContentLength, ""
+		if res.Header.Get("Accept-Ranges") == "bytes" {
+			if d.validator = res.Header.Get("ETag"); d.validator == "" {
+				d.validator = res.Header.Get("Last-Modified")
+			}
+		}
+	}
+
+	n, err := io.Copy(d.file, io.LimitReader(res.Body, limits.MaxArchiveBytes-d.size+1))
+	d.size += n
+	if err != nil {
+		return &incompleteDownloadError{fmt.Sprintf("got %d bytes: %v", d.size, err)}
+	} else if d.size > limits.MaxArchiveBytes {
+		return fmt.Errorf("archive exceeds the limit of %d bytes", limits.MaxArchiveBytes)
+	} else if d.total >= 0 && d.size != d.total {
+		return &incompleteDownloadError{fmt.Sprintf("got %d of %d bytes", d.size, d.total)}
+	}
+	return d.verifyDigest(res.Header.Get("Repr-Digest"))
+}
+
+// verifyDigest compares the sha-256 checksum of the file to the one in the
+// Repr-Digest header value, e.g. sha-256=:base64:. Other algorithms and
+// missing headers are ignored.
+func (d *partialDownload) verifyDigest(header string) error {
+	var want string
+	for _, field := range strings.Split(header, ",") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(field), "sha-256="); ok {
+			want = strings.Trim(value, ":")
+		}
+	}
+	if want == "" {
+		return nil
+	}
+	h := sha256.New()
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	} else if _, err := io.Copy(h, d.file); err != nil {
+		return err
+	}
+	if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != want {
+		// The partial content is useless, start over on the next attempt.
+		d.size, d.validator = 0, ""
+		return &incompleteDownloadError{"sha-256 checksum mismatch"}
+	}
+	return nil
+}
+
+// parseContentRange parses a Content-Range header like "bytes 100-199/200"
+// and returns the first byte position and the complete length, which is -1
+// if it's unknown.
+func parseContentRange(header string) (start, total int64, ok bool) {
+	rng, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	rng, length, ok := strings.Cut(rng, "/")
+	first, _, ok2 := strings.Cut(rng, "-")
+	if !ok || !ok2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total = -1
+	if length != "*" {
+		if total, err = strconv.ParseInt(length, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, total, true
+}
+
+// incompleteDownloadError is returned if a downloaded body is truncated or
+// corrupted. Such downloads are retried.
+type incompleteDownloadError struct {
+	msg string
+}
+
+func (e *incompleteDownloadError) Error() string {
+	return "incomplete download: " + e.msg
+}
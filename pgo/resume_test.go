@@ -0,0 +1,96 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDownloadResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	var requests atomic.Int32
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		if requests.Add(1) == 1 {
+			// Announce the full body, but only send half of it.
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:len(data)/2])
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, Retries: 1, baseURL: srv.URL}
+	file, size, err := c.download(context.Background(), "/", nil)
+	require.NoError(t, err)
+	defer removeTemp(file)
+	require.Equal(t, []string{"", "bytes=5000-"}, ranges)
+	require.Equal(t, int64(len(data)), size)
+	got, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func TestClientDownloadChecksum(t *testing.T) {
+	data := []byte("profile")
+	sum := sha256.Sum256(data)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		if requests.Add(1) == 1 {
+			w.Write([]byte("corrupt"))
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	c := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, Retries: 1, baseURL: srv.URL}
+	file, size, err := c.download(context.Background(), "/", nil)
+	require.NoError(t, err)
+	defer removeTemp(file)
+	require.Equal(t, int32(2), requests.Load())
+	require.Equal(t, int64(len(data)), size)
+	got, err := io.ReadAll(io.NewSectionReader(file, 0, size))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	requests.Store(0)
+	c.Retries = 0
+	_, _, err = c.download(context.Background(), "/", nil)
+	require.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, tt := range []struct {
+		header       string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-9/*", 0, -1, true},
+		{"bytes */200", 0, 0, false},
+		{"items 0-9/10", 0, 0, false},
+		{"", 0, 0, false},
+	} {
+		start, total, ok := parseContentRange(tt.header)
+		require.Equal(t, tt.ok, ok, tt.header)
+		require.Equal(t, tt.start, start, tt.header)
+		require.Equal(t, tt.total, total, tt.header)
+	}
+}
@@ -0,0 +1,109 @@
+package pgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultRetries is the default number of retries for failed requests.
+	DefaultRetries = 3
+	// DefaultRetryBackoff is the default delay before the first retry.
+	DefaultRetryBackoff = time.Second
+)
+
+// retry calls fn until it succeeds, returns an error that is not worth
+// retrying, or c.Retries retries have been made. The delay between attempts
+// grows exponentially and is randomized to avoid retrying in lockstep with
+// other clients. Rate limited requests are retried once the rate limit resets
+// instead. Retries stop early if ctx is done.
+//
+// Every attempt gets its own context bounded by c.RequestTimeout, so a slow
+// request is cancelled and retried without using up the deadline of ctx.
+func (c *Client) retry(ctx context.Context, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := c.attempt(ctx, fn)
+		if err == nil || attempt >= c.Retries || !retryable(err) {
+			return data, err
+		}
+		delay := retryDelay(c.RetryBackoff, attempt)
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			delay = statusErr.RetryAfter
+		}
+		if c.Log != nil {
+			c.Log.Warn("request failed, retrying", "error", err, "attempt", attempt+1, "retries", c.Retries, "delay", delay.Round(time.Millisecond))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt calls fn with a context bounded by c.RequestTimeout. If the timeout
+// expires before ctx is done, a retryable requestTimeoutError is returned.
+func (c *Client) attempt(ctx context.Context, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	if c.RequestTimeout <= 0 {
+		return fn(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, c.RequestTimeout)
+	defer cancel()
+	data, err := fn(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return nil, &requestTimeoutError{timeout: c.RequestTimeout}
+	}
+	return data, err
+}
+
+// requestTimeoutError is returned if an attempt exceeds Client.RequestTimeout.
+type requestTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *requestTimeoutError) Error() string {
+	return fmt.Sprintf("request timed out after %s", e.timeout)
+}
+
+// retryDelay returns the delay before the retry following the given attempt.
+// It's a random duration between half and all of backoff * 2^attempt.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	d := backoff << min(attempt, 16)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable returns true if err is a server error, a rate limit error, a
+// network error, a request timeout or an incomplete download that might go
+// away when retrying.
+func retryable(err error) bool {
+	var statusErr *statusError
+	var urlErr *url.Error
+	var opErr *net.OpError
+	var incompleteErr *incompleteDownloadError
+	var timeoutErr *requestTimeoutError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return true
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	case errors.As(err, &urlErr) || errors.As(err, &opErr) || errors.As(err, &incompleteErr):
+		return true
+	default:
+		return errors.Is(err, io.ErrUnexpectedEOF)
+	}
+}
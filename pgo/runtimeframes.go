@@ -0,0 +1,84 @@
+package pgo
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// runtimeFuncPrefixes are the prefixes of the names of runtime and cgo
+// functions removed by PruneRuntimeFrames.
+var runtimeFuncPrefixes = []string{
+	"runtime.",
+	"runtime/cgo.",
+	"runtime/internal/",
+	"internal/runtime/",
+	"_cgo_",
+	"crosscall2",
+}
+
+// nativeFileExts are the extensions of the source files of assembly and C
+// functions removed by PruneRuntimeFrames.
+var nativeFileExts = map[string]bool{".s": true, ".S": true, ".c": true}
+
+// PruneRuntimeFrames collapses the runtime, cgo and assembly frames of all
+// samples, i.e. removes them from the stacks, so their cpu time is attributed
+// to their callers. Samples without any other frames, e.g. of the garbage
+// collector, are dropped, and samples with identical stacks are merged. These
+// frames rarely influence the inlining of user code, but they inflate the
+// profile. Note that the runtime is compiled with PGO as well, so it loses
+// its optimizations.
+func (p *MergedProfile) PruneRuntimeFrames() (stats PruneStats, err error) {
+	if stats.BytesBefore, err = encodedSize(p.profile); err != nil {
+		return stats, err
+	}
+	for _, s := range p.profile.Sample {
+		locations := s.Location[:0]
+		for _, loc := range s.Location {
+			if isRuntimeLocation(loc) {
+				stats.Frames++
+				continue
+			}
+			locations = append(locations, loc)
+		}
+		s.Location = locations
+	}
+	stats.Samples = dropSamples(p.profile, func(s *profile.Sample) bool {
+		return len(s.Location) == 0
+	})
+	functionsBefore := len(p.profile.Function)
+	p.profile = p.profile.Compact()
+	stats.Functions = functionsBefore - len(p.profile.Function)
+
+	stats.BytesAfter, err = encodedSize(p.profile)
+	return stats, err
+}
+
+// isRuntimeLocation returns true if all functions of loc, including inlined
+// ones, are runtime, cgo or assembly functions. Locations without any lines,
+// e.g. unsymbolized C code, are considered native as well.
+func isRuntimeLocation(loc *profile.Location) bool {
+	for _, line := range loc.Line {
+		if !isRuntimeFunction(line.Function) {
+			return false
+		}
+	}
+	return true
+}
+
+// isRuntimeFunction returns true if fn is a runtime or cgo function, or
+// implemented in assembly or C.
+func isRuntimeFunction(fn *profile.Function) bool {
+	if fn == nil {
+		return true
+	} else if nativeFileExts[filepath.Ext(fn.Filename)] {
+		return true
+	}
+	for _, prefix := range runtimeFuncPrefixes {
+		if strings.HasPrefix(fn.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
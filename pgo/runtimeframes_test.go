@@ -0,0 +1,43 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneRuntimeFrames(t *testing.T) {
+	mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{
+		"main;foo":                               1e7,
+		"main;foo;runtime.memmove":               2e7,
+		"main;runtime.mallocgc":                  3e7,
+		"runtime.gcBgMarkWorker;runtime.gcDrain": 4e7,
+	})}
+	stats, err := mp.PruneRuntimeFrames()
+	require.NoError(t, err)
+	require.Equal(t, 4, stats.Frames)
+	require.Equal(t, 1, stats.Samples)
+	require.Equal(t, 4, stats.Functions)
+	require.Less(t, stats.BytesAfter, stats.BytesBefore)
+	require.Equal(t, map[string][]int64{
+		"main;foo": {3, 3e7},
+		"main":     {3, 3e7},
+	}, stackValues(mp.profile))
+	require.Len(t, mp.profile.Sample, 2, "identical stacks are merged")
+}
+
+func TestIsRuntimeFunction(t *testing.T) {
+	for name, want := range map[string]bool{
+		"runtime.mallocgc":                    true,
+		"runtime/cgo.Handle.Value":            true,
+		"internal/runtime/atomic.Load":        true,
+		"_cgo_topofstack":                     true,
+		"runtime/pprof.(*profileBuilder).add": false,
+		"main.main":                           false,
+	} {
+		require.Equal(t, want, isRuntimeFunction(&profile.Function{Name: name, Filename: "x.go"}), name)
+	}
+	require.True(t, isRuntimeFunction(&profile.Function{Name: "crypto/sha256.block", Filename: "sha256block_amd64.s"}))
+	require.True(t, isRuntimeLocation(&profile.Location{}), "unsymbolized locations are native")
+}
@@ -0,0 +1,113 @@
+package pgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// secretTimeout bounds the time it takes to resolve a secret reference.
+const secretTimeout = 30 * time.Second
+
+// secretProviders maps the schemes of secret references to the functions
+// returning the command that prints the referenced secret. The commands use
+// the CLI of each provider, so its usual credentials apply.
+var secretProviders = map[string]func(ctx context.Context, path, field string) (*exec.Cmd, error){
+	// aws-sm://SECRET_ID#FIELD, SECRET_ID may be a name or an ARN.
+	"aws-sm://": func(ctx context.Context, path, _ string) (*exec.Cmd, error) {
+		return exec.CommandContext(ctx, "aws", "secretsmanager", "get-secret-value", "--secret-id", path, "--query", "SecretString", "--output", "text"), nil
+	},
+	// gcp-sm://PROJECT/SECRET[/VERSION]#FIELD, VERSION defaults to latest.
+	"gcp-sm://": func(ctx context.Context, path, _ string) (*exec.Cmd, error) {
+		parts := strings.Split(path, "/")
+		if len(parts) == 2 {
+			parts = append(parts, "latest")
+		} else if len(parts) != 3 {
+			return nil, fmt.Errorf("must be of the form gcp-sm://PROJECT/SECRET[/VERSION]")
+		}
+		return exec.CommandContext(ctx, "gcloud", "secrets", "versions", "access", parts[2], "--secret="+parts[1], "--project="+parts[0]), nil
+	},
+	// vault://PATH#FIELD, FIELD is required.
+	"vault://": func(ctx context.Context, path, field string) (*exec.Cmd, error) {
+		if field == "" {
+			return nil, fmt.Errorf("must be of the form vault://PATH#FIELD")
+		}
+		return exec.CommandContext(ctx, "vault", "kv", "get", "-field="+field, path), nil
+	},
+}
+
+// isSecretRef returns true if value is a secret reference like
+// aws-sm://my-secret#api_key.
+func isSecretRef(value string) bool {
+	for scheme := range secretProviders {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretCommand returns the command printing the secret referenced by ref
+// and the JSON field of its output that holds the secret, if any.
+func secretCommand(ctx context.Context, ref string) (cmd *exec.Cmd, jsonField string, err error) {
+	for scheme, command := range secretProviders {
+		if rest, ok := strings.CutPrefix(ref, scheme); ok {
+			path, field, _ := strings.Cut(rest, "#")
+			if cmd, err = command(ctx, path, field); err != nil {
+				return nil, "", err
+			} else if scheme == "vault://" {
+				// vault extracts the field itself.
+				field = ""
+			}
+			return cmd, field, nil
+		}
+	}
+	return nil, "", fmt.Errorf("unsupported secret reference")
+}
+
+// resolveSecret returns value, or the secret it references if it is a secret
+// reference, see secretProviders. The secret is trimmed of surrounding
+// whitespace. If the reference has a #FIELD, the secret must be a JSON object
+// and the string value of FIELD is returned.
+func resolveSecret(value string) (secret string, err error) {
+	if !isSecretRef(value) {
+		return value, nil
+	}
+	defer wrapErr(&err, "resolve "+value)
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	cmd, field, err := secretCommand(ctx, value)
+	if err != nil {
+		return "", err
+	}
+	// Errors only include stderr, as stdout holds the secret.
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+	} else if err != nil {
+		return "", fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return secretValue(out, field)
+}
+
+// secretValue returns the secret in the command output out, extracting field
+// from it if it is not empty.
+func secretValue(out []byte, field string) (string, error) {
+	if field == "" {
+		return strings.TrimSpace(string(out)), nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(out, &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, can't extract field %q", field)
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret has no string field %q", field)
+	}
+	return strings.TrimSpace(value), nil
+}
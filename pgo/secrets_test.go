@@ -0,0 +1,73 @@
+package pgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretCommand(t *testing.T) {
+	ctx := context.Background()
+	cmd, field, err := secretCommand(ctx, "aws-sm://arn:aws:secretsmanager:us-east-1:123:secret:dd#api_key")
+	require.NoError(t, err)
+	require.Equal(t, "api_key", field)
+	require.Equal(t, []string{"aws", "secretsmanager", "get-secret-value", "--secret-id", "arn:aws:secretsmanager:us-east-1:123:secret:dd", "--query", "SecretString", "--output", "text"}, cmd.Args)
+
+	cmd, field, err = secretCommand(ctx, "gcp-sm://my-project/dd-app-key")
+	require.NoError(t, err)
+	require.Empty(t, field)
+	require.Equal(t, []string{"gcloud", "secrets", "versions", "access", "latest", "--secret=dd-app-key", "--project=my-project"}, cmd.Args)
+	_, _, err = secretCommand(ctx, "gcp-sm://dd-app-key")
+	require.ErrorContains(t, err, "gcp-sm://PROJECT/SECRET")
+
+	cmd, field, err = secretCommand(ctx, "vault://secret/datadog#app_key")
+	require.NoError(t, err)
+	require.Empty(t, field)
+	require.Equal(t, []string{"vault", "kv", "get", "-field=app_key", "secret/datadog"}, cmd.Args)
+	_, _, err = secretCommand(ctx, "vault://secret/datadog")
+	require.ErrorContains(t, err, "#FIELD")
+}
+
+func TestSecretValue(t *testing.T) {
+	v, err := secretValue([]byte("abc\n"), "")
+	require.NoError(t, err)
+	require.Equal(t, "abc", v)
+	v, err = secretValue([]byte(`{"api_key": "abc", "app_key": "def"}`), "app_key")
+	require.NoError(t, err)
+	require.Equal(t, "def", v)
+	_, err = secretValue([]byte(`{"api_key": "abc"}`), "app_key")
+	require.ErrorContains(t, err, `no string field "app_key"`)
+	_, err = secretValue([]byte("abc"), "app_key")
+	require.ErrorContains(t, err, "not a JSON object")
+}
+
+func TestClientFromEnvSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell script")
+	}
+	// A fake aws CLI prints the secret.
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho '{\"api_key\": \"resolved-api\", \"app_key\": \"resolved-app\"}'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "aws"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("DD_BEARER_TOKEN", "")
+	t.Setenv("DD_OAUTH_CLIENT_ID", "")
+	t.Setenv("DD_OAUTH_CLIENT_SECRET", "")
+	t.Setenv("DD_API_KEY", "aws-sm://dd#api_key")
+	t.Setenv("DD_APP_KEY", "aws-sm://dd#app_key")
+
+	c, err := ClientFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "resolved-api", c.apiKey)
+	require.Equal(t, "resolved-app", c.appKey)
+
+	t.Setenv("DD_APP_KEY", "aws-sm://dd#missing")
+	_, err = ClientFromEnv()
+	require.ErrorContains(t, err, "DD_APP_KEY")
+	require.Equal(t, ErrorClassAuth, ErrorClass(err))
+}
@@ -0,0 +1,266 @@
+package pgo
+
+import (
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SelectOptions controls which of the profiles returned by a search are
+// downloaded and merged. Selecting profiles requires the search results, so
+// non-zero options force the use of the search and download endpoints.
+type SelectOptions struct {
+	// MinVersion drops profiles with a version lower than MinVersion. See
+	// compareVersions for how versions are compared.
+	MinVersion string
+	// GoVersion drops profiles from go runtimes not matching GoVersion. See
+	// matchGoVersion for how versions are matched.
+	GoVersion string
+	// SampleRate is the fraction of profiles to randomly select. Values <= 0
+	// or >= 1 disable sampling.
+	SampleRate float64
+	// SampleSeed seeds the random selection to make it reproducible.
+	SampleSeed int64
+	// SampleKeepTop is the number of top profiles (according to the search
+	// sort order) that are always kept when sampling. Only the remaining
+	// profiles are sampled.
+	SampleKeepTop int
+	// CPUPercentile chooses the profiles whose cpu cores are closest to this
+	// percentile of the cpu cores of the profiles in the window, instead of
+	// the top profiles. Zero disables it. See searchQuery.
+	CPUPercentile float64
+	// WindowFilter drops profiles taken outside of its windows, e.g. outside
+	// of business hours. Nil disables it. See searchQuery.
+	WindowFilter *WindowFilter
+}
+
+// RequiresSearch returns true if the options need to inspect search results.
+func (o SelectOptions) RequiresSearch() bool {
+	return o.MinVersion != "" || o.GoVersion != "" || o.sampling() || o.CPUPercentile > 0 || o.WindowFilter != nil
+}
+
+// percentileSearchLimit is the number of profiles searched to determine the
+// cpu percentile used by SelectOptions.CPUPercentile.
+const percentileSearchLimit = 1000
+
+// searchQuery returns the query used to search the candidates for q. If
+// CPUPercentile is set, the most recent percentileSearchLimit profiles are
+// searched, which represent the window better than the profiles with the
+// most cpu cores. If WindowFilter is set, at least percentileSearchLimit
+// profiles are searched, so enough of them remain after dropping the ones
+// outside of the windows.
+func (o SelectOptions) searchQuery(q SearchQuery) SearchQuery {
+	if o.CPUPercentile > 0 {
+		q.Sort = SearchSort{Order: "desc", Field: sortFields["timestamp"]}
+		q.Limit = max(q.Limit, percentileSearchLimit)
+	}
+	if o.WindowFilter != nil {
+		q.Limit = max(q.Limit, percentileSearchLimit)
+	}
+	return q
+}
+
+// sampling returns true if random sampling is enabled.
+func (o SelectOptions) sampling() bool {
+	return o.SampleRate > 0 && o.SampleRate < 1
+}
+
+// Select returns the profiles that should be downloaded.
+func (o SelectOptions) Select(log *slog.Logger, profiles []*SearchProfile) []*SearchProfile {
+	if o.MinVersion != "" {
+		profiles = filterProfiles(profiles, func(p *SearchProfile) bool {
+			if p.Version == "" || compareVersions(p.Version, o.MinVersion) < 0 {
+				log.Debug("dropping profile below min version", "profile-id", p.ProfileID, "version", p.Version, "min-version", o.MinVersion)
+				return false
+			}
+			return true
+		})
+	}
+	if o.GoVersion != "" {
+		profiles = filterProfiles(profiles, func(p *SearchProfile) bool {
+			if !matchGoVersion(p.GoVersion, o.GoVersion) {
+				log.Debug("dropping profile with other go version", "profile-id", p.ProfileID, "go-version", p.GoVersion, "want-go-version", o.GoVersion)
+				return false
+			}
+			return true
+		})
+	}
+	if o.WindowFilter != nil {
+		profiles = filterProfiles(profiles, func(p *SearchProfile) bool {
+			if !o.WindowFilter.Match(p.Timestamp) {
+				log.Debug("dropping profile outside of window filter", "profile-id", p.ProfileID, "timestamp", p.Timestamp, "window-filter", o.WindowFilter.String())
+				return false
+			}
+			return true
+		})
+	}
+	if o.sampling() {
+		matched := len(profiles)
+		profiles = sampleProfiles(profiles, o.SampleRate, o.SampleKeepTop, o.SampleSeed)
+		log.Info("sampled profiles", "sampled", len(profiles), "matched", matched, "rate", o.SampleRate, "keep-top", o.SampleKeepTop, "seed", o.SampleSeed)
+	}
+	if o.CPUPercentile > 0 && len(profiles) > 0 {
+		var target float64
+		profiles, target = nearPercentile(profiles, o.CPUPercentile)
+		log.Info("ordered profiles by distance to cpu percentile", "percentile", o.CPUPercentile, "cpu-cores", float64(int(target*10))/10, "candidates", len(profiles))
+	}
+	return profiles
+}
+
+// nearPercentile returns profiles ordered by the distance of their cpu cores
+// to the pth percentile of the cpu cores of all profiles, closest first, and
+// the cpu cores of the percentile. Avoiding the profiles with the most cpu
+// cores keeps incidents or GC storms from dominating the merged profile.
+func nearPercentile(profiles []*SearchProfile, p float64) ([]*SearchProfile, float64) {
+	cores := make([]float64, len(profiles))
+	for i, prof := range profiles {
+		cores[i] = prof.CPUCores
+	}
+	sort.Float64s(cores)
+	target := cores[int(math.Round(p/100*float64(len(cores)-1)))]
+
+	ordered := append([]*SearchProfile{}, profiles...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return math.Abs(ordered[i].CPUCores-target) < math.Abs(ordered[j].CPUCores-target)
+	})
+	return ordered, target
+}
+
+// sampleProfiles keeps the first keepTop profiles and randomly selects
+// round(rate * n) of the remaining n profiles, preserving their order. The
+// selection is deterministic for a given seed.
+func sampleProfiles(profiles []*SearchProfile, rate float64, keepTop int, seed int64) []*SearchProfile {
+	if keepTop >= len(profiles) {
+		return profiles
+	}
+	if keepTop < 0 {
+		keepTop = 0
+	}
+	tail := profiles[keepTop:]
+	n := int(math.Round(rate * float64(len(tail))))
+	picked := rand.New(rand.NewSource(seed)).Perm(len(tail))[:n]
+	sort.Ints(picked)
+
+	sampled := append([]*SearchProfile{}, profiles[:keepTop]...)
+	for _, idx := range picked {
+		sampled = append(sampled, tail[idx])
+	}
+	return sampled
+}
+
+// filterProfiles returns the profiles for which keep returns true.
+func filterProfiles(profiles []*SearchProfile, keep func(*SearchProfile) bool) []*SearchProfile {
+	var kept []*SearchProfile
+	for _, p := range profiles {
+		if keep(p) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// matchGoVersion returns true if the go runtime version got matches want.
+// Versions match exactly by default, e.g. "go1.21.5" only matches "go1.21.5".
+// If want only specifies a language version like "go1.21", it matches all of
+// its patch releases and pre-releases, e.g. "go1.21.5" and "go1.21rc2". The
+// "go" prefix is optional.
+func matchGoVersion(got, want string) bool {
+	got, want = strings.TrimPrefix(got, "go"), strings.TrimPrefix(want, "go")
+	if got == want {
+		return true
+	} else if strings.Count(want, ".") != 1 || !strings.HasPrefix(got, want) {
+		return false
+	}
+	rest := got[len(want):]
+	return strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "rc") || strings.HasPrefix(rest, "beta")
+}
+
+// compareVersions compares the versions a and b and returns -1, 0 or 1 if a
+// is lower, equal or greater than b. If both versions look like semantic
+// versions (with an optional "v" prefix), they are compared according to
+// semver precedence. Otherwise they are compared lexically.
+func compareVersions(a, b string) int {
+	sa, aok := parseSemver(a)
+	sb, bok := parseSemver(b)
+	if !aok || !bok {
+		return strings.Compare(a, b)
+	}
+	for i := range sa.core {
+		if sa.core[i] != sb.core[i] {
+			if sa.core[i] < sb.core[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case sa.pre == sb.pre:
+		return 0
+	case sa.pre == "":
+		return 1
+	case sb.pre == "":
+		return -1
+	}
+	return comparePrerelease(sa.pre, sb.pre)
+}
+
+// semver is a parsed semantic version.
+type semver struct {
+	core [3]uint64
+	pre  string
+}
+
+// parseSemver parses v as a semantic version. Build metadata is ignored.
+func parseSemver(v string) (s semver, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, s.pre, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semver{}, false
+		}
+		s.core[i] = n
+	}
+	return s, true
+}
+
+// comparePrerelease compares two semver pre-release strings.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package pgo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.10.0", -1},
+		{"v2.0.0", "v1.10.0", 1},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"v1.0.0+build1", "v1.0.0+build2", 0},
+		{"2024-01-02", "2024-01-10", -1},
+		{"abc", "abd", -1},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, compareVersions(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+		require.Equal(t, -tt.want, compareVersions(tt.b, tt.a), "%s vs %s", tt.b, tt.a)
+	}
+}
+
+func TestSampleProfiles(t *testing.T) {
+	var profiles []*SearchProfile
+	for i := 0; i < 20; i++ {
+		profiles = append(profiles, &SearchProfile{ProfileID: fmt.Sprint(i)})
+	}
+
+	sampled := sampleProfiles(profiles, 0.25, 3, 42)
+	require.Len(t, sampled, 3+4)
+	require.Equal(t, profiles[:3], sampled[:3])
+	require.Equal(t, sampled, sampleProfiles(profiles, 0.25, 3, 42))
+	require.NotEqual(t, sampled, sampleProfiles(profiles, 0.25, 3, 43))
+
+	require.Equal(t, profiles, sampleProfiles(profiles, 0.1, 20, 42))
+}
+
+func TestMatchGoVersion(t *testing.T) {
+	require.True(t, matchGoVersion("go1.21.5", "go1.21.5"))
+	require.True(t, matchGoVersion("go1.21.5", "1.21.5"))
+	require.False(t, matchGoVersion("go1.21.5", "go1.21.4"))
+	require.True(t, matchGoVersion("go1.21.5", "go1.21"))
+	require.True(t, matchGoVersion("go1.21rc2", "go1.21"))
+	require.False(t, matchGoVersion("go1.210.1", "go1.21"))
+	require.False(t, matchGoVersion("go1.22.0", "go1.21"))
+	require.False(t, matchGoVersion("", "go1.21"))
+}
+
+func TestNearPercentile(t *testing.T) {
+	var profiles []*SearchProfile
+	for i := 0; i <= 10; i++ {
+		profiles = append(profiles, &SearchProfile{ProfileID: fmt.Sprint(i), CPUCores: float64(i)})
+	}
+	// An incident profile with far more cpu cores than the others
+	profiles = append(profiles, &SearchProfile{ProfileID: "incident", CPUCores: 100})
+
+	ordered, target := nearPercentile(profiles, 90)
+	require.Equal(t, 10.0, target)
+	var ids []string
+	for _, p := range ordered[:3] {
+		ids = append(ids, p.ProfileID)
+	}
+	require.Equal(t, []string{"10", "9", "8"}, ids)
+	require.Equal(t, "incident", ordered[len(ordered)-1].ProfileID)
+
+	sel := SelectOptions{CPUPercentile: 90}
+	require.True(t, sel.RequiresSearch())
+	q := sel.searchQuery(SearchQuery{Limit: 5, Sort: SearchSort{Order: "desc", Field: DefaultSortField}})
+	require.Equal(t, percentileSearchLimit, q.Limit)
+	require.Equal(t, "timestamp", q.Sort.Field)
+	require.Equal(t, 5, SelectOptions{}.searchQuery(SearchQuery{Limit: 5}).Limit)
+}
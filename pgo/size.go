@@ -0,0 +1,71 @@
+package pgo
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/google/pprof/profile"
+)
+
+// DefaultCompressionLevel is the gzip compression level used by Write, the
+// same as used by the go toolchain and pprof.
+const DefaultCompressionLevel = gzip.DefaultCompression
+
+// ValidCompressionLevel returns an error unless level is a valid argument for
+// WriteLevel.
+func ValidCompressionLevel(level int) error {
+	if level < gzip.DefaultCompression || level > gzip.BestCompression {
+		return fmt.Errorf("invalid compression level %d, must be between %d and %d", level, gzip.DefaultCompression, gzip.BestCompression)
+	}
+	return nil
+}
+
+// writeProfile writes prof to w compressed with the gzip level, see
+// WriteLevel.
+func writeProfile(w io.Writer, prof *profile.Profile, level int) error {
+	switch level {
+	case DefaultCompressionLevel:
+		return prof.Write(w)
+	case gzip.NoCompression:
+		return prof.WriteUncompressed(w)
+	}
+	zw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	} else if err := prof.WriteUncompressed(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// SizeStats breaks down the size of a profile, see ProfileSize.
+type SizeStats struct {
+	// Compressed is the size of the profile compressed with the default
+	// gzip level.
+	Compressed int64
+	// Uncompressed is the size of the uncompressed protobuf encoding.
+	Uncompressed int64
+	// Samples, Locations, Functions and Mappings are the number of entries
+	// of the respective tables of the profile.
+	Samples   int
+	Locations int
+	Functions int
+	Mappings  int
+}
+
+// ProfileSize returns the size of prof when written and the number of
+// entries of its tables, e.g. to track the growth of PGO files over time.
+func ProfileSize(prof *profile.Profile) (stats SizeStats, err error) {
+	defer wrapErr(&err, "profile size")
+	if stats.Compressed, err = encodedSize(prof); err != nil {
+		return stats, err
+	}
+	cw := &countingWriter{W: io.Discard}
+	if err := prof.WriteUncompressed(cw); err != nil {
+		return stats, err
+	}
+	stats.Uncompressed = cw.N
+	stats.Samples, stats.Locations, stats.Functions, stats.Mappings = len(prof.Sample), len(prof.Location), len(prof.Function), len(prof.Mapping)
+	return stats, nil
+}
@@ -0,0 +1,43 @@
+package pgo
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLevel(t *testing.T) {
+	prof, err := ReadProfile("testdata/grpc-anon.pprof")
+	require.NoError(t, err)
+	mp := &MergedProfile{profile: prof}
+
+	dir := t.TempDir()
+	sizes := map[int]int64{}
+	for _, level := range []int{gzip.NoCompression, gzip.BestSpeed, DefaultCompressionLevel, gzip.BestCompression} {
+		dst := filepath.Join(dir, "default.pgo")
+		n, err := mp.WriteLevel(dst, 0, level)
+		require.NoError(t, err)
+		sizes[level] = n
+
+		// All levels can be read back.
+		written, err := ReadProfile(dst)
+		require.NoError(t, err)
+		require.Len(t, written.Sample, len(prof.Sample))
+	}
+	// Writing normalizes the profile, so its size is only known afterwards.
+	stats, err := ProfileSize(prof)
+	require.NoError(t, err)
+	require.Equal(t, len(prof.Sample), stats.Samples)
+	require.Equal(t, len(prof.Function), stats.Functions)
+	require.Equal(t, stats.Uncompressed, sizes[gzip.NoCompression])
+	require.Equal(t, stats.Compressed, sizes[DefaultCompressionLevel])
+	require.Greater(t, sizes[gzip.BestSpeed], sizes[gzip.BestCompression])
+
+	_, err = mp.WriteLevel(filepath.Join(dir, "invalid.pgo"), 0, 10)
+	require.ErrorContains(t, err, "invalid compression level 10")
+	_, err = os.Stat(filepath.Join(dir, "invalid.pgo"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
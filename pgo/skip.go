@@ -0,0 +1,45 @@
+package pgo
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Levels for logging skipped profiles.
+const (
+	// SkipLogSilent doesn't log skipped profiles.
+	SkipLogSilent = "silent"
+	// SkipLogSummary logs the number of skipped profiles at the end.
+	SkipLogSummary = "summary"
+	// SkipLogEach logs every skipped profile.
+	SkipLogEach = "each"
+)
+
+// Skip records that the profile with the given id was skipped because of err
+// and logs it if the skip log level is SkipLogEach.
+func (p *MergedProfile) Skip(log *slog.Logger, id string, err error) {
+	p.mu.Lock()
+	p.skipped++
+	p.mu.Unlock()
+	if p.opts.SkipLogLevel == SkipLogEach {
+		log.Warn("skipping invalid profile", "profile-id", id, "error", err)
+	}
+}
+
+// skipInvalid skips the invalid profile with the given id like Skip, unless
+// MergeOptions.Strict is set, in which case it returns an error instead.
+func (p *MergedProfile) skipInvalid(log *slog.Logger, id string, err error) error {
+	if p.opts.Strict {
+		return fmt.Errorf("invalid profile %s: %w", id, err)
+	}
+	p.Skip(log, id, err)
+	return nil
+}
+
+// LogSkipSummary logs the number of skipped profiles if the skip log level is
+// SkipLogSummary.
+func (p *MergedProfile) LogSkipSummary(log *slog.Logger) {
+	if p.opts.SkipLogLevel == SkipLogSummary && p.skipped > 0 {
+		log.Warn("skipped invalid profiles", "count", p.skipped)
+	}
+}
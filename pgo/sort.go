@@ -0,0 +1,86 @@
+package pgo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sortFields maps the names accepted by SortField to the search fields they sort
+// by. Profiles are always sorted in descending order.
+var sortFields = map[string]string{
+	"cpu_cores":           "@metrics.core_cpu_cores",
+	"core_cpu_cores":      "@metrics.core_cpu_cores",
+	"cpu_time":            "@metrics.core_cpu_time_total",
+	"core_cpu_time_total": "@metrics.core_cpu_time_total",
+	"duration":            "duration_nanos",
+	"timestamp":           "timestamp",
+}
+
+// sortFieldRE matches the @fields accepted by SortField, e.g.
+// @metrics.core_cpu_time_total.
+var sortFieldRE = regexp.MustCompile(`^@[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+
+// DefaultSortField is the field profiles are sorted by if no other field is
+// given.
+const DefaultSortField = "@metrics.core_cpu_cores"
+
+// SortField returns the search field for the sort name, which is one of the
+// names in sortFields or a numeric search field starting with "@", e.g.
+// "@metrics.core_cpu_time_total". The CPU cores favor profiles of busy
+// periods, which may not be representative for bursty services, while the
+// CPU time favors long profiles and the timestamp recent ones.
+func SortField(name string) (string, error) {
+	if field, ok := sortFields[name]; ok {
+		return field, nil
+	} else if sortFieldRE.MatchString(name) {
+		return name, nil
+	} else if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("invalid sort %q, @fields must look like @metrics.core_cpu_time_total", name)
+	}
+	names := make([]string, 0, len(sortFields))
+	for name := range sortFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("unknown sort %q, must be one of %s or an @field", name, strings.Join(names, ", "))
+}
+
+// hasDuplicateQueries returns true if the same query is searched more than
+// once in the same time window, e.g. using different sort fields. The pgo
+// endpoint can't deduplicate the profiles of such queries. Queries for
+// different windows, see StratifyQueries, don't match the same profiles.
+func hasDuplicateQueries(queries []SearchQuery) bool {
+	seen := map[string]bool{}
+	for _, q := range queries {
+		key := q.Filter.Query + "\x00" + q.Filter.From.String() + "\x00" + q.Filter.To.String()
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+	}
+	return false
+}
+
+// profileSet is a concurrency-safe set of profile ids used to avoid
+// downloading the same profile for multiple queries.
+type profileSet struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// Claim adds id to the set and returns true if it wasn't in the set yet.
+func (s *profileSet) Claim(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids == nil {
+		s.ids = map[string]bool{}
+	}
+	if s.ids[id] {
+		return false
+	}
+	s.ids[id] = true
+	return true
+}
@@ -0,0 +1,31 @@
+package pgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildQueriesSorts(t *testing.T) {
+	queries, err := BuildQueries(time.Hour, 5, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	require.Equal(t, DefaultSortField, queries[0].Sort.Field)
+	require.False(t, hasDuplicateQueries(queries))
+
+	queries, err = BuildQueries(time.Hour, 5, []string{"@metrics.core_cpu_cores", "timestamp"}, []string{"service:foo", "service:bar"})
+	require.NoError(t, err)
+	require.Len(t, queries, 4)
+	require.Equal(t, "service:foo runtime:go", queries[1].Filter.Query)
+	require.Equal(t, "timestamp", queries[1].Sort.Field)
+	require.True(t, hasDuplicateQueries(queries))
+	require.False(t, hasDuplicateQueries(StratifyQueries(queries[:1], 3)), "buckets don't overlap")
+}
+
+func TestProfileSet(t *testing.T) {
+	var s profileSet
+	require.True(t, s.Claim("a"))
+	require.True(t, s.Claim("b"))
+	require.False(t, s.Claim("a"))
+}
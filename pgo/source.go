@@ -0,0 +1,34 @@
+package pgo
+
+import (
+	"context"
+	"fmt"
+)
+
+// ProfileSource is a store of profiles that can be searched and downloaded.
+// Client implements it for Datadog, DirSource and HTTPSource implement it for
+// local directories and generic HTTP endpoints, so the merging pipeline can be
+// used with profiles stored outside of Datadog, see Fetcher.Source.
+type ProfileSource interface {
+	// SearchProfiles returns the profiles matching query, sorted as requested
+	// by query.Sort. It returns ErrNoProfiles if there are none.
+	SearchProfiles(ctx context.Context, query SearchQuery) ([]*SearchProfile, error)
+	// DownloadProfile downloads a profile returned by SearchProfiles.
+	DownloadProfile(ctx context.Context, p *SearchProfile) (ProfileDownload, error)
+}
+
+var (
+	_ ProfileSource = (*Client)(nil)
+	_ ProfileSource = (*DirSource)(nil)
+	_ ProfileSource = (*HTTPSource)(nil)
+)
+
+// NewPprofDownload returns a download holding the single pprof file data, as
+// opposed to the zip archives downloaded from Datadog. It's meant for
+// implementations of ProfileSource. The limits apply to the size of data.
+func NewPprofDownload(data []byte, limits ZipLimits) (ProfileDownload, error) {
+	if limits.MaxEntryBytes > 0 && int64(len(data)) > limits.MaxEntryBytes {
+		return ProfileDownload{}, fmt.Errorf("profile of %d bytes exceeds the limit of %d bytes", len(data), limits.MaxEntryBytes)
+	}
+	return ProfileDownload{data: data, limits: limits, pprof: true}, nil
+}
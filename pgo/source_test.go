@@ -0,0 +1,83 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	for name, stacks := range map[string]map[string]int64{
+		"a.pprof":     {"main;foo": 6e10},
+		"sub/b.pprof": {"main;bar": 3e10},
+		"c.pprof":     {"main;baz": 1.2e11},
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, newTestProfile(t, stacks).Write(&buf))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a profile"), 0644))
+
+	src := &DirSource{Dir: dir}
+	queries, err := BuildQueries(time.Since(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)), 2, nil, []string{"ignored"})
+	require.NoError(t, err)
+	profiles, err := src.SearchProfiles(context.Background(), queries[0])
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	require.Equal(t, "c.pprof", profiles[0].ProfileID)
+	require.Equal(t, 2.0, profiles[0].CPUCores)
+	require.Equal(t, "a.pprof", profiles[1].ProfileID)
+
+	mp, err := (&Fetcher{Source: src}).Fetch(context.Background(), queries)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]int64{"main;foo": {6000, 6e10}, "main;baz": {12000, 1.2e11}}, stackValues(mp.profile))
+
+	queries, err = BuildQueries(time.Hour, 2, nil, []string{"ignored"})
+	require.NoError(t, err)
+	_, err = src.SearchProfiles(context.Background(), queries[0])
+	require.ErrorIs(t, err, ErrNoProfiles, "the profiles are older than the window")
+}
+
+func TestHTTPSource(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			var q SearchQuery
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&q))
+			require.Equal(t, "service:foo runtime:go", q.Filter.Query)
+			fmt.Fprint(w, `{"profiles": [{"id": "a/1", "service": "foo", "cpu_cores": 1.5, "duration_seconds": 60}, {"id": "missing"}]}`)
+		case "/profiles/a/1":
+			w.Write(buf.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	src := &HTTPSource{URL: srv.URL + "/"}
+	queries, err := BuildQueries(time.Hour, 1, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	profiles, err := src.SearchProfiles(context.Background(), queries[0])
+	require.NoError(t, err)
+	require.Equal(t, []*SearchProfile{{Service: "foo", CPUCores: 1.5, ProfileID: "a/1", Duration: time.Minute}}, profiles)
+
+	mp, err := (&Fetcher{Source: src}).Fetch(context.Background(), queries)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a/1"}, mp.ProfileIDs())
+
+	_, err = src.DownloadProfile(context.Background(), &SearchProfile{ProfileID: "missing"})
+	require.ErrorContains(t, err, "404")
+}
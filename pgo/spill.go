@@ -0,0 +1,106 @@
+package pgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/pprof/profile"
+)
+
+// maybeSpill writes the in-memory profile to disk and resets it if the number
+// of profiles merged since the last spill has reached the configured chunk
+// size. Callers must hold p.mu.
+func (p *MergedProfile) maybeSpill() (err error) {
+	if p.opts.SpillChunk <= 0 {
+		return nil
+	}
+	if p.spill == nil {
+		if p.spill, err = newSpiller(); err != nil {
+			return err
+		}
+	}
+	p.spill.pending++
+	if p.spill.pending < p.opts.SpillChunk {
+		return nil
+	}
+	if err := p.spill.Spill(p.profile); err != nil {
+		return err
+	}
+	p.profile = nil
+	return nil
+}
+
+// spiller stores intermediate merge results as chunk files in a temporary
+// directory. This trades speed for a lower memory ceiling, as only the chunk
+// currently being merged needs to be held in memory.
+type spiller struct {
+	dir     string
+	chunks  []string
+	pending int
+}
+
+// newSpiller creates a spiller backed by a new temporary directory.
+func newSpiller() (*spiller, error) {
+	dir, err := os.MkdirTemp("", Name+"-spill-")
+	if err != nil {
+		return nil, fmt.Errorf("spill: %w", err)
+	}
+	return &spiller{dir: dir}, nil
+}
+
+// Spill writes prof to a new chunk file.
+func (s *spiller) Spill(prof *profile.Profile) (err error) {
+	defer wrapErr(&err, "spill")
+	path := filepath.Join(s.dir, fmt.Sprintf("chunk-%d.pprof", len(s.chunks)))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := prof.Write(file); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	s.chunks = append(s.chunks, path)
+	s.pending = 0
+	return nil
+}
+
+// MergeChunks merges all spilled chunks into prof, reading one chunk at a time
+// from disk. prof may be nil if there are no unspilled profiles left.
+func (s *spiller) MergeChunks(prof *profile.Profile) (merged *profile.Profile, err error) {
+	defer wrapErr(&err, "merge spilled chunks")
+	merged = prof
+	for _, path := range s.chunks {
+		chunk, err := readProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = chunk
+			continue
+		}
+		if merged, err = profile.Merge([]*profile.Profile{merged, chunk}); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// Close removes the temporary directory holding the chunk files.
+func (s *spiller) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// readProfile reads and parses the pprof file at path.
+func readProfile(path string) (*profile.Profile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return profile.Parse(file)
+}
@@ -0,0 +1,93 @@
+package pgo
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpill(t *testing.T) {
+	merge := func(opts MergeOptions) *MergedProfile {
+		mp := NewMergedProfile(opts)
+		for i := 0; i < 25; i++ {
+			prof := newTestProfile(t, map[string]int64{
+				"main;foo":                      int64(i+1) * 1e7,
+				"main;bar":                      2e7,
+				fmt.Sprintf("main;fn%d", i%7):   3e7,
+				fmt.Sprintf("main;foo;fn%d", i): 1e7,
+			})
+			require.NoError(t, mp.Merge(fmt.Sprintf("id%d", i), prof))
+		}
+		require.NoError(t, mp.Finish())
+		return mp
+	}
+
+	want := merge(MergeOptions{})
+	for _, chunk := range []int{1, 3, 10, 25, 100} {
+		t.Run(fmt.Sprintf("chunk=%d", chunk), func(t *testing.T) {
+			got := merge(MergeOptions{SpillChunk: chunk})
+			require.Nil(t, got.spill)
+			require.Equal(t, stackValues(want.profile), stackValues(got.profile))
+			require.Equal(t, want.profileIDs, got.profileIDs)
+		})
+	}
+}
+
+func TestSpillClose(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	mp := NewMergedProfile(MergeOptions{SpillChunk: 1})
+	require.NoError(t, mp.Merge("id", newTestProfile(t, map[string]int64{"main;foo": 1e7})))
+	require.DirExists(t, mp.spill.dir)
+	dir := mp.spill.dir
+	require.NoError(t, mp.Close())
+	require.NoDirExists(t, dir)
+	require.NoError(t, mp.Close())
+
+	// Abandoned merges remove their spilled chunks.
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 10, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	source := &failingSource{profiles: 10, failing: 1, data: buf.Bytes()}
+	_, err = SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{SpillChunk: 1})
+	require.ErrorContains(t, err, "boom")
+	entries, err := os.ReadDir(os.Getenv("TMPDIR"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestSpillClosePGOEndpoint(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	var good bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&good))
+	// The good profile is spilled before the corrupt one fails the merge.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{{"good.pprof", good.Bytes()}, {"corrupt.pprof", []byte("garbage")}} {
+		w, err := zw.Create(entry.name)
+		require.NoError(t, err)
+		_, err = w.Write(entry.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	d := &ProfilesDownload{data: buf.Bytes(), limits: DefaultZipLimits}
+	_, err := d.MergedProfile(log, MergeOptions{Strict: true, SpillChunk: 1})
+	require.ErrorContains(t, err, "invalid profile corrupt.pprof")
+	entries, err := os.ReadDir(os.Getenv("TMPDIR"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
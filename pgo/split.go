@@ -0,0 +1,114 @@
+package pgo
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/sourcegraph/conc/pool"
+)
+
+// splitPGOQueries splits queries into batches that request at most
+// maxPGOEndpointProfiles profiles each, so each batch can be fetched with a
+// single request to the pgo endpoint.
+//
+// A query with a larger limit is split into queries for disjoint time
+// subwindows of equal length, which share the limit. Each subwindow then
+// contributes its own top profiles, so the profiles are spread more evenly
+// over time than those of a single search. Queries of ProfileIDsQuery are
+// split into chunks of their IDs instead, as all of their profiles are
+// needed.
+func splitPGOQueries(queries []SearchQuery) (batches [][]SearchQuery) {
+	var split []SearchQuery
+	for _, q := range queries {
+		if q.Limit <= maxPGOEndpointProfiles {
+			split = append(split, q)
+			continue
+		} else if len(q.profileIDs) > 0 {
+			split = append(split, splitProfileIDs(q, maxPGOEndpointProfiles)...)
+			continue
+		}
+		n := (q.Limit + maxPGOEndpointProfiles - 1) / maxPGOEndpointProfiles
+		split = append(split, splitWindow(q, n)...)
+	}
+
+	var batch []SearchQuery
+	var limit int
+	for _, q := range split {
+		if len(batch) > 0 && limit+q.Limit > maxPGOEndpointProfiles {
+			batches = append(batches, batch)
+			batch, limit = nil, 0
+		}
+		batch = append(batch, q)
+		limit += q.Limit
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// StratifyQueries splits the time window of each query into the given number
+// of buckets of equal length and returns a query for each bucket. The limit of
+// each query is shared by its buckets, but each bucket contributes at least one
+// profile. Unlike the top profiles of the whole window, which might all come
+// from a single traffic spike, the top profiles of each bucket represent the
+// traffic pattern over the whole window, e.g. day and night.
+func StratifyQueries(queries []SearchQuery, buckets int) []SearchQuery {
+	if buckets <= 1 {
+		return queries
+	}
+	var stratified []SearchQuery
+	for _, q := range queries {
+		for _, sub := range splitWindow(q, buckets) {
+			sub.Limit = max(sub.Limit, 1)
+			stratified = append(stratified, sub)
+		}
+	}
+	return stratified
+}
+
+// splitWindow splits q into n queries for disjoint time subwindows of equal
+// length, which share the limit of q.
+func splitWindow(q SearchQuery, n int) []SearchQuery {
+	split := make([]SearchQuery, 0, n)
+	from, to := q.Filter.From.Time, q.Filter.To.Time
+	step := to.Sub(from) / time.Duration(n)
+	for i := 0; i < n; i++ {
+		sub := q
+		sub.Filter.From = JSONTime{from.Add(time.Duration(i) * step)}
+		if i < n-1 {
+			sub.Filter.To = JSONTime{from.Add(time.Duration(i+1) * step)}
+		}
+		sub.Limit = q.Limit / n
+		if i < q.Limit%n {
+			sub.Limit++
+		}
+		split = append(split, sub)
+	}
+	return split
+}
+
+// searchDownloadMergePGOBatches fetches the profiles matching queries using
+// one pgo endpoint request per batch returned by splitPGOQueries and merges
+// the results.
+func searchDownloadMergePGOBatches(ctx context.Context, log *slog.Logger, client *Client, queries []SearchQuery, opts MergeOptions) (*MergedProfile, error) {
+	batches := splitPGOQueries(queries)
+	if len(batches) == 1 {
+		return searchDownloadMergePGOEndpoint(ctx, log, client, batches[0], opts)
+	}
+	log.Info("splitting pgo endpoint request", "requests", len(batches))
+	groups := make([]*MergedProfile, len(batches))
+	p := pool.New().WithErrors().WithContext(ctx).WithCancelOnError().WithFirstError()
+	for i, batch := range batches {
+		i, batch := i, batch
+		p.Go(func(ctx context.Context) (err error) {
+			groups[i], err = searchDownloadMergePGOEndpoint(ctx, log, client, batch, opts)
+			return err
+		})
+	}
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+	return reduceMerged(groups, opts)
+}
@@ -0,0 +1,82 @@
+package pgo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPGOQueries(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := func(q string, limit int) SearchQuery {
+		return SearchQuery{Filter: SearchFilter{From: JSONTime{from}, To: JSONTime{from.Add(70 * time.Hour)}, Query: q}, Limit: limit}
+	}
+	limits := func(batches [][]SearchQuery) (l [][]int) {
+		for _, b := range batches {
+			var bl []int
+			for _, q := range b {
+				bl = append(bl, q.Limit)
+			}
+			l = append(l, bl)
+		}
+		return l
+	}
+
+	small := []SearchQuery{query("a", 5), query("b", 5)}
+	require.Equal(t, [][]SearchQuery{small}, splitPGOQueries(small))
+
+	require.Equal(t, [][]int{{20}, {20, 10}, {5}}, limits(splitPGOQueries([]SearchQuery{query("a", 20), query("b", 20), query("c", 10), query("d", 5)})))
+
+	batches := splitPGOQueries([]SearchQuery{query("a", 70)})
+	require.Equal(t, [][]int{{24}, {23}, {23}}, limits(batches))
+	require.Equal(t, from, batches[0][0].Filter.From.Time)
+	require.Equal(t, from.Add(70*time.Hour/3), batches[0][0].Filter.To.Time)
+	require.Equal(t, from.Add(70*time.Hour/3), batches[1][0].Filter.From.Time)
+	require.Equal(t, from.Add(70*time.Hour), batches[2][0].Filter.To.Time)
+
+	// Pinned profiles are split by their IDs, so none of them are dropped if
+	// they were collected within the same subwindow.
+	var ids []string
+	for i := 0; i < 70; i++ {
+		ids = append(ids, fmt.Sprintf("id%d", i))
+	}
+	idsQuery := WithQueryFilter([]SearchQuery{ProfileIDsQuery(time.Hour, ids)}, "-env:staging")[0]
+	batches = splitPGOQueries([]SearchQuery{idsQuery})
+	require.Equal(t, [][]int{{30}, {30}, {10}}, limits(batches))
+	var got []string
+	for _, b := range batches {
+		q := b[0]
+		require.Equal(t, idsQuery.Filter.From, q.Filter.From)
+		require.Equal(t, idsQuery.Filter.To, q.Filter.To)
+		require.Equal(t, profileIDsFilter(q.profileIDs)+" -env:staging", q.Filter.Query)
+		got = append(got, q.profileIDs...)
+	}
+	require.Equal(t, ids, got)
+}
+
+func TestStratifyQueries(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := SearchQuery{Filter: SearchFilter{From: JSONTime{from}, To: JSONTime{from.Add(72 * time.Hour)}, Query: "a"}, Limit: 8, Weight: 2}
+	require.Equal(t, []SearchQuery{q}, StratifyQueries([]SearchQuery{q}, 1))
+
+	buckets := StratifyQueries([]SearchQuery{q}, 6)
+	require.Len(t, buckets, 6)
+	for i, b := range buckets {
+		require.Equal(t, from.Add(time.Duration(i)*12*time.Hour), b.Filter.From.Time)
+		require.Equal(t, from.Add(time.Duration(i+1)*12*time.Hour), b.Filter.To.Time)
+		require.Equal(t, "a", b.Filter.Query)
+		require.Equal(t, 2.0, b.Weight)
+	}
+	var limits []int
+	for _, b := range buckets {
+		limits = append(limits, b.Limit)
+	}
+	require.Equal(t, []int{2, 2, 1, 1, 1, 1}, limits)
+
+	q.Limit = 2
+	for _, b := range StratifyQueries([]SearchQuery{q}, 6) {
+		require.Equal(t, 1, b.Limit, "each bucket contributes at least one profile")
+	}
+}
@@ -0,0 +1,102 @@
+package pgo
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// metricPrefix is the prefix of all metrics sent via DogStatsD.
+const metricPrefix = "datadog_pgo."
+
+// Statsd sends metrics to a DogStatsD server. It is implemented without
+// depending on the datadog-go client to keep the dependencies of the tool
+// small.
+type Statsd struct {
+	network string
+	addr    string
+	tags    []string
+}
+
+// StatsdFromEnv returns a Statsd sending to the address configured via the
+// DD_DOGSTATSD_URL environment variable, e.g. udp://localhost:8125 or
+// unix:///var/run/datadog/dsd.socket. It returns nil if the variable is not
+// set. The space or comma-separated tags in DD_TAGS are added to all
+// metrics.
+func StatsdFromEnv() (*Statsd, error) {
+	raw := os.Getenv("DD_DOGSTATSD_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("DD_DOGSTATSD_URL: %w", err)
+	}
+	s := &Statsd{tags: strings.FieldsFunc(os.Getenv("DD_TAGS"), func(r rune) bool {
+		return r == ' ' || r == ','
+	})}
+	switch u.Scheme {
+	case "udp":
+		s.network, s.addr = "udp", u.Host
+	case "unix":
+		s.network, s.addr = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("DD_DOGSTATSD_URL: unsupported scheme %q, must be udp or unix", u.Scheme)
+	}
+	return s, nil
+}
+
+// SendMetrics sends the request metrics of every endpoint in m, tagged with
+// the endpoint name and the given tags:
+//
+//   - datadog_pgo.requests: the number of requests (count)
+//   - datadog_pgo.request.errors: the number of failed requests (count)
+//   - datadog_pgo.request.bytes: the number of downloaded bytes (count)
+//   - datadog_pgo.request.duration: the latency of every request (timer, ms)
+func (s *Statsd) SendMetrics(m *Metrics, tags ...string) (err error) {
+	defer wrapErr(&err, "send metrics")
+	conn, err := net.Dial(s.network, s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	endpoints := m.Endpoints()
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e := endpoints[name]
+		t := append(append(append([]string{}, s.tags...), tags...), "endpoint:"+name)
+		lines := []string{
+			statsdLine("requests", fmt.Sprint(e.Requests), "c", t),
+			statsdLine("request.errors", fmt.Sprint(e.Errors), "c", t),
+			statsdLine("request.bytes", fmt.Sprint(e.Bytes), "c", t),
+		}
+		for _, d := range e.Durations {
+			lines = append(lines, statsdLine("request.duration", fmt.Sprintf("%g", float64(d.Microseconds())/1000), "ms", t))
+		}
+		// Every line is sent as its own datagram to stay below the maximum
+		// packet size.
+		for _, line := range lines {
+			if _, err := conn.Write([]byte(line)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// statsdLine returns a metric in the DogStatsD datagram format.
+func statsdLine(name, value, typ string, tags []string) string {
+	line := metricPrefix + name + ":" + value + "|" + typ
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
@@ -0,0 +1,14 @@
+package pgo
+
+// Strategies for choosing the profiles of each query.
+const (
+	// StrategyTop chooses the top profiles of the whole time window according
+	// to the sort order.
+	StrategyTop = "top"
+	// StrategyStratified chooses the top profiles of each bucket of the time
+	// window, see StratifyQueries.
+	StrategyStratified = "stratified"
+	// StrategyP90CPU chooses the profiles closest to the 90th percentile of
+	// cpu cores, see SelectOptions.CPUPercentile.
+	StrategyP90CPU = "p90-cpu"
+)
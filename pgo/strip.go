@@ -0,0 +1,49 @@
+package pgo
+
+import (
+	"io"
+
+	"github.com/google/pprof/profile"
+)
+
+// StripLines removes file names from the profile and rewrites line numbers to
+// be relative to the start of their function. The Go compiler only uses
+// function names and call site offsets (line - start line) to apply PGO, so
+// this preserves everything it needs while making the profile smaller. It
+// returns the encoded size of the profile before and after stripping.
+func (p *MergedProfile) StripLines() (before, after int64, err error) {
+	if before, err = encodedSize(p.profile); err != nil {
+		return 0, 0, err
+	}
+	stripLines(p.profile)
+	if after, err = encodedSize(p.profile); err != nil {
+		return 0, 0, err
+	}
+	return before, after, nil
+}
+
+// stripLines implements StripLines for prof.
+func stripLines(prof *profile.Profile) {
+	for _, loc := range prof.Location {
+		for i, line := range loc.Line {
+			if line.Function != nil && line.Function.StartLine > 0 {
+				loc.Line[i].Line = line.Line - line.Function.StartLine
+			}
+			loc.Line[i].Column = 0
+		}
+	}
+	for _, fn := range prof.Function {
+		fn.StartLine = 0
+		fn.Filename = ""
+	}
+	for _, m := range prof.Mapping {
+		m.File = ""
+	}
+}
+
+// encodedSize returns the number of bytes prof occupies when written.
+func encodedSize(prof *profile.Profile) (int64, error) {
+	cw := &countingWriter{W: io.Discard}
+	err := prof.Write(cw)
+	return cw.N, err
+}
@@ -0,0 +1,30 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripLines(t *testing.T) {
+	prof := loadTestProfile(t, "grpc-anon.pprof")
+	offsets := func() (offsets []int64) {
+		for _, loc := range prof.Location {
+			for _, line := range loc.Line {
+				offsets = append(offsets, line.Line-line.Function.StartLine)
+			}
+		}
+		return offsets
+	}
+	want := offsets()
+
+	mp := &MergedProfile{profile: prof}
+	before, after, err := mp.StripLines()
+	require.NoError(t, err)
+	require.Less(t, after, before)
+	require.Equal(t, want, offsets())
+	for _, fn := range prof.Function {
+		require.Empty(t, fn.Filename)
+		require.NotEmpty(t, fn.Name)
+	}
+}
@@ -0,0 +1,137 @@
+package pgo
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"debug/macho"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// BinaryFunctions returns the names of the functions of the Go binary at
+// path. They are read from the pclntab rather than the symbol table, so
+// stripped binaries work as well. ELF and Mach-O binaries are supported.
+func BinaryFunctions(path string) (funcs map[string]bool, err error) {
+	defer wrapErr(&err, "binary functions")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pclntab []byte
+	var textStart uint64
+	if ef, err := elf.NewFile(f); err == nil {
+		sec, text := ef.Section(".gopclntab"), ef.Section(".text")
+		if sec == nil || text == nil {
+			return nil, errors.New("no .gopclntab section, is it a Go binary?")
+		} else if pclntab, err = sec.Data(); err != nil {
+			return nil, err
+		}
+		textStart = text.Addr
+	} else if mf, err := macho.NewFile(f); err == nil {
+		sec, text := mf.Section("__gopclntab"), mf.Section("__text")
+		if sec == nil || text == nil {
+			return nil, errors.New("no __gopclntab section, is it a Go binary?")
+		} else if pclntab, err = sec.Data(); err != nil {
+			return nil, err
+		}
+		textStart = text.Addr
+	} else {
+		return nil, errors.New("unsupported binary format, only ELF and Mach-O are supported")
+	}
+
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(pclntab, textStart))
+	if err != nil {
+		return nil, err
+	}
+	funcs = make(map[string]bool, len(table.Funcs))
+	for _, fn := range table.Funcs {
+		funcs[fn.Name] = true
+	}
+	return funcs, nil
+}
+
+// SymbolMatch reports how many of the hot functions of a profile exist in a
+// binary, see MatchSymbols.
+type SymbolMatch struct {
+	// Functions is the number of hot functions that were checked.
+	Functions int
+	// Found is the number of hot functions that exist in the binary.
+	Found int
+	// CPU is the flat cpu time of the checked functions.
+	CPU time.Duration
+	// FoundPercent is the percentage of CPU spent in functions that exist
+	// in the binary.
+	FoundPercent float64
+	// Missing are the hot functions that don't exist in the binary, hottest
+	// first.
+	Missing []FunctionShare
+}
+
+// MatchSymbols checks which of the top hottest functions of the cpu profile
+// prof exist in funcs, e.g. the functions of the binary the profile is meant
+// for, see BinaryFunctions. A low match indicates that the profile belongs to
+// a different service or predates a large refactoring. The hotness of a
+// function is the flat cpu time of the function that contains the sampled
+// instruction, inlined functions are attributed to the function they were
+// inlined into, as they don't exist in the binary on their own.
+func MatchSymbols(prof *profile.Profile, funcs map[string]bool, top int) (match SymbolMatch, err error) {
+	defer wrapErr(&err, "match symbols")
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return match, err
+	}
+	flat := map[string]int64{}
+	var total int64
+	for _, s := range prof.Sample {
+		if len(s.Location) == 0 || len(s.Location[0].Line) == 0 {
+			continue
+		}
+		lines := s.Location[0].Line
+		if fn := lines[len(lines)-1].Function; fn != nil {
+			flat[fn.Name] += s.Value[cpuIdx]
+			total += s.Value[cpuIdx]
+		}
+	}
+
+	hot := make([]FunctionShare, 0, len(flat))
+	for fn, v := range flat {
+		share := FunctionShare{Function: fn, CPU: time.Duration(v)}
+		if total > 0 {
+			share.Percent = percent(v, total)
+		}
+		hot = append(hot, share)
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].CPU != hot[j].CPU {
+			return hot[i].CPU > hot[j].CPU
+		}
+		return hot[i].Function < hot[j].Function
+	})
+	if top > 0 && len(hot) > top {
+		hot = hot[:top]
+	}
+
+	var found time.Duration
+	for _, fn := range hot {
+		match.Functions++
+		match.CPU += fn.CPU
+		if funcs[fn.Function] {
+			match.Found++
+			found += fn.CPU
+		} else {
+			match.Missing = append(match.Missing, fn)
+		}
+	}
+	if match.Functions == 0 {
+		return match, errors.New("profile has no samples")
+	} else if match.CPU > 0 {
+		match.FoundPercent = percent(int64(found), int64(match.CPU))
+	}
+	return match, nil
+}
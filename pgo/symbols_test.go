@@ -0,0 +1,47 @@
+package pgo
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryFunctions(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("only ELF and Mach-O binaries are supported")
+	}
+	funcs, err := BinaryFunctions(os.Args[0])
+	require.NoError(t, err)
+	require.True(t, funcs["github.com/DataDog/datadog-pgo/pgo.BinaryFunctions"])
+	require.True(t, funcs["runtime.main"])
+
+	notBinary := filepath.Join(t.TempDir(), "default.pgo")
+	require.NoError(t, os.WriteFile(notBinary, []byte("not a binary"), 0644))
+	_, err = BinaryFunctions(notBinary)
+	require.ErrorContains(t, err, "unsupported binary format")
+}
+
+func TestMatchSymbols(t *testing.T) {
+	prof := newTestProfile(t, map[string]int64{
+		"main;foo": 6e7,
+		"main;bar": 3e7,
+		"main;baz": 1e7,
+	})
+	match, err := MatchSymbols(prof, map[string]bool{"main": true, "foo": true, "baz": true}, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, match.Functions)
+	require.Equal(t, 1, match.Found)
+	require.Equal(t, 90*time.Millisecond, match.CPU)
+	require.InDelta(t, 66.67, match.FoundPercent, 0.01)
+	require.Len(t, match.Missing, 1)
+	require.Equal(t, "bar", match.Missing[0].Function)
+
+	match, err = MatchSymbols(prof, map[string]bool{"foo": true, "bar": true, "baz": true}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, match.Found)
+	require.Equal(t, float64(100), match.FoundPercent)
+}
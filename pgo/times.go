@@ -0,0 +1,44 @@
+package pgo
+
+import (
+	"fmt"
+	"time"
+)
+
+// Modes for setting the time fields of the merged profile.
+const (
+	// TimeModeMerge keeps the time fields as computed by profile.Merge.
+	TimeModeMerge = "merge"
+	// TimeModeSum sets TimeNanos to the run time and DurationNanos to the sum
+	// of the input durations.
+	TimeModeSum = "sum"
+	// TimeModeMax sets TimeNanos to the run time and DurationNanos to the
+	// maximum of the input durations.
+	TimeModeMax = "max"
+)
+
+// SetTimes sets the TimeNanos and DurationNanos fields of the merged profile
+// according to mode. See the timeMode constants for the supported modes.
+func (p *MergedProfile) SetTimes(mode string, runTime time.Time) error {
+	switch mode {
+	case TimeModeMerge:
+		return nil
+	case TimeModeSum:
+		p.profile.DurationNanos = p.durationSum
+	case TimeModeMax:
+		p.profile.DurationNanos = p.durationMax
+	default:
+		return fmt.Errorf("unknown time mode %q", mode)
+	}
+	p.profile.TimeNanos = runTime.UnixNano()
+	return nil
+}
+
+// addDuration records the duration of a merged input profile. Callers must
+// hold p.mu.
+func (p *MergedProfile) addDuration(d int64) {
+	p.durationSum += d
+	if d > p.durationMax {
+		p.durationMax = d
+	}
+}
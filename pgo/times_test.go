@@ -0,0 +1,41 @@
+package pgo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTimes(t *testing.T) {
+	runTime := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	merge := func() *MergedProfile {
+		mp := NewMergedProfile(MergeOptions{})
+		for i, d := range []time.Duration{time.Minute, 3 * time.Minute, 2 * time.Minute} {
+			prof := newTestProfile(t, map[string]int64{"main;foo": 1e7})
+			prof.DurationNanos = int64(d)
+			prof.TimeNanos += int64(i) * int64(time.Hour)
+			require.NoError(t, mp.Merge(fmt.Sprint(i), prof))
+		}
+		require.NoError(t, mp.Finish())
+		return mp
+	}
+
+	mp := merge()
+	wantTime := mp.profile.TimeNanos
+	require.NoError(t, mp.SetTimes(TimeModeMerge, runTime))
+	require.Equal(t, wantTime, mp.profile.TimeNanos)
+
+	mp = merge()
+	require.NoError(t, mp.SetTimes(TimeModeSum, runTime))
+	require.Equal(t, runTime.UnixNano(), mp.profile.TimeNanos)
+	require.Equal(t, int64(6*time.Minute), mp.profile.DurationNanos)
+
+	mp = merge()
+	require.NoError(t, mp.SetTimes(TimeModeMax, runTime))
+	require.Equal(t, runTime.UnixNano(), mp.profile.TimeNanos)
+	require.Equal(t, int64(3*time.Minute), mp.profile.DurationNanos)
+
+	require.Error(t, merge().SetTimes("avg", runTime))
+}
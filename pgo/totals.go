@@ -0,0 +1,32 @@
+package pgo
+
+import (
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Totals returns the total number of cpu samples and the total cpu time of
+// the merged profile. The number of samples is zero if the profile has no
+// samples/count sample type.
+func (p *MergedProfile) Totals() (samples int64, cpu time.Duration, err error) {
+	return profileTotals(p.profile)
+}
+
+// profileTotals implements Totals for prof.
+func profileTotals(prof *profile.Profile) (samples int64, cpu time.Duration, err error) {
+	cpuNanos, err := totalCPUNanos(prof)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, st := range prof.SampleType {
+		if st.Type != "samples" {
+			continue
+		}
+		for _, s := range prof.Sample {
+			samples += s.Value[i]
+		}
+		break
+	}
+	return samples, time.Duration(cpuNanos), nil
+}
@@ -0,0 +1,16 @@
+package pgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTotals(t *testing.T) {
+	mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{"main;foo": 3e7, "main;bar": 1e8})}
+	samples, cpu, err := mp.Totals()
+	require.NoError(t, err)
+	require.Equal(t, int64(13), samples)
+	require.Equal(t, 130*time.Millisecond, cpu)
+}
@@ -0,0 +1,36 @@
+package pgo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// NewHTTPClient returns an HTTP client that trusts the PEM encoded
+// certificates in caFile in addition to the system certificates, unless caFile
+// is empty. If insecure is true, server certificates are not verified at all.
+// Like http.DefaultClient, it uses the proxy set via the HTTPS_PROXY, HTTP_PROXY
+// and NO_PROXY env vars.
+func NewHTTPClient(caFile string, insecure bool) (client *http.Client, err error) {
+	defer wrapErr(&err, "http client")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM encoded certificates found", caFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	return &http.Client{Transport: transport}, nil
+}
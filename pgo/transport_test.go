@@ -0,0 +1,38 @@
+package pgo
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	get := func(caFile string, insecure bool) error {
+		hc, err := NewHTTPClient(caFile, insecure)
+		require.NoError(t, err)
+		res, err := hc.Get(srv.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+	require.ErrorContains(t, get("", false), "certificate")
+	require.NoError(t, get("", true))
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, certPEM, 0644))
+	require.NoError(t, get(caFile, false))
+
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0644))
+	_, err := NewHTTPClient(caFile, false)
+	require.ErrorContains(t, err, "no PEM encoded certificates")
+}
@@ -0,0 +1,158 @@
+package pgo
+
+import (
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// TrimStats holds statistics about data removed from the profiles before they
+// were merged.
+type TrimStats struct {
+	// Frames is the number of stack frames removed from samples.
+	Frames int
+	// Locations is the number of locations removed from profiles.
+	Locations int
+	// Samples is the number of samples removed by PreAggregateTopK, see
+	// MergeOptions.
+	Samples int
+	// Bytes is the number of bytes saved in the encoded input profiles.
+	Bytes int64
+}
+
+// trimProfile applies the trimming configured in opts to prof and returns
+// statistics about the removed data.
+func trimProfile(prof *profile.Profile, opts MergeOptions) (stats TrimStats, err error) {
+	if opts.MaxLocationDepth <= 0 && opts.PreAggregateTopK <= 0 {
+		return stats, nil
+	}
+	before, err := encodedSize(prof)
+	if err != nil {
+		return stats, err
+	}
+	if opts.MaxLocationDepth > 0 {
+		stats.Frames = truncateStacks(prof, opts.MaxLocationDepth)
+	}
+	if opts.PreAggregateTopK > 0 {
+		if stats.Samples, err = keepTopLeaves(prof, opts.PreAggregateTopK); err != nil {
+			return stats, err
+		}
+	}
+	stats.Locations = removeUnreferenced(prof)
+	after, err := encodedSize(prof)
+	if err != nil {
+		return stats, err
+	}
+	stats.Bytes = before - after
+	return stats, nil
+}
+
+// truncateStacks truncates the stack of every sample to its depth frames
+// closest to the leaf. It returns the number of removed frames.
+func truncateStacks(prof *profile.Profile, depth int) (removed int) {
+	for _, s := range prof.Sample {
+		if len(s.Location) > depth {
+			removed += len(s.Location) - depth
+			s.Location = s.Location[:depth]
+		}
+	}
+	return removed
+}
+
+// keepTopLeaves removes the samples of the cpu profile prof whose leaf
+// function isn't one of the k functions with the most flat cpu time. Functions
+// tied with the k-th function are kept as well. It returns the number of
+// removed samples.
+//
+// The compiler weighs call edges by the cpu time of the samples they are the
+// leaf call of, so samples of cold leaf functions barely contribute to the
+// hot call edges of the merged profile. A function that is cold in every
+// profile can still become hot when the profiles are merged, so k should be
+// generous.
+func keepTopLeaves(prof *profile.Profile, k int) (removed int, err error) {
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return 0, err
+	}
+	flat := map[string]int64{}
+	for _, s := range prof.Sample {
+		if leaf, ok := leafLine(s); ok && leaf.Function != nil {
+			flat[leaf.Function.Name] += s.Value[cpuIdx]
+		}
+	}
+	if len(flat) <= k {
+		return 0, nil
+	}
+	weights := make([]int64, 0, len(flat))
+	for _, v := range flat {
+		weights = append(weights, v)
+	}
+	sort.Slice(weights, func(i, j int) bool { return weights[i] > weights[j] })
+	threshold := weights[k-1]
+
+	samples := prof.Sample[:0]
+	for _, s := range prof.Sample {
+		if leaf, ok := leafLine(s); ok && leaf.Function != nil && flat[leaf.Function.Name] < threshold {
+			removed++
+			continue
+		}
+		samples = append(samples, s)
+	}
+	prof.Sample = samples
+	return removed, nil
+}
+
+// removeUnreferenced removes locations, functions and mappings that are no
+// longer referenced by any sample. It returns the number of removed
+// locations.
+func removeUnreferenced(prof *profile.Profile) (removed int) {
+	usedLocations := map[*profile.Location]bool{}
+	for _, s := range prof.Sample {
+		for _, loc := range s.Location {
+			usedLocations[loc] = true
+		}
+	}
+
+	usedFunctions := map[*profile.Function]bool{}
+	usedMappings := map[*profile.Mapping]bool{}
+	locations := prof.Location[:0]
+	for _, loc := range prof.Location {
+		if !usedLocations[loc] {
+			removed++
+			continue
+		}
+		locations = append(locations, loc)
+		if loc.Mapping != nil {
+			usedMappings[loc.Mapping] = true
+		}
+		for _, line := range loc.Line {
+			usedFunctions[line.Function] = true
+		}
+	}
+	prof.Location = locations
+
+	functions := prof.Function[:0]
+	for _, fn := range prof.Function {
+		if usedFunctions[fn] {
+			functions = append(functions, fn)
+		}
+	}
+	prof.Function = functions
+
+	mappings := prof.Mapping[:0]
+	for _, m := range prof.Mapping {
+		if usedMappings[m] {
+			mappings = append(mappings, m)
+		}
+	}
+	prof.Mapping = mappings
+	return removed
+}
+
+// add adds the statistics of o to s.
+func (s *TrimStats) add(o TrimStats) {
+	s.Frames += o.Frames
+	s.Locations += o.Locations
+	s.Samples += o.Samples
+	s.Bytes += o.Bytes
+}
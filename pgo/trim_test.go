@@ -0,0 +1,55 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrimProfileMaxLocationDepth(t *testing.T) {
+	prof := newTestProfile(t, map[string]int64{
+		"main;a;b;c;d": 1e7,
+		"main;a;e":     2e7,
+		"main;f":       3e7,
+	})
+	stats, err := trimProfile(prof, MergeOptions{MaxLocationDepth: 2})
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+	require.Equal(t, 4, stats.Frames)
+	require.Equal(t, 1, stats.Locations) // b
+	require.Greater(t, stats.Bytes, int64(0))
+	require.Equal(t, map[string][]int64{
+		"c;d":    {1, 1e7},
+		"a;e":    {2, 2e7},
+		"main;f": {3, 3e7},
+	}, stackValues(prof))
+	require.Len(t, prof.Function, 6)
+}
+
+func TestTrimProfilePreAggregateTopK(t *testing.T) {
+	stacks := map[string]int64{
+		"main;a;x": 1e7,
+		"main;b;x": 1e7,
+		"main;y":   3e7,
+		"main;z":   1e7,
+		"main;w":   1e7,
+	}
+	prof := newTestProfile(t, stacks)
+	stats, err := trimProfile(prof, MergeOptions{PreAggregateTopK: 2})
+	require.NoError(t, err)
+	require.NoError(t, prof.CheckValid())
+	require.Equal(t, 2, stats.Samples)
+	require.Equal(t, 2, stats.Locations) // z and w
+	require.Equal(t, map[string][]int64{
+		"main;a;x": {1, 1e7},
+		"main;b;x": {1, 1e7},
+		"main;y":   {3, 3e7},
+	}, stackValues(prof))
+
+	// Functions tied with the k-th function are kept
+	prof = newTestProfile(t, stacks)
+	stats, err = trimProfile(prof, MergeOptions{PreAggregateTopK: 3})
+	require.NoError(t, err)
+	require.Zero(t, stats.Samples)
+	require.Len(t, prof.Sample, 5)
+}
@@ -0,0 +1,31 @@
+package pgo
+
+import (
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// DefaultUpdateShare is the default share of the cpu time of a profile updated
+// with MergePrevious that comes from the previous profile.
+const DefaultUpdateShare = 0.3
+
+// ReadProfile reads the pprof file at path, e.g. a previously written DEST.
+func ReadProfile(path string) (prof *profile.Profile, err error) {
+	defer wrapErr(&err, "read profile")
+	return readProfile(path)
+}
+
+// MergePrevious merges the previously written profile prev into the merged
+// profile, scaling prev so that it accounts for share of the cpu time of the
+// result. This smooths the drift between consecutive profiles. share must be in
+// the range [0, 1).
+func (p *MergedProfile) MergePrevious(prev *profile.Profile, share float64) (err error) {
+	defer wrapErr(&err, "merge previous profile")
+	if share < 0 || share >= 1 {
+		return fmt.Errorf("share must be in the range [0, 1): %v", share)
+	} else if share == 0 {
+		return nil
+	}
+	return p.mergeScaled(prev, share/(1-share))
+}
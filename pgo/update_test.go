@@ -0,0 +1,35 @@
+package pgo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePrevious(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "default.pgo")
+	prev := &MergedProfile{profile: newTestProfile(t, map[string]int64{"main;foo": 3e7})}
+	_, err := prev.Write(path, 0)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		share float64
+		want  map[string][]int64
+	}{
+		{0, map[string][]int64{"main;foo": {1, 1e7}, "main;bar": {1, 1e7}}},
+		{0.5, map[string][]int64{"main;foo": {3, 3e7}, "main;bar": {1, 1e7}}},
+	} {
+		prof, err := ReadProfile(path)
+		require.NoError(t, err)
+		mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{"main;foo": 1e7, "main;bar": 1e7})}
+		require.NoError(t, mp.MergePrevious(prof, tc.share))
+		require.Equal(t, tc.want, stackValues(mp.profile), "share %v", tc.share)
+	}
+
+	mp := &MergedProfile{profile: newTestProfile(t, map[string]int64{"main;foo": 1e7})}
+	require.ErrorContains(t, mp.MergePrevious(prev.profile, 1), "range")
+
+	_, err = ReadProfile(filepath.Join(t.TempDir(), "missing.pgo"))
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package pgo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// validateProfile checks that prof looks like a sane profile of the given type.
+// Truncated or corrupted downloads can sometimes be parsed successfully, but
+// yield profiles that would poison the merged profile with garbage weights.
+func validateProfile(prof *profile.Profile, typ string) error {
+	if typ != ProfileTypeCPU {
+		return validateOtherProfile(prof)
+	}
+	if prof.DurationNanos <= 0 {
+		return fmt.Errorf("invalid duration: %dns", prof.DurationNanos)
+	} else if len(prof.Sample) == 0 {
+		return errors.New("no samples")
+	}
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return err
+	}
+	for _, s := range prof.Sample {
+		if len(s.Value) <= cpuIdx {
+			return errors.New("invalid sample value")
+		} else if s.Value[cpuIdx] < 0 {
+			return fmt.Errorf("negative cpu sample value: %d", s.Value[cpuIdx])
+		}
+	}
+	return validateStructure(prof)
+}
+
+// validateOtherProfile checks that prof, which is not a cpu profile, has
+// samples with a value for each sample type.
+func validateOtherProfile(prof *profile.Profile) error {
+	if len(prof.Sample) == 0 {
+		return errors.New("no samples")
+	}
+	return validateStructure(prof)
+}
+
+// validateStructure checks the parts of prof that are independent of its
+// type: every sample has a non-negative value for each sample type, every
+// mapping covers a valid address range, and all references between samples,
+// locations, mappings and functions are consistent.
+func validateStructure(prof *profile.Profile) error {
+	for _, s := range prof.Sample {
+		if len(s.Value) != len(prof.SampleType) {
+			return errors.New("invalid sample value")
+		}
+		for i, v := range s.Value {
+			if v < 0 {
+				return fmt.Errorf("negative %s sample value: %d", prof.SampleType[i].Type, v)
+			}
+		}
+	}
+	for _, m := range prof.Mapping {
+		if m.Limit < m.Start {
+			return fmt.Errorf("invalid mapping %d: limit %#x is below start %#x", m.ID, m.Limit, m.Start)
+		}
+	}
+	return prof.CheckValid()
+}
@@ -0,0 +1,75 @@
+package pgo
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateProfile(t *testing.T) {
+	valid := func() *profile.Profile {
+		return newTestProfile(t, map[string]int64{"main;foo": 1e7})
+	}
+	require.NoError(t, validateProfile(valid(), ProfileTypeCPU))
+	require.NoError(t, validateProfile(loadTestProfile(t, "grpc-anon.pprof"), ProfileTypeCPU))
+
+	prof := valid()
+	prof.DurationNanos = -1
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeCPU), "invalid duration")
+
+	prof = valid()
+	prof.Sample = nil
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeCPU), "no samples")
+
+	prof = valid()
+	prof.SampleType[1].Type = "alloc_space"
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeCPU), "no cpu sample type")
+
+	prof = valid()
+	prof.Sample[0].Value = prof.Sample[0].Value[:1]
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeCPU), "invalid sample value")
+
+	prof = valid()
+	prof.Sample[0].Value[1] = -5
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeCPU), "negative cpu sample value")
+
+	prof = valid()
+	prof.Sample[0].Value[0] = -1
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeCPU), "negative samples sample value")
+
+	prof = valid()
+	prof.Mapping = []*profile.Mapping{{ID: 1, Start: 0x2000, Limit: 0x1000}}
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeCPU), "invalid mapping 1")
+
+	prof = valid()
+	prof.Location[0].Line[0].Function = &profile.Function{ID: 999}
+	require.Error(t, validateProfile(prof, ProfileTypeCPU), "dangling function references are rejected")
+
+	// Other profile types don't need a cpu sample type or duration
+	prof = valid()
+	prof.SampleType[1].Type = "alloc_space"
+	prof.DurationNanos = 0
+	require.NoError(t, validateProfile(prof, ProfileTypeHeap))
+	prof.Sample[0].Value = prof.Sample[0].Value[:1]
+	require.ErrorContains(t, validateProfile(prof, ProfileTypeHeap), "invalid sample value")
+}
+
+func TestMergeStrict(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestProfile(t, map[string]int64{"main;foo": 1e7}).Write(&buf))
+	data := newTestZip(t, map[string][]byte{"good.pprof": buf.Bytes(), "corrupt.pprof": []byte("garbage")})
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	d := &ProfilesDownload{data: data, limits: DefaultZipLimits}
+	mp, err := d.MergedProfile(log, MergeOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"good.pprof"}, mp.ProfileIDs())
+	require.Equal(t, 1, mp.skipped)
+
+	_, err = d.MergedProfile(log, MergeOptions{Strict: true})
+	require.ErrorContains(t, err, "invalid profile corrupt.pprof")
+}
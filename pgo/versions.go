@@ -0,0 +1,66 @@
+package pgo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+// WithQueryFilter returns copies of queries with filter added to each query,
+// e.g. "version:v1.42.0".
+func WithQueryFilter(queries []SearchQuery, filter string) []SearchQuery {
+	filtered := make([]SearchQuery, len(queries))
+	for i, q := range queries {
+		q.Filter.Query = strings.TrimSpace(q.Filter.Query + " " + filter)
+		filtered[i] = q
+	}
+	return filtered
+}
+
+// RecentVersions returns up to n distinct versions of the profiles matching
+// query, most recent first. The limit and sort of query are ignored. Profiles
+// without a version are ignored.
+func RecentVersions(ctx context.Context, source ProfileSource, query SearchQuery, n int) (versions []string, err error) {
+	defer wrapErr(&err, "recent versions")
+	query.Limit = discoverLimit
+	query.Sort = SearchSort{Order: "desc", Field: sortFields["timestamp"]}
+	profiles, err := source.SearchProfiles(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, p := range profiles {
+		if p.Version != "" && !seen[p.Version] && len(versions) < n {
+			seen[p.Version] = true
+			versions = append(versions, p.Version)
+		}
+	}
+	return versions, nil
+}
+
+// RestrictToRecentVersions returns copies of queries that only match the
+// profiles of the n most recent versions of each query, see RecentVersions.
+// Queries without any versioned profiles are returned unchanged.
+func RestrictToRecentVersions(ctx context.Context, log *slog.Logger, source ProfileSource, queries []SearchQuery, n int) ([]SearchQuery, error) {
+	filters := map[string]string{}
+	restricted := make([]SearchQuery, len(queries))
+	for i, q := range queries {
+		// Queries searched with multiple sort fields share the same versions.
+		filter, ok := filters[q.Filter.Query]
+		if !ok {
+			versions, err := RecentVersions(ctx, source, q, n)
+			if err != nil && !errors.Is(err, ErrNoProfiles) {
+				return nil, err
+			} else if len(versions) == 0 {
+				log.Warn("no versioned profiles found, not restricting query to recent versions", "query", q.Filter.Query)
+			} else {
+				log.Info("restricting query to recent versions", "query", q.Filter.Query, "versions", versions)
+				filter = "version:(" + strings.Join(versions, " OR ") + ")"
+			}
+			filters[q.Filter.Query] = filter
+		}
+		restricted[i] = WithQueryFilter([]SearchQuery{q}, filter)[0]
+	}
+	return restricted, nil
+}
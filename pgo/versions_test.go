@@ -0,0 +1,61 @@
+package pgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestrictToRecentVersions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var q SearchQuery
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&q))
+		require.Equal(t, "timestamp", q.Sort.Field)
+		switch q.Filter.Query {
+		case "service:foo runtime:go":
+			fmt.Fprint(w, `{"data": [
+				{"attributes": {"version": "v3"}},
+				{"attributes": {"version": "v3"}},
+				{"attributes": {"tags": ["version:v2"]}},
+				{"attributes": {}},
+				{"attributes": {"version": "v1"}}
+			]}`)
+		case "service:bar runtime:go":
+			fmt.Fprint(w, `{"data": [{"attributes": {}}]}`)
+		default:
+			fmt.Fprint(w, `{"data": []}`)
+		}
+	}))
+	defer srv.Close()
+
+	client := &Client{concurrency: make(chan struct{}, 1), ZipLimits: DefaultZipLimits, baseURL: srv.URL}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queries, err := BuildQueries(time.Hour, 5, []string{DefaultSortField, "timestamp"}, []string{"service:foo", "service:bar", "service:baz"})
+	require.NoError(t, err)
+	restricted, err := RestrictToRecentVersions(context.Background(), log, client, queries, 2)
+	require.NoError(t, err)
+	var got []string
+	for _, q := range restricted {
+		got = append(got, q.Filter.Query)
+	}
+	require.Equal(t, []string{
+		"service:foo runtime:go version:(v3 OR v2)",
+		"service:foo runtime:go version:(v3 OR v2)",
+		"service:bar runtime:go",
+		"service:bar runtime:go",
+		"service:baz runtime:go",
+		"service:baz runtime:go",
+	}, got)
+	require.Equal(t, 5, restricted[0].Limit)
+	require.Equal(t, "timestamp", restricted[1].Sort.Field)
+
+	require.Equal(t, "service:foo runtime:go version:v1", WithQueryFilter(queries[:1], "version:v1")[0].Filter.Query)
+}
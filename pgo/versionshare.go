@@ -0,0 +1,64 @@
+package pgo
+
+import (
+	"cmp"
+	"slices"
+)
+
+// VersionShare is the share of the cpu time of a MergedProfile that comes from
+// the profiles of a single version.
+type VersionShare struct {
+	// Version is the version tag, it's empty for profiles without one.
+	Version string
+	// Profiles is the number of merged profiles of the version.
+	Profiles int
+	// Share is the fraction of the cpu time of all merged profiles.
+	Share float64
+}
+
+// VersionShares returns the share of the cpu time of each version of the
+// merged profiles, largest first. The cpu time of a profile is its average
+// cpu cores times its duration. The versions are only known if the profiles
+// were found with the search endpoint, see MergeOptions.TrackVersions.
+func (p *MergedProfile) VersionShares() []VersionShare {
+	var total float64
+	byVersion := map[string]*VersionShare{}
+	for _, info := range p.profileInfos {
+		share := byVersion[info.Version]
+		if share == nil {
+			share = &VersionShare{Version: info.Version}
+			byVersion[info.Version] = share
+		}
+		cpu := info.CPUCores * info.Duration
+		share.Profiles++
+		share.Share += cpu
+		total += cpu
+	}
+	shares := make([]VersionShare, 0, len(byVersion))
+	for _, share := range byVersion {
+		if total > 0 {
+			share.Share /= total
+		}
+		shares = append(shares, *share)
+	}
+	slices.SortFunc(shares, func(a, b VersionShare) int {
+		if c := cmp.Compare(b.Share, a.Share); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return shares
+}
+
+// CurrentVersion returns the version of the newest merged profile with a
+// version, which is assumed to be the currently deployed version. It returns
+// an empty string if no version is known.
+func (p *MergedProfile) CurrentVersion() string {
+	var current ProfileInfo
+	for _, info := range p.profileInfos {
+		if info.Version != "" && (current.Version == "" || info.Time.After(current.Time)) {
+			current = info
+		}
+	}
+	return current.Version
+}
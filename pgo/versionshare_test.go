@@ -0,0 +1,27 @@
+package pgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionShares(t *testing.T) {
+	now := time.Now()
+	p := &MergedProfile{profileInfos: []ProfileInfo{
+		{ID: "a", Time: now.Add(-3 * time.Hour), CPUCores: 2, Duration: 60, Version: "v1"},
+		{ID: "b", Time: now.Add(-2 * time.Hour), CPUCores: 4, Duration: 60, Version: "v1"},
+		{ID: "c", Time: now.Add(-time.Hour), CPUCores: 2, Duration: 60, Version: "v2"},
+		{ID: "d", Time: now, CPUCores: 2, Duration: 60},
+	}}
+	require.Equal(t, []VersionShare{
+		{Version: "v1", Profiles: 2, Share: 0.6},
+		{Version: "", Profiles: 1, Share: 0.2},
+		{Version: "v2", Profiles: 1, Share: 0.2},
+	}, p.VersionShares())
+	require.Equal(t, "v2", p.CurrentVersion())
+
+	require.Empty(t, (&MergedProfile{}).VersionShares())
+	require.Empty(t, (&MergedProfile{}).CurrentVersion())
+}
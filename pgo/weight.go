@@ -0,0 +1,159 @@
+package pgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// weightSuffix separates a query from its weight, e.g. "service:foo@weight=0.7".
+const weightSuffix = "@weight="
+
+// WeightedQuery returns query with a suffix giving it the weight w, e.g.
+// "service:foo@weight=0.7".
+func WeightedQuery(query string, w float64) string {
+	return query + weightSuffix + strconv.FormatFloat(w, 'g', -1, 64)
+}
+
+// parseQueryWeight splits an optional weight suffix off query q.
+func parseQueryWeight(q string) (string, float64, error) {
+	idx := strings.LastIndex(q, weightSuffix)
+	if idx == -1 {
+		return q, 0, nil
+	}
+	weight, err := strconv.ParseFloat(q[idx+len(weightSuffix):], 64)
+	if err != nil || weight <= 0 {
+		return "", 0, fmt.Errorf("invalid weight in query %q: must be a positive number", q)
+	}
+	return q[:idx], weight, nil
+}
+
+// hasQueryWeights returns true if any of the queries has a weight.
+func hasQueryWeights(queries []SearchQuery) bool {
+	for _, q := range queries {
+		if q.Weight != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// searchDownloadMergeWeighted merges the profiles of each query separately,
+// scales each query's merged profile according to its weight and then merges
+// the results. The queries are searched, downloaded and merged concurrently,
+// sharing the MaxInFlight and ParseWorkers limits of opts.
+//
+// Weights are normalized: a query with weight w contributes w/W of the total
+// cpu time of the final profile, where W is the sum of the weights of all
+// queries that matched any profiles. Queries without weight have a weight of
+// 1. The total cpu time of the final profile equals the sum of the inputs.
+func searchDownloadMergeWeighted(ctx context.Context, log *slog.Logger, source ProfileSource, queries []SearchQuery, sel SelectOptions, opts MergeOptions) (*MergedProfile, error) {
+	var (
+		groups  [][]SearchQuery
+		weights []float64
+	)
+	for len(queries) > 0 {
+		// Queries searched with multiple sort fields are adjacent and are
+		// merged as a single group.
+		n := 1
+		for n < len(queries) && queries[n].Filter.Query == queries[0].Filter.Query {
+			n++
+		}
+		group := make([]SearchQuery, n)
+		copy(group, queries[:n])
+		queries = queries[n:]
+
+		weight := group[0].Weight
+		if weight == 0 {
+			weight = 1
+		}
+		for i := range group {
+			group[i].Weight = 0
+		}
+		groups = append(groups, group)
+		weights = append(weights, weight)
+	}
+
+	opts.limits = opts.mergeLimits()
+	merged := make([]*MergedProfile, len(groups))
+	groupPool := pool.New().WithErrors().WithContext(ctx).WithCancelOnError().WithFirstError()
+	for i, group := range groups {
+		i, group := i, group
+		groupPool.Go(func(ctx context.Context) error {
+			mp, err := SearchDownloadMerge(ctx, log, source, group, sel, opts)
+			if errors.Is(err, ErrNoProfiles) {
+				log.Warn("no profiles found", "query", group[0].Filter.Query)
+				return nil
+			} else if err != nil {
+				return err
+			}
+			merged[i] = mp
+			return nil
+		})
+	}
+	if err := groupPool.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Queries without profiles don't contribute to the weights.
+	var found []*MergedProfile
+	var foundWeights []float64
+	for i, mp := range merged {
+		if mp != nil {
+			found = append(found, mp)
+			foundWeights = append(foundWeights, weights[i])
+		}
+	}
+	return mergeWeighted(log, found, foundWeights, opts)
+}
+
+// mergeWeighted merges groups after scaling each of them according to the
+// given weights. See searchDownloadMergeWeighted for how weights are
+// normalized.
+func mergeWeighted(log *slog.Logger, groups []*MergedProfile, weights []float64, opts MergeOptions) (*MergedProfile, error) {
+	var totalWeight, totalCPU float64
+	cpuTotals := make([]float64, len(groups))
+	for i, g := range groups {
+		cpu, err := totalCPUNanos(g.profile)
+		if err != nil {
+			return nil, err
+		}
+		cpuTotals[i] = cpu
+		totalCPU += cpu
+		totalWeight += weights[i]
+	}
+
+	for i, g := range groups {
+		if cpuTotals[i] > 0 {
+			ratio := weights[i] / totalWeight * totalCPU / cpuTotals[i]
+			g.profile.Scale(ratio)
+			for _, values := range g.maxValues {
+				for j, v := range values {
+					values[j] = int64(math.Round(float64(v) * ratio))
+				}
+			}
+			log.Debug("scaled query profile", "weight", weights[i]/totalWeight, "ratio", ratio)
+		}
+	}
+	return reduceMerged(groups, opts)
+}
+
+// totalCPUNanos returns the sum of the cpu sample values of prof.
+func totalCPUNanos(prof *profile.Profile) (float64, error) {
+	cpuIdx, err := cpuSampleIndex(prof)
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, s := range prof.Sample {
+		total += float64(s.Value[cpuIdx])
+	}
+	return total, nil
+}
@@ -0,0 +1,95 @@
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueryWeight(t *testing.T) {
+	q, w, err := parseQueryWeight("service:foo env:prod")
+	require.NoError(t, err)
+	require.Equal(t, "service:foo env:prod", q)
+	require.Equal(t, 0.0, w)
+
+	q, w, err = parseQueryWeight("service:foo@weight=0.7")
+	require.NoError(t, err)
+	require.Equal(t, "service:foo", q)
+	require.Equal(t, 0.7, w)
+
+	_, _, err = parseQueryWeight("service:foo@weight=-1")
+	require.Error(t, err)
+	_, _, err = parseQueryWeight("service:foo@weight=abc")
+	require.Error(t, err)
+}
+
+func TestMergeWeighted(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reader := &MergedProfile{
+		profile:    newTestProfile(t, map[string]int64{"main;read": 9e9}),
+		profileIDs: []string{"r1", "r2"},
+	}
+	writer := &MergedProfile{
+		profile:    newTestProfile(t, map[string]int64{"main;write": 1e9}),
+		profileIDs: []string{"w1"},
+	}
+	mp, err := mergeWeighted(log, []*MergedProfile{reader, writer}, []float64{0.7, 0.3}, MergeOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"r1", "r2", "w1"}, mp.profileIDs)
+
+	values := stackValues(mp.profile)
+	require.InDelta(t, 7e9, values["main;read"][1], 1)
+	require.InDelta(t, 3e9, values["main;write"][1], 1)
+}
+
+// barrierSource is a ProfileSource whose searches only return once all n
+// queries are searched at the same time. Each query finds one profile named
+// after its first term, e.g. service:a.
+type barrierSource struct {
+	searching sync.WaitGroup
+	data      map[string][]byte
+}
+
+func (s *barrierSource) SearchProfiles(ctx context.Context, query SearchQuery) ([]*SearchProfile, error) {
+	s.searching.Done()
+	done := make(chan struct{})
+	go func() { s.searching.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("queries were not searched concurrently")
+	}
+	return []*SearchProfile{{ProfileID: strings.Fields(query.Filter.Query)[0]}}, nil
+}
+
+func (s *barrierSource) DownloadProfile(ctx context.Context, p *SearchProfile) (ProfileDownload, error) {
+	return NewPprofDownload(s.data[p.ProfileID], DefaultZipLimits)
+}
+
+func TestSearchDownloadMergeWeightedConcurrent(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	source := &barrierSource{data: map[string][]byte{}}
+	for query, stack := range map[string]string{"service:a": "main;a", "service:b": "main;b"} {
+		var buf bytes.Buffer
+		require.NoError(t, newTestProfile(t, map[string]int64{stack: 1e9}).Write(&buf))
+		source.data[query] = buf.Bytes()
+	}
+	source.searching.Add(2)
+	queries, err := BuildQueries(time.Hour, 1, nil, []string{"service:a@weight=3", "service:b"})
+	require.NoError(t, err)
+
+	mp, err := SearchDownloadMerge(context.Background(), log, source, queries, SelectOptions{}, MergeOptions{MaxInFlight: 1, ParseWorkers: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"service:a", "service:b"}, mp.profileIDs)
+	values := stackValues(mp.profile)
+	require.InDelta(t, 1.5e9, values["main;a"][1], 1)
+	require.InDelta(t, 0.5e9, values["main;b"][1], 1)
+}
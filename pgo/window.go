@@ -0,0 +1,200 @@
+package pgo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdayNames maps the day names accepted by ParseWindowFilter to the days
+// they select.
+var weekdayNames = map[string][]time.Weekday{
+	"daily":    {time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday},
+	"weekday":  {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekend":  {time.Saturday, time.Sunday},
+	"weekends": {time.Saturday, time.Sunday},
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+}
+
+// WindowFilter matches times within recurring windows of the week, e.g.
+// business hours, see ParseWindowFilter.
+type WindowFilter struct {
+	spec    string
+	windows []timeWindow
+}
+
+// timeWindow is a recurring window of the week. It starts at start minutes
+// after midnight on each of days and ends at end minutes after midnight, on
+// the next day if end <= start.
+type timeWindow struct {
+	days       [7]bool
+	start, end int
+	loc        *time.Location
+}
+
+// ParseWindowFilter parses spec, a list of windows separated by ";". Each
+// window consists of days, a time range and a time zone, separated by spaces,
+// e.g. "weekday 09:00-18:00 UTC" or "mon,wed 08:00-12:00 Europe/Berlin".
+// Days are daily, weekday, weekend, day names like mon, or ranges or lists of
+// them like mon-fri or sat,sun, and default to daily. Time ranges end on the
+// next day if they end before they start, e.g. 22:00-06:00, and default to the
+// whole day. Time zones are UTC or IANA names, and default to UTC. Either the
+// days or the time range must be given.
+func ParseWindowFilter(spec string) (*WindowFilter, error) {
+	f := &WindowFilter{spec: spec}
+	for _, part := range strings.Split(spec, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		w, err := parseTimeWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window filter %q: %w", spec, err)
+		}
+		f.windows = append(f.windows, w)
+	}
+	if len(f.windows) == 0 {
+		return nil, fmt.Errorf("invalid window filter %q: no windows", spec)
+	}
+	return f, nil
+}
+
+// parseTimeWindow parses a single window of ParseWindowFilter.
+func parseTimeWindow(s string) (w timeWindow, err error) {
+	var hasDays, hasTimes, hasLoc bool
+	for _, field := range strings.Fields(s) {
+		switch {
+		case !hasDays && isDaySpec(field):
+			if w.days, err = parseDays(field); err != nil {
+				return w, err
+			}
+			hasDays = true
+		case !hasTimes && strings.Contains(field, ":") && strings.Contains(field, "-"):
+			if w.start, w.end, err = parseTimeRange(field); err != nil {
+				return w, err
+			}
+			hasTimes = true
+		case !hasLoc:
+			if w.loc, err = time.LoadLocation(field); err != nil || field == "" || field == "Local" {
+				return w, fmt.Errorf("unknown days, time range or time zone %q", field)
+			}
+			hasLoc = true
+		default:
+			return w, fmt.Errorf("unexpected %q", field)
+		}
+	}
+	if !hasDays && !hasTimes {
+		return w, fmt.Errorf("window %q needs days like weekday or a time range like 09:00-18:00", strings.TrimSpace(s))
+	}
+	if !hasDays {
+		w.days, _ = parseDays("daily")
+	}
+	if !hasTimes {
+		w.start, w.end = 0, 24*60
+	}
+	if !hasLoc {
+		w.loc = time.UTC
+	}
+	return w, nil
+}
+
+// isDaySpec returns true if s looks like days rather than a time zone, i.e.
+// its first day name is known.
+func isDaySpec(s string) bool {
+	first, _, _ := strings.Cut(strings.ToLower(s), ",")
+	first, _, _ = strings.Cut(first, "-")
+	return weekdayNames[first] != nil
+}
+
+// parseDays parses days like weekday, mon-fri or sat,sun.
+func parseDays(s string) (days [7]bool, err error) {
+	for _, item := range strings.Split(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		fromDays, toDays := weekdayNames[from], weekdayNames[to]
+		switch {
+		case fromDays == nil:
+			return days, fmt.Errorf("unknown day %q", from)
+		case !isRange:
+			for _, d := range fromDays {
+				days[d] = true
+			}
+		case len(fromDays) != 1 || len(toDays) != 1:
+			return days, fmt.Errorf("invalid day range %q, use day names like mon-fri", item)
+		default:
+			for d := fromDays[0]; ; d = (d + 1) % 7 {
+				days[d] = true
+				if d == toDays[0] {
+					break
+				}
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseTimeRange parses a time range like 09:00-18:00 into minutes after
+// midnight. The end may be 24:00.
+func parseTimeRange(s string) (start, end int, err error) {
+	from, to, _ := strings.Cut(s, "-")
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, err
+	} else if end, err = parseClock(to); err != nil {
+		return 0, 0, err
+	} else if start == end {
+		return 0, 0, fmt.Errorf("empty time range %q", s)
+	} else if start == 24*60 {
+		return 0, 0, fmt.Errorf("time range %q can't start at 24:00", s)
+	}
+	return start, end, nil
+}
+
+// parseClock parses a time of day like 09:30 into minutes after midnight.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time %q, must look like 09:30", s)
+	} else if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, errors.New("invalid time " + s)
+	}
+	return h*60 + m, nil
+}
+
+// Match returns true if t is within any window of f.
+func (f *WindowFilter) Match(t time.Time) bool {
+	for _, w := range f.windows {
+		if w.match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the spec f was parsed from.
+func (f *WindowFilter) String() string {
+	return f.spec
+}
+
+// MarshalText returns the spec f was parsed from, so it is part of the
+// CacheKey.
+func (f *WindowFilter) MarshalText() ([]byte, error) {
+	return []byte(f.spec), nil
+}
+
+// match returns true if t is within w.
+func (w timeWindow) match(t time.Time) bool {
+	t = t.In(w.loc)
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// The window ends on the next day.
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
@@ -0,0 +1,127 @@
+package pgo
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowFilter(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	at := func(day int, clock string) time.Time {
+		ts, err := time.Parse("2006-01-02 15:04", fmt.Sprintf("2024-01-%02d %s", day, clock))
+		require.NoError(t, err)
+		return ts
+	}
+	tests := []struct {
+		spec  string
+		match []time.Time
+		miss  []time.Time
+	}{
+		{
+			spec:  "weekday 09:00-18:00 UTC",
+			match: []time.Time{at(1, "09:00"), at(5, "17:59")},
+			miss:  []time.Time{at(1, "08:59"), at(1, "18:00"), at(6, "12:00"), at(7, "12:00")},
+		},
+		{
+			spec:  "mon-wed",
+			match: []time.Time{at(1, "00:00"), at(3, "23:59")},
+			miss:  []time.Time{at(4, "00:00"), at(7, "12:00")},
+		},
+		{
+			spec:  "fri-mon",
+			match: []time.Time{at(5, "12:00"), at(7, "12:00"), at(1, "12:00")},
+			miss:  []time.Time{at(2, "12:00")},
+		},
+		{
+			spec:  "Sat,sun",
+			match: []time.Time{at(6, "12:00"), at(7, "12:00")},
+			miss:  []time.Time{at(5, "12:00")},
+		},
+		{
+			// Ends on the next day, so Friday night extends into Saturday.
+			spec:  "fri 22:00-06:00",
+			match: []time.Time{at(5, "22:00"), at(6, "05:59")},
+			miss:  []time.Time{at(5, "21:59"), at(6, "06:00"), at(5, "05:00"), at(6, "22:00")},
+		},
+		{
+			spec:  "12:00-24:00",
+			match: []time.Time{at(3, "12:00"), at(7, "23:59")},
+			miss:  []time.Time{at(3, "11:59")},
+		},
+		{
+			// 09:00-18:00 in Berlin is 08:00-17:00 UTC in winter.
+			spec:  "weekday 09:00-18:00 Europe/Berlin",
+			match: []time.Time{at(1, "08:00"), at(1, "16:59")},
+			miss:  []time.Time{at(1, "07:59"), at(1, "17:00")},
+		},
+		{
+			spec:  "weekday 09:00-12:00; weekend 20:00-22:00",
+			match: []time.Time{at(2, "10:00"), at(6, "21:00")},
+			miss:  []time.Time{at(2, "21:00"), at(6, "10:00")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			f, err := ParseWindowFilter(tt.spec)
+			require.NoError(t, err)
+			require.Equal(t, tt.spec, f.String())
+			for _, ts := range tt.match {
+				require.True(t, f.Match(ts), "%s", ts)
+			}
+			for _, ts := range tt.miss {
+				require.False(t, f.Match(ts), "%s", ts)
+			}
+		})
+	}
+
+	for _, spec := range []string{
+		"",
+		";",
+		"UTC",
+		"weekday UTC UTC",
+		"weekday weekend",
+		"weekday-fri",
+		"mon-funday",
+		"mon,funday",
+		"09:00-09:00",
+		"9:00-18:00",
+		"09:00-25:00",
+		"09:60-18:00",
+		"24:00-06:00",
+		"weekday 09:00-18:00 Mars/Olympus",
+		"weekday 09:00-18:00 Local",
+	} {
+		_, err := ParseWindowFilter(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestSelectWindowFilter(t *testing.T) {
+	f, err := ParseWindowFilter("weekday 09:00-18:00 UTC")
+	require.NoError(t, err)
+	sel := SelectOptions{WindowFilter: f}
+	require.True(t, sel.RequiresSearch())
+	require.Equal(t, percentileSearchLimit, sel.searchQuery(SearchQuery{Limit: 5}).Limit)
+
+	profiles := []*SearchProfile{
+		{ProfileID: "business", Timestamp: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{ProfileID: "night", Timestamp: time.Date(2024, 1, 2, 23, 0, 0, 0, time.UTC)},
+		{ProfileID: "weekend", Timestamp: time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC)},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	selected := sel.Select(log, profiles)
+	require.Len(t, selected, 1)
+	require.Equal(t, "business", selected[0].ProfileID)
+
+	other, err := ParseWindowFilter("weekend")
+	require.NoError(t, err)
+	require.NotEqual(t,
+		CacheKey(time.Hour, nil, "", sel, MergeOptions{}),
+		CacheKey(time.Hour, nil, "", SelectOptions{WindowFilter: other}, MergeOptions{}),
+	)
+}
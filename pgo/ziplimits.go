@@ -0,0 +1,102 @@
+package pgo
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ZipLimits bounds the resources used for reading zip archives downloaded
+// from the API. This protects against malformed or malicious responses, e.g.
+// zip bombs.
+type ZipLimits struct {
+	// MaxArchiveBytes is the maximum size of a downloaded archive.
+	MaxArchiveBytes int64
+	// MaxEntryBytes is the maximum uncompressed size of a single entry.
+	MaxEntryBytes int64
+	// MaxEntries is the maximum number of entries in an archive.
+	MaxEntries int
+}
+
+// DefaultZipLimits are generous limits that real downloads should never hit.
+var DefaultZipLimits = ZipLimits{
+	MaxArchiveBytes: 1 << 30,
+	MaxEntryBytes:   512 << 20,
+	MaxEntries:      10000,
+}
+
+// removeTemp closes and removes the temporary file f.
+func removeTemp(f *os.File) error {
+	closeErr := f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// OpenArchive opens the zip archive in data and checks it against the limits.
+func (l ZipLimits) OpenArchive(data []byte) (*zip.Reader, error) {
+	return l.OpenArchiveReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// OpenArchiveReader opens the zip archive of the given size in r and checks it
+// against the limits. Entries are read from r on demand, so r can be a file.
+func (l ZipLimits) OpenArchiveReader(r io.ReaderAt, size int64) (*zip.Reader, error) {
+	if size > l.MaxArchiveBytes {
+		return nil, fmt.Errorf("archive exceeds the limit of %d bytes", l.MaxArchiveBytes)
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	} else if len(zr.File) > l.MaxEntries {
+		return nil, fmt.Errorf("archive contains %d entries, exceeding the limit of %d", len(zr.File), l.MaxEntries)
+	}
+	return zr, nil
+}
+
+// OpenEntry opens the zip entry f. The returned reader fails once more than
+// MaxEntryBytes have been read from it, regardless of the size declared in
+// the archive.
+func (l ZipLimits) OpenEntry(f *zip.File) (io.ReadCloser, error) {
+	if f.UncompressedSize64 > uint64(l.MaxEntryBytes) {
+		return nil, entryTooLargeError(f.Name, l.MaxEntryBytes)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &boundedReader{rc: rc, name: f.Name, max: l.MaxEntryBytes, n: l.MaxEntryBytes}, nil
+}
+
+// boundedReader returns an error once more than max bytes are read from rc.
+type boundedReader struct {
+	rc   io.ReadCloser
+	name string
+	max  int64
+	n    int64
+}
+
+// Read implements io.Reader.
+func (b *boundedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.rc.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return n, entryTooLargeError(b.name, b.max)
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *boundedReader) Close() error {
+	return b.rc.Close()
+}
+
+// entryTooLargeError returns the error for an entry exceeding max bytes.
+func entryTooLargeError(name string, max int64) error {
+	return fmt.Errorf("archive entry %q exceeds the limit of %d uncompressed bytes", name, max)
+}
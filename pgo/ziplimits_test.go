@@ -0,0 +1,104 @@
+package pgo
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZipLimits(t *testing.T) {
+	limits := ZipLimits{MaxArchiveBytes: 64 << 10, MaxEntryBytes: 1 << 10, MaxEntries: 2}
+	large := bytes.Repeat([]byte{0}, 1<<20)
+
+	t.Run("archive", func(t *testing.T) {
+		_, err := limits.OpenArchive(make([]byte, 64<<10+1))
+		require.ErrorContains(t, err, "exceeds the limit")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		data := newTestZip(t, map[string][]byte{"cpu.pprof": []byte("profile")})
+		file, err := os.CreateTemp(t.TempDir(), "download-*.zip")
+		require.NoError(t, err)
+		_, err = file.Write(data)
+		require.NoError(t, err)
+		d := ProfileDownload{file: file, size: int64(len(data)), limits: limits}
+		require.Equal(t, int64(len(data)), d.Size())
+		extracted, err := d.ExtractProfile(ProfileTypeCPU)
+		require.NoError(t, err)
+		require.Equal(t, "profile", string(extracted))
+		require.NoError(t, d.Close())
+		_, err = os.Stat(file.Name())
+		require.ErrorIs(t, err, os.ErrNotExist, "the temporary file is removed")
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		data := newTestZip(t, map[string][]byte{"a": nil, "b": nil, "c": nil})
+		_, err := limits.OpenArchive(data)
+		require.ErrorContains(t, err, "3 entries")
+	})
+
+	t.Run("declared-size", func(t *testing.T) {
+		zr, err := limits.OpenArchive(newTestZip(t, map[string][]byte{"cpu.pprof": large}))
+		require.NoError(t, err)
+		_, err = limits.OpenEntry(zr.File[0])
+		require.ErrorContains(t, err, `"cpu.pprof" exceeds the limit`)
+
+		d := ProfileDownload{data: newTestZip(t, map[string][]byte{"cpu.pprof": large}), limits: limits}
+		_, err = d.ExtractProfile(ProfileTypeCPU)
+		require.ErrorContains(t, err, `"cpu.pprof" exceeds the limit`)
+	})
+
+	t.Run("lying-size", func(t *testing.T) {
+		// Write an entry that claims to be small, but inflates to 1MB. The zip
+		// package itself rejects entries exceeding their declared size, but
+		// reading must stop before the whole entry is inflated either way.
+		var compressed bytes.Buffer
+		fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+		require.NoError(t, err)
+		_, err = fw.Write(large)
+		require.NoError(t, err)
+		require.NoError(t, fw.Close())
+
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "cpu.pprof",
+			Method:             zip.Deflate,
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: 10,
+		})
+		require.NoError(t, err)
+		_, err = w.Write(compressed.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		zr, err := limits.OpenArchive(buf.Bytes())
+		require.NoError(t, err)
+		rc, err := limits.OpenEntry(zr.File[0])
+		require.NoError(t, err)
+		defer rc.Close()
+		n, err := io.Copy(io.Discard, rc)
+		require.Error(t, err)
+		require.LessOrEqual(t, n, int64(1<<10+1))
+	})
+}
+
+// newTestZip returns a zip archive containing the given files.
+func newTestZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
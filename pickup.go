@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultPGOFile is the file name the go toolchain looks for in the main
+// package directory when building with -pgo=auto (the default since go1.21).
+const defaultPGOFile = "default.pgo"
+
+// verifyPickup checks that the go toolchain will pick up the PGO file at dst
+// when building the package in its directory. It returns a list of problems
+// that will prevent this. An empty list means dst will be picked up.
+func verifyPickup(dst string) (problems []string, err error) {
+	defer wrapErr(&err, "verify pickup")
+	if base := filepath.Base(dst); base != defaultPGOFile {
+		problems = append(problems, fmt.Sprintf("file name is %q, but the go toolchain only picks up %q automatically", base, defaultPGOFile))
+	}
+
+	dir := filepath.Dir(dst)
+	pkgName, err := packageName(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch pkgName {
+	case "main":
+	case "":
+		problems = append(problems, fmt.Sprintf("directory %q does not contain a go package, but %s must be placed in a main package directory", dir, defaultPGOFile))
+	default:
+		problems = append(problems, fmt.Sprintf("directory %q contains package %q, but %s is only picked up in main package directories", dir, pkgName, defaultPGOFile))
+	}
+	return problems, nil
+}
+
+// packageName returns the name of the go package in dir, or an empty string
+// if dir does not contain any non-test go files.
+func packageName(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	fset := token.NewFileSet()
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", err
+		}
+		return f.Name.Name, nil
+	}
+	return "", nil
+}
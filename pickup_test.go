@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPickup(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, data string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	writeFile("cmd/foo/main.go", "package main\n")
+	writeFile("cmd/foo/main_test.go", "package main_test\n")
+	writeFile("pkg/bar/bar.go", "package bar\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "empty"), 0755))
+
+	problems, err := verifyPickup(filepath.Join(dir, "cmd/foo/default.pgo"))
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	problems, err = verifyPickup(filepath.Join(dir, "cmd/foo/cpu.pgo"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+
+	problems, err = verifyPickup(filepath.Join(dir, "pkg/bar/default.pgo"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Contains(t, problems[0], `package "bar"`)
+
+	problems, err = verifyPickup(filepath.Join(dir, "empty/default.pgo"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+}
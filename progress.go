@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// progressRedrawInterval is how often the progress line is redrawn on a TTY.
+const progressRedrawInterval = 200 * time.Millisecond
+
+// progressReporter reports the progress of fetching profiles, either as a
+// single line that is redrawn on a TTY, or as periodic log lines.
+type progressReporter struct {
+	progress *pgo.Progress
+	start    time.Time
+	// tty is the terminal the progress line is drawn on, or nil to log the
+	// progress instead.
+	tty io.Writer
+
+	mu sync.Mutex
+	// shown is true if the progress line is currently drawn on tty.
+	shown bool
+}
+
+// newProgressReporter returns a reporter of progress. If tty is not nil, the
+// progress is drawn on it.
+func newProgressReporter(progress *pgo.Progress, tty io.Writer) *progressReporter {
+	return &progressReporter{progress: progress, start: time.Now(), tty: tty}
+}
+
+// Run reports the progress until ctx is done. Without a TTY, a log line is
+// written to log every interval.
+func (r *progressReporter) Run(ctx context.Context, log *slog.Logger, interval time.Duration) {
+	if r.tty != nil {
+		interval = progressRedrawInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.clear()
+			return
+		case <-ticker.C:
+		}
+		s := r.progress.Snapshot()
+		if s.Queries == 0 {
+			continue
+		} else if r.tty != nil {
+			r.mu.Lock()
+			r.draw(s)
+			r.mu.Unlock()
+			continue
+		}
+		args := []any{
+			"queries-searched", fmt.Sprintf("%d/%d", s.Searched, s.Queries),
+			"profiles-downloaded", fmt.Sprintf("%d/%d", s.Downloaded, s.Profiles),
+			"profiles-merged", fmt.Sprintf("%d/%d", s.Merged, s.Profiles),
+			"percent", fmt.Sprintf("%.0f", s.Percent()),
+			"bytes", s.Bytes,
+		}
+		if eta, ok := progressETA(s, time.Since(r.start)); ok {
+			args = append(args, "eta", eta)
+		}
+		log.Info("progress", args...)
+	}
+}
+
+// draw draws the progress line for s on the TTY. r.mu must be held.
+func (r *progressReporter) draw(s pgo.ProgressSnapshot) {
+	fmt.Fprintf(r.tty, "\r\033[K%s", formatProgress(s, time.Since(r.start)))
+	r.shown = true
+}
+
+// clear removes the progress line from the TTY.
+func (r *progressReporter) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clearLocked()
+}
+
+// clearLocked removes the progress line from the TTY. r.mu must be held.
+func (r *progressReporter) clearLocked() {
+	if r.shown {
+		fmt.Fprint(r.tty, "\r\033[K")
+		r.shown = false
+	}
+}
+
+// formatProgress returns the progress line for s after elapsed time.
+func formatProgress(s pgo.ProgressSnapshot, elapsed time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "searched %d/%d queries, downloaded %d/%d profiles (%s), merged %d/%d, %.0f%%",
+		s.Searched, s.Queries, s.Downloaded, s.Profiles, formatBytes(s.Bytes), s.Merged, s.Profiles, s.Percent())
+	if eta, ok := progressETA(s, elapsed); ok {
+		fmt.Fprintf(&b, ", ETA %s", eta)
+	}
+	return b.String()
+}
+
+// progressETA estimates the remaining time of the fetch from the rate at which
+// profiles finished so far. It's only known once all queries were searched,
+// as the number of profiles isn't known before.
+func progressETA(s pgo.ProgressSnapshot, elapsed time.Duration) (time.Duration, bool) {
+	finished := s.Merged + s.Failed
+	if s.Searched < s.Queries || finished == 0 || finished >= s.Profiles {
+		return 0, false
+	}
+	perProfile := elapsed / time.Duration(finished)
+	return (perProfile * time.Duration(s.Profiles-finished)).Round(time.Second), true
+}
+
+// formatBytes formats n as a human readable size, e.g. 1.5 MB.
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// progressHandler is a slog.Handler that removes the progress line of a
+// progressReporter before each log record and redraws it afterwards, so they
+// don't interleave on the terminal.
+type progressHandler struct {
+	slog.Handler
+	r *progressReporter
+}
+
+// Handle implements slog.Handler.
+func (h *progressHandler) Handle(ctx context.Context, rec slog.Record) error {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	shown := h.r.shown
+	h.r.clearLocked()
+	err := h.Handler.Handle(ctx, rec)
+	if shown {
+		h.r.draw(h.r.progress.Snapshot())
+	}
+	return err
+}
+
+// WithAttrs implements slog.Handler.
+func (h *progressHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &progressHandler{Handler: h.Handler.WithAttrs(attrs), r: h.r}
+}
+
+// WithGroup implements slog.Handler.
+func (h *progressHandler) WithGroup(name string) slog.Handler {
+	return &progressHandler{Handler: h.Handler.WithGroup(name), r: h.r}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestFormatProgress(t *testing.T) {
+	s := pgo.ProgressSnapshot{Queries: 2, Searched: 2, Profiles: 10, Downloaded: 6, Merged: 4, Failed: 1, Bytes: 1_500_000}
+	require.Equal(t,
+		"searched 2/2 queries, downloaded 6/10 profiles (1.5 MB), merged 4/10, 50%, ETA 10s",
+		formatProgress(s, 10*time.Second),
+	)
+
+	// The ETA is unknown until all queries were searched
+	s.Searched = 1
+	_, ok := progressETA(s, 10*time.Second)
+	require.False(t, ok)
+	require.Equal(t, "searched 1/2 queries, downloaded 6/10 profiles (1.5 MB), merged 4/10, 50%", formatProgress(s, 10*time.Second))
+
+	require.Equal(t, "999 B", formatBytes(999))
+	require.Equal(t, "2.0 kB", formatBytes(2000))
+	require.Equal(t, "3.2 GB", formatBytes(3_200_000_000))
+}
+
+func TestProgressHandler(t *testing.T) {
+	var tty, logs bytes.Buffer
+	r := newProgressReporter(&pgo.Progress{}, &tty)
+	log := slog.New(&progressHandler{Handler: slog.NewTextHandler(&logs, nil), r: r})
+
+	log.Info("before the progress line is shown")
+	require.Empty(t, tty.String())
+
+	r.mu.Lock()
+	r.draw(pgo.ProgressSnapshot{Queries: 1})
+	r.mu.Unlock()
+	tty.Reset()
+	log.Info("hello")
+	require.Contains(t, logs.String(), "hello")
+	require.Equal(t, "\r\033[K\r\033[Ksearched 0/0 queries, downloaded 0/0 profiles (0 B), merged 0/0, 0%", tty.String())
+
+	tty.Reset()
+	r.clear()
+	require.Equal(t, "\r\033[K", tty.String())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+const (
+	// ociScheme is the URL scheme of the -publish reference.
+	ociScheme = "oci://"
+	// ociArtifactType is the artifact type of published PGO files.
+	ociArtifactType = "application/vnd.datadog.pgo.v1"
+	// ociProfileMediaType is the media type of the layer holding the PGO
+	// file.
+	ociProfileMediaType = "application/vnd.datadog.pgo.profile.v1+pprof"
+	// ociAnnotationPrefix prefixes the annotations specific to datadog-pgo.
+	ociAnnotationPrefix = "com.datadoghq.pgo."
+)
+
+// ociRefRE matches the references accepted by -publish after the scheme, a
+// registry host, a repository and a tag, e.g.
+// registry.example.com/org/pgo:my-service.
+var ociRefRE = regexp.MustCompile(`^[a-zA-Z0-9.\-]+(:[0-9]+)?(/[a-z0-9]+([._\-]+[a-z0-9]+)*)+:[a-zA-Z0-9_][a-zA-Z0-9._\-]{0,127}$`)
+
+// parsePublishRef validates the -publish value s, e.g.
+// oci://registry.example.com/org/pgo:my-service, and returns it without the
+// scheme.
+func parsePublishRef(s string) (string, error) {
+	ref, ok := strings.CutPrefix(s, ociScheme)
+	if !ok {
+		return "", fmt.Errorf("-publish: %q must start with %s", s, ociScheme)
+	} else if !ociRefRE.MatchString(ref) {
+		return "", fmt.Errorf("-publish: %q must look like %sregistry.example.com/org/pgo:tag", s, ociScheme)
+	}
+	return ref, nil
+}
+
+// publishAnnotations returns the manifest annotations of a PGO file merged
+// from the profiles matching queries at created.
+func publishAnnotations(queries []pgo.SearchQuery, p *pgo.MergedProfile, created time.Time) (map[string]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, q := range queries {
+		if !seen[q.Filter.Query] {
+			seen[q.Filter.Query] = true
+			names = append(names, q.Filter.Query)
+		}
+	}
+	queriesJSON, err := json.Marshal(names)
+	if err != nil {
+		return nil, err
+	}
+	ids := append([]string{}, p.ProfileIDs()...)
+	sort.Strings(ids)
+	return map[string]string{
+		"org.opencontainers.image.created":   created.UTC().Format(time.RFC3339),
+		ociAnnotationPrefix + "queries":      string(queriesJSON),
+		ociAnnotationPrefix + "profile-ids":  strings.Join(ids, ","),
+		ociAnnotationPrefix + "tool-version": version,
+	}, nil
+}
+
+// publishCommand returns the command that pushes the PGO file at path to the
+// OCI registry reference ref with the given manifest annotations.
+func publishCommand(ctx context.Context, path, ref string, annotations map[string]string) *exec.Cmd {
+	args := []string{"push", ref, "--artifact-type", ociArtifactType}
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--annotation", k+"="+annotations[k])
+	}
+	// oras only accepts relative paths, the file name becomes the title of
+	// the layer.
+	args = append(args, filepath.Base(path)+":"+ociProfileMediaType)
+	cmd := exec.CommandContext(ctx, "oras", args...)
+	cmd.Dir = filepath.Dir(path)
+	return cmd
+}
+
+// publish pushes the PGO file at path to the OCI registry reference ref
+// using the oras CLI, so the usual registry credentials apply, and returns
+// the digest of the pushed manifest if oras reports it.
+func publish(ctx context.Context, path, ref string, annotations map[string]string) (digest string, err error) {
+	cmd := publishCommand(ctx, path, ref, annotations)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("publish %s%s: oras: %w: %s", ociScheme, ref, err, strings.TrimSpace(string(out)))
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if d, ok := strings.CutPrefix(strings.TrimSpace(line), "Digest: "); ok {
+			digest = d
+		}
+	}
+	return digest, nil
+}
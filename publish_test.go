@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePublishRef(t *testing.T) {
+	for _, s := range []string{
+		"oci://registry.example.com/org/pgo:my-service",
+		"oci://localhost:5000/pgo:v1.2.3",
+	} {
+		ref, err := parsePublishRef(s)
+		require.NoError(t, err, s)
+		require.Equal(t, s[len("oci://"):], ref)
+	}
+	for _, s := range []string{
+		"registry.example.com/org/pgo:my-service",
+		"oci://registry.example.com/org/pgo",
+		"oci://registry.example.com/Org/pgo:tag",
+		"oci://registry.example.com:tag",
+	} {
+		_, err := parsePublishRef(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestPublishCommand(t *testing.T) {
+	cmd := publishCommand(context.Background(), "/tmp/x/default.pgo", "localhost:5000/pgo:foo", map[string]string{
+		"b": "2",
+		"a": "1=1",
+	})
+	require.Equal(t, []string{
+		"oras", "push", "localhost:5000/pgo:foo",
+		"--artifact-type", "application/vnd.datadog.pgo.v1",
+		"--annotation", "a=1=1",
+		"--annotation", "b=2",
+		"default.pgo:application/vnd.datadog.pgo.profile.v1+pprof",
+	}, cmd.Args)
+	require.Equal(t, "/tmp/x", cmd.Dir)
+}
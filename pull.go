@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// ociDigestRefRE matches the references accepted by pull in addition to
+// ociRefRE, a repository pinned to the sha256 digest of a manifest, e.g.
+// registry.example.com/org/pgo@sha256:0123....
+var ociDigestRefRE = regexp.MustCompile(`^[a-zA-Z0-9.\-]+(:[0-9]+)?(/[a-z0-9]+([._\-]+[a-z0-9]+)*)+@sha256:[a-f0-9]{64}$`)
+
+// sha256HexRE matches a hex encoded sha256 checksum.
+var sha256HexRE = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// runPull implements the pull subcommand. It downloads a PGO file published
+// with -publish from an OCI registry.
+func runPull(args []string, _ io.Writer) error {
+	fs := flag.NewFlagSet(name+" pull", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: `+name+` pull [OPTIONS]... REF DEST
+
+pull downloads the PGO file published to the OCI registry reference REF with
+fetch -publish and writes it to DEST, so builds can use the profile without
+Datadog credentials, e.g.:
+
+	`+name+` pull oci://registry.example.com/org/pgo:my-service ./cmd/my-service/default.pgo
+
+REF is either tagged, or pinned to the digest of the artifact's manifest, e.g.
+oci://registry.example.com/org/pgo@sha256:<digest>, which the registry
+content is verified against. -sha256 additionally verifies the checksum of
+the PGO file itself, e.g. as written by fetch -output-digest. DEST is only
+replaced if the checks pass and the file is a valid profile.
+
+The artifact is pulled with the oras CLI, so the usual registry credentials
+apply.
+
+OPTIONS`)
+		fs.PrintDefaults()
+	}
+	sha256F := fs.String("sha256", "", "the expected hex encoded sha256 checksum of the PGO file")
+	timeoutF := fs.Duration("timeout", 60*time.Second, "timeout for pulling the PGO file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("pull requires exactly 2 arguments")
+	} else if *sha256F != "" && !sha256HexRE.MatchString(*sha256F) {
+		return errors.New("-sha256 must be 64 lower case hex digits")
+	}
+	ref, err := parsePullRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst := fs.Arg(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeoutF)
+	defer cancel()
+	tmp, err := os.MkdirTemp("", name+"-pull-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	cmd := pullCommand(ctx, ref, tmp)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pull %s: oras: %w: %s", fs.Arg(0), err, strings.TrimSpace(string(out)))
+	}
+
+	src, err := pulledFile(tmp)
+	if err != nil {
+		return fmt.Errorf("pull %s: %w", fs.Arg(0), err)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); *sha256F != "" && hex.EncodeToString(sum[:]) != *sha256F {
+		return fmt.Errorf("pull %s: sha256 checksum is %x, but -sha256 is %s", fs.Arg(0), sum, *sha256F)
+	}
+	if _, err := pgo.ReadProfile(src); err != nil {
+		return fmt.Errorf("pull %s: %w", fs.Arg(0), err)
+	}
+	if err := writeFileAtomic(dst, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "pulled %s to %s\n", fs.Arg(0), dst)
+	return nil
+}
+
+// parsePullRef validates the REF argument of pull and returns it without the
+// scheme. Unlike -publish, it may be pinned to a digest.
+func parsePullRef(s string) (string, error) {
+	ref, ok := strings.CutPrefix(s, ociScheme)
+	if !ok {
+		return "", fmt.Errorf("REF %q must start with %s", s, ociScheme)
+	} else if !ociRefRE.MatchString(ref) && !ociDigestRefRE.MatchString(ref) {
+		return "", fmt.Errorf("REF %q must look like %sregistry.example.com/org/pgo:tag or %sregistry.example.com/org/pgo@sha256:<digest>", s, ociScheme, ociScheme)
+	}
+	return ref, nil
+}
+
+// pullCommand returns the command that pulls the artifact ref into dir.
+func pullCommand(ctx context.Context, ref, dir string) *exec.Cmd {
+	return exec.CommandContext(ctx, "oras", "pull", ref, "--output", dir)
+}
+
+// pulledFile returns the path of the single file pulled into dir.
+func pulledFile(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			files = append(files, e.Name())
+		}
+	}
+	if len(files) != 1 {
+		return "", fmt.Errorf("artifact must contain exactly 1 file, but contains %d", len(files))
+	}
+	return filepath.Join(dir, files[0]), nil
+}
+
+// writeFileAtomic writes data to path via a temporary file in the same
+// directory, so path is never left partially written.
+func writeFileAtomic(path string, data []byte) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		return err
+	} else if err := f.Chmod(0o644); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePullRef(t *testing.T) {
+	digest := "registry.example.com/org/pgo@sha256:" + strings.Repeat("ab", 32)
+	for _, want := range []string{"registry.example.com/org/pgo:my-service", digest} {
+		ref, err := parsePullRef("oci://" + want)
+		require.NoError(t, err)
+		require.Equal(t, want, ref)
+	}
+	for _, s := range []string{
+		"registry.example.com/org/pgo:my-service",
+		"oci://registry.example.com/org/pgo@sha256:abc",
+		"oci://registry.example.com/org/pgo",
+	} {
+		_, err := parsePullRef(s)
+		require.Error(t, err, s)
+	}
+	require.Equal(t,
+		[]string{"oras", "pull", "localhost:5000/pgo:foo", "--output", "/tmp/x"},
+		pullCommand(context.Background(), "localhost:5000/pgo:foo", "/tmp/x").Args,
+	)
+}
+
+func TestPulledFile(t *testing.T) {
+	dir := t.TempDir()
+	_, err := pulledFile(dir)
+	require.ErrorContains(t, err, "contains 0")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo.pgo"), []byte("a"), 0o644))
+	path, err := pulledFile(dir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "foo.pgo"), path)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bar.pgo"), []byte("b"), 0o644))
+	_, err = pulledFile(dir)
+	require.ErrorContains(t, err, "contains 2")
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "default.pgo")
+	require.NoError(t, os.WriteFile(dst, []byte("old"), 0o644))
+	require.NoError(t, writeFileAtomic(dst, []byte("new")))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// regexpFlag is a repeatable flag holding regular expressions.
+type regexpFlag []*regexp.Regexp
+
+// String implements flag.Value.
+func (f *regexpFlag) String() string {
+	exprs := make([]string, len(*f))
+	for i, re := range *f {
+		exprs[i] = re.String()
+	}
+	return strings.Join(exprs, ",")
+}
+
+// Set implements flag.Value. It accepts a regular expression in the syntax of
+// the regexp package.
+func (f *regexpFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, re)
+	return nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexpFlag(t *testing.T) {
+	var f regexpFlag
+	require.NoError(t, f.Set(`^foo\.`))
+	require.NoError(t, f.Set(`bar`))
+	require.Equal(t, `^foo\.,bar`, f.String())
+	require.True(t, f[0].MatchString("foo.Bar"))
+	require.Error(t, f.Set(`(`))
+	require.Len(t, f, 2)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// resultSchemaVersion is the version of the Result schema. It must be bumped
+// whenever a field is removed or its meaning changes. Adding fields is
+// backwards compatible and doesn't require a new version.
+const resultSchemaVersion = 1
+
+// Result is the machine-readable result of a run written by -result-json. Its
+// schema is a stable contract for integrators, see resultSchemaVersion.
+type Result struct {
+	SchemaVersion int           `json:"schema_version"`
+	ToolVersion   string        `json:"tool_version"`
+	Success       bool          `json:"success"`
+	Error         string        `json:"error,omitempty"`
+	Output        string        `json:"output"`
+	Bytes         int64         `json:"bytes"`
+	Samples       int           `json:"samples"`
+	ProfileIDs    []string      `json:"profile_ids"`
+	Queries       []QueryResult `json:"queries"`
+	DurationMS    int64         `json:"duration_ms"`
+	// DebugQuery is a query that shows the merged profiles in Datadog.
+	DebugQuery string `json:"debug_query,omitempty"`
+	// Warnings holds the messages of all warnings logged during the run.
+	Warnings []string `json:"warnings,omitempty"`
+	// Outputs holds the results of the individual outputs if multiple
+	// outputs were written, see the outputs key of the config file.
+	Outputs []*Result `json:"outputs,omitempty"`
+}
+
+// QueryResult is the result for a single query.
+type QueryResult struct {
+	Query string `json:"query"`
+	// Profiles is the number of merged profiles matching the query. It is
+	// null if the number is unknown, which is the case when multiple queries
+	// are fetched using a single request to the pgo endpoint.
+	Profiles *int `json:"profiles"`
+}
+
+// newResult returns a new Result for the given queries and output.
+func newResult(queries []pgo.SearchQuery, dst string) *Result {
+	r := &Result{
+		SchemaVersion: resultSchemaVersion,
+		ToolVersion:   version,
+		Output:        dst,
+		ProfileIDs:    []string{},
+		Queries:       []QueryResult{},
+	}
+	r.setQueries(queries)
+	return r
+}
+
+// setQueries replaces the queries of the result.
+func (r *Result) setQueries(queries []pgo.SearchQuery) {
+	r.Queries = []QueryResult{}
+	seen := map[string]bool{}
+	for _, q := range queries {
+		// A query searched with multiple sort fields is only reported once.
+		if !seen[q.Filter.Query] {
+			seen[q.Filter.Query] = true
+			r.Queries = append(r.Queries, QueryResult{Query: q.Filter.Query})
+		}
+	}
+}
+
+// SetProfile populates the result with the data from the merged profile.
+func (r *Result) SetProfile(p *pgo.MergedProfile, bytes int64) {
+	r.Bytes = bytes
+	r.Samples = p.Samples()
+	r.ProfileIDs = append([]string{}, p.ProfileIDs()...)
+	r.DebugQuery = p.DebugQuery()
+	for i, q := range r.Queries {
+		if n, ok := p.QueryProfiles()[q.Query]; ok {
+			n := n
+			r.Queries[i].Profiles = &n
+		}
+	}
+}
+
+// Finish sets the success, error and duration fields of the result.
+func (r *Result) Finish(start time.Time, err error) {
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.DurationMS = timeSinceRoundMS(start).Milliseconds()
+}
+
+// WriteFile writes the result as JSON to path.
+func (r *Result) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// WriteGitHubOutput appends the result as GitHub Actions step outputs to the
+// file at path, see
+// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions#setting-an-output-parameter.
+// The results of multiple outputs are summed up.
+func (r *Result) WriteGitHubOutput(path string) error {
+	outputs, bytes, samples, profiles := r.totals()
+	var buf strings.Builder
+	for _, kv := range [][2]string{
+		{"success", strconv.FormatBool(r.Success)},
+		{"error", r.Error},
+		{"output", strings.Join(outputs, " ")},
+		{"bytes", strconv.FormatInt(bytes, 10)},
+		{"samples", strconv.Itoa(samples)},
+		{"profiles", strconv.Itoa(profiles)},
+		{"debug-query", r.DebugQuery},
+		{"duration-ms", strconv.FormatInt(r.DurationMS, 10)},
+	} {
+		// Outputs are single-line, newlines in error messages are replaced.
+		fmt.Fprintf(&buf, "%s=%s\n", kv[0], strings.ReplaceAll(kv[1], "\n", " "))
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(buf.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// totals returns the written outputs and the bytes, samples and profiles
+// summed up across them.
+func (r *Result) totals() (outputs []string, bytes int64, samples, profiles int) {
+	outputs, bytes, samples, profiles = []string{}, r.Bytes, r.Samples, len(r.ProfileIDs)
+	if r.Output != "" {
+		outputs = append(outputs, r.Output)
+	}
+	for _, o := range r.Outputs {
+		outputs = append(outputs, o.Output)
+		bytes += o.Bytes
+		samples += o.Samples
+		profiles += len(o.ProfileIDs)
+	}
+	return outputs, bytes, samples, profiles
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGitHubOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "github_output")
+	require.NoError(t, os.WriteFile(path, []byte("previous=step\n"), 0644))
+
+	r := newResult(nil, "default.pgo")
+	r.Bytes, r.Samples, r.ProfileIDs, r.DebugQuery = 100, 10, []string{"a", "b"}, "profile-id:(a OR b)"
+	r.Finish(time.Now(), nil)
+	require.NoError(t, r.WriteGitHubOutput(path))
+
+	failed := newResult(nil, "")
+	failed.Outputs = []*Result{newResult(nil, "a.pgo"), newResult(nil, "b.pgo")}
+	failed.Outputs[0].Bytes = 5
+	failed.Outputs[1].Bytes = 7
+	failed.Finish(time.Now(), errors.New("boom\nbang"))
+	require.NoError(t, failed.WriteGitHubOutput(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `previous=step
+success=true
+error=
+output=default.pgo
+bytes=100
+samples=10
+profiles=2
+debug-query=profile-id:(a OR b)
+duration-ms=0
+success=false
+error=boom bang
+output=a.pgo b.pgo
+bytes=12
+samples=0
+profiles=0
+debug-query=
+duration-ms=0
+`, string(data))
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// serveShutdownTimeout bounds how long serve waits for in-flight requests
+// when it is stopped.
+const serveShutdownTimeout = 10 * time.Second
+
+// runServe implements the serve subcommand. It periodically refreshes the
+// PGO files of services and serves them over HTTP.
+func runServe(args []string, _ io.Writer) error {
+	fs := flag.NewFlagSet(name+" serve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: `+name+` serve [OPTIONS]... [-- FETCH OPTIONS...]
+
+serve runs as a long-lived process that refreshes the PGO files of services
+every -interval and serves them over HTTP, so build farms can download the
+latest profile instead of every CI job fetching it from Datadog, e.g.:
+
+	`+name+` serve -services foo,bar -query env:prod -interval 6h
+
+The profile of each service is written to -dir/<service>/default.pgo and served
+at /pgo/<service>. Without -services, the services are discovered with -query
+like with fetch -discover. /healthz reports the state of the refreshes, and
+/metrics reports metrics in the Prometheus text format.
+
+With -generate, POST /generate fetches the profiles of the queries of a JSON
+body and responds with the merged pprof file, so build services can request
+profiles without Datadog credentials, e.g.:
+
+	curl -fsS -o default.pgo -d '{"queries": ["service:foo env:prod"], "window": "72h", "profiles": 10}' http://localhost:8080/generate
+
+Then -services and -query are optional.
+
+Every refresh runs the fetch command with -fail and the FETCH OPTIONS in a child
+process, see '`+name+` fetch -h'. If a refresh fails, the previous files are
+served until the next refresh. The FETCH OPTIONS apply to /generate as well,
+the fields of the request take precedence.
+
+OPTIONS`)
+		fs.PrintDefaults()
+	}
+	addrF := fs.String("addr", ":8080", "the address to serve the PGO files on")
+	intervalF := fs.Duration("interval", 6*time.Hour, "how often to refresh the PGO files")
+	dirF := fs.String("dir", "pgo", "the directory the PGO files are written to and served from")
+	servicesF := fs.String("services", "", "comma-separated services to refresh, if empty they are discovered with -query")
+	queryF := fs.String("query", "", "the query added to the query of every service, e.g. env:prod, or the query used to discover the services")
+	verboseF := fs.Bool("v", false, "verbose output")
+	generateF := fs.Bool("generate", false, "enable POST /generate to fetch profiles on demand")
+	genConcF := fs.Int("generate-concurrency", 2, "the maximum number of /generate requests processed at the same time, further requests wait")
+	genTimeF := fs.Duration("generate-timeout", 5*time.Minute, "the timeout of a /generate request")
+	jsonF := fs.Bool("json", false, "print logs in json format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if *intervalF <= 0 {
+		return errors.New("-interval must be positive")
+	} else if *servicesF == "" && *queryF == "" && !*generateF {
+		fs.Usage()
+		return errors.New("serve requires -services, -query or -generate")
+	} else if *genConcF < 1 {
+		return errors.New("-generate-concurrency must be at least 1")
+	} else if *genTimeF <= 0 {
+		return errors.New("-generate-timeout must be positive")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	log := newLogger(*verboseF, *jsonF)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &pgoServer{
+		dir:             *dirF,
+		log:             log,
+		refresh:         *servicesF != "" || *queryF != "",
+		fetchFlags:      fs.Args(),
+		generate:        *generateF,
+		generating:      make(chan struct{}, *genConcF),
+		generateTimeout: *genTimeF,
+		fetch: func(ctx context.Context, args []string, out io.Writer) error {
+			cmd := exec.CommandContext(ctx, exe, append([]string{"fetch"}, args...)...)
+			cmd.Stdout, cmd.Stderr = out, out
+			return cmd.Run()
+		},
+	}
+	ln, err := net.Listen("tcp", *addrF)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+	log.Info("serving PGO files", "addr", ln.Addr().String(), "dir", *dirF, "interval", *intervalF)
+
+	if s.refresh {
+		fetchArgs := serveFetchArgs(s.fetchFlags, *dirF, *servicesF, *queryF)
+		s.refreshLoop(ctx, *intervalF, func(ctx context.Context) error {
+			return s.fetch(ctx, fetchArgs, os.Stdout)
+		})
+	} else {
+		<-ctx.Done()
+	}
+	select {
+	case err := <-serveErr:
+		return err
+	default:
+	}
+	log.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// serveFetchArgs returns the arguments of the fetch command run by every
+// refresh of serve. The profile of each service is written to
+// dir/<service>/default.pgo.
+func serveFetchArgs(fetchFlags []string, dir, services, query string) []string {
+	args := append([]string{"-fail"}, fetchFlags...)
+	if services == "" {
+		return append(args, "-discover", query, dir)
+	}
+	return append(args,
+		"-services", services,
+		strings.TrimSpace("service:{service} "+query),
+		filepath.Join(dir, "{service}", defaultPGOFile),
+	)
+}
+
+// pgoServer serves the PGO files below dir and keeps track of the refreshes.
+type pgoServer struct {
+	dir string
+	log *slog.Logger
+	// refresh is true if the files below dir are refreshed.
+	refresh bool
+	// fetchFlags are the FETCH OPTIONS of serve.
+	fetchFlags []string
+	// fetch runs the fetch command with args and writes its output to out.
+	fetch func(ctx context.Context, args []string, out io.Writer) error
+	// generate is true if POST /generate is enabled, see serveGenerate.
+	generate        bool
+	generating      chan struct{}
+	generateTimeout time.Duration
+
+	mu                sync.Mutex
+	successes         int
+	failures          int
+	lastRefresh       time.Time
+	lastSuccess       time.Time
+	lastErr           error
+	generateSuccesses int
+	generateFailures  int
+}
+
+// refreshLoop calls refresh right away and then every interval until ctx is
+// done. A refresh is not retried before the next interval if it fails.
+func (s *pgoServer) refreshLoop(ctx context.Context, interval time.Duration, refresh func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		err := refresh(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.recordRefresh(start, err)
+		if err != nil {
+			s.log.Error("refresh failed, serving the previous PGO files", "error", err)
+		} else {
+			s.log.Info("refreshed PGO files", "duration", time.Since(start).Round(time.Millisecond))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordRefresh records the result of a refresh started at start.
+func (s *pgoServer) recordRefresh(start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRefresh, s.lastErr = start, err
+	if err != nil {
+		s.failures++
+	} else {
+		s.successes++
+		s.lastSuccess = start
+	}
+}
+
+// handler returns the HTTP handler of the server.
+func (s *pgoServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pgo/", s.servePGO)
+	mux.HandleFunc("/healthz", s.serveHealth)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	if s.generate {
+		mux.HandleFunc("/generate", s.serveGenerate)
+	}
+	return mux
+}
+
+// servePGO serves the PGO file of the service named by the path.
+func (s *pgoServer) servePGO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	service := strings.TrimPrefix(r.URL.Path, "/pgo/")
+	if service == "" || strings.Contains(service, "/") || !filepath.IsLocal(service) {
+		http.Error(w, "invalid service", http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(filepath.Join(s.dir, service, defaultPGOFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "no PGO file for service "+service, http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, defaultPGOFile, fi.ModTime(), f)
+}
+
+// serveHealth reports the state of the refreshes as JSON. It responds with
+// 503 until the first refresh succeeded, and with 200 afterwards, even if
+// later refreshes fail, as the previous files are still served. Without
+// refreshes, it always responds with 200.
+func (s *pgoServer) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	health := struct {
+		Status      string     `json:"status"`
+		LastRefresh *time.Time `json:"last_refresh,omitempty"`
+		LastSuccess *time.Time `json:"last_success,omitempty"`
+		LastError   string     `json:"last_error,omitempty"`
+	}{Status: "ok"}
+	if !s.lastRefresh.IsZero() {
+		health.LastRefresh = &s.lastRefresh
+	}
+	if !s.lastSuccess.IsZero() {
+		health.LastSuccess = &s.lastSuccess
+	}
+	if s.lastErr != nil {
+		health.LastError = s.lastErr.Error()
+		health.Status = "degraded"
+	}
+	status := http.StatusOK
+	if s.refresh && s.lastSuccess.IsZero() {
+		health.Status, status = "starting", http.StatusServiceUnavailable
+	}
+	data, err := json.Marshal(health)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+// serveMetrics reports the refreshes and the size of the served files in the
+// Prometheus text format.
+func (s *pgoServer) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	var b strings.Builder
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP datadog_pgo_%s %s\n# TYPE datadog_pgo_%s %s\n", name, help, name, typ)
+	}
+	s.mu.Lock()
+	metric("refreshes_total", "counter", "The number of refreshes by result.")
+	fmt.Fprintf(&b, "datadog_pgo_refreshes_total{result=\"success\"} %d\n", s.successes)
+	fmt.Fprintf(&b, "datadog_pgo_refreshes_total{result=\"failure\"} %d\n", s.failures)
+	if !s.lastSuccess.IsZero() {
+		metric("last_success_timestamp_seconds", "gauge", "The start time of the last successful refresh.")
+		fmt.Fprintf(&b, "datadog_pgo_last_success_timestamp_seconds %d\n", s.lastSuccess.Unix())
+	}
+	if s.generate {
+		metric("generate_requests_total", "counter", "The number of /generate requests by result.")
+		fmt.Fprintf(&b, "datadog_pgo_generate_requests_total{result=\"success\"} %d\n", s.generateSuccesses)
+		fmt.Fprintf(&b, "datadog_pgo_generate_requests_total{result=\"failure\"} %d\n", s.generateFailures)
+	}
+	s.mu.Unlock()
+
+	sizes := s.fileSizes()
+	services := make([]string, 0, len(sizes))
+	for service := range sizes {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	metric("file_bytes", "gauge", "The size of the served PGO file of each service.")
+	for _, service := range services {
+		fmt.Fprintf(&b, "datadog_pgo_file_bytes{service=%q} %d\n", service, sizes[service])
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	io.WriteString(w, b.String())
+}
+
+// fileSizes returns the size of the PGO file of each service below dir.
+func (s *pgoServer) fileSizes() map[string]int64 {
+	sizes := map[string]int64{}
+	entries, _ := os.ReadDir(s.dir)
+	for _, e := range entries {
+		if fi, err := os.Stat(filepath.Join(s.dir, e.Name(), defaultPGOFile)); err == nil && e.IsDir() {
+			sizes[e.Name()] = fi.Size()
+		}
+	}
+	return sizes
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeFetchArgs(t *testing.T) {
+	require.Equal(t,
+		[]string{"-fail", "-profiles", "10", "-services", "foo,bar", "service:{service} env:prod", filepath.Join("pgo", "{service}", "default.pgo")},
+		serveFetchArgs([]string{"-profiles", "10"}, "pgo", "foo,bar", "env:prod"),
+	)
+	require.Equal(t,
+		[]string{"-fail", "-services", "foo", "service:{service}", filepath.Join("pgo", "{service}", "default.pgo")},
+		serveFetchArgs(nil, "pgo", "foo", ""),
+	)
+	require.Equal(t,
+		[]string{"-fail", "-discover", "env:prod", "pgo"},
+		serveFetchArgs(nil, "pgo", "", "env:prod"),
+	)
+}
+
+func TestServeHandler(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "foo"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo", "default.pgo"), []byte("profile"), 0o644))
+	s := &pgoServer{dir: dir, log: slog.New(slog.NewTextHandler(io.Discard, nil)), refresh: true}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		res, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	code, body := get("/pgo/foo")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "profile", body)
+	code, _ = get("/pgo/bar")
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = get("/pgo/foo/default.pgo")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/pgo/..")
+	require.NotEqual(t, http.StatusOK, code)
+
+	code, body = get("/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, body, `"status":"starting"`)
+
+	s.recordRefresh(time.Now(), nil)
+	s.recordRefresh(time.Now(), errors.New("boom"))
+	code, body = get("/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, `"status":"degraded"`)
+	require.Contains(t, body, `"last_error":"boom"`)
+
+	code, body = get("/metrics")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, `datadog_pgo_refreshes_total{result="success"} 1`)
+	require.Contains(t, body, `datadog_pgo_refreshes_total{result="failure"} 1`)
+	require.Contains(t, body, `datadog_pgo_file_bytes{service="foo"} 7`)
+	require.Contains(t, body, "datadog_pgo_last_success_timestamp_seconds ")
+}
+
+func TestServeRefreshLoop(t *testing.T) {
+	s := &pgoServer{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	s.refreshLoop(ctx, time.Millisecond, func(context.Context) error {
+		if calls++; calls == 3 {
+			cancel()
+		} else if calls == 2 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	require.Equal(t, 3, calls)
+	require.Equal(t, 1, s.successes)
+	require.Equal(t, 1, s.failures)
+	require.EqualError(t, s.lastErr, "boom")
+}
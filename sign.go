@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// signatureSuffix is appended to a file to get the path of the sigstore
+	// bundle written by -sign, e.g. default.pgo.sigstore.json.
+	signatureSuffix = ".sigstore.json"
+	// attestationSuffix is appended to DEST to get the path of the in-toto
+	// statement written by -attestation, e.g. default.pgo.intoto.json.
+	attestationSuffix = ".intoto.json"
+
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	// attestationBuildType identifies how DEST was built in the provenance.
+	attestationBuildType = "https://github.com/DataDog/datadog-pgo/fetch/v1"
+	// attestationBuilderID identifies the tool that built DEST.
+	attestationBuilderID = "https://github.com/DataDog/datadog-pgo"
+)
+
+// inTotoStatement is an in-toto statement with a SLSA provenance predicate,
+// see https://slsa.dev/spec/v1.0/provenance. It records the queries, profiles
+// and tool version DEST was built from.
+type inTotoStatement struct {
+	Type          string         `json:"_type"`
+	Subject       []slsaResource `json:"subject"`
+	PredicateType string         `json:"predicateType"`
+	Predicate     slsaProvenance `json:"predicate"`
+}
+
+// slsaProvenance is the predicate of an inTotoStatement.
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType            string                `json:"buildType"`
+		ExternalParameters   attestationParameters `json:"externalParameters"`
+		ResolvedDependencies []slsaResource        `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  time.Time `json:"startedOn"`
+			FinishedOn time.Time `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// attestationParameters are the external parameters of a slsaProvenance.
+type attestationParameters struct {
+	Queries       []string  `json:"queries"`
+	FallbackQuery string    `json:"fallbackQuery,omitempty"`
+	LocalFiles    []string  `json:"localFiles,omitempty"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	BaselineURL   string    `json:"baselineURL,omitempty"`
+}
+
+// slsaResource is an in-toto resource descriptor, e.g. a subject or a
+// profile DEST was merged from.
+type slsaResource struct {
+	Name        string            `json:"name,omitempty"`
+	URI         string            `json:"uri,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+	Annotations map[string]any    `json:"annotations,omitempty"`
+}
+
+// newAttestation returns the provenance of the PGO file recorded by manifest
+// m, whose sha256 checksum is digest, built between started and finished.
+// Downloaded profiles are identified by their profile ID, local files by
+// their checksum.
+func newAttestation(m *Manifest, digest string, started, finished time.Time) (*inTotoStatement, error) {
+	st := &inTotoStatement{
+		Type:          inTotoStatementType,
+		Subject:       []slsaResource{{Name: path.Base(m.Output), Digest: map[string]string{"sha256": digest}}},
+		PredicateType: slsaProvenanceType,
+	}
+	bd := &st.Predicate.BuildDefinition
+	bd.BuildType = attestationBuildType
+	bd.ExternalParameters = attestationParameters{
+		Queries:       m.Queries,
+		FallbackQuery: m.FallbackQuery,
+		LocalFiles:    m.LocalFiles,
+		From:          m.From,
+		To:            m.To,
+		BaselineURL:   m.BaselineURL,
+	}
+	bd.ResolvedDependencies = []slsaResource{}
+	for _, p := range m.Profiles {
+		annotations := map[string]any{"time": p.Time, "samples": p.Samples}
+		if p.Version != "" {
+			annotations["version"] = p.Version
+		}
+		bd.ResolvedDependencies = append(bd.ResolvedDependencies, slsaResource{
+			Name:        p.ID,
+			URI:         "urn:datadog:profile:" + p.ID,
+			Annotations: annotations,
+		})
+	}
+	for _, f := range m.LocalFiles {
+		sum, err := fileSHA256(f)
+		if err != nil {
+			return nil, err
+		}
+		bd.ResolvedDependencies = append(bd.ResolvedDependencies, slsaResource{Name: f, Digest: map[string]string{"sha256": sum}})
+	}
+	rd := &st.Predicate.RunDetails
+	rd.Builder.ID = attestationBuilderID
+	rd.Builder.Version = map[string]string{name: version}
+	rd.Metadata.StartedOn, rd.Metadata.FinishedOn = started.UTC(), finished.UTC()
+	return st, nil
+}
+
+// WriteFile writes the statement as JSON to path.
+func (st *inTotoStatement) WriteFile(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// signCommand returns the command that signs the file at path with cosign and
+// writes the signature and certificate as a sigstore bundle to
+// path+signatureSuffix. Without key, cosign signs keyless with the ambient
+// OIDC identity, e.g. of the CI job.
+func signCommand(ctx context.Context, path, key string) *exec.Cmd {
+	args := []string{"sign-blob", "--yes", "--bundle", path + signatureSuffix}
+	if key != "" {
+		args = append(args, "--key", key)
+	}
+	return exec.CommandContext(ctx, "cosign", append(args, path)...)
+}
+
+// sign signs the file at path with the cosign CLI, see signCommand.
+func sign(ctx context.Context, path, key string) error {
+	cmd := signCommand(ctx, path, key)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sign %s: cosign: %w: %s", path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestAttestation(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local.pprof")
+	require.NoError(t, os.WriteFile(local, []byte("local"), 0o644))
+	localSum, err := fileSHA256(local)
+	require.NoError(t, err)
+
+	queries, err := pgo.BuildQueries(time.Hour, 5, nil, []string{"service:foo"})
+	require.NoError(t, err)
+	m := newManifest("cmd/foo/default.pgo", queries, []string{local}, pgo.NewMergedProfile(pgo.MergeOptions{}))
+	m.Profiles = []pgo.ProfileInfo{{ID: "abc", Version: "v1.2.3", Samples: 10}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st, err := newAttestation(m, "0123", start, start.Add(time.Minute))
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "default.pgo"+attestationSuffix)
+	require.NoError(t, st.WriteFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded struct {
+		Type          string `json:"_type"`
+		PredicateType string `json:"predicateType"`
+		Subject       []struct {
+			Name   string            `json:"name"`
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+		Predicate struct {
+			BuildDefinition struct {
+				ExternalParameters struct {
+					Queries []string `json:"queries"`
+				} `json:"externalParameters"`
+				ResolvedDependencies []struct {
+					Name   string            `json:"name"`
+					URI    string            `json:"uri"`
+					Digest map[string]string `json:"digest"`
+				} `json:"resolvedDependencies"`
+			} `json:"buildDefinition"`
+			RunDetails struct {
+				Builder struct {
+					Version map[string]string `json:"version"`
+				} `json:"builder"`
+			} `json:"runDetails"`
+		} `json:"predicate"`
+	}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "https://in-toto.io/Statement/v1", decoded.Type)
+	require.Equal(t, "https://slsa.dev/provenance/v1", decoded.PredicateType)
+	require.Len(t, decoded.Subject, 1)
+	require.Equal(t, "default.pgo", decoded.Subject[0].Name)
+	require.Equal(t, map[string]string{"sha256": "0123"}, decoded.Subject[0].Digest)
+	require.Equal(t, []string{"service:foo runtime:go"}, decoded.Predicate.BuildDefinition.ExternalParameters.Queries)
+	deps := decoded.Predicate.BuildDefinition.ResolvedDependencies
+	require.Len(t, deps, 2)
+	require.Equal(t, "urn:datadog:profile:abc", deps[0].URI)
+	require.Equal(t, map[string]string{"sha256": localSum}, deps[1].Digest)
+	require.Equal(t, version, decoded.Predicate.RunDetails.Builder.Version[name])
+}
+
+func TestSignCommand(t *testing.T) {
+	require.Equal(t,
+		[]string{"cosign", "sign-blob", "--yes", "--bundle", "/tmp/default.pgo.sigstore.json", "/tmp/default.pgo"},
+		signCommand(context.Background(), "/tmp/default.pgo", "").Args,
+	)
+	require.Equal(t,
+		[]string{"cosign", "sign-blob", "--yes", "--bundle", "/tmp/default.pgo.sigstore.json", "--key", "cosign.key", "/tmp/default.pgo"},
+		signCommand(context.Background(), "/tmp/default.pgo", "cosign.key").Args,
+	)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// sortFlag is a repeatable flag holding the search fields to sort by.
+type sortFlag []string
+
+// String implements flag.Value.
+func (f *sortFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set implements flag.Value. It accepts the values accepted by pgo.SortField.
+func (f *sortFlag) Set(value string) error {
+	field, err := pgo.SortField(value)
+	if err != nil {
+		return err
+	}
+	for _, existing := range *f {
+		if existing == field {
+			return fmt.Errorf("duplicate sort %q", value)
+		}
+	}
+	*f = append(*f, field)
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestSortFlag(t *testing.T) {
+	var f sortFlag
+	require.NoError(t, f.Set("cpu_cores"))
+	require.NoError(t, f.Set("timestamp"))
+	require.NoError(t, f.Set("@metrics.core_cpu_time_total"))
+	require.Equal(t, sortFlag{"@metrics.core_cpu_cores", "timestamp", "@metrics.core_cpu_time_total"}, f)
+	require.Error(t, f.Set("timestamp"))
+	require.Error(t, f.Set("bogus"))
+	require.ErrorContains(t, f.Set("@metrics core"), "invalid sort")
+
+	f = nil
+	require.NoError(t, f.Set("cpu_time"))
+	require.NoError(t, f.Set("duration"))
+	require.Equal(t, sortFlag{"@metrics.core_cpu_time_total", "duration_nanos"}, f)
+	require.ErrorContains(t, f.Set("core_cpu_time_total"), "duplicate sort")
+}
+
+func TestNewResultSorts(t *testing.T) {
+	queries, err := pgo.BuildQueries(time.Hour, 5, sortFlag{"@metrics.core_cpu_cores", "timestamp"}, []string{"service:foo", "service:bar"})
+	require.NoError(t, err)
+	require.Len(t, queries, 4)
+	require.Len(t, newResult(queries, "default.pgo").Queries, 2)
+}
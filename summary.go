@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// Summary is the single-line JSON summary of a run printed by
+// -summary-format json. Unlike the logs, its fields are a stable contract
+// that CI scripts can parse.
+type Summary struct {
+	Success    bool     `json:"success"`
+	Error      string   `json:"error,omitempty"`
+	Outputs    []string `json:"outputs"`
+	Profiles   int      `json:"profiles"`
+	Samples    int      `json:"samples"`
+	Bytes      int64    `json:"bytes"`
+	DurationMS int64    `json:"duration_ms"`
+	Warnings   []string `json:"warnings"`
+	DebugQuery string   `json:"debug_query,omitempty"`
+}
+
+// newSummary returns the summary of the finished result r. The numbers are
+// summed up across all outputs.
+func newSummary(r *Result) Summary {
+	s := Summary{
+		Success:    r.Success,
+		Error:      r.Error,
+		DurationMS: r.DurationMS,
+		Warnings:   append([]string{}, r.Warnings...),
+		DebugQuery: r.DebugQuery,
+	}
+	s.Outputs, s.Bytes, s.Samples, s.Profiles = r.totals()
+	return s
+}
+
+// Write writes the summary as a single line of JSON to w.
+func (s Summary) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// warningCollector is a slog.Handler that records the messages of all
+// warnings before passing them on to the wrapped handler.
+type warningCollector struct {
+	slog.Handler
+	warnings *warnings
+}
+
+// warnings holds the messages collected by a warningCollector and its
+// derived handlers.
+type warnings struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+// newWarningCollector returns a warningCollector wrapping h.
+func newWarningCollector(h slog.Handler) *warningCollector {
+	return &warningCollector{Handler: h, warnings: &warnings{}}
+}
+
+// Handle implements slog.Handler.
+func (c *warningCollector) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelWarn {
+		c.warnings.mu.Lock()
+		c.warnings.messages = append(c.warnings.messages, r.Message)
+		c.warnings.mu.Unlock()
+	}
+	return c.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (c *warningCollector) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &warningCollector{Handler: c.Handler.WithAttrs(attrs), warnings: c.warnings}
+}
+
+// WithGroup implements slog.Handler.
+func (c *warningCollector) WithGroup(name string) slog.Handler {
+	return &warningCollector{Handler: c.Handler.WithGroup(name), warnings: c.warnings}
+}
+
+// Warnings returns the messages of the collected warnings.
+func (c *warningCollector) Warnings() []string {
+	c.warnings.mu.Lock()
+	defer c.warnings.mu.Unlock()
+	return append([]string{}, c.warnings.messages...)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	collector := newWarningCollector(slog.NewTextHandler(io.Discard, nil))
+	log := slog.New(collector)
+	log.Info("info")
+	log.With("output", "a.pgo").Warn("stale")
+	log.WithGroup("g").Warn("little data")
+	log.Error("boom")
+
+	r := newResult(nil, "")
+	r.Outputs = []*Result{newResult(nil, "a.pgo"), newResult(nil, "b.pgo")}
+	r.Outputs[0].Bytes, r.Outputs[0].Samples, r.Outputs[0].ProfileIDs = 5, 2, []string{"x"}
+	r.Outputs[1].Bytes, r.Outputs[1].Samples, r.Outputs[1].ProfileIDs = 7, 3, []string{"y", "z"}
+	r.Finish(time.Now(), errors.New("boom"))
+	r.Warnings = collector.Warnings()
+
+	var buf strings.Builder
+	require.NoError(t, newSummary(r).Write(&buf))
+	require.Equal(t, `{"success":false,"error":"boom","outputs":["a.pgo","b.pgo"],"profiles":3,"samples":5,"bytes":12,"duration_ms":0,"warnings":["stale","little data"]}`+"\n", buf.String())
+}
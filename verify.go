@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// runVerify implements the verify subcommand. It checks that the hot
+// functions of a profile exist in the binary it is meant for.
+func runVerify(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(name+" verify", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: `+name+` verify -binary BINARY [OPTIONS]... FILE
+
+verify checks which of the hottest functions of the pprof or PGO file FILE
+exist in the Go binary BINARY, and fails if the functions that are found
+account for less than -min-match percent of their cpu time. A mismatch
+indicates that FILE belongs to a different service, or that the code was
+refactored so heavily that the profile no longer applies, e.g.:
+
+	go build -o my-service ./cmd/my-service
+	`+name+` verify -binary ./my-service ./cmd/my-service/default.pgo
+
+OPTIONS`)
+		fs.PrintDefaults()
+	}
+	binaryF := fs.String("binary", "", "the Go binary to check FILE against (required), ELF and Mach-O binaries are supported")
+	topF := fs.Int("top", 100, "the number of hot functions to check, 0 checks all")
+	minMatchF := fs.Float64("min-match", 80, "fail if the functions found in BINARY account for less than this percentage of the cpu time of the checked functions")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("verify requires exactly 1 argument")
+	} else if *binaryF == "" {
+		fs.Usage()
+		return errors.New("-binary is required")
+	} else if *topF < 0 {
+		return errors.New("-top must not be negative")
+	} else if *minMatchF < 0 || *minMatchF > 100 {
+		return errors.New("-min-match must be between 0 and 100")
+	}
+	path := fs.Arg(0)
+
+	prof, err := pgo.ReadProfile(path)
+	if err != nil {
+		return err
+	}
+	funcs, err := pgo.BinaryFunctions(*binaryF)
+	if err != nil {
+		return err
+	}
+	match, err := pgo.MatchSymbols(prof, funcs, *topF)
+	if err != nil {
+		return err
+	}
+	if err := printVerify(stdout, *binaryF, match); err != nil {
+		return err
+	}
+	if match.FoundPercent < *minMatchF {
+		return fmt.Errorf("the hot functions of %s found in %s account for %.2f%% of their cpu time, below -min-match %g%%, the profile may belong to a different service or predate a large refactoring", path, *binaryF, match.FoundPercent, *minMatchF)
+	}
+	return nil
+}
+
+// printVerify writes the result of matching the hot functions of a profile
+// against binary to w.
+func printVerify(w io.Writer, binary string, m pgo.SymbolMatch) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "binary:\t%s\n", binary)
+	fmt.Fprintf(tw, "hot functions found:\t%d of %d\n", m.Found, m.Functions)
+	fmt.Fprintf(tw, "cpu time found:\t%.2f%% of %s\n", m.FoundPercent, m.CPU.Round(time.Millisecond))
+	if err := tw.Flush(); err != nil {
+		return err
+	} else if len(m.Missing) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\n%d missing functions:\n", len(m.Missing))
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "FLAT\tFLAT%\t  FUNCTION")
+	for _, fn := range m.Missing {
+		fmt.Fprintf(tw, "%s\t%.2f%%\t  %s\n", fn.CPU.Round(time.Millisecond), fn.Percent, fn.Function)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+func TestPrintVerify(t *testing.T) {
+	var buf strings.Builder
+	require.NoError(t, printVerify(&buf, "./foo", pgo.SymbolMatch{
+		Functions:    3,
+		Found:        2,
+		CPU:          100 * time.Millisecond,
+		FoundPercent: 75,
+		Missing:      []pgo.FunctionShare{{Function: "main.gone", CPU: 25 * time.Millisecond, Percent: 25}},
+	}))
+	require.Equal(t, `binary:               ./foo
+hot functions found:  2 of 3
+cpu time found:       75.00% of 100ms
+
+1 missing functions:
+  FLAT   FLAT%  FUNCTION
+  25ms  25.00%  main.gone
+`, buf.String())
+}
+
+func TestRunVerify(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("only ELF and Mach-O binaries are supported")
+	}
+	// The functions of the anonymized profile don't exist in the test binary.
+	err := runVerify([]string{"-binary", os.Args[0], "pgo/testdata/grpc-anon.pprof"}, io.Discard)
+	require.ErrorContains(t, err, "below -min-match 80%")
+	require.NoError(t, runVerify([]string{"-binary", os.Args[0], "-min-match", "0", "pgo/testdata/grpc-anon.pprof"}, io.Discard))
+	require.ErrorContains(t, runVerify([]string{"pgo/testdata/grpc-anon.pprof"}, io.Discard), "-binary is required")
+}
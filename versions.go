@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// formatVersionShares formats shares like "v1.2.0=75%, v1.1.0=25%". Profiles
+// without a version are listed as "unknown".
+func formatVersionShares(shares []pgo.VersionShare) string {
+	parts := make([]string, len(shares))
+	for i, s := range shares {
+		version := s.Version
+		if version == "" {
+			version = "unknown"
+		}
+		parts[i] = fmt.Sprintf("%s=%.0f%%", version, s.Share*100)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkVersionMajority returns an error unless at least percent of the cpu
+// time of mp comes from its current version, see pgo.MergedProfile.CurrentVersion.
+func checkVersionMajority(mp *pgo.MergedProfile, percent float64) error {
+	current := mp.CurrentVersion()
+	if current == "" {
+		return errors.New("-require-version-majority: the merged profiles have no version tags")
+	}
+	for _, s := range mp.VersionShares() {
+		if s.Version == current && s.Share*100 >= percent {
+			return nil
+		} else if s.Version == current {
+			return fmt.Errorf("-require-version-majority: only %.0f%% of the cpu time comes from the current version %s, want at least %g%%: %s", s.Share*100, current, percent, formatVersionShares(mp.VersionShares()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatVersionShares(t *testing.T) {
+	shares := []pgo.VersionShare{
+		{Version: "v1.2.0", Profiles: 3, Share: 0.75},
+		{Version: "", Profiles: 1, Share: 0.25},
+	}
+	require.Equal(t, "v1.2.0=75%, unknown=25%", formatVersionShares(shares))
+}
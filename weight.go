@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/datadog-pgo/pgo"
+)
+
+// weightFlag is a repeatable flag holding weighted queries that are added to
+// the QUERY arguments.
+type weightFlag []string
+
+// String implements flag.Value.
+func (f *weightFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set implements flag.Value. It accepts a weight followed by a query, e.g.
+// "3 service:api env:prod".
+func (f *weightFlag) Set(value string) error {
+	weight, query, _ := strings.Cut(strings.TrimSpace(value), " ")
+	query = strings.TrimSpace(query)
+	w, err := strconv.ParseFloat(weight, 64)
+	if err != nil || w <= 0 || query == "" {
+		return errors.New(`must be a positive weight followed by a query, e.g. "3 service:api env:prod"`)
+	}
+	*f = append(*f, pgo.WeightedQuery(query, w))
+	return nil
+}
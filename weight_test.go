@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightFlag(t *testing.T) {
+	var f weightFlag
+	require.NoError(t, f.Set("3 service:api env:prod"))
+	require.NoError(t, f.Set(" 0.5  env:canary "))
+	require.Equal(t, weightFlag{"service:api env:prod@weight=3", "env:canary@weight=0.5"}, f)
+	require.Error(t, f.Set("service:api"))
+	require.Error(t, f.Set("0 service:api"))
+	require.Error(t, f.Set("3"))
+}